@@ -0,0 +1,160 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/heyLu/numblr/feed"
+	"github.com/heyLu/numblr/feed/anything"
+)
+
+// apiFeedResponse is the response of HandleAPIFeed.
+type apiFeedResponse struct {
+	Posts []apiPost `json:"posts"`
+	// Next is the `before` parameter for the next page, it is empty if
+	// there are no more posts.
+	Next string `json:"next,omitempty"`
+	// NextURL is the url of the next page, with a cursor that is stable even
+	// if posts have the same date.
+	NextURL string        `json:"nextURL,omitempty"`
+	Feeds   []apiFeedInfo `json:"feeds"`
+}
+
+// apiPost is a feed.Post in the api, with its Date as RFC3339.
+type apiPost struct {
+	Source          string   `json:"source"`
+	ID              string   `json:"id"`
+	Author          string   `json:"author"`
+	AvatarURL       string   `json:"avatarURL,omitempty"`
+	URL             string   `json:"url"`
+	Title           string   `json:"title"`
+	DescriptionHTML string   `json:"descriptionHTML"`
+	Tags            []string `json:"tags"`
+	Date            string   `json:"date"`
+}
+
+// apiFeedInfo is the per-feed info of the "Performance details" on the feed
+// pages, i.e. how long the feed took to open and why it failed.
+type apiFeedInfo struct {
+	Name       string `json:"name"`
+	DurationMs int64  `json:"durationMs"`
+	Notes      string `json:"notes,omitempty"`
+	Error      string `json:"error,omitempty"`
+}
+
+// HandleAPIFeed returns the posts of the feeds in the `feeds` parameter as
+// JSON, e.g. for other clients.
+//
+// It supports the `limit`, `before` and `search` parameters like the feed
+// pages.
+func HandleAPIFeed(w http.ResponseWriter, req *http.Request) {
+	start := time.Now()
+
+	settings := settingsFromFeeds(queryFeeds(req))
+	feedNames := uniqueFeeds(settings.SelectedFeeds)
+	if len(feedNames) == 0 {
+		http.Error(w, "Error: no feeds, expected e.g. ?feeds=staff,engineering", http.StatusBadRequest)
+		return
+	}
+
+	limit := feed.DefaultLimit
+	if limitParam := req.URL.Query().Get("limit"); limitParam != "" {
+		l, err := strconv.Atoi(limitParam)
+		if err != nil || l <= 0 {
+			http.Error(w, fmt.Sprintf("Error: invalid limit %q", limitParam), http.StatusBadRequest)
+			return
+		}
+		limit = l
+		if limit > feed.MaxLimit {
+			limit = feed.MaxLimit
+		}
+	}
+
+	search := feed.FromRequest(req)
+	search.Limit = limit
+	search.MinAge = DelayFromRequest(req)
+	searchFor := sourceSearches(search)
+
+	var feedInfoMu sync.Mutex
+	feedInfo := make([]FeedInfo, len(feedNames))
+	feeds := make([]feed.Feed, 0, len(feedNames))
+	var wg sync.WaitGroup
+	wg.Add(len(feedNames))
+	for i, feedName := range feedNames {
+		go func(ctx context.Context, i int, feedName string) {
+			defer wg.Done()
+
+			// not opened in HandleTumblr either
+			if strings.HasPrefix(feedName, ":") {
+				return
+			}
+
+			f, err := anything.Open(ctx, feedName, cacheFn, searchFor(anything.Source(feedName)))
+
+			feedInfoMu.Lock()
+			defer feedInfoMu.Unlock()
+			feedInfo[i] = FeedInfo{Duration: time.Since(start), Error: err, Feed: f}
+			if err != nil {
+				log.Printf("Error: opening %s: %s", feedName, err)
+				return
+			}
+			feeds = append(feeds, f)
+		}(req.Context(), i, feedName)
+	}
+	wg.Wait()
+
+	mergedFeeds := feed.Merge(feeds...)
+	defer func() {
+		err := mergedFeeds.Close()
+		if err != nil {
+			log.Printf("Error: closing %s: %s", feedNames, err)
+		}
+	}()
+
+	posts := collectPosts(mergedFeeds, search, searchFor, settings, limit)
+
+	resp := apiFeedResponse{
+		Posts: make([]apiPost, 0, len(posts)),
+		Feeds: make([]apiFeedInfo, 0, len(feedNames)),
+	}
+	for _, post := range posts {
+		resp.Posts = append(resp.Posts, apiPost{
+			Source:          post.Source,
+			ID:              post.ID,
+			Author:          post.Author,
+			AvatarURL:       post.AvatarURL,
+			URL:             post.URL,
+			Title:           post.Title,
+			DescriptionHTML: post.DescriptionHTML,
+			Tags:            post.Tags,
+			Date:            post.Date.Format(time.RFC3339),
+		})
+	}
+	if len(posts) == limit {
+		resp.Next = posts[len(posts)-1].ID
+		resp.NextURL = nextPageURL(req.URL, posts[len(posts)-1], false)
+	}
+	for i, info := range feedInfo {
+		feedResp := apiFeedInfo{Name: feedNames[i], DurationMs: info.Duration.Milliseconds()}
+		if info.Error != nil {
+			feedResp.Error = info.Error.Error()
+		}
+		if feedWithNotes, ok := info.Feed.(feed.Notes); ok {
+			feedResp.Notes = strings.TrimSpace(feedWithNotes.Notes())
+		}
+		resp.Feeds = append(resp.Feeds, feedResp)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	err := json.NewEncoder(w).Encode(resp)
+	if err != nil {
+		log.Printf("Error: encoding api response: %s", err)
+	}
+}
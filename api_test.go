@@ -0,0 +1,90 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/heyLu/numblr/feed"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHandleAPIFeed(t *testing.T) {
+	date := time.Date(2022, time.June, 1, 12, 0, 0, 0, time.UTC)
+
+	origCacheFn := cacheFn
+	cacheFn = func(ctx context.Context, name string, uncachedFn feed.Open, search feed.Search) (feed.Feed, error) {
+		if name == "missing" {
+			return nil, fmt.Errorf("no such feed")
+		}
+		offset := time.Duration(len(name)) * time.Minute
+		return &feed.Static{FeedName: name, Posts: []feed.Post{
+			{Source: "tumblr", ID: "2", Author: name, URL: "https://" + name + ".tumblr.com/post/2", Title: "second post by " + name, Tags: []string{"art"}, Date: date.Add(offset)},
+			{Source: "tumblr", ID: "1", Author: name, URL: "https://" + name + ".tumblr.com/post/1", DescriptionHTML: "<p>first post by " + name + "</p>", Date: date.Add(-time.Hour + offset)},
+		}}, nil
+	}
+	defer func() {
+		cacheFn = origCacheFn
+	}()
+
+	w := httptest.NewRecorder()
+	HandleAPIFeed(w, httptest.NewRequest("GET", "/api/feed?feeds=staff,engineering,missing&limit=3", nil))
+	assert.Equal(t, 200, w.Code)
+	assert.Equal(t, "application/json", w.Header().Get("Content-Type"))
+
+	var resp apiFeedResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	if assert.Len(t, resp.Posts, 3, "limit") {
+		post := resp.Posts[0]
+		assert.Equal(t, "engineering", post.Author, "newest first")
+		assert.Equal(t, "2", post.ID)
+		assert.Equal(t, "https://engineering.tumblr.com/post/2", post.URL)
+		assert.Equal(t, "second post by engineering", post.Title)
+		assert.Equal(t, []string{"art"}, post.Tags)
+		assert.Equal(t, "2022-06-01T12:11:00Z", post.Date, "RFC3339")
+		assert.Equal(t, "engineering", resp.Posts[2].Author)
+	}
+	assert.Equal(t, "1", resp.Next, "next cursor")
+	assert.Contains(t, resp.NextURL, "before=1", "next url")
+
+	if assert.Len(t, resp.Feeds, 3, "feed infos") {
+		assert.Equal(t, "staff", resp.Feeds[0].Name)
+		assert.Empty(t, resp.Feeds[0].Error)
+		assert.Equal(t, "missing", resp.Feeds[2].Name)
+		assert.Contains(t, resp.Feeds[2].Error, "no such feed")
+	}
+
+	w = httptest.NewRecorder()
+	HandleAPIFeed(w, httptest.NewRequest("GET", "/api/feed?feeds=staff&search=first", nil))
+	resp = apiFeedResponse{}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	if assert.Len(t, resp.Posts, 1, "search") {
+		assert.Equal(t, "<p>first post by staff</p>", resp.Posts[0].DescriptionHTML)
+	}
+	assert.Empty(t, resp.Next, "no more posts")
+
+	w = httptest.NewRecorder()
+	HandleAPIFeed(w, httptest.NewRequest("GET", "/api/feed", nil))
+	assert.Equal(t, 400, w.Code, "no feeds")
+}
+
+func TestHandleAPIFeedMaxLimit(t *testing.T) {
+	origCacheFn := cacheFn
+	var limit int
+	cacheFn = func(ctx context.Context, name string, uncachedFn feed.Open, search feed.Search) (feed.Feed, error) {
+		limit = search.Limit
+		return &feed.Static{FeedName: name}, nil
+	}
+	defer func() {
+		cacheFn = origCacheFn
+	}()
+
+	w := httptest.NewRecorder()
+	HandleAPIFeed(w, httptest.NewRequest("GET", "/api/feed?feeds=staff&limit=100000", nil))
+	assert.Equal(t, 200, w.Code)
+	assert.Equal(t, feed.MaxLimit, limit)
+}
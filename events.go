@@ -0,0 +1,214 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/heyLu/numblr/feed"
+	"github.com/heyLu/numblr/feed/anything"
+)
+
+// MaxEventFeeds is the maximum number of feeds one event stream checks.
+const MaxEventFeeds = 50
+
+// MaxEventStreamDuration is how long an event stream is kept open, browsers
+// reconnect after it was closed.
+const MaxEventStreamDuration = time.Hour
+
+// eventStreams limits the number of open event streams, it is created with
+// `-events-max-streams` slots in main.
+var eventStreams chan bool
+
+// eventFetches limits how many feeds are fetched at once by all event
+// streams together.
+var eventFetches = make(chan bool, 10)
+
+// postEvent is the data of a `post` event, see HandleEvents.
+type postEvent struct {
+	Feed string    `json:"feed"`
+	ID   string    `json:"id"`
+	URL  string    `json:"url"`
+	Text string    `json:"text"`
+	Date time.Time `json:"date"`
+}
+
+// HandleEvents streams new posts of the feeds as Server-Sent Events, so that
+// pages can show them without reloading.
+//
+// The feeds are fetched every `-events-interval`, and every post that is
+// newer than the newest one seen so far is sent as a `post` event with the
+// post date as its id.  Reconnecting with that id as `Last-Event-ID`
+// continues after that post.
+//
+// See https://html.spec.whatwg.org/multipage/server-sent-events.html.
+func HandleEvents(w http.ResponseWriter, req *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "Error: streaming not supported", http.StatusInternalServerError)
+		return
+	}
+
+	feeds := eventFeeds(req)
+	if len(feeds) == 0 {
+		http.Error(w, "Error: no feeds", http.StatusBadRequest)
+		return
+	}
+
+	select {
+	case eventStreams <- true:
+		defer func() {
+			<-eventStreams
+		}()
+	default:
+		http.Error(w, "Error: too many event streams, try again later", http.StatusServiceUnavailable)
+		return
+	}
+
+	since := time.Now()
+	if lastEventID := req.Header.Get("Last-Event-ID"); lastEventID != "" {
+		nanos, err := strconv.ParseInt(lastEventID, 10, 64)
+		if err == nil {
+			since = time.Unix(0, nanos)
+		}
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	// not compressed so that events are sent immediately
+	w.Header().Set("Content-Encoding", "identity")
+	w.Header().Set("X-Accel-Buffering", "no")
+
+	fmt.Fprintf(w, "retry: %d\n\n", config.EventsInterval.Milliseconds())
+	flusher.Flush()
+
+	ctx, cancel := context.WithTimeout(req.Context(), MaxEventStreamDuration)
+	defer cancel()
+
+	ticker := time.NewTicker(config.EventsInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		posts := newPosts(ctx, feeds, since)
+		if len(posts) == 0 {
+			// keeps proxies from closing the connection and notices
+			// when the browser is gone
+			_, err := io.WriteString(w, ": keepalive\n\n")
+			if err != nil {
+				return
+			}
+		}
+		for _, post := range posts {
+			data, err := json.Marshal(postEvent{Feed: post.Author, ID: post.ID, URL: post.URL, Text: postSummary(post), Date: post.Date})
+			if err != nil {
+				log.Printf("Error: encoding event for %s/%s: %s", post.Author, post.ID, err)
+				continue
+			}
+
+			_, err = fmt.Fprintf(w, "event: post\nid: %d\ndata: %s\n\n", post.Date.UnixNano(), data)
+			if err != nil {
+				return
+			}
+			since = post.Date
+		}
+		flusher.Flush()
+	}
+}
+
+// eventFeeds returns the feeds to stream from the `feeds` parameter
+// (comma-separated or repeated), but at most MaxEventFeeds.
+func eventFeeds(req *http.Request) []string {
+	feeds := queryFeeds(req)
+	if len(feeds) > MaxEventFeeds {
+		feeds = feeds[:MaxEventFeeds]
+	}
+	return feeds
+}
+
+// newPosts fetches the feeds and returns their posts that are newer than
+// `since`, oldest first.
+func newPosts(ctx context.Context, feeds []string, since time.Time) []*feed.Post {
+	var mu sync.Mutex
+	var posts []*feed.Post
+
+	var wg sync.WaitGroup
+	for _, feedName := range feeds {
+		select {
+		case eventFetches <- true:
+		case <-ctx.Done():
+			wg.Wait()
+			return nil
+		}
+
+		wg.Add(1)
+		go func(feedName string) {
+			defer func() {
+				<-eventFetches
+				wg.Done()
+			}()
+
+			feedPosts, err := postsSince(ctx, feedName, since)
+			if err != nil {
+				log.Printf("Error: events for %s: %s", feedName, err)
+			}
+
+			mu.Lock()
+			posts = append(posts, feedPosts...)
+			mu.Unlock()
+		}(feedName)
+	}
+	wg.Wait()
+
+	sort.Slice(posts, func(i, j int) bool {
+		return feed.IsNewer(posts[j], posts[i])
+	})
+	return posts
+}
+
+// postsSince returns the posts of the feed that are newer than `since`.
+func postsSince(ctx context.Context, feedName string, since time.Time) ([]*feed.Post, error) {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	f, err := anything.Open(ctx, feedName, cacheFn, feed.Search{ForceFresh: true})
+	if err != nil {
+		return nil, fmt.Errorf("open: %w", err)
+	}
+	defer func() {
+		err := f.Close()
+		if err != nil {
+			log.Printf("Error: closing %s: %s", feedName, err)
+		}
+	}()
+
+	var posts []*feed.Post
+	for {
+		post, err := f.Next()
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				return posts, nil
+			}
+			return posts, fmt.Errorf("next: %w", err)
+		}
+
+		// feeds are sorted newest first
+		if !post.Date.After(since) {
+			return posts, nil
+		}
+		posts = append(posts, post)
+	}
+}
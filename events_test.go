@@ -0,0 +1,74 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/heyLu/numblr/feed"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHandleEvents(t *testing.T) {
+	now := time.Now()
+
+	origCacheFn := cacheFn
+	cacheFn = func(ctx context.Context, name string, uncachedFn feed.Open, search feed.Search) (feed.Feed, error) {
+		assert.True(t, search.ForceFresh, "fresh")
+		return &feed.Static{FeedName: name, Posts: []feed.Post{
+			{Source: "tumblr", ID: "3", Author: name, URL: "https://" + name + ".tumblr.com/post/3", Title: "newest", Date: now.Add(-1 * time.Minute)},
+			{Source: "tumblr", ID: "2", Author: name, URL: "https://" + name + ".tumblr.com/post/2", Title: "new", Date: now.Add(-2 * time.Minute)},
+			{Source: "tumblr", ID: "1", Author: name, URL: "https://" + name + ".tumblr.com/post/1", Title: "seen", Date: now.Add(-1 * time.Hour)},
+		}}, nil
+	}
+	origInterval := config.EventsInterval
+	config.EventsInterval = 10 * time.Millisecond
+	eventStreams = make(chan bool, 1)
+	defer func() {
+		cacheFn = origCacheFn
+		config.EventsInterval = origInterval
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	req := httptest.NewRequest("GET", "/events?feeds=staff", nil).WithContext(ctx)
+	req.Header.Set("Last-Event-ID", strconv.FormatInt(now.Add(-10*time.Minute).UnixNano(), 10))
+	w := httptest.NewRecorder()
+	HandleEvents(w, req)
+
+	assert.Equal(t, "text/event-stream", w.Header().Get("Content-Type"))
+
+	var events []postEvent
+	for _, line := range strings.Split(w.Body.String(), "\n") {
+		if strings.HasPrefix(line, "data: ") {
+			var event postEvent
+			assert.NoError(t, json.Unmarshal([]byte(strings.TrimPrefix(line, "data: ")), &event))
+			events = append(events, event)
+		}
+	}
+	if assert.Len(t, events, 2, "only new posts, once") {
+		assert.Equal(t, "2", events[0].ID, "oldest first")
+		assert.Equal(t, "3", events[1].ID)
+		assert.Equal(t, "staff", events[1].Feed)
+		assert.Equal(t, "https://staff.tumblr.com/post/3", events[1].URL)
+	}
+	assert.Contains(t, w.Body.String(), ": keepalive", "keepalive")
+
+	assert.Empty(t, eventStreams, "stream slot released")
+}
+
+func TestEventFeeds(t *testing.T) {
+	req := httptest.NewRequest("GET", "/events?feeds=staff,+engineering@tumblr,&feeds=xkcd.com", nil)
+	assert.Equal(t, []string{"staff", "engineering@tumblr", "xkcd.com"}, eventFeeds(req))
+
+	req = httptest.NewRequest("GET", "/events?feeds="+strings.Repeat("staff,", MaxEventFeeds+10), nil)
+	assert.Len(t, eventFeeds(req), MaxEventFeeds, "limited")
+
+	req = httptest.NewRequest("GET", "/events", nil)
+	assert.Empty(t, eventFeeds(req), "no feeds")
+}
@@ -0,0 +1,32 @@
+package feed
+
+import (
+	"fmt"
+	"net"
+	"syscall"
+)
+
+// AllowPrivateAddresses disables RejectPrivateAddresses, for tests.
+var AllowPrivateAddresses = false
+
+// RejectPrivateAddresses refuses to connect to loopback, private and
+// link-local addresses, so that urls from posts or sites can't make numblr
+// request things from its own network.
+//
+// It is meant as the Control of a net.Dialer, so that it is checked after
+// resolving and for every redirect.
+func RejectPrivateAddresses(network, address string, _ syscall.RawConn) error {
+	if AllowPrivateAddresses {
+		return nil
+	}
+
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	ip := net.ParseIP(host)
+	if ip == nil || ip.IsLoopback() || ip.IsPrivate() || ip.IsUnspecified() || ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() || ip.IsMulticast() {
+		return fmt.Errorf("%s is not a public address", host)
+	}
+	return nil
+}
@@ -0,0 +1,14 @@
+package feed
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestRejectPrivateAddresses(t *testing.T) {
+	for _, address := range []string{"127.0.0.1:80", "10.0.0.1:80", "192.168.1.1:443", "169.254.169.254:80", "[::1]:80", "[fe80::1]:80", "0.0.0.0:80"} {
+		require.Error(t, RejectPrivateAddresses("tcp", address, nil), address)
+	}
+	require.NoError(t, RejectPrivateAddresses("tcp", "93.184.215.14:443", nil), "public")
+}
@@ -2,37 +2,191 @@ package anything
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"sort"
 	"strings"
+	"time"
 
 	"github.com/heyLu/numblr/feed"
 	"github.com/heyLu/numblr/feed/ao3"
 	"github.com/heyLu/numblr/feed/bibliogram"
+	"github.com/heyLu/numblr/feed/bluesky"
+	"github.com/heyLu/numblr/feed/lemmy"
+	"github.com/heyLu/numblr/feed/mastodon"
 	"github.com/heyLu/numblr/feed/nitter"
+	"github.com/heyLu/numblr/feed/reddit"
 	"github.com/heyLu/numblr/feed/rss"
+	"github.com/heyLu/numblr/feed/scraper"
+	"github.com/heyLu/numblr/feed/sitemap"
 	"github.com/heyLu/numblr/feed/tiktok"
 	"github.com/heyLu/numblr/feed/tumblr"
 	"github.com/heyLu/numblr/feed/youtube"
 )
 
+// Sources are the names of all sources that feeds can be opened from.
+func Sources() []string {
+	names := make([]string, 0, len(sources))
+	for name := range sources {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+var sources = map[string]feed.Open{
+	"twitter":   nitter.Open,
+	"instagram": bibliogram.Open,
+	"youtube":   youtube.Open,
+	"tumblr":    tumblr.Open,
+	"tiktok":    tiktok.Open,
+	"ao3":       ao3.Open,
+	"mastodon":  mastodon.Open,
+	"bluesky":   bluesky.Open,
+	"reddit":    reddit.Open,
+	"lemmy":     lemmy.Open,
+	"scraper":   scraper.Open,
+	"web":       openWeb,
+}
+
+// DefaultTimeout is how long opening feeds may take, unless their source
+// has one in Timeouts.
+var DefaultTimeout = 10 * time.Second
+
+// Timeouts are how long opening feeds from slower sources may take.
+var Timeouts = map[string]time.Duration{
+	"ao3":     ao3.Timeout,
+	"youtube": youtube.Timeout,
+}
+
+// Timeout returns how long opening feeds from `source` may take.
+func Timeout(source string) time.Duration {
+	if timeout, ok := Timeouts[source]; ok {
+		return timeout
+	}
+	return DefaultTimeout
+}
+
+// MaxTimeout returns the longest timeout of all sources.
+func MaxTimeout() time.Duration {
+	max := DefaultTimeout
+	for _, timeout := range Timeouts {
+		if timeout > max {
+			max = timeout
+		}
+	}
+	return max
+}
+
+// withTimeout limits how long opening the feed and reading its posts may
+// take.
+func withTimeout(open feed.Open, timeout time.Duration) feed.Open {
+	return func(ctx context.Context, name string, search feed.Search) (feed.Feed, error) {
+		ctx, cancel := context.WithTimeout(ctx, timeout)
+		f, err := open(ctx, name, search)
+		if err != nil {
+			cancel()
+			return nil, err
+		}
+
+		// feeds may fetch more while reading them, e.g. older pages
+		time.AfterFunc(timeout, cancel)
+		return f, nil
+	}
+}
+
+// openWeb opens the feed of a website, falling back to its sitemap if it
+// has no feed.
+func openWeb(ctx context.Context, name string, search feed.Search) (feed.Feed, error) {
+	f, err := rss.Open(ctx, name, search)
+	if errors.Is(err, rss.ErrNoFeed) && !strings.Contains(name, "@") {
+		return sitemap.Open(ctx, name, search)
+	}
+	return f, err
+}
+
+// Resolver rewrites the feed `name` to another feed, e.g. using a table of
+// aliases.  It returns false if it does not know the name.
+type Resolver func(name string) (string, bool)
+
+// Resolvers are tried in order before opening a feed, the first one that
+// knows the name decides which feed is opened.
+var Resolvers []Resolver
+
+// DefaultSource is the source of bare names without a suffix or dots.
+var DefaultSource = "tumblr"
+
+// Disabled are the sources that can't be opened.
+var Disabled = map[string]bool{}
+
+// DisabledError is returned when opening a feed from a disabled source.
+type DisabledError struct {
+	Source string
+}
+
+func (de DisabledError) Error() string {
+	return fmt.Sprintf("%s feeds are disabled on this instance", de.Source)
+}
+
 // Open any supported feed by name, depending on name, suffix or even full
 // urls.
 func Open(ctx context.Context, name string, cacheFn feed.OpenCached, search feed.Search) (feed.Feed, error) {
+	name = Resolve(name)
+	source := sourceOf(name)
+	if Disabled[source] {
+		return nil, DisabledError{Source: source}
+	}
+	return cacheFn(ctx, name, withTimeout(sources[source], Timeout(source)), search)
+}
+
+// Resolve returns the feed that is opened for `name`, which is `name` itself
+// unless one of the Resolvers knows it.
+func Resolve(name string) string {
+	for _, resolver := range Resolvers {
+		if resolved, ok := resolver(name); ok {
+			return resolved
+		}
+	}
+	return name
+}
+
+// Source returns the source that the feed `name` is from, e.g. "tumblr",
+// "twitter", "bluesky", "lemmy", "mastodon" for accounts and hashtag timelines,
+// "scraper" for sites configured in scraper.Configs or "web" for generic RSS
+// feeds.
+func Source(name string) string {
+	return sourceOf(Resolve(name))
+}
+
+// sourceOf returns the source of `name` without resolving it first, e.g. for
+// names that were already resolved.
+func sourceOf(name string) string {
 	switch {
 	case strings.HasSuffix(name, "@twitter") || strings.HasSuffix(name, "@t"):
-		return cacheFn(ctx, name, nitter.Open, search)
+		return "twitter"
 	case strings.HasSuffix(name, "@instagram") || strings.HasSuffix(name, "@ig"):
-		return cacheFn(ctx, name, bibliogram.Open, search)
+		return "instagram"
 	case strings.HasSuffix(name, "@youtube") || strings.HasSuffix(name, "@yt"):
-		return cacheFn(ctx, name, youtube.Open, search)
+		return "youtube"
 	case strings.HasSuffix(name, "@tumblr"):
-		return cacheFn(ctx, name, tumblr.Open, search)
+		return "tumblr"
 	case strings.Contains(name, "www.tiktok.com") || strings.HasSuffix(name, "@tiktok"):
-		return cacheFn(ctx, name, tiktok.Open, search)
+		return "tiktok"
 	case strings.Contains(name, "archiveofourown.org") || strings.HasSuffix(name, "@ao3"):
-		return cacheFn(ctx, name, ao3.Open, search)
+		return "ao3"
+	case bluesky.IsBluesky(name):
+		return "bluesky"
+	case reddit.IsReddit(name):
+		return "reddit"
+	case lemmy.IsLemmy(name):
+		return "lemmy"
+	case mastodon.IsMastodon(name):
+		return "mastodon"
+	case strings.Contains(name, ".") && scraper.Matches(name):
+		return "scraper"
 	case strings.Contains(name, "@") || strings.Contains(name, "."):
-		return cacheFn(ctx, name, rss.Open, search)
+		return "web"
 	default:
-		return cacheFn(ctx, name, tumblr.Open, search)
+		return DefaultSource
 	}
 }
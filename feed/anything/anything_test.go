@@ -0,0 +1,70 @@
+package anything
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/heyLu/numblr/feed"
+)
+
+func TestResolve(t *testing.T) {
+	origResolvers := Resolvers
+	Resolvers = []Resolver{
+		func(name string) (string, bool) {
+			aliases := map[string]string{
+				"news":  "staff@twitter",
+				"other": "news",
+			}
+			resolved, ok := aliases[name]
+			return resolved, ok
+		},
+	}
+	defer func() {
+		Resolvers = origResolvers
+	}()
+
+	assert.Equal(t, "staff@twitter", Resolve("news"))
+	assert.Equal(t, "twitter", Source("news"))
+	assert.Equal(t, "staff", Resolve("staff"), "unknown names")
+	assert.Equal(t, "tumblr", Source("staff"), "unknown names")
+
+	// aliases are only resolved once, so that opening and the source agree
+	assert.Equal(t, "news", Resolve("other"))
+	assert.Equal(t, "tumblr", Source("other"))
+
+	var opened string
+	cacheFn := func(ctx context.Context, name string, uncachedFn feed.Open, search feed.Search) (feed.Feed, error) {
+		opened = name
+		return &feed.Static{FeedName: name}, nil
+	}
+
+	_, err := Open(context.Background(), "news", cacheFn, feed.Search{})
+	require.NoError(t, err)
+	assert.Equal(t, "staff@twitter", opened)
+
+	_, err = Open(context.Background(), "other", cacheFn, feed.Search{})
+	require.NoError(t, err)
+	assert.Equal(t, "news", opened)
+}
+
+func TestDisabled(t *testing.T) {
+	Disabled["twitter"] = true
+	defer delete(Disabled, "twitter")
+
+	opened := false
+	cacheFn := func(ctx context.Context, name string, uncachedFn feed.Open, search feed.Search) (feed.Feed, error) {
+		opened = true
+		return &feed.Static{FeedName: name}, nil
+	}
+
+	_, err := Open(context.Background(), "staff@twitter", cacheFn, feed.Search{})
+	assert.Equal(t, DisabledError{Source: "twitter"}, err)
+	assert.False(t, opened, "disabled sources are not opened")
+
+	_, err = Open(context.Background(), "staff", cacheFn, feed.Search{})
+	assert.NoError(t, err, "other sources")
+	assert.True(t, opened, "other sources")
+}
@@ -16,6 +16,13 @@ import (
 	"github.com/heyLu/numblr/feed"
 )
 
+// CacheTTL is how long AO3 feeds are cached for, which is longer than most
+// feeds because works are updated rarely and AO3 limits requests strictly.
+var CacheTTL = 6 * time.Hour
+
+// Timeout is how long opening AO3 feeds may take, as searches are often slow.
+const Timeout = 30 * time.Second
+
 var workMatcher = cascadia.MustCompile("li.work")
 var dateMatcher = cascadia.MustCompile(".datetime")
 var titleMatcher = cascadia.MustCompile(".header .heading a")
@@ -24,18 +31,41 @@ var fandomTagsMatcher = cascadia.MustCompile(".fandoms a.tag")
 var requiredTagsMatcher = cascadia.MustCompile(".required-tags li span.text")
 var tagsMatcher = cascadia.MustCompile("ul.tags li .tag")
 
+var bookmarkMatcher = cascadia.MustCompile("li.bookmark")
+var bookmarkerMatcher = cascadia.MustCompile(".user .byline a")
+var bookmarkDateMatcher = cascadia.MustCompile(".user .datetime")
+var bookmarkNotesMatcher = cascadia.MustCompile(".user blockquote.notes")
+
 type ao3 struct {
+	ctx  context.Context
 	name string
 
-	works []*html.Node
+	// full is set if the text of the works should be shown, see
+	// addWorkText.
+	full bool
+
+	// bookmarks is set if this is a bookmarks listing, where works is the
+	// list of bookmarks.
+	bookmarks bool
+	works     []*html.Node
 }
 
 // Open opens the feed with the given account name (or works url) from AO3.
-func Open(ctx context.Context, name string, _ feed.Search) (feed.Feed, error) {
+//
+// `user/bookmarks@ao3` (or a bookmarks url) opens the bookmarks of the user
+// instead of their works.
+//
+// With search.Full the text of the works is fetched as well, see FullText.
+func Open(ctx context.Context, name string, search feed.Search) (feed.Feed, error) {
 	// TODO: implement ao3 search
 	nameIdx := strings.Index(name, "@")
 	if nameIdx != -1 {
-		name = "https://archiveofourown.org/users/" + name[:nameIdx] + "/works"
+		user := name[:nameIdx]
+		if strings.HasSuffix(user, "/bookmarks") {
+			name = "https://archiveofourown.org/users/" + user
+		} else {
+			name = "https://archiveofourown.org/users/" + user + "/works"
+		}
 	}
 
 	u, err := url.Parse(name)
@@ -74,14 +104,37 @@ func Open(ctx context.Context, name string, _ feed.Search) (feed.Feed, error) {
 		return nil, fmt.Errorf("parse feed: %w", err)
 	}
 
-	works := cascadia.QueryAll(node, workMatcher)
+	bookmarks := strings.HasSuffix(u.Path, "/bookmarks")
 
 	return &ao3{
-		name:  name,
-		works: works,
+		ctx:       ctx,
+		name:      name,
+		full:      search.Full && FullText && !bookmarks,
+		bookmarks: bookmarks,
+		works:     listItems(node, bookmarks),
 	}, nil
 }
 
+// listItems returns the works (or bookmarks) listed on the page.
+//
+// Bookmarks of deleted works are skipped, as there is nothing left to show
+// about them.
+func listItems(node *html.Node, bookmarks bool) []*html.Node {
+	if !bookmarks {
+		return cascadia.QueryAll(node, workMatcher)
+	}
+
+	items := make([]*html.Node, 0, 20)
+	for _, item := range cascadia.QueryAll(node, bookmarkMatcher) {
+		if cascadia.Query(item, titleMatcher) == nil {
+			continue
+		}
+
+		items = append(items, item)
+	}
+	return items
+}
+
 func (ao3 *ao3) Name() string {
 	return ao3.name
 }
@@ -94,29 +147,129 @@ func (ao3 *ao3) URL() string {
 	return ao3.name
 }
 
+// CacheTTL implements feed.CacheTTL.
+func (ao3 *ao3) CacheTTL() time.Duration {
+	return CacheTTL
+}
+
 func (ao3 *ao3) Next() (*feed.Post, error) {
 	if len(ao3.works) == 0 {
 		return nil, io.EOF
 	}
 
-	work := ao3.works[0]
+	var post *feed.Post
+	var err error
+	if ao3.bookmarks {
+		post, err = parseBookmark(ao3.works[0])
+	} else {
+		post, err = parseWork(ao3.works[0])
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if ao3.full {
+		addWorkText(ao3.ctx, post, ao3.works[0])
+	}
+
+	ao3.works = ao3.works[1:]
+	return post, nil
+}
+
+func parseWork(work *html.Node) (*feed.Post, error) {
+	id, err := parseID(work, "work_")
+	if err != nil {
+		return nil, err
+	}
+
+	return parseBlurb(work, id, "https://archiveofourown.org/works/"+id)
+}
+
+// parseBookmark parses a bookmark, which is the bookmarked work along with
+// the notes and tags of the user that bookmarked it.
+//
+// The post is by the bookmarker and dated when it was bookmarked, so that the
+// bookmarks are shown in the order they were made.
+func parseBookmark(bookmark *html.Node) (*feed.Post, error) {
+	id, err := parseID(bookmark, "bookmark_")
+	if err != nil {
+		return nil, err
+	}
+
+	// bookmarks may also be of series or external works, so use the link
+	// as is
+	title := cascadia.Query(bookmark, titleMatcher)
+	if title == nil {
+		return nil, fmt.Errorf("no title")
+	}
+	var postURL string
+	for _, attr := range title.Attr {
+		if attr.Key == "href" {
+			postURL = attr.Val
+		}
+	}
+	if strings.HasPrefix(postURL, "/") {
+		postURL = "https://archiveofourown.org" + postURL
+	}
+
+	post, err := parseBlurb(bookmark, id, postURL)
+	if err != nil {
+		return nil, err
+	}
+
+	bookmarker := cascadia.Query(bookmark, bookmarkerMatcher)
+	if bookmarker == nil || bookmarker.FirstChild == nil {
+		return nil, fmt.Errorf("no bookmarker")
+	}
+	post.Author = bookmarker.FirstChild.Data
+
+	date := cascadia.Query(bookmark, bookmarkDateMatcher)
+	if date == nil || date.FirstChild == nil {
+		return nil, fmt.Errorf("no bookmark date")
+	}
+	dateParsed, err := time.Parse("2 Jan 2006", date.FirstChild.Data)
+	if err != nil {
+		return nil, fmt.Errorf("invalid bookmark date %q: %w", date.FirstChild.Data, err)
+	}
+	post.DateString = date.FirstChild.Data
+	post.Date = dateParsed.UTC()
+
+	notes := cascadia.Query(bookmark, bookmarkNotesMatcher)
+	if notes != nil {
+		makeAbsoluteLinks(notes, "https://archiveofourown.org")
+
+		notesHTML := new(bytes.Buffer)
+		fmt.Fprintf(notesHTML, "<p>Bookmarked by %s:</p>", html.EscapeString(post.Author))
+		err := html.Render(notesHTML, notes)
+		if err != nil {
+			return nil, fmt.Errorf("render notes: %w", err)
+		}
+		post.DescriptionHTML = notesHTML.String() + "<hr />" + post.DescriptionHTML
+	}
+
+	return post, nil
+}
 
+func parseID(node *html.Node, prefix string) (string, error) {
 	var id string
-	for _, attr := range work.Attr {
+	for _, attr := range node.Attr {
 		if attr.Key == "id" {
-			if !strings.HasPrefix(attr.Val, "work_") {
-				return nil, fmt.Errorf("invalid id %q", attr.Val)
+			if !strings.HasPrefix(attr.Val, prefix) {
+				return "", fmt.Errorf("invalid id %q", attr.Val)
 			}
 
-			id = attr.Val[len("work_"):]
+			id = attr.Val[len(prefix):]
 		}
 	}
 	if id == "" {
-		return nil, fmt.Errorf("invalid id %q", id)
+		return "", fmt.Errorf("invalid id %q", id)
 	}
+	return id, nil
+}
 
-	postURL := "https://archiveofourown.org/works/" + id
-
+// parseBlurb parses the summary of a work, as shown in listings of works
+// and bookmarks.
+func parseBlurb(work *html.Node, id string, postURL string) (*feed.Post, error) {
 	title := cascadia.Query(work, titleMatcher)
 	if title == nil || title.FirstChild == nil {
 		return nil, fmt.Errorf("no title")
@@ -128,7 +281,7 @@ func (ao3 *ao3) Next() (*feed.Post, error) {
 	}
 
 	date := cascadia.Query(work, dateMatcher)
-	if dateMatcher == nil {
+	if date == nil || date.FirstChild == nil {
 		return nil, fmt.Errorf("no date")
 	}
 	dateString := date.FirstChild.Data
@@ -200,7 +353,6 @@ func (ao3 *ao3) Next() (*feed.Post, error) {
 		tags = append(tags, tagNode.FirstChild.Data)
 	}
 
-	ao3.works = ao3.works[1:]
 	return &feed.Post{
 		Source:          "ao3",
 		ID:              id,
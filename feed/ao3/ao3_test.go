@@ -2,11 +2,15 @@ package ao3
 
 import (
 	"context"
+	"io"
+	"strings"
 	"testing"
 	"time"
 
 	"github.com/heyLu/numblr/feed"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/net/html"
 )
 
 func TestAO3AuthorFandomFeed(t *testing.T) {
@@ -30,3 +34,143 @@ func TestAO3AuthorFandomFeed(t *testing.T) {
 		"Teen And Up Audiences", "Choose Not To Use Archive Warnings", "M/M", "Complete Work",
 		"Creator Chose Not To Use Archive Warnings", "Draco Malfoy/Harry Potter", "Draco Malfoy", "Harry Potter", "Vividcon", "Vividcon 2016", "Vividcon 2016 Premieres"}, post.Tags, "tags")
 }
+
+const bookmarksFixture = `<!DOCTYPE html>
+<html><body><div id="main" class="bookmarks-index dashboard filtered region" role="main">
+<h2 class="heading">1 - 2 of 2 Bookmarks by reader</h2>
+<ol class="bookmark index group">
+<li id="bookmark_1234567" class="bookmark blurb group" role="article">
+  <div class="header module">
+    <h4 class="heading">
+      <a href="/works/7756009">[VID] You Are A Runner And I Am My Father&#39;s Son</a>
+      by
+      <a rel="author" href="/users/astolat/pseuds/astolat">astolat</a>
+    </h4>
+    <h5 class="fandoms heading">
+      <span class="landmark">Fandoms:</span>
+      <a class="tag" href="/tags/Harry%20Potter%20-%20J*d*%20K*d*%20Rowling/works">Harry Potter - J. K. Rowling</a>
+    </h5>
+    <ul class="required-tags">
+      <li><a class="help symbol question modal" title="Symbols key" href="/help/symbols-key.html"><span class="rating-teen rating" title="Teen And Up Audiences"><span class="text">Teen And Up Audiences</span></span></a></li>
+      <li><a class="help symbol question modal" title="Symbols key" href="/help/symbols-key.html"><span class="category-slash category" title="M/M"><span class="text">M/M</span></span></a></li>
+    </ul>
+    <p class="datetime">13 Aug 2016</p>
+  </div>
+  <h6 class="landmark heading">Tags</h6>
+  <ul class="tags commas">
+    <li class="relationships"><a class="tag" href="/tags/Draco%20Malfoy*s*Harry%20Potter/works">Draco Malfoy/Harry Potter</a></li>
+    <li class="freeforms"><a class="tag" href="/tags/Vividcon/works">Vividcon</a></li>
+  </ul>
+  <h6 class="landmark heading">Summary</h6>
+  <blockquote class="userstuff summary">
+    <p>I'll draw three figures on your heart.</p>
+  </blockquote>
+  <div class="user module group">
+    <h5 class="byline heading">Bookmarked by <a href="/users/reader/pseuds/reader/bookmarks">reader</a></h5>
+    <p class="datetime">02 Feb 2024</p>
+    <h6 class="landmark heading">Bookmarker's Tags:</h6>
+    <ul class="meta tags commas">
+      <li><a class="tag" href="/tags/favorites/works">favorites</a></li>
+    </ul>
+    <h6 class="landmark heading">Bookmarker's Notes</h6>
+    <blockquote class="userstuff notes">
+      <p>Rewatch every year, see <a href="/works/123">also</a>.</p>
+    </blockquote>
+  </div>
+</li>
+<li id="bookmark_1234566" class="bookmark blurb group" role="article">
+  <p class="message">This has been deleted, sorry!</p>
+  <div class="user module group">
+    <h5 class="byline heading">Bookmarked by <a href="/users/reader/pseuds/reader/bookmarks">reader</a></h5>
+    <p class="datetime">01 Feb 2024</p>
+  </div>
+</li>
+</ol>
+</div></body></html>`
+
+func TestAO3Bookmarks(t *testing.T) {
+	node, err := html.Parse(strings.NewReader(bookmarksFixture))
+	require.NoError(t, err, "parse")
+
+	bookmarks := &ao3{name: "https://archiveofourown.org/users/reader/bookmarks", bookmarks: true, works: listItems(node, true)}
+	require.Len(t, bookmarks.works, 1, "deleted works are skipped")
+
+	post, err := bookmarks.Next()
+	require.NoError(t, err, "next")
+
+	assert.Equal(t, "1234567", post.ID, "id")
+	assert.Equal(t, "https://archiveofourown.org/works/7756009", post.URL, "url")
+	assert.Equal(t, "reader", post.Author, "author")
+	assert.Equal(t, "02 Feb 2024", post.DateString, "date string")
+	assert.Equal(t, time.Date(2024, time.February, 2, 0, 0, 0, 0, time.UTC), post.Date, "date")
+	assert.Contains(t, post.Title, "</a> by astolat</h1>", "title")
+	assert.Contains(t, post.DescriptionHTML, `<a href="https://archiveofourown.org/works/123">also</a>`, "notes")
+	assert.Contains(t, post.DescriptionHTML, "<p>I&#39;ll draw three figures on your heart.</p>", "summary")
+	assert.Equal(t, []string{
+		"Harry Potter - J. K. Rowling",
+		"Teen And Up Audiences", "M/M",
+		"Draco Malfoy/Harry Potter", "Vividcon", "favorites"}, post.Tags, "tags")
+
+	_, err = bookmarks.Next()
+	assert.Equal(t, io.EOF, err, "end")
+}
+
+const workFixture = `<!DOCTYPE html>
+<html><body><div id="main" class="works-show region" role="main">
+<div id="workskin">
+  <div class="preface group">
+    <h2 class="title heading">A Long Story</h2>
+    <h3 class="byline heading"><a rel="author" href="/users/writer/pseuds/writer">writer</a></h3>
+  </div>
+  <div id="chapters" role="article">
+    <div class="chapter" id="chapter-1">
+      <div class="chapter preface group" role="complementary">
+        <h3 class="title"><a href="/works/1234/chapters/5678">Chapter 1</a>: Beginnings</h3>
+        <div id="notes" class="notes module" role="note">
+          <h3 class="heading">Notes:</h3>
+          <blockquote class="userstuff"><p>Thanks to my <a href="/users/beta">beta</a>!</p></blockquote>
+        </div>
+      </div>
+      <div class="userstuff module" role="article">
+        <h3 class="landmark heading" id="work">Chapter Text</h3>
+        <p>It was a dark and stormy night.</p>
+      </div>
+    </div>
+  </div>
+</div>
+</div></body></html>`
+
+const adultWarningFixture = `<!DOCTYPE html>
+<html><body><div id="main" class="works-show region" role="main">
+<p class="caution">This work could have adult content. If you continue, you have agreed that you are willing to see such content.</p>
+</div></body></html>`
+
+func TestAO3WorkText(t *testing.T) {
+	node, err := html.Parse(strings.NewReader(workFixture))
+	require.NoError(t, err, "parse")
+
+	text, err := workText(node)
+	require.NoError(t, err, "work text")
+	assert.Contains(t, text, "<p>It was a dark and stormy night.</p>", "text")
+	assert.Contains(t, text, `<a href="https://archiveofourown.org/works/1234/chapters/5678">Chapter 1</a>: Beginnings`, "chapter title")
+	assert.Contains(t, text, `<a href="https://archiveofourown.org/users/beta">beta</a>`, "notes")
+	assert.NotContains(t, text, "Chapter Text", "landmarks")
+
+	node, err = html.Parse(strings.NewReader(adultWarningFixture))
+	require.NoError(t, err, "parse")
+	_, err = workText(node)
+	assert.Error(t, err, "adult content warning")
+}
+
+func TestAO3StatNumber(t *testing.T) {
+	node, err := html.Parse(strings.NewReader(`<li class="work"><dl class="stats"><dt class="words">Words:</dt><dd class="words">12,345</dd><dt class="chapters">Chapters:</dt><dd class="chapters"><a href="/works/1234/chapters/9999">3</a>/?</dd></dl></li>`))
+	require.NoError(t, err, "parse")
+
+	assert.Equal(t, 12345, statNumber(node, wordsMatcher), "words")
+	assert.Equal(t, 3, statNumber(node, chaptersMatcher), "chapters")
+
+	node, err = html.Parse(strings.NewReader(`<li class="work"><dl class="stats"><dd class="chapters">1/1</dd></dl></li>`))
+	require.NoError(t, err, "parse")
+	assert.Equal(t, 1, statNumber(node, chaptersMatcher), "single chapter")
+	assert.Equal(t, 0, statNumber(node, wordsMatcher), "missing")
+}
@@ -0,0 +1,144 @@
+package ao3
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/andybalholm/cascadia"
+	lru "github.com/hashicorp/golang-lru"
+	"golang.org/x/net/html"
+
+	"github.com/heyLu/numblr/feed"
+)
+
+// FullText enables showing the text of works inline when a feed is viewed
+// with `full`, see feed.Search.Full.
+var FullText = true
+
+// ShortWorkWords is the number of words up to which works are shown as a
+// whole, only the first chapter is shown of longer ones.
+var ShortWorkWords = 10000
+
+var wordsMatcher = cascadia.MustCompile("dl.stats dd.words")
+var chaptersMatcher = cascadia.MustCompile("dl.stats dd.chapters")
+var workTextMatcher = cascadia.MustCompile("#chapters")
+var landmarkMatcher = cascadia.MustCompile(".landmark")
+
+// workTextCache caches the rendered text of works by id, date of the last
+// update and whether it is the whole work, so that updated works are
+// fetched again.
+var workTextCache, _ = lru.New(100)
+
+// addWorkText appends the text of the work to the post, which is the whole
+// work for short works and the first chapter otherwise.
+func addWorkText(ctx context.Context, post *feed.Post, work *html.Node) {
+	words := statNumber(work, wordsMatcher)
+	chapters := statNumber(work, chaptersMatcher)
+	// the page of a work shows only the first chapter by default
+	whole := chapters > 1 && words > 0 && words <= ShortWorkWords
+
+	text, err := fetchWorkText(ctx, post.ID, post.DateString, whole)
+	if err != nil {
+		log.Printf("Error: full text of %s: %s", post.URL, err)
+		return
+	}
+
+	post.DescriptionHTML += `<hr /><section class="work-text">` + text + `</section>`
+	if chapters > 1 && !whole {
+		post.DescriptionHTML += fmt.Sprintf(`<p><a href="%s?view_full_work=true">Continue reading on AO3</a> (%d chapters, %d words)</p>`, post.URL, chapters, words)
+	}
+}
+
+// statNumber returns the number in the stats of the work that `matcher`
+// selects, e.g. `1,234` words or `2/?` chapters, or 0 if there is none.
+func statNumber(work *html.Node, matcher cascadia.Selector) int {
+	stat := cascadia.Query(work, matcher)
+	if stat == nil || stat.FirstChild == nil {
+		return 0
+	}
+
+	text := stat.FirstChild.Data
+	if stat.FirstChild.Type != html.TextNode && stat.FirstChild.FirstChild != nil {
+		// the published chapters are a link if there are several
+		text = stat.FirstChild.FirstChild.Data
+	}
+	text, _, _ = strings.Cut(text, "/")
+	n, err := strconv.Atoi(strings.ReplaceAll(strings.TrimSpace(text), ",", ""))
+	if err != nil {
+		return 0
+	}
+	return n
+}
+
+func fetchWorkText(ctx context.Context, id string, updated string, whole bool) (string, error) {
+	key := fmt.Sprintf("%s/%s/%t", id, updated, whole)
+	if cached, ok := workTextCache.Get(key); ok {
+		return cached.(string), nil
+	}
+
+	workURL := "https://archiveofourown.org/works/" + id
+	if whole {
+		workURL += "?view_full_work=true"
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "GET", workURL, nil)
+	if err != nil {
+		return "", fmt.Errorf("new request: %w", err)
+	}
+	// skips the page that warns about adult content
+	req.AddCookie(&http.Cookie{Name: "view_adult", Value: "true"})
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("download: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != 200 {
+		return "", fmt.Errorf("download: %w", feed.StatusError{Code: resp.StatusCode})
+	}
+
+	node, err := html.Parse(resp.Body)
+	if err != nil {
+		return "", fmt.Errorf("parse: %w", err)
+	}
+
+	text, err := workText(node)
+	if err != nil {
+		return "", err
+	}
+
+	workTextCache.Add(key, text)
+	return text, nil
+}
+
+// workText renders the chapters on the page of a work, along with their
+// titles and notes.
+func workText(node *html.Node) (string, error) {
+	chapters := cascadia.Query(node, workTextMatcher)
+	if chapters == nil {
+		// e.g. works that are only visible when logged in
+		return "", fmt.Errorf("no work text")
+	}
+
+	// headings for screen readers that only say "Chapter Text"
+	for _, landmark := range cascadia.QueryAll(chapters, landmarkMatcher) {
+		landmark.Parent.RemoveChild(landmark)
+	}
+
+	makeAbsoluteLinks(chapters, "https://archiveofourown.org")
+
+	buf := new(bytes.Buffer)
+	for child := chapters.FirstChild; child != nil; child = child.NextSibling {
+		err := html.Render(buf, child)
+		if err != nil {
+			return "", fmt.Errorf("render: %w", err)
+		}
+	}
+	return strings.TrimSpace(buf.String()), nil
+}
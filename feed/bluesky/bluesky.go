@@ -0,0 +1,340 @@
+package bluesky
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"html"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/heyLu/numblr/feed"
+)
+
+// Suffixes mark names as Bluesky feeds, e.g. `jay.bsky.social@bluesky`.
+var Suffixes = []string{"@bsky", "@bluesky"}
+
+// APIURL is the Bluesky server that is asked for the posts, which serves
+// public data without logging in.
+var APIURL = "https://public.api.bsky.app"
+
+// maxLimit is the maximum number of posts getAuthorFeed returns at once.
+const maxLimit = 100
+
+// IsBluesky returns true if `name` has one of the Suffixes.
+func IsBluesky(name string) bool {
+	for _, suffix := range Suffixes {
+		if strings.HasSuffix(name, suffix) {
+			return true
+		}
+	}
+	return false
+}
+
+// Handle returns the handle of the account `name`, e.g. `jay.bsky.social`.
+func Handle(name string) string {
+	for _, suffix := range Suffixes {
+		name = strings.TrimSuffix(name, suffix)
+	}
+	return strings.TrimPrefix(name, "@")
+}
+
+// Open opens the posts and reposts of the Bluesky account `name`, see
+// Suffixes.
+//
+// See https://docs.bsky.app/docs/api/app-bsky-feed-get-author-feed.
+func Open(ctx context.Context, name string, search feed.Search) (feed.Feed, error) {
+	handle := Handle(name)
+	if handle == "" {
+		return nil, fmt.Errorf("unrecognized bluesky feed %q, expected handle@bluesky", name)
+	}
+
+	did, err := resolveHandle(ctx, handle)
+	if err != nil {
+		return nil, fmt.Errorf("resolve %q: %w", handle, err)
+	}
+
+	limit := search.Limit
+	if limit <= 0 {
+		limit = feed.DefaultLimit
+	}
+	if limit > maxLimit {
+		limit = maxLimit
+	}
+
+	params := url.Values{}
+	params.Set("actor", did)
+	params.Set("filter", "posts_no_replies")
+	params.Set("limit", fmt.Sprint(limit))
+
+	var authorFeed authorFeed
+	err = xrpc(ctx, "app.bsky.feed.getAuthorFeed", params, &authorFeed)
+	if err != nil {
+		return nil, err
+	}
+
+	return &bluesky{name: name, handle: handle, items: authorFeed.Feed}, nil
+}
+
+// resolveHandle returns the DID of the account with `handle`.
+func resolveHandle(ctx context.Context, handle string) (string, error) {
+	var resolved struct {
+		DID string `json:"did"`
+	}
+	err := xrpc(ctx, "com.atproto.identity.resolveHandle", url.Values{"handle": {handle}}, &resolved)
+	if err != nil {
+		return "", err
+	}
+	if resolved.DID == "" {
+		return "", fmt.Errorf("no did")
+	}
+	return resolved.DID, nil
+}
+
+// xrpc calls the XRPC `method` at APIURL and decodes the response into
+// `result`.
+//
+// Unknown accounts are reported as feed.StatusError with status 404, the
+// api itself says 400.
+func xrpc(ctx context.Context, method string, params url.Values, result interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, "GET", APIURL+"/xrpc/"+method+"?"+params.Encode(), nil)
+	if err != nil {
+		return fmt.Errorf("new request: %w", err)
+	}
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("%s: %w", method, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusBadRequest {
+		var xrpcErr struct {
+			Error   string `json:"error"`
+			Message string `json:"message"`
+		}
+		_ = json.NewDecoder(io.LimitReader(resp.Body, 64*1024)).Decode(&xrpcErr)
+		if xrpcErr.Error == "InvalidRequest" || xrpcErr.Error == "AccountTakedown" || xrpcErr.Error == "AccountDeactivated" {
+			return fmt.Errorf("%s: %s: %w", method, xrpcErr.Message, feed.StatusError{Code: http.StatusNotFound})
+		}
+		return fmt.Errorf("%s: %s %s: %w", method, xrpcErr.Error, xrpcErr.Message, feed.StatusError{Code: resp.StatusCode})
+	}
+	if resp.StatusCode != 200 {
+		return fmt.Errorf("%s: %w", method, feed.StatusError{Code: resp.StatusCode})
+	}
+
+	err = json.NewDecoder(resp.Body).Decode(result)
+	if err != nil {
+		return fmt.Errorf("%s: decode: %w", method, err)
+	}
+	return nil
+}
+
+type authorFeed struct {
+	Feed []feedItem `json:"feed"`
+}
+
+type feedItem struct {
+	Post struct {
+		URI    string  `json:"uri"`
+		CID    string  `json:"cid"`
+		Author profile `json:"author"`
+		Record struct {
+			Text      string    `json:"text"`
+			CreatedAt time.Time `json:"createdAt"`
+			Facets    []facet   `json:"facets"`
+		} `json:"record"`
+		Embed *embed `json:"embed"`
+	} `json:"post"`
+	Reason *struct {
+		Type      string    `json:"$type"`
+		By        profile   `json:"by"`
+		IndexedAt time.Time `json:"indexedAt"`
+	} `json:"reason"`
+}
+
+type profile struct {
+	DID         string `json:"did"`
+	Handle      string `json:"handle"`
+	DisplayName string `json:"displayName"`
+	Avatar      string `json:"avatar"`
+}
+
+// facet marks a part of the text of a post as a link, mention or tag, by
+// its byte offsets.
+//
+// See https://docs.bsky.app/docs/advanced-guides/post-richtext.
+type facet struct {
+	Index struct {
+		ByteStart int `json:"byteStart"`
+		ByteEnd   int `json:"byteEnd"`
+	} `json:"index"`
+	Features []struct {
+		Type string `json:"$type"`
+		URI  string `json:"uri"`
+		DID  string `json:"did"`
+		Tag  string `json:"tag"`
+	} `json:"features"`
+}
+
+type embed struct {
+	Type   string  `json:"$type"`
+	Images []image `json:"images"`
+
+	External *struct {
+		URI         string `json:"uri"`
+		Title       string `json:"title"`
+		Description string `json:"description"`
+	} `json:"external"`
+
+	// Media are the images of posts that quote another post.
+	Media *embed `json:"media"`
+}
+
+type image struct {
+	Fullsize string `json:"fullsize"`
+	Alt      string `json:"alt"`
+}
+
+type bluesky struct {
+	name   string
+	handle string
+	items  []feedItem
+}
+
+func (bs *bluesky) Name() string {
+	return bs.name
+}
+
+func (bs *bluesky) Description() string {
+	return ""
+}
+
+func (bs *bluesky) URL() string {
+	return "https://bsky.app/profile/" + bs.handle
+}
+
+// Next returns the next post, reposts are marked like reblogs on Tumblr so
+// that `noreblogs` hides them.
+//
+// Posts are dated when they were created and reposts when they were
+// reposted, which is the order the feed is in.
+func (bs *bluesky) Next() (*feed.Post, error) {
+	if len(bs.items) == 0 {
+		return nil, io.EOF
+	}
+
+	item := bs.items[0]
+	bs.items = bs.items[1:]
+
+	post := item.Post
+	postURL := post.URI
+	if idx := strings.LastIndex(post.URI, "/"); idx != -1 && post.Author.Handle != "" {
+		postURL = "https://bsky.app/profile/" + post.Author.Handle + "/post/" + post.URI[idx+1:]
+	}
+
+	descriptionHTML, tags := renderText(post.Record.Text, post.Record.Facets)
+	descriptionHTML += renderEmbed(post.Embed)
+
+	date := post.Record.CreatedAt
+	if item.Reason != nil && strings.HasSuffix(item.Reason.Type, "#reasonRepost") {
+		author := post.Author.Handle + "@bluesky"
+		descriptionHTML = fmt.Sprintf(`<p><a class="tumblr_blog" href="/%s">%s</a>:</p><blockquote>%s</blockquote>`, html.EscapeString(author), html.EscapeString(post.Author.Handle), descriptionHTML)
+		date = item.Reason.IndexedAt
+	}
+
+	return &feed.Post{
+		Source:          "bluesky",
+		ID:              post.CID,
+		Author:          bs.name,
+		AvatarURL:       post.Author.Avatar,
+		URL:             postURL,
+		DescriptionHTML: descriptionHTML,
+		Tags:            tags,
+		DateString:      date.Format(time.RFC3339),
+		Date:            date.UTC(),
+	}, nil
+}
+
+func (bs *bluesky) Close() error {
+	return nil
+}
+
+// renderText renders the text of a post with its links, mentions and tags,
+// and returns the tags separately as well.
+func renderText(text string, facets []facet) (string, []string) {
+	sort.Slice(facets, func(i, j int) bool {
+		return facets[i].Index.ByteStart < facets[j].Index.ByteStart
+	})
+
+	var tags []string
+	buf := new(strings.Builder)
+	pos := 0
+	for _, facet := range facets {
+		start, end := facet.Index.ByteStart, facet.Index.ByteEnd
+		if start < pos || end > len(text) || start >= end || len(facet.Features) == 0 {
+			continue
+		}
+
+		buf.WriteString(html.EscapeString(text[pos:start]))
+
+		var href string
+		feature := facet.Features[0]
+		switch {
+		case strings.HasSuffix(feature.Type, "#link"):
+			href = feature.URI
+		case strings.HasSuffix(feature.Type, "#mention"):
+			href = "/" + strings.TrimPrefix(text[start:end], "@") + "@bluesky"
+		case strings.HasSuffix(feature.Type, "#tag"):
+			tags = append(tags, feature.Tag)
+			href = "https://bsky.app/hashtag/" + url.PathEscape(feature.Tag)
+		}
+		if href == "" {
+			buf.WriteString(html.EscapeString(text[start:end]))
+		} else {
+			fmt.Fprintf(buf, `<a href="%s">%s</a>`, html.EscapeString(href), html.EscapeString(text[start:end]))
+		}
+		pos = end
+	}
+	buf.WriteString(html.EscapeString(text[pos:]))
+
+	paragraphs := strings.Split(buf.String(), "\n\n")
+	for i, paragraph := range paragraphs {
+		paragraphs[i] = "<p>" + strings.ReplaceAll(paragraph, "\n", "<br />") + "</p>"
+	}
+	return strings.Join(paragraphs, ""), tags
+}
+
+// renderEmbed renders the images and link cards of posts.
+func renderEmbed(e *embed) string {
+	if e == nil {
+		return ""
+	}
+
+	buf := new(strings.Builder)
+	if len(e.Images) > 1 {
+		buf.WriteString(`<div class="gallery">`)
+	}
+	for _, img := range e.Images {
+		fmt.Fprintf(buf, `<img src="%s" alt="%s" />`, html.EscapeString(img.Fullsize), html.EscapeString(img.Alt))
+	}
+	if len(e.Images) > 1 {
+		buf.WriteString(`</div>`)
+	}
+
+	if e.External != nil && e.External.URI != "" {
+		title := e.External.Title
+		if title == "" {
+			title = e.External.URI
+		}
+		fmt.Fprintf(buf, `<p class="link-card"><a href="%s">%s</a></p>`, html.EscapeString(e.External.URI), html.EscapeString(title))
+	}
+
+	buf.WriteString(renderEmbed(e.Media))
+	return buf.String()
+}
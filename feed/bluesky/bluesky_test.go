@@ -0,0 +1,84 @@
+package bluesky
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/heyLu/numblr/feed"
+)
+
+const authorFeedFixture = `{"feed":[
+{"post":{"uri":"at://did:plc:z72i7hdynmk6r22z27h6tvur/app.bsky.feed.post/3kq2sqzrvta2b","cid":"bafyreib2rxk3rh6kzwq","author":{"did":"did:plc:oky5czdrnfjpqslsw2a5iclo","handle":"other.bsky.social","avatar":"https://cdn.bsky.app/img/avatar/other.jpg"},"record":{"$type":"app.bsky.feed.post","text":"reposted post","createdAt":"2024-03-01T10:00:00.000Z"},"indexedAt":"2024-03-01T10:00:01.000Z"},"reason":{"$type":"app.bsky.feed.defs#reasonRepost","by":{"did":"did:plc:z72i7hdynmk6r22z27h6tvur","handle":"jay.bsky.team"},"indexedAt":"2024-03-02T12:00:00.000Z"}},
+{"post":{"uri":"at://did:plc:z72i7hdynmk6r22z27h6tvur/app.bsky.feed.post/3kq2sqzrvta2a","cid":"bafyreia3ql2kdhsbfq","author":{"did":"did:plc:z72i7hdynmk6r22z27h6tvur","handle":"jay.bsky.team","avatar":"https://cdn.bsky.app/img/avatar/jay.jpg"},"record":{"$type":"app.bsky.feed.post","text":"héllo @other.bsky.social, see example.com\n\n#art <3","createdAt":"2024-03-01T09:00:00.000Z","facets":[
+{"index":{"byteStart":7,"byteEnd":25},"features":[{"$type":"app.bsky.richtext.facet#mention","did":"did:plc:oky5czdrnfjpqslsw2a5iclo"}]},
+{"index":{"byteStart":31,"byteEnd":42},"features":[{"$type":"app.bsky.richtext.facet#link","uri":"https://example.com"}]},
+{"index":{"byteStart":44,"byteEnd":48},"features":[{"$type":"app.bsky.richtext.facet#tag","tag":"art"}]}]},
+"embed":{"$type":"app.bsky.embed.images#view","images":[{"thumb":"https://cdn.bsky.app/img/feed_thumbnail/1.jpg","fullsize":"https://cdn.bsky.app/img/feed_fullsize/1.jpg","alt":"a cat"},{"thumb":"https://cdn.bsky.app/img/feed_thumbnail/2.jpg","fullsize":"https://cdn.bsky.app/img/feed_fullsize/2.jpg","alt":""}]},"indexedAt":"2024-03-01T09:00:01.000Z"}}
+],"cursor":"2024-03-01T09:00:01.000Z"}`
+
+func TestOpen(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		switch req.URL.Path {
+		case "/xrpc/com.atproto.identity.resolveHandle":
+			if req.URL.Query().Get("handle") != "jay.bsky.team" {
+				w.WriteHeader(http.StatusBadRequest)
+				fmt.Fprint(w, `{"error":"InvalidRequest","message":"Unable to resolve handle"}`)
+				return
+			}
+			fmt.Fprint(w, `{"did":"did:plc:z72i7hdynmk6r22z27h6tvur"}`)
+		case "/xrpc/app.bsky.feed.getAuthorFeed":
+			require.Equal(t, "did:plc:z72i7hdynmk6r22z27h6tvur", req.URL.Query().Get("actor"), "actor")
+			fmt.Fprint(w, authorFeedFixture)
+		default:
+			http.NotFound(w, req)
+		}
+	}))
+	defer server.Close()
+
+	origAPIURL := APIURL
+	APIURL = server.URL
+	defer func() {
+		APIURL = origAPIURL
+	}()
+
+	f, err := Open(context.Background(), "jay.bsky.team@bluesky", feed.Search{})
+	require.NoError(t, err, "open")
+	assert.Equal(t, "https://bsky.app/profile/jay.bsky.team", f.URL(), "url")
+
+	repost, err := f.Next()
+	require.NoError(t, err, "repost")
+	assert.True(t, repost.IsReblog(), "repost is a reblog")
+	assert.Equal(t, "bafyreib2rxk3rh6kzwq", repost.ID, "id")
+	assert.Equal(t, "jay.bsky.team@bluesky", repost.Author, "author")
+	assert.Equal(t, time.Date(2024, time.March, 2, 12, 0, 0, 0, time.UTC), repost.Date, "reposted at")
+	assert.Equal(t, "https://bsky.app/profile/other.bsky.social/post/3kq2sqzrvta2b", repost.URL, "url")
+	assert.Contains(t, repost.DescriptionHTML, `<a class="tumblr_blog" href="/other.bsky.social@bluesky">other.bsky.social</a>`, "attribution")
+
+	post, err := f.Next()
+	require.NoError(t, err, "post")
+	assert.False(t, post.IsReblog(), "post")
+	assert.Equal(t, "bafyreia3ql2kdhsbfq", post.ID, "id")
+	assert.Equal(t, time.Date(2024, time.March, 1, 9, 0, 0, 0, time.UTC), post.Date, "created at")
+	assert.Equal(t, "https://cdn.bsky.app/img/avatar/jay.jpg", post.AvatarURL, "avatar")
+	assert.Equal(t, []string{"art"}, post.Tags, "tags")
+	assert.Equal(t, `<p>héllo <a href="/other.bsky.social@bluesky">@other.bsky.social</a>, see <a href="https://example.com">example.com</a></p>`+
+		`<p><a href="https://bsky.app/hashtag/art">#art</a> &lt;3</p>`+
+		`<div class="gallery"><img src="https://cdn.bsky.app/img/feed_fullsize/1.jpg" alt="a cat" /><img src="https://cdn.bsky.app/img/feed_fullsize/2.jpg" alt="" /></div>`, post.DescriptionHTML, "description")
+
+	_, err = f.Next()
+	assert.Equal(t, io.EOF, err, "end")
+
+	_, err = Open(context.Background(), "nobody.example@bsky", feed.Search{})
+	var statusErr feed.StatusError
+	require.ErrorAs(t, err, &statusErr, "unknown handle")
+	assert.Equal(t, http.StatusNotFound, statusErr.Code, "unknown handle")
+}
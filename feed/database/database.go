@@ -6,21 +6,50 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"html"
 	"io"
 	"log"
 	"net/http"
+	"sort"
 	"strings"
 	"time"
+	"unicode/utf8"
 
 	"github.com/mattn/go-sqlite3"
 	_ "github.com/mattn/go-sqlite3" // use sqlite3 for this feed
+	"golang.org/x/sync/singleflight"
 
 	"github.com/heyLu/numblr/feed"
 )
 
-// CacheTime is the duration that feeds should be cached for.
+// hasFullTextSearch is set by InitDatabase if sqlite supports fts5, which
+// go-sqlite3 only does when built with `-tags sqlite_fts5`.
+var hasFullTextSearch bool
+
+// CacheTime is the duration that feeds should be cached for, unless they
+// implement feed.CacheTTL.
 var CacheTime time.Duration
 
+// CachePreferTimeout is how long fetching cached feeds may take before the
+// cached posts are returned instead.
+var CachePreferTimeout = 150 * time.Millisecond
+
+// MaxDescriptionSize is the maximum size in bytes of the html of a post that
+// is stored, larger posts (e.g. long reblog chains) are stored truncated with
+// a link to the original.  It is not limited if it is 0.
+var MaxDescriptionSize = 256 * 1024
+
+// Retention is how long posts are kept in the cache, they are kept forever
+// if it is 0.
+//
+// The newest RetentionMinPosts posts of each feed are always kept, so that
+// feeds that rarely post never become empty.
+var Retention time.Duration
+
+// RetentionMinPosts is the number of posts of each feed that are kept
+// regardless of Retention.
+var RetentionMinPosts = 20
+
 // InitDatabase creates a cache database at dbPath and returns a connection to
 // it.
 func InitDatabase(dbPath string) (*sql.DB, error) {
@@ -65,6 +94,23 @@ func InitDatabase(dbPath string) (*sql.DB, error) {
 		}
 	}()
 
+	go func() {
+		for {
+			time.Sleep(1 * time.Hour)
+
+			if Retention <= 0 {
+				continue
+			}
+
+			n, err := PurgePosts(context.Background(), db, time.Now().Add(-Retention), RetentionMinPosts)
+			if err != nil {
+				log.Printf("Error: purging old posts: %s", err)
+				continue
+			}
+			log.Printf("Purged %d posts older than %s", n, Retention)
+		}
+	}()
+
 	db.SetConnMaxLifetime(60 * time.Minute)
 	db.SetMaxIdleConns(100)
 
@@ -77,6 +123,40 @@ func InitDatabase(dbPath string) (*sql.DB, error) {
 		return nil, fmt.Errorf("setup feed_infos table: %w", err)
 	}
 
+	_, err = db.Exec(`ALTER TABLE feed_infos ADD COLUMN priority INTEGER NOT NULL DEFAULT 0`)
+	if err != nil && !strings.Contains(err.Error(), "duplicate column name") {
+		return nil, fmt.Errorf("add feed_infos priority: %w", err)
+	}
+
+	// the feed.CacheTTL of the feed in seconds, 0 means CacheTime
+	_, err = db.Exec(`ALTER TABLE feed_infos ADD COLUMN cache_ttl INTEGER NOT NULL DEFAULT 0`)
+	if err != nil && !strings.Contains(err.Error(), "duplicate column name") {
+		return nil, fmt.Errorf("add feed_infos cache_ttl: %w", err)
+	}
+
+	// the validators of the feed, see feed.Validators
+	_, err = db.Exec(`ALTER TABLE feed_infos ADD COLUMN etag TEXT NOT NULL DEFAULT ''`)
+	if err != nil && !strings.Contains(err.Error(), "duplicate column name") {
+		return nil, fmt.Errorf("add feed_infos etag: %w", err)
+	}
+	_, err = db.Exec(`ALTER TABLE feed_infos ADD COLUMN last_modified TEXT NOT NULL DEFAULT ''`)
+	if err != nil && !strings.Contains(err.Error(), "duplicate column name") {
+		return nil, fmt.Errorf("add feed_infos last_modified: %w", err)
+	}
+
+	// when the feed was last fetched without an error, feeds that were
+	// cached before were last successful then
+	_, err = db.Exec(`ALTER TABLE feed_infos ADD COLUMN last_success_at DATE`)
+	if err != nil && !strings.Contains(err.Error(), "duplicate column name") {
+		return nil, fmt.Errorf("add feed_infos last_success_at: %w", err)
+	}
+	if err == nil {
+		_, err = db.Exec(`UPDATE feed_infos SET last_success_at = cached_at WHERE error IS NULL OR error = ''`)
+		if err != nil {
+			return nil, fmt.Errorf("setup feed_infos last_success_at: %w", err)
+		}
+	}
+
 	_, err = db.Exec(`CREATE TABLE IF NOT EXISTS posts ( source TEXT, name TEXT, id TEXT, author TEXT, avatar_url TEXT, url TEXT, title TEXT, description_html TEXT, tags TEXT, date_string TEXT, date DATE, PRIMARY KEY (source, name, id))`)
 	if err != nil {
 		return nil, fmt.Errorf("setup posts table: %w", err)
@@ -87,11 +167,103 @@ func InitDatabase(dbPath string) (*sql.DB, error) {
 		return nil, fmt.Errorf("setup posts index: %w", err)
 	}
 
+	err = setupFullTextSearch(db)
+	if err != nil {
+		return nil, err
+	}
+
 	return db, err
 }
 
+// purgedPosts selects the posts older than the first argument, unless they
+// are one of the newest posts of their feed.
+//
+// Counting the newer posts of the same author uses posts_by_author_and_date,
+// and stops once there are enough of them.
+const purgedPosts = `SELECT rowid FROM posts AS old WHERE date < ? AND (SELECT COUNT(*) FROM (SELECT 1 FROM posts WHERE author = old.author AND date > old.date LIMIT ?)) >= ?`
+
+// PurgePosts deletes the posts that are older than `olderThan`, except for
+// the newest `keep` posts of each feed.  It returns the number of posts
+// that were deleted.
+func PurgePosts(ctx context.Context, db *sql.DB, olderThan time.Time, keep int) (int64, error) {
+	tx, err := db.BeginTx(ctx, &sql.TxOptions{ReadOnly: false})
+	if err != nil {
+		return 0, fmt.Errorf("begin tx: %w", err)
+	}
+	defer func() {
+		_ = tx.Rollback()
+	}()
+
+	if hasFullTextSearch {
+		_, err = tx.ExecContext(ctx, `DELETE FROM posts_fts WHERE rowid IN (`+purgedPosts+`)`, olderThan, keep, keep)
+		if err != nil {
+			return 0, fmt.Errorf("update posts index: %w", err)
+		}
+	}
+
+	res, err := tx.ExecContext(ctx, `DELETE FROM posts WHERE rowid IN (`+purgedPosts+`)`, olderThan, keep, keep)
+	if err != nil {
+		return 0, fmt.Errorf("delete posts: %w", err)
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("rows affected: %w", err)
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return 0, fmt.Errorf("commit: %w", err)
+	}
+
+	return n, nil
+}
+
+// setupFullTextSearch sets up the posts_fts table that SearchPosts uses,
+// indexing the already cached posts if it is new.
+//
+// Full-text search is optional, SearchPosts falls back to LIKE if sqlite does
+// not support it.
+func setupFullTextSearch(db *sql.DB) error {
+	var exists int
+	err := db.QueryRow(`SELECT COUNT(*) FROM sqlite_master WHERE type = 'table' AND name = 'posts_fts'`).Scan(&exists)
+	if err != nil {
+		return fmt.Errorf("check posts_fts table: %w", err)
+	}
+
+	// rows are the posts with the same rowid
+	_, err = db.Exec(`CREATE VIRTUAL TABLE IF NOT EXISTS posts_fts USING fts5 ( title, description_html, tags )`)
+	if err != nil && strings.Contains(err.Error(), "no such module: fts5") {
+		log.Printf("Note: full-text search is not supported, build with `-tags sqlite_fts5` to enable it")
+		hasFullTextSearch = false
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("setup posts_fts table: %w", err)
+	}
+	hasFullTextSearch = true
+
+	if exists == 0 {
+		_, err = db.Exec(`INSERT INTO posts_fts (rowid, title, description_html, tags) SELECT rowid, title, description_html, tags FROM posts`)
+		if err != nil {
+			return fmt.Errorf("index posts: %w", err)
+		}
+	}
+
+	return nil
+}
+
 // ListFeedsOlderThan lists feeds older than time so that they can be updated.
+//
+// Feeds with a higher priority are considered to be older sooner: with
+// priority `p` they are listed after `1/(p+1)` of the time since `olderThan`,
+// and before feeds with a lower priority.
+//
+// Feeds with a longer feed.CacheTTL are listed only once that has passed.
 func ListFeedsOlderThan(ctx context.Context, db *sql.DB, olderThan time.Time, limit int) ([]string, error) {
+	now := time.Now()
+	cacheDays := now.Sub(olderThan).Hours() / 24
+
 	tx, err := db.BeginTx(ctx, &sql.TxOptions{ReadOnly: true})
 	if err != nil {
 		return nil, fmt.Errorf("begin tx: %w", err)
@@ -100,7 +272,7 @@ func ListFeedsOlderThan(ctx context.Context, db *sql.DB, olderThan time.Time, li
 		_ = tx.Rollback()
 	}()
 
-	rows, err := tx.Query(`SELECT name FROM feed_infos WHERE ? > cached_at ORDER BY RANDOM() LIMIT ?`, olderThan, limit)
+	rows, err := tx.Query(`SELECT name FROM feed_infos WHERE julianday(cached_at) < julianday(?) - MAX(?, cache_ttl / 86400.0) / (MAX(priority, 0) + 1.0) ORDER BY priority DESC, RANDOM() LIMIT ?`, now, cacheDays, limit)
 	if err != nil {
 		return nil, fmt.Errorf("select: %w", err)
 	}
@@ -124,9 +296,610 @@ func ListFeedsOlderThan(ctx context.Context, db *sql.DB, olderThan time.Time, li
 	return feeds, nil
 }
 
+// FeedInfo is the information stored about a cached feed.
+type FeedInfo struct {
+	Name        string
+	URL         string
+	CachedAt    time.Time
+	Description string
+	// Error is the error of the last fetch, if it failed.
+	Error string
+	// LastSuccessAt is when the feed was last fetched without an error, or
+	// the zero time if it never was.
+	LastSuccessAt time.Time
+}
+
+// SetFeedPriority sets the refresh priority of the cached feed `name`, see
+// ListFeedsOlderThan.  The default priority is 0.
+func SetFeedPriority(ctx context.Context, db *sql.DB, name string, priority int) error {
+	if priority < 0 {
+		return fmt.Errorf("invalid priority %d, must be at least 0", priority)
+	}
+
+	res, err := db.ExecContext(ctx, `UPDATE feed_infos SET priority = ? WHERE name = ?`, priority, name)
+	if err != nil {
+		return fmt.Errorf("update: %w", err)
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("rows affected: %w", err)
+	}
+	if n == 0 {
+		return fmt.Errorf("feed %q is not cached yet", name)
+	}
+
+	return nil
+}
+
+// ListFeedInfos returns the infos for the feeds with the given names.
+//
+// Feeds that have not been cached are not part of the result.
+func ListFeedInfos(ctx context.Context, db *sql.DB, names []string) (map[string]FeedInfo, error) {
+	infos := make(map[string]FeedInfo, len(names))
+	if len(names) == 0 {
+		return infos, nil
+	}
+
+	args := make([]interface{}, 0, len(names))
+	for _, name := range names {
+		args = append(args, name)
+	}
+
+	rows, err := db.QueryContext(ctx, `SELECT name, url, cached_at, description, error, last_success_at FROM feed_infos WHERE name IN (?`+strings.Repeat(", ?", len(names)-1)+`)`, args...)
+	if err != nil {
+		return nil, fmt.Errorf("select: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var info FeedInfo
+		var feedError *string
+		var lastSuccessAt *time.Time
+		err := rows.Scan(&info.Name, &info.URL, &info.CachedAt, &info.Description, &feedError, &lastSuccessAt)
+		if err != nil {
+			return nil, fmt.Errorf("scan: %w", err)
+		}
+		if feedError != nil {
+			info.Error = *feedError
+		}
+		if lastSuccessAt != nil {
+			info.LastSuccessAt = *lastSuccessAt
+		}
+
+		infos[info.Name] = info
+	}
+
+	if rows.Err() != nil {
+		return nil, fmt.Errorf("after scan: %w", rows.Err())
+	}
+
+	return infos, nil
+}
+
+// FeedStats is the information stored about a cached feed together with the
+// number of its cached posts.
+type FeedStats struct {
+	FeedInfo
+	NumPosts int
+}
+
+// ListFeedStats returns the stats of all cached feeds.
+func ListFeedStats(ctx context.Context, db *sql.DB) ([]FeedStats, error) {
+	// counting the posts of each feed uses posts_by_author_and_date
+	rows, err := db.QueryContext(ctx, `SELECT name, url, cached_at, description, error, last_success_at, (SELECT COUNT(*) FROM posts WHERE author = feed_infos.name) FROM feed_infos`)
+	if err != nil {
+		return nil, fmt.Errorf("select: %w", err)
+	}
+	defer rows.Close()
+
+	stats := make([]FeedStats, 0, 100)
+	for rows.Next() {
+		var feedStats FeedStats
+		var feedError *string
+		var lastSuccessAt *time.Time
+		err := rows.Scan(&feedStats.Name, &feedStats.URL, &feedStats.CachedAt, &feedStats.Description, &feedError, &lastSuccessAt, &feedStats.NumPosts)
+		if err != nil {
+			return nil, fmt.Errorf("scan: %w", err)
+		}
+		if feedError != nil {
+			feedStats.Error = *feedError
+		}
+		if lastSuccessAt != nil {
+			feedStats.LastSuccessAt = *lastSuccessAt
+		}
+
+		stats = append(stats, feedStats)
+	}
+
+	if rows.Err() != nil {
+		return nil, fmt.Errorf("after scan: %w", rows.Err())
+	}
+
+	return stats, nil
+}
+
+// StreamPosts writes all cached posts by `author` to `w` as newline-delimited
+// JSON, newest first.
+//
+// Posts are written as they are read from the database, so this works for
+// feeds with many posts as well.
+func StreamPosts(ctx context.Context, db *sql.DB, author string, w io.Writer) error {
+	rows, err := db.QueryContext(ctx, "SELECT source, id, author, avatar_url, url, title, description_html, tags, date_string, date FROM posts WHERE author = ? ORDER BY date DESC, id DESC", author)
+	if err != nil {
+		return fmt.Errorf("select: %w", err)
+	}
+	defer rows.Close()
+
+	enc := json.NewEncoder(w)
+	for rows.Next() {
+		var post feed.Post
+		var tags []byte
+		err := rows.Scan(&post.Source, &post.ID, &post.Author, &post.AvatarURL, &post.URL, &post.Title, &post.DescriptionHTML, &tags, &post.DateString, &post.Date)
+		if err != nil {
+			return fmt.Errorf("scan: %w", err)
+		}
+
+		err = json.Unmarshal(tags, &post.Tags)
+		if err != nil {
+			return fmt.Errorf("decode tags: %w", err)
+		}
+
+		err = enc.Encode(post)
+		if err != nil {
+			return fmt.Errorf("encode: %w", err)
+		}
+	}
+
+	if rows.Err() != nil {
+		return fmt.Errorf("after scan: %w", rows.Err())
+	}
+
+	return nil
+}
+
+// ListPostsSince returns the newest `limit` cached posts of the feeds `authors`
+// that were posted after `since`, newest first.
+func ListPostsSince(ctx context.Context, db *sql.DB, authors []string, since time.Time, limit int) ([]*feed.Post, error) {
+	if len(authors) == 0 {
+		return nil, nil
+	}
+
+	args := make([]interface{}, 0, len(authors)+2)
+	for _, author := range authors {
+		args = append(args, author)
+	}
+	args = append(args, since, limit)
+
+	placeholders := strings.Repeat("?, ", len(authors))
+	placeholders = placeholders[:len(placeholders)-2]
+
+	rows, err := db.QueryContext(ctx, `SELECT source, id, author, avatar_url, url, title, description_html, tags, date_string, date FROM posts WHERE author IN (`+placeholders+`) AND date > ? ORDER BY date DESC, id DESC LIMIT ?`, args...)
+	if err != nil {
+		return nil, fmt.Errorf("select: %w", err)
+	}
+	defer rows.Close()
+
+	posts := make([]*feed.Post, 0, 10)
+	for rows.Next() {
+		var post feed.Post
+		var tags []byte
+		err := rows.Scan(&post.Source, &post.ID, &post.Author, &post.AvatarURL, &post.URL, &post.Title, &post.DescriptionHTML, &tags, &post.DateString, &post.Date)
+		if err != nil {
+			return nil, fmt.Errorf("scan: %w", err)
+		}
+
+		err = json.Unmarshal(tags, &post.Tags)
+		if err != nil {
+			return nil, fmt.Errorf("decode tags: %w", err)
+		}
+
+		posts = append(posts, &post)
+	}
+
+	if rows.Err() != nil {
+		return nil, fmt.Errorf("after scan: %w", rows.Err())
+	}
+
+	return posts, nil
+}
+
+// SearchPosts returns the newest `limit` cached posts of all feeds that
+// contain all words of `query` in their title, text or tags.
+//
+// Words are matched as prefixes using the posts_fts table if sqlite supports
+// full-text search, and as substrings otherwise.
+func SearchPosts(ctx context.Context, db *sql.DB, query string, limit int) ([]*feed.Post, error) {
+	words := strings.Fields(query)
+	if len(words) == 0 {
+		return nil, nil
+	}
+
+	var rows *sql.Rows
+	var err error
+	if hasFullTextSearch {
+		// quoted so that words are not fts5 syntax
+		match := make([]string, 0, len(words))
+		for _, word := range words {
+			match = append(match, `"`+strings.ReplaceAll(word, `"`, `""`)+`"*`)
+		}
+		rows, err = db.QueryContext(ctx, `SELECT p.source, p.id, p.author, p.avatar_url, p.url, p.title, p.description_html, p.tags, p.date_string, p.date FROM posts_fts JOIN posts p ON p.rowid = posts_fts.rowid WHERE posts_fts MATCH ? ORDER BY p.date DESC, p.id DESC LIMIT ?`, strings.Join(match, " "), limit)
+	} else {
+		stmt := `SELECT source, id, author, avatar_url, url, title, description_html, tags, date_string, date FROM posts WHERE 1`
+		args := make([]interface{}, 0, len(words)*3+1)
+		for _, word := range words {
+			stmt += ` AND (title LIKE ? ESCAPE '\' OR description_html LIKE ? ESCAPE '\' OR tags LIKE ? ESCAPE '\')`
+			pattern := "%" + likeEscaper.Replace(word) + "%"
+			args = append(args, pattern, pattern, pattern)
+		}
+		rows, err = db.QueryContext(ctx, stmt+` ORDER BY date DESC, id DESC LIMIT ?`, append(args, limit)...)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("select: %w", err)
+	}
+	defer rows.Close()
+
+	posts := make([]*feed.Post, 0, 10)
+	for rows.Next() {
+		var post feed.Post
+		var tags []byte
+		err := rows.Scan(&post.Source, &post.ID, &post.Author, &post.AvatarURL, &post.URL, &post.Title, &post.DescriptionHTML, &tags, &post.DateString, &post.Date)
+		if err != nil {
+			return nil, fmt.Errorf("scan: %w", err)
+		}
+
+		err = json.Unmarshal(tags, &post.Tags)
+		if err != nil {
+			return nil, fmt.Errorf("decode tags: %w", err)
+		}
+
+		posts = append(posts, &post)
+	}
+
+	if rows.Err() != nil {
+		return nil, fmt.Errorf("after scan: %w", rows.Err())
+	}
+
+	return posts, nil
+}
+
+// CachedPost returns the cached post `id` of the feed `author`, or nil if it
+// is not cached.
+func CachedPost(ctx context.Context, db *sql.DB, author string, id string) (*feed.Post, error) {
+	row := db.QueryRowContext(ctx, `SELECT source, id, author, avatar_url, url, title, description_html, tags, date_string, date FROM posts WHERE author = ? AND id = ? ORDER BY date DESC LIMIT 1`, author, id)
+
+	var post feed.Post
+	var tags []byte
+	err := row.Scan(&post.Source, &post.ID, &post.Author, &post.AvatarURL, &post.URL, &post.Title, &post.DescriptionHTML, &tags, &post.DateString, &post.Date)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("select: %w", err)
+	}
+
+	err = json.Unmarshal(tags, &post.Tags)
+	if err != nil {
+		return nil, fmt.Errorf("decode tags: %w", err)
+	}
+
+	return &post, nil
+}
+
+// RandomPost returns a random cached post, or nil if there are none.
+func RandomPost(ctx context.Context, db *sql.DB) (*feed.Post, error) {
+	// picking a random rowid is much faster than sorting all posts randomly,
+	// posts after gaps of deleted ones are picked a bit more often
+	row := db.QueryRowContext(ctx, `SELECT source, id, author, avatar_url, url, title, description_html, tags, date_string, date FROM posts WHERE rowid > (SELECT abs(random()) % MAX(rowid) FROM posts) ORDER BY rowid LIMIT 1`)
+
+	var post feed.Post
+	var tags []byte
+	err := row.Scan(&post.Source, &post.ID, &post.Author, &post.AvatarURL, &post.URL, &post.Title, &post.DescriptionHTML, &tags, &post.DateString, &post.Date)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("select: %w", err)
+	}
+
+	err = json.Unmarshal(tags, &post.Tags)
+	if err != nil {
+		return nil, fmt.Errorf("decode tags: %w", err)
+	}
+
+	return &post, nil
+}
+
+// idLength orders numeric ids by their length before comparing them as
+// text, like feed.IsNewer does, so that e.g. 10 comes after 9.  Other ids
+// are only compared as text.
+const idLength = "(CASE WHEN id != '' AND id NOT GLOB '*[^0-9]*' THEN length(id) ELSE 0 END)"
+
+// idLengthOf returns the value of idLength for `id`.
+func idLengthOf(id string) int {
+	if id == "" || strings.Trim(id, "0123456789") != "" {
+		return 0
+	}
+	return len(id)
+}
+
+// ListPostsChronologically returns the `limit` oldest cached posts of the feed
+// `author`, oldest first, e.g. to read a blog from the beginning.
+//
+// If `afterID` is set only posts after that post (posted at `afterDate`) are
+// returned, so that reading can continue from there.
+func ListPostsChronologically(ctx context.Context, db *sql.DB, author string, afterID string, afterDate time.Time, limit int) ([]*feed.Post, error) {
+	var rows *sql.Rows
+	var err error
+	if afterID != "" {
+		rows, err = db.QueryContext(ctx, `SELECT source, id, author, avatar_url, url, title, description_html, tags, date_string, date FROM posts WHERE author = ? AND (date > ? OR (date = ? AND (`+idLength+` > ? OR (`+idLength+` = ? AND id > ?)))) ORDER BY date ASC, `+idLength+` ASC, id ASC LIMIT ?`, author, afterDate, afterDate, idLengthOf(afterID), idLengthOf(afterID), afterID, limit)
+	} else {
+		rows, err = db.QueryContext(ctx, `SELECT source, id, author, avatar_url, url, title, description_html, tags, date_string, date FROM posts WHERE author = ? ORDER BY date ASC, `+idLength+` ASC, id ASC LIMIT ?`, author, limit)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("select: %w", err)
+	}
+	defer rows.Close()
+
+	posts := make([]*feed.Post, 0, limit)
+	for rows.Next() {
+		var post feed.Post
+		var tags []byte
+		err := rows.Scan(&post.Source, &post.ID, &post.Author, &post.AvatarURL, &post.URL, &post.Title, &post.DescriptionHTML, &tags, &post.DateString, &post.Date)
+		if err != nil {
+			return nil, fmt.Errorf("scan: %w", err)
+		}
+
+		err = json.Unmarshal(tags, &post.Tags)
+		if err != nil {
+			return nil, fmt.Errorf("decode tags: %w", err)
+		}
+
+		posts = append(posts, &post)
+	}
+
+	if rows.Err() != nil {
+		return nil, fmt.Errorf("after scan: %w", rows.Err())
+	}
+
+	return posts, nil
+}
+
+// NewestPostDates returns the date of the newest cached post for each of the
+// feeds `authors`.
+//
+// Feeds without cached posts are not part of the result.
+func NewestPostDates(ctx context.Context, db *sql.DB, authors []string) (map[string]time.Time, error) {
+	dates := make(map[string]time.Time, len(authors))
+	if len(authors) == 0 {
+		return dates, nil
+	}
+
+	args := make([]interface{}, 0, len(authors))
+	for _, author := range authors {
+		args = append(args, author)
+	}
+
+	placeholders := strings.Repeat("?, ", len(authors))
+	placeholders = placeholders[:len(placeholders)-2]
+
+	// select the date column directly (instead of MAX(date)) so that it is
+	// still scanned as a date
+	rows, err := db.QueryContext(ctx, `SELECT author, date FROM posts p WHERE author IN (`+placeholders+`) AND date = (SELECT MAX(date) FROM posts WHERE author = p.author)`, args...)
+	if err != nil {
+		return nil, fmt.Errorf("select: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var author string
+		var date time.Time
+		err := rows.Scan(&author, &date)
+		if err != nil {
+			return nil, fmt.Errorf("scan: %w", err)
+		}
+
+		dates[author] = date
+	}
+
+	if rows.Err() != nil {
+		return nil, fmt.Errorf("after scan: %w", rows.Err())
+	}
+
+	return dates, nil
+}
+
+// MaxSuggestions is the maximum number of feeds returned by SuggestFeeds.
+const MaxSuggestions = 5
+
+// SuggestFeeds returns the names of cached feeds that are similar to `name`,
+// e.g. to suggest what was meant when a feed name contains a typo.
+//
+// Feeds are similar if their edit distance is small relative to the length of
+// the name, and the closest ones are returned first.  Feeds that could not be
+// fetched are never suggested.
+func SuggestFeeds(ctx context.Context, db *sql.DB, name string) ([]string, error) {
+	name = strings.ToLower(name)
+	maxDistance := 1 + utf8.RuneCountInString(name)/4
+
+	rows, err := db.QueryContext(ctx, `SELECT name FROM feed_infos WHERE length(name) BETWEEN ? AND ? AND (error IS NULL OR error = '') AND name != ?`, utf8.RuneCountInString(name)-maxDistance, utf8.RuneCountInString(name)+maxDistance, name)
+	if err != nil {
+		return nil, fmt.Errorf("select: %w", err)
+	}
+	defer rows.Close()
+
+	distances := make(map[string]int)
+	suggestions := make([]string, 0, MaxSuggestions)
+	for rows.Next() {
+		var candidate string
+		err := rows.Scan(&candidate)
+		if err != nil {
+			return nil, fmt.Errorf("scan: %w", err)
+		}
+
+		distance := editDistance(name, strings.ToLower(candidate))
+		if distance > maxDistance {
+			continue
+		}
+
+		distances[candidate] = distance
+		suggestions = append(suggestions, candidate)
+	}
+
+	if rows.Err() != nil {
+		return nil, fmt.Errorf("after scan: %w", rows.Err())
+	}
+
+	sort.Slice(suggestions, func(i, j int) bool {
+		if distances[suggestions[i]] == distances[suggestions[j]] {
+			return suggestions[i] < suggestions[j]
+		}
+		return distances[suggestions[i]] < distances[suggestions[j]]
+	})
+	if len(suggestions) > MaxSuggestions {
+		suggestions = suggestions[:MaxSuggestions]
+	}
+
+	return suggestions, nil
+}
+
+// editDistance returns the Levenshtein distance between a and b.
+func editDistance(a, b string) int {
+	as, bs := []rune(a), []rune(b)
+
+	prev := make([]int, len(bs)+1)
+	cur := make([]int, len(bs)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+
+	for i := 1; i <= len(as); i++ {
+		cur[0] = i
+		for j := 1; j <= len(bs); j++ {
+			cost := 1
+			if as[i-1] == bs[j-1] {
+				cost = 0
+			}
+			cur[j] = min(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+		}
+		prev, cur = cur, prev
+	}
+
+	return prev[len(bs)]
+}
+
+// Reprocess applies `process` to all cached posts from `source` and updates
+// the title and description of the posts that were changed by it.
+//
+// Posts are processed in batches of `batchSize` posts, each in their own
+// transaction to avoid locking the database for too long.  It returns the
+// number of posts that were updated.
+func Reprocess(ctx context.Context, db *sql.DB, source string, batchSize int, process func(*feed.Post) error) (int, error) {
+	updated := 0
+	lastRowID := int64(0)
+	for {
+		rowIDs, posts, err := listPostsAfter(ctx, db, source, lastRowID, batchSize)
+		if err != nil {
+			return updated, fmt.Errorf("list posts: %w", err)
+		}
+		if len(posts) == 0 {
+			return updated, nil
+		}
+		lastRowID = rowIDs[len(rowIDs)-1]
+
+		tx, err := db.BeginTx(ctx, &sql.TxOptions{ReadOnly: false})
+		if err != nil {
+			return updated, fmt.Errorf("begin tx: %w", err)
+		}
+
+		batchUpdated := 0
+		for i, post := range posts {
+			title, descriptionHTML := post.Title, post.DescriptionHTML
+
+			err = process(post)
+			if err != nil {
+				log.Printf("Error: reprocessing %s/%s: %s", post.Source, post.ID, err)
+				continue
+			}
+
+			if post.Title == title && post.DescriptionHTML == descriptionHTML {
+				continue
+			}
+
+			_, err = tx.ExecContext(ctx, `UPDATE posts SET title = ?, description_html = ? WHERE rowid = ?`, post.Title, storedDescription(post), rowIDs[i])
+			if err != nil {
+				_ = tx.Rollback()
+				return updated, fmt.Errorf("update post: %w", err)
+			}
+
+			if hasFullTextSearch {
+				_, err = tx.ExecContext(ctx, `UPDATE posts_fts SET title = ?, description_html = ? WHERE rowid = ?`, post.Title, storedDescription(post), rowIDs[i])
+				if err != nil {
+					_ = tx.Rollback()
+					return updated, fmt.Errorf("update post index: %w", err)
+				}
+			}
+			batchUpdated++
+		}
+
+		err = tx.Commit()
+		if err != nil {
+			return updated, fmt.Errorf("commit: %w", err)
+		}
+		updated += batchUpdated
+	}
+}
+
+func listPostsAfter(ctx context.Context, db *sql.DB, source string, afterRowID int64, limit int) ([]int64, []*feed.Post, error) {
+	rows, err := db.QueryContext(ctx, `SELECT rowid, source, id, author, avatar_url, url, title, description_html, tags, date_string, date FROM posts WHERE source = ? AND rowid > ? ORDER BY rowid LIMIT ?`, source, afterRowID, limit)
+	if err != nil {
+		return nil, nil, fmt.Errorf("select: %w", err)
+	}
+	defer rows.Close()
+
+	rowIDs := make([]int64, 0, limit)
+	posts := make([]*feed.Post, 0, limit)
+	for rows.Next() {
+		var rowID int64
+		var post feed.Post
+		var tags []byte
+		err := rows.Scan(&rowID, &post.Source, &post.ID, &post.Author, &post.AvatarURL, &post.URL, &post.Title, &post.DescriptionHTML, &tags, &post.DateString, &post.Date)
+		if err != nil {
+			return nil, nil, fmt.Errorf("scan: %w", err)
+		}
+
+		err = json.Unmarshal(tags, &post.Tags)
+		if err != nil {
+			return nil, nil, fmt.Errorf("decode tags: %w", err)
+		}
+
+		rowIDs = append(rowIDs, rowID)
+		posts = append(posts, &post)
+	}
+
+	if rows.Err() != nil {
+		return nil, nil, fmt.Errorf("after scan: %w", rows.Err())
+	}
+
+	return rowIDs, posts, nil
+}
+
 // OpenCached returns a feed that is either already cached or one that will
 // cache the uncached in the database one as it is iterated through.
 func OpenCached(ctx context.Context, db *sql.DB, name string, uncachedFn feed.Open, search feed.Search) (feed.Feed, error) {
+	// full text posts would replace the summaries in the cache, so they are
+	// always fetched from the source.  if that fails the cached summaries
+	// are shown instead.
+	if search.Full {
+		f, err := uncachedFn(ctx, name, search)
+		if err == nil || ctx.Err() != nil {
+			return f, err
+		}
+
+		log.Printf("Error: opening %q with full text, falling back to the cache: %s", name, err)
+		search.Full = false
+	}
+
 	tx, err := db.BeginTx(ctx, &sql.TxOptions{ReadOnly: true})
 	if err != nil {
 		return nil, fmt.Errorf("begin tx: %w", err)
@@ -147,67 +920,134 @@ func OpenCached(ctx context.Context, db *sql.DB, name string, uncachedFn feed.Op
 	}()
 
 	// FIXME: cache non-canonical names correctly (e.g. oops@tumblr should be looked up as `oops`)
-	row := tx.QueryRowContext(ctx, "SELECT cached_at, url, description, error FROM feed_infos WHERE name = ?", name)
+	row := tx.QueryRowContext(ctx, "SELECT cached_at, url, description, error, cache_ttl, etag, last_modified FROM feed_infos WHERE name = ?", name)
 	var cachedAt time.Time
 	var url string
 	var description string
 	var feedError *string
-	err = row.Scan(&cachedAt, &url, &description, &feedError)
+	var cacheTTLSeconds int64
+	var etag, lastModified string
+	err = row.Scan(&cachedAt, &url, &description, &feedError, &cacheTTLSeconds, &etag, &lastModified)
 	if err != nil && err != sql.ErrNoRows {
 		return nil, fmt.Errorf("looking up feed: %w", err)
 	}
 
 	isCached := err != sql.ErrNoRows
+
+	cacheTTL := CacheTime
+	if cacheTTLSeconds > 0 {
+		cacheTTL = time.Duration(cacheTTLSeconds) * time.Second
+	}
+
+	limit := search.Limit
+	if limit <= 0 {
+		limit = feed.DefaultLimit
+	}
+	if limit > feed.MaxLimit {
+		limit = feed.MaxLimit
+	}
 	_, hasTimeout := ctx.Deadline()
 
+	// paging beyond the cached posts, so let the source fetch older ones if
+	// it can (e.g. tumblr.Open)
+	isBeyondCache := false
+	if isCached && search.BeforeID != "" {
+		var hasOlderPosts bool
+		err = tx.QueryRowContext(ctx, "SELECT EXISTS (SELECT 1 FROM posts WHERE author = ? AND id < ?)", name, search.BeforeID).Scan(&hasOlderPosts)
+		if err != nil {
+			return nil, fmt.Errorf("looking up older posts: %w", err)
+		}
+		isBeyondCache = !hasOlderPosts
+	}
+
 	origCtx := ctx
-	if !search.ForceFresh && !hasTimeout && isCached {
+	if !search.ForceFresh && !hasTimeout && isCached && !isBeyondCache {
 		// if we have the feed cached and the uncached one took too long, return the cached one
-		ctx, *cancel = context.WithTimeout(ctx, 150*time.Millisecond)
+		ctx, *cancel = context.WithTimeout(ctx, CachePreferTimeout)
 	}
 
-	if !search.ForceFresh && (isCached && time.Since(cachedAt) < CacheTime || feedError != nil && *feedError != "") {
+	if !search.ForceFresh && (isCached && !isBeyondCache && time.Since(cachedAt) < cacheTTL || feedError != nil && *feedError != "") {
 		notes := []string{"cached"}
 
+		// private feeds are only served if they used to be public, see below
+		if feedError != nil && errors.Is(storedError(*feedError), feed.ErrPrivate) {
+			var hasPosts bool
+			hasPosts, err = hasCachedPosts(ctx, tx, name)
+			if err != nil {
+				return nil, err
+			}
+			if !hasPosts {
+				return nil, storedError(*feedError)
+			}
+		}
+
+		// posts by the feed in the date range of the search
+		byAuthor, byAuthorArgs := "author = ?", []interface{}{name}
+		if !search.After.IsZero() {
+			byAuthor += " AND date >= ?"
+			byAuthorArgs = append(byAuthorArgs, search.After)
+		}
+		if !search.Before.IsZero() {
+			byAuthor += " AND date <= ?"
+			byAuthorArgs = append(byAuthorArgs, search.Before)
+		}
+		args := func(args ...interface{}) []interface{} {
+			return append(append([]interface{}{}, byAuthorArgs...), args...)
+		}
+
 		var rows *sql.Rows
 		if search.BeforeID != "" {
 			if search.NoReblogs {
 				notes = append(notes, "noreblogs")
-				rows, err = tx.QueryContext(ctx, `SELECT source, id, author, avatar_url, url, title, description_html, tags, date_string, date FROM posts WHERE author = ? AND id < ? AND description_html NOT LIKE '%class="tumblr_blog"%' ORDER BY id DESC LIMIT 20`, name, search.BeforeID)
+				rows, err = tx.QueryContext(ctx, `SELECT source, id, author, avatar_url, url, title, description_html, tags, date_string, date FROM posts WHERE `+byAuthor+` AND id < ? AND description_html NOT LIKE '%class="tumblr_blog"%' ORDER BY id DESC LIMIT ?`, args(search.BeforeID, limit)...)
+			} else if !search.BeforeDate.IsZero() {
+				// stable cursor, posts with the same date are ordered by id
+				rows, err = tx.QueryContext(ctx, "SELECT source, id, author, avatar_url, url, title, description_html, tags, date_string, date FROM posts WHERE "+byAuthor+" AND (date < ? OR (date = ? AND ("+idLength+" < ? OR ("+idLength+" = ? AND id < ?)))) ORDER BY date DESC, "+idLength+" DESC, id DESC LIMIT ?", args(search.BeforeDate, search.BeforeDate, idLengthOf(search.BeforeID), idLengthOf(search.BeforeID), search.BeforeID, limit)...)
 			} else {
-				rows, err = tx.QueryContext(ctx, "SELECT source, id, author, avatar_url, url, title, description_html, tags, date_string, date FROM posts WHERE author = ? AND date < (SELECT date FROM posts WHERE author = ? AND  id < ? ORDER BY id DESC) AND id < ? ORDER BY date DESC LIMIT 20", name, name, search.BeforeID, search.BeforeID)
+				rows, err = tx.QueryContext(ctx, "SELECT source, id, author, avatar_url, url, title, description_html, tags, date_string, date FROM posts WHERE "+byAuthor+" AND date < (SELECT date FROM posts WHERE author = ? AND  id < ? ORDER BY id DESC) AND id < ? ORDER BY date DESC, "+idLength+" DESC, id DESC LIMIT ?", args(name, search.BeforeID, search.BeforeID, limit)...)
 			}
 		} else if len(search.Terms) > 0 {
 			notes = append(notes, "search")
 
 			match := "%" + search.Terms[0] + "%"
-			rows, err = tx.QueryContext(ctx, "SELECT source, id, author, avatar_url, url, title, description_html, tags, date_string, date FROM posts WHERE author = ? AND (title LIKE ? OR description_html LIKE ? OR tags LIKE ?) ORDER BY date DESC LIMIT 20", name, match, match, match)
+			rows, err = tx.QueryContext(ctx, "SELECT source, id, author, avatar_url, url, title, description_html, tags, date_string, date FROM posts WHERE "+byAuthor+" AND (title LIKE ? OR description_html LIKE ? OR tags LIKE ?) ORDER BY date DESC, "+idLength+" DESC, id DESC LIMIT ?", args(match, match, match, limit)...)
 		} else if len(search.Tags) > 0 {
 			notes = append(notes, "tags")
-			// TODO: support filtering for multiple tags at once
-			rows, err = tx.QueryContext(ctx, "SELECT source, id, author, avatar_url, url, title, description_html, tags, date_string, date FROM posts WHERE author = ? AND (tags LIKE ?) ORDER BY date DESC LIMIT 20", name, "%"+search.Tags[0]+"%")
+
+			// must match all tags, like feed.Search.Matches
+			stmt := "SELECT source, id, author, avatar_url, url, title, description_html, tags, date_string, date FROM posts WHERE " + byAuthor
+			tagArgs := args()
+			for _, tag := range search.Tags {
+				stmt += ` AND tags LIKE ? ESCAPE '\'`
+				tagArgs = append(tagArgs, tagPattern(tag))
+			}
+			stmt += " ORDER BY date DESC, " + idLength + " DESC, id DESC LIMIT ?"
+			tagArgs = append(tagArgs, limit)
+			rows, err = tx.QueryContext(ctx, stmt, tagArgs...)
 		} else {
 			if search.NoReblogs {
 				notes = append(notes, "noreblogs")
-				rows, err = tx.QueryContext(ctx, `SELECT source, id, author, avatar_url, url, title, description_html, tags, date_string, date FROM posts WHERE author = ? AND description_html NOT LIKE '%class="tumblr_blog"%' ORDER BY date DESC LIMIT 20`, name)
+				rows, err = tx.QueryContext(ctx, `SELECT source, id, author, avatar_url, url, title, description_html, tags, date_string, date FROM posts WHERE `+byAuthor+` AND description_html NOT LIKE '%class="tumblr_blog"%' ORDER BY date DESC, `+idLength+` DESC, id DESC LIMIT ?`, args(limit)...)
 			} else {
-				rows, err = tx.QueryContext(ctx, "SELECT source, id, author, avatar_url, url, title, description_html, tags, date_string, date FROM posts WHERE author = ? ORDER BY date DESC LIMIT 20", name)
+				rows, err = tx.QueryContext(ctx, "SELECT source, id, author, avatar_url, url, title, description_html, tags, date_string, date FROM posts WHERE "+byAuthor+" ORDER BY date DESC, "+idLength+" DESC, id DESC LIMIT ?", args(limit)...)
 			}
 		}
 		if err != nil {
 			return nil, fmt.Errorf("querying posts: %w", err)
 		}
 
+		var cachedErr error
 		if feedError != nil && *feedError != "" {
 			notes = []string{fmt.Sprintf("cached-by-error: %s", *feedError)}
+			cachedErr = storedError(*feedError)
 		}
 		needsCleanupNow = false
-		return &databaseCached{name: name, description: description, url: url, rows: rows, cancel: cleanup, notes: notes}, nil
+		return &databaseCached{name: name, description: description, url: url, rows: rows, cancel: cleanup, notes: notes, err: cachedErr}, nil
 	}
 
 	if name == "random" {
 		var rows *sql.Rows
-		rows, err = tx.QueryContext(ctx, "SELECT source, id, author, avatar_url, url, title, description_html, tags, date_string, date FROM posts WHERE author IN (SELECT name FROM feed_infos ORDER BY RANDOM() LIMIT 20) GROUP BY author ORDER BY RANDOM() LIMIT 20", name)
+		rows, err = tx.QueryContext(ctx, "SELECT source, id, author, avatar_url, url, title, description_html, tags, date_string, date FROM posts WHERE author IN (SELECT name FROM feed_infos ORDER BY RANDOM() LIMIT 20) GROUP BY author ORDER BY RANDOM() LIMIT ?", limit)
 		if err != nil {
 			return nil, fmt.Errorf("querying posts: %w", err)
 		}
@@ -217,12 +1057,33 @@ func OpenCached(ctx context.Context, db *sql.DB, name string, uncachedFn feed.Op
 
 	}
 
+	// the source only has to send the feed again if it changed
+	if isCached && !isBeyondCache && (feedError == nil || *feedError == "") {
+		search.IfNoneMatch = etag
+		search.IfModifiedSince = lastModified
+	}
+
 	var uncachedFeed feed.Feed
-	uncachedFeed, err = uncachedFn(ctx, name, search)
+	uncachedFeed, err = openShared(ctx, name, uncachedFn, search)
 
 	// cancel first timeout
 	(*cancel)()
 
+	if errors.Is(err, feed.ErrNotModified) {
+		cleanup()
+		needsCleanupNow = false
+
+		err = touchFeed(origCtx, db, name)
+		if err != nil {
+			return nil, err
+		}
+
+		// the cached posts are fresh again
+		search.ForceFresh = false
+		search.IfNoneMatch, search.IfModifiedSince = "", ""
+		return OpenCached(origCtx, db, name, uncachedFn, search)
+	}
+
 	if err != nil {
 		fallbackCtx := origCtx
 		cancel = &emptyCancel
@@ -236,9 +1097,9 @@ func OpenCached(ctx context.Context, db *sql.DB, name string, uncachedFn feed.Op
 			var rows *sql.Rows
 			var err error
 			if search.BeforeID != "" {
-				rows, err = tx.QueryContext(fallbackCtx, "SELECT source, id, author, avatar_url, url, title, description_html, tags, date_string, date FROM posts WHERE author = ? AND id < ? ORDER BY date DESC LIMIT 20", name, search.BeforeID)
+				rows, err = tx.QueryContext(fallbackCtx, "SELECT source, id, author, avatar_url, url, title, description_html, tags, date_string, date FROM posts WHERE author = ? AND id < ? ORDER BY date DESC, "+idLength+" DESC, id DESC LIMIT ?", name, search.BeforeID, limit)
 			} else {
-				rows, err = tx.QueryContext(fallbackCtx, "SELECT source, id, author, avatar_url, url, title, description_html, tags, date_string, date FROM posts WHERE author = ? ORDER BY date DESC LIMIT 20", name)
+				rows, err = tx.QueryContext(fallbackCtx, "SELECT source, id, author, avatar_url, url, title, description_html, tags, date_string, date FROM posts WHERE author = ? ORDER BY date DESC, "+idLength+" DESC, id DESC LIMIT ?", name, limit)
 			}
 			if err != nil {
 				return nil, fmt.Errorf("querying posts: %w", err)
@@ -269,7 +1130,7 @@ func OpenCached(ctx context.Context, db *sql.DB, name string, uncachedFn feed.Op
 
 			// TODO: do not store in table if things don't exist ("no such host")
 			// TODO: remove from table if "invalid"?  (difficult to do, don't want to loose valid feeds => check if we have content, let remain if posts exist?)
-			_, updateErr = updateTx.ExecContext(ctx, `INSERT OR REPLACE INTO feed_infos VALUES (?, ?, ?, ?, ?)`, name, url, time.Now(), description, err.Error())
+			_, updateErr = updateTx.ExecContext(ctx, `INSERT INTO feed_infos (name, url, cached_at, description, error) VALUES (?, ?, ?, ?, ?) ON CONFLICT (name) DO UPDATE SET url = excluded.url, cached_at = excluded.cached_at, description = excluded.description, error = excluded.error`, name, url, time.Now(), description, err.Error())
 			if updateErr != nil {
 				updateErr = fmt.Errorf("update feed_infos after error: %w", updateErr)
 				log.Printf("Error: %s", updateErr)
@@ -283,20 +1144,40 @@ func OpenCached(ctx context.Context, db *sql.DB, name string, uncachedFn feed.Op
 		}()
 
 		var statusErr feed.StatusError
-		if ok := errors.As(err, &statusErr); ok && statusErr.Code == http.StatusNotFound {
+		isNotFound := errors.As(err, &statusErr) && statusErr.Code == http.StatusNotFound
+
+		// feeds that became private are served from the cache like feeds
+		// that don't exist anymore
+		isPrivate := false
+		if isCached && errors.Is(err, feed.ErrPrivate) {
+			var lookupErr error
+			isPrivate, lookupErr = hasCachedPosts(fallbackCtx, tx, name)
+			if lookupErr != nil {
+				return nil, lookupErr
+			}
+		}
+
+		if isNotFound || isPrivate {
+			notes := []string{"not-found"}
+			var feedErr error = statusErr
+			if isPrivate {
+				notes = []string{"private"}
+				feedErr = err
+			}
+
 			var rows *sql.Rows
 			var err error
 			if search.BeforeID != "" {
-				rows, err = tx.QueryContext(fallbackCtx, "SELECT source, id, author, avatar_url, url, title, description_html, tags, date_string, date FROM posts WHERE author = ? AND id < ? ORDER BY date DESC LIMIT 20", name, search.BeforeID)
+				rows, err = tx.QueryContext(fallbackCtx, "SELECT source, id, author, avatar_url, url, title, description_html, tags, date_string, date FROM posts WHERE author = ? AND id < ? ORDER BY date DESC, "+idLength+" DESC, id DESC LIMIT ?", name, search.BeforeID, limit)
 			} else {
-				rows, err = tx.QueryContext(fallbackCtx, "SELECT source, id, author, avatar_url, url, title, description_html, tags, date_string, date FROM posts WHERE author = ? ORDER BY date DESC LIMIT 20", name)
+				rows, err = tx.QueryContext(fallbackCtx, "SELECT source, id, author, avatar_url, url, title, description_html, tags, date_string, date FROM posts WHERE author = ? ORDER BY date DESC, "+idLength+" DESC, id DESC LIMIT ?", name, limit)
 			}
 			if err != nil {
 				return nil, fmt.Errorf("querying posts: %w", err)
 			}
 
 			needsCleanupNow = false
-			return &databaseCached{name: name, description: description, url: url, outOfDate: true, rows: rows, cancel: cleanup, notes: []string{"not-found"}}, nil
+			return &databaseCached{name: name, description: description, url: url, outOfDate: true, rows: rows, cancel: cleanup, notes: notes, err: feedErr}, nil
 		}
 
 		return nil, fmt.Errorf("open uncached: %w", err)
@@ -310,6 +1191,156 @@ func OpenCached(ctx context.Context, db *sql.DB, name string, uncachedFn feed.Op
 	}, nil
 }
 
+// openGroup coalesces concurrent uncached opens of the same feed.
+var openGroup singleflight.Group
+
+// SharedOpenTimeout is how long an uncached open that is shared by
+// concurrent requests may take at most, independent of the requests.
+// Sources usually time out earlier, see anything.Timeout.
+var SharedOpenTimeout = 1 * time.Minute
+
+// openShared opens the uncached feed, sharing the result with all concurrent
+// opens of the same feed with the same search so that only one request is
+// made upstream.  This includes the validators (see feed.Validators), which
+// only callers that have the feed cached send: a caller without a cache must
+// never get feed.ErrNotModified from another caller's conditional request.
+//
+// Because feeds can only be iterated once, the posts are read into a snapshot
+// and every caller gets its own copy of it.  Paginatable feeds get the cursor
+// before that, so that they fetch the right page from upstream.  The snapshot has up to
+// search.Limit posts after the cursor, as many as the callers read.
+//
+// The feed is opened independently of `ctx`, so that one caller giving up
+// does not fail the others.
+func openShared(ctx context.Context, name string, uncachedFn feed.Open, search feed.Search) (feed.Feed, error) {
+	key, err := json.Marshal(search)
+	if err != nil {
+		return nil, fmt.Errorf("shared open key: %w", err)
+	}
+
+	resCh := openGroup.DoChan(name+"\x00"+string(key), func() (interface{}, error) {
+		ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), SharedOpenTimeout)
+		defer cancel()
+
+		uncached, err := uncachedFn(ctx, name, search)
+		if err != nil {
+			return nil, err
+		}
+		defer func() {
+			closeErr := uncached.Close()
+			if closeErr != nil {
+				log.Printf("Error: closing %s: %s", name, closeErr)
+			}
+		}()
+
+		if paginatable, ok := uncached.(feed.Paginatable); ok && search.BeforeID != "" {
+			paginatable.SetCursor(search.BeforeID)
+		}
+
+		limit := search.Limit
+		if limit <= 0 {
+			limit = feed.DefaultLimit
+		}
+		if limit > feed.MaxLimit {
+			limit = feed.MaxLimit
+		}
+
+		snapshot := &feed.Static{
+			FeedName:        uncached.Name(),
+			FeedURL:         uncached.URL(),
+			FeedDescription: uncached.Description(),
+			Posts:           make([]feed.Post, 0, limit),
+		}
+		if withTTL, ok := uncached.(feed.CacheTTL); ok {
+			snapshot.FeedCacheTTL = withTTL.CacheTTL()
+		}
+		if withValidators, ok := uncached.(feed.Validators); ok {
+			snapshot.FeedETag = withValidators.ETag()
+			snapshot.FeedLastModified = withValidators.LastModified()
+		}
+
+		found := 0
+		post, err := uncached.Next()
+		for err == nil {
+			snapshot.Posts = append(snapshot.Posts, *post)
+			if search.IsAfterCursor(post) {
+				found++
+				if found >= limit {
+					break
+				}
+			}
+			post, err = uncached.Next()
+		}
+		if err != nil && !errors.Is(err, io.EOF) {
+			if len(snapshot.Posts) == 0 {
+				return nil, err
+			}
+			log.Printf("Error: reading %s: %s", name, err)
+		}
+
+		return snapshot, nil
+	})
+
+	var res singleflight.Result
+	select {
+	case res = <-resCh:
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+	if res.Err != nil {
+		return nil, res.Err
+	}
+
+	snapshot := res.Val.(*feed.Static)
+	posts := make([]feed.Post, len(snapshot.Posts))
+	copy(posts, snapshot.Posts)
+	return &feed.Static{
+		FeedName:         snapshot.FeedName,
+		FeedURL:          snapshot.FeedURL,
+		FeedDescription:  snapshot.FeedDescription,
+		FeedCacheTTL:     snapshot.FeedCacheTTL,
+		FeedETag:         snapshot.FeedETag,
+		FeedLastModified: snapshot.FeedLastModified,
+		Posts:            posts,
+	}, nil
+}
+
+// touchFeed marks the cached feed `name` as fresh, e.g. because its source
+// said it did not change.
+func touchFeed(ctx context.Context, db *sql.DB, name string) error {
+	now := time.Now()
+	_, err := db.ExecContext(ctx, `UPDATE feed_infos SET cached_at = ?, last_success_at = ?, error = '' WHERE name = ?`, now, now, name)
+	if err != nil {
+		return fmt.Errorf("update feed_infos: %w", err)
+	}
+	return nil
+}
+
+// tagPattern returns a LIKE pattern that matches the JSON-encoded tags of
+// posts containing `tag`.
+//
+// The tag is matched including its quotes so that e.g. `art` does not match
+// `artist`.
+func tagPattern(tag string) string {
+	// strings can always be encoded
+	quoted, _ := json.Marshal(tag)
+	return "%" + likeEscaper.Replace(string(quoted)) + "%"
+}
+
+// likeEscaper escapes the wildcards of LIKE patterns that use `ESCAPE '\'`.
+var likeEscaper = strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`)
+
+// hasCachedPosts returns true if there are posts of the feed `name` in the
+// cache.
+func hasCachedPosts(ctx context.Context, tx *sql.Tx, name string) (bool, error) {
+	var hasPosts bool
+	err := tx.QueryRowContext(ctx, "SELECT EXISTS (SELECT 1 FROM posts WHERE author = ?)", name).Scan(&hasPosts)
+	if err != nil {
+		return false, fmt.Errorf("looking up posts: %w", err)
+	}
+	return hasPosts, nil
+}
+
 func isTimeoutError(err error) bool {
 	if strings.Contains(err.Error(), "Temporary failure in name resolution") {
 		return true
@@ -398,18 +1429,47 @@ func (ct *databaseCaching) Save() error {
 		}
 
 		stmt += "(?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?), "
-		vals = append(vals, post.Source, ct.uncached.Name(), post.ID, post.Author, post.AvatarURL, post.URL, post.Title, post.DescriptionHTML, tagsJSON, post.DateString, post.Date)
+		vals = append(vals, post.Source, ct.uncached.Name(), post.ID, post.Author, post.AvatarURL, post.URL, post.Title, storedDescription(post), tagsJSON, post.DateString, post.Date)
 	}
 
 	// trim last comma and space
 	stmt = stmt[:len(stmt)-2]
 
+	if hasFullTextSearch {
+		// replaced posts get a new rowid
+		for _, post := range ct.posts {
+			_, err = tx.Exec(`DELETE FROM posts_fts WHERE rowid IN (SELECT rowid FROM posts WHERE source = ? AND name = ? AND id = ?)`, post.Source, ct.uncached.Name(), post.ID)
+			if err != nil {
+				return fmt.Errorf("update posts index: %w", err)
+			}
+		}
+	}
+
 	_, err = tx.Exec(stmt, vals...)
 	if err != nil {
 		return fmt.Errorf("update posts: %w", err)
 	}
 
-	res, err := tx.Exec(`INSERT OR REPLACE INTO feed_infos VALUES (?, ?, ?, ?, ?)`, ct.uncached.Name(), ct.uncached.URL(), ct.cachedAt, ct.uncached.Description(), "")
+	if hasFullTextSearch {
+		for _, post := range ct.posts {
+			_, err = tx.Exec(`INSERT INTO posts_fts (rowid, title, description_html, tags) SELECT rowid, title, description_html, tags FROM posts WHERE source = ? AND name = ? AND id = ?`, post.Source, ct.uncached.Name(), post.ID)
+			if err != nil {
+				return fmt.Errorf("update posts index: %w", err)
+			}
+		}
+	}
+
+	var cacheTTL time.Duration
+	if withTTL, ok := ct.uncached.(feed.CacheTTL); ok {
+		cacheTTL = withTTL.CacheTTL()
+	}
+
+	var etag, lastModified string
+	if withValidators, ok := ct.uncached.(feed.Validators); ok {
+		etag, lastModified = withValidators.ETag(), withValidators.LastModified()
+	}
+
+	res, err := tx.Exec(`INSERT INTO feed_infos (name, url, cached_at, description, error, cache_ttl, etag, last_modified, last_success_at) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?) ON CONFLICT (name) DO UPDATE SET url = excluded.url, cached_at = excluded.cached_at, description = excluded.description, error = excluded.error, cache_ttl = excluded.cache_ttl, etag = excluded.etag, last_modified = excluded.last_modified, last_success_at = excluded.last_success_at`, ct.uncached.Name(), ct.uncached.URL(), ct.cachedAt, ct.uncached.Description(), "", int64(cacheTTL/time.Second), etag, lastModified, ct.cachedAt)
 	if err != nil {
 		return fmt.Errorf("update feed_infos: %w", err)
 	}
@@ -446,15 +1506,34 @@ func (ct *databaseCaching) Save() error {
 	return nil
 }
 
+// storedDescription returns the html of the post as it is stored, truncated
+// to MaxDescriptionSize.
+func storedDescription(post *feed.Post) string {
+	if MaxDescriptionSize <= 0 || len(post.DescriptionHTML) <= MaxDescriptionSize {
+		return post.DescriptionHTML
+	}
+
+	note := `<p class="truncated"><small>truncated</small></p>`
+	if post.URL != "" {
+		note = fmt.Sprintf(`<p class="truncated"><small>truncated — <a href="%s">view original</a></small></p>`, html.EscapeString(post.URL))
+	}
+
+	truncated, _ := feed.TruncateHTML(post.DescriptionHTML, MaxDescriptionSize-len(note))
+	return truncated + note
+}
+
 type databaseCached struct {
 	name        string
 	description string
 	url         string
 	outOfDate   bool
 	notes       []string
-	rows        *sql.Rows
-	cancel      func()
-	lastPost    *feed.Post
+	// err is why the feed could not be fetched from its source, if it
+	// could not be.
+	err      error
+	rows     *sql.Rows
+	cancel   func()
+	lastPost *feed.Post
 }
 
 func (dc *databaseCached) Name() string {
@@ -476,6 +1555,52 @@ func (dc *databaseCached) Notes() string {
 	return strings.Join(dc.notes, ",")
 }
 
+// FeedError returns why the feed `f` returned by OpenCached could not be
+// fetched from its source, or nil if it could be or if it was not tried.
+func FeedError(f feed.Feed) error {
+	cached, ok := f.(*databaseCached)
+	if !ok {
+		return nil
+	}
+	return cached.err
+}
+
+// storedError turns an error that was stored in the database back into an
+// error, so that errors.Is works for the errors that are handled specially.
+func storedError(msg string) error {
+	if strings.HasSuffix(msg, feed.ErrPrivate.Error()) {
+		return fmt.Errorf("%s: %w", strings.TrimSuffix(strings.TrimSuffix(msg, feed.ErrPrivate.Error()), ": "), feed.ErrPrivate)
+	}
+	return errors.New(msg)
+}
+
+// How OpenCached served a feed, see CacheResult.
+const (
+	ResultCached = "cached"
+	ResultLive   = "live"
+	ResultStale  = "stale"
+	ResultError  = "error"
+)
+
+// CacheResult returns how the feed `f` (and `err`) returned by OpenCached
+// was served: from the cache, live from the source, from the cache as a
+// fallback because the source failed or was too slow, or not at all.
+func CacheResult(f feed.Feed, err error) string {
+	if err != nil {
+		return ResultError
+	}
+
+	cached, ok := f.(*databaseCached)
+	if !ok {
+		return ResultLive
+	}
+
+	if cached.outOfDate || strings.HasPrefix(cached.Notes(), "cached-by-error") {
+		return ResultStale
+	}
+	return ResultCached
+}
+
 func (dc *databaseCached) Next() (*feed.Post, error) {
 	if !dc.rows.Next() {
 		if dc.rows.Err() != nil {
@@ -500,6 +1625,9 @@ func (dc *databaseCached) Next() (*feed.Post, error) {
 	if dc.outOfDate {
 		post.Tags = append(post.Tags, "numblr:out-of-date")
 	}
+	if errors.Is(dc.err, feed.ErrPrivate) {
+		post.Tags = append(post.Tags, "numblr:private")
+	}
 
 	dc.lastPost = &post
 	return &post, nil
@@ -1,14 +1,18 @@
 package database
 
 import (
+	"bytes"
 	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
 	"math/rand"
 	"net"
 	"path"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
@@ -100,9 +104,1165 @@ func TestConcurrentWrites(t *testing.T) {
 	wg.Wait()
 }
 
+func TestConcurrentOpensAreShared(t *testing.T) {
+	db, err := InitDatabase(path.Join(t.TempDir(), "cache.db"))
+	require.NoError(t, err)
+	defer db.Close()
+
+	var upstreamCalls int32
+	open := func(ctx context.Context, name string, _ feed.Search) (feed.Feed, error) {
+		atomic.AddInt32(&upstreamCalls, 1)
+		time.Sleep(200 * time.Millisecond)
+		return &feed.Static{FeedName: name, Posts: []feed.Post{
+			{Source: "tumblr", ID: "2", Author: name},
+			{Source: "tumblr", ID: "1", Author: name},
+		}}, nil
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			f, err := OpenCached(context.Background(), db, "popular", open, feed.Search{ForceFresh: true})
+			require.NoError(t, err)
+			defer f.Close()
+
+			n := 0
+			_, err = f.Next()
+			for err == nil {
+				n++
+				_, err = f.Next()
+			}
+			require.ErrorIs(t, err, io.EOF)
+			require.Equal(t, 2, n, "every open should see all posts")
+		}()
+	}
+	wg.Wait()
+
+	require.Equal(t, int32(1), atomic.LoadInt32(&upstreamCalls), "upstream calls")
+}
+
+func TestOpenShared(t *testing.T) {
+	release := make(chan bool)
+	var upstreamCalls int32
+	open := func(ctx context.Context, name string, search feed.Search) (feed.Feed, error) {
+		atomic.AddInt32(&upstreamCalls, 1)
+		<-release
+		if search.IfNoneMatch != "" {
+			return nil, feed.ErrNotModified
+		}
+
+		posts := make([]feed.Post, 0, 30)
+		for i := 0; i < 30; i++ {
+			posts = append(posts, feed.Post{Source: "tumblr", ID: fmt.Sprintf("%03d", 100-i), Author: name})
+		}
+		return &feed.Static{FeedName: name, Posts: posts}, nil
+	}
+
+	type result struct {
+		posts int
+		err   error
+	}
+	openAsync := func(ctx context.Context, search feed.Search) chan result {
+		resCh := make(chan result, 1)
+		go func() {
+			f, err := openShared(ctx, "shared", open, search)
+			if err != nil {
+				resCh <- result{err: err}
+				return
+			}
+			defer f.Close()
+
+			n := 0
+			_, err = f.Next()
+			for err == nil {
+				n++
+				_, err = f.Next()
+			}
+			resCh <- result{posts: n}
+		}()
+		return resCh
+	}
+
+	cancelled, cancel := context.WithCancel(context.Background())
+	first := openAsync(cancelled, feed.Search{Limit: 5})
+	require.Eventually(t, func() bool { return atomic.LoadInt32(&upstreamCalls) == 1 }, time.Second, time.Millisecond)
+	second := openAsync(context.Background(), feed.Search{Limit: 5})
+	more := openAsync(context.Background(), feed.Search{Limit: 25})
+	conditional := openAsync(context.Background(), feed.Search{Limit: 5, IfNoneMatch: `"abc"`})
+	require.Eventually(t, func() bool { return atomic.LoadInt32(&upstreamCalls) == 3 }, time.Second, time.Millisecond, "shared by searches")
+
+	cancel()
+	require.ErrorIs(t, (<-first).err, context.Canceled, "cancelled caller")
+
+	close(release)
+	require.Equal(t, result{posts: 5}, <-second, "not failed by the cancelled caller")
+	require.Equal(t, result{posts: 25}, <-more, "own limit")
+	require.ErrorIs(t, (<-conditional).err, feed.ErrNotModified, "conditional")
+}
+
 func fakeOpen(ctx context.Context, name string, _ feed.Search) (feed.Feed, error) {
 	time.Sleep(100 * time.Millisecond)
 	return &feed.Static{Posts: []feed.Post{
 		{ID: "xyz", Author: name},
 	}}, nil
 }
+
+func TestReprocess(t *testing.T) {
+	db, err := InitDatabase(path.Join(t.TempDir(), "cache.db"))
+	require.NoError(t, err)
+	defer db.Close()
+
+	open := func(ctx context.Context, name string, _ feed.Search) (feed.Feed, error) {
+		return &feed.Static{FeedName: name, Posts: []feed.Post{
+			{Source: "tumblr", ID: "1", Author: name, DescriptionHTML: "old"},
+			{Source: "tumblr", ID: "2", Author: name, DescriptionHTML: "new"},
+			{Source: "web", ID: "3", Author: name, DescriptionHTML: "old"},
+		}}, nil
+	}
+
+	f, err := OpenCached(context.Background(), db, "staff", open, feed.Search{ForceFresh: true})
+	require.NoError(t, err)
+	_, err = f.Next()
+	for err == nil {
+		_, err = f.Next()
+	}
+	require.ErrorIs(t, err, io.EOF)
+	require.NoError(t, f.Close())
+
+	updated, err := Reprocess(context.Background(), db, "tumblr", 1, func(post *feed.Post) error {
+		post.DescriptionHTML = "new"
+		return nil
+	})
+	require.NoError(t, err)
+	require.Equal(t, 1, updated, "updated posts")
+
+	var numOld int
+	err = db.QueryRow(`SELECT COUNT(*) FROM posts WHERE description_html = 'old'`).Scan(&numOld)
+	require.NoError(t, err)
+	require.Equal(t, 1, numOld, "other sources should not be reprocessed")
+}
+
+func TestMaxDescriptionSize(t *testing.T) {
+	db, err := InitDatabase(path.Join(t.TempDir(), "cache.db"))
+	require.NoError(t, err)
+	defer db.Close()
+
+	MaxDescriptionSize = 1024
+	defer func() {
+		MaxDescriptionSize = 256 * 1024
+	}()
+
+	oversized := `<p>start</p>` + strings.Repeat(`<blockquote><p>reblog</p>`, 500) + strings.Repeat(`</blockquote>`, 500)
+	open := func(ctx context.Context, name string, _ feed.Search) (feed.Feed, error) {
+		return &feed.Static{FeedName: name, Posts: []feed.Post{
+			{Source: "tumblr", ID: "1", Author: name, URL: "https://staff.tumblr.com/post/1", DescriptionHTML: oversized},
+			{Source: "tumblr", ID: "2", Author: name, DescriptionHTML: "<p>small</p>"},
+		}}, nil
+	}
+
+	f, err := OpenCached(context.Background(), db, "staff", open, feed.Search{ForceFresh: true})
+	require.NoError(t, err)
+	post, err := f.Next()
+	require.NoError(t, err)
+	require.Equal(t, oversized, post.DescriptionHTML, "shown in full when fetched")
+	for err == nil {
+		_, err = f.Next()
+	}
+	require.ErrorIs(t, err, io.EOF)
+	require.NoError(t, f.Close())
+
+	var stored string
+	require.NoError(t, db.QueryRow(`SELECT description_html FROM posts WHERE id = '1'`).Scan(&stored))
+	require.LessOrEqual(t, len(stored), 1024, "stored size")
+	require.True(t, strings.HasPrefix(stored, `<p>start</p><blockquote><p>reblog</p>`), "start is kept: %s", stored)
+	require.True(t, strings.HasSuffix(stored, `<p class="truncated"><small>truncated — <a href="https://staff.tumblr.com/post/1">view original</a></small></p>`), "note: %s", stored)
+
+	require.NoError(t, db.QueryRow(`SELECT description_html FROM posts WHERE id = '2'`).Scan(&stored))
+	require.Equal(t, "<p>small</p>", stored, "small posts are stored as is")
+}
+
+func TestStreamPosts(t *testing.T) {
+	db, err := InitDatabase(path.Join(t.TempDir(), "cache.db"))
+	require.NoError(t, err)
+	defer db.Close()
+
+	open := func(ctx context.Context, name string, _ feed.Search) (feed.Feed, error) {
+		return &feed.Static{FeedName: name, Posts: []feed.Post{
+			{Source: "tumblr", ID: "2", Author: name, Tags: []string{"two"}, Date: time.Date(2022, time.June, 2, 0, 0, 0, 0, time.UTC)},
+			{Source: "tumblr", ID: "1", Author: name, Tags: []string{"one"}, Date: time.Date(2022, time.June, 1, 0, 0, 0, 0, time.UTC)},
+		}}, nil
+	}
+
+	f, err := OpenCached(context.Background(), db, "staff", open, feed.Search{ForceFresh: true})
+	require.NoError(t, err)
+	_, err = f.Next()
+	for err == nil {
+		_, err = f.Next()
+	}
+	require.NoError(t, f.Close())
+
+	buf := new(bytes.Buffer)
+	err = StreamPosts(context.Background(), db, "staff", buf)
+	require.NoError(t, err)
+
+	dec := json.NewDecoder(buf)
+	ids := make([]string, 0, 2)
+	for dec.More() {
+		var post feed.Post
+		require.NoError(t, dec.Decode(&post))
+		ids = append(ids, post.ID)
+	}
+	require.Equal(t, []string{"2", "1"}, ids)
+}
+
+func TestCachedLimit(t *testing.T) {
+	db, err := InitDatabase(path.Join(t.TempDir(), "cache.db"))
+	require.NoError(t, err)
+	defer db.Close()
+
+	CacheTime = 10 * time.Minute
+
+	open := func(ctx context.Context, name string, _ feed.Search) (feed.Feed, error) {
+		posts := make([]feed.Post, 0, 30)
+		for i := 0; i < 30; i++ {
+			posts = append(posts, feed.Post{Source: "tumblr", ID: fmt.Sprintf("%03d", 100-i), Author: name, Date: time.Now().Add(-time.Duration(i) * time.Minute)})
+		}
+		return &feed.Static{FeedName: name, Posts: posts}, nil
+	}
+
+	countPosts := func(search feed.Search) int {
+		f, err := OpenCached(context.Background(), db, "staff", open, search)
+		require.NoError(t, err)
+		defer f.Close()
+
+		n := 0
+		_, err = f.Next()
+		for err == nil {
+			n++
+			_, err = f.Next()
+		}
+		require.ErrorIs(t, err, io.EOF)
+		return n
+	}
+
+	require.Equal(t, 30, countPosts(feed.Search{ForceFresh: true, Limit: 30}), "uncached")
+	require.Equal(t, feed.DefaultLimit, countPosts(feed.Search{}), "cached, default limit")
+	require.Equal(t, 25, countPosts(feed.Search{Limit: 25}), "cached, requested limit")
+}
+
+func TestCachedTags(t *testing.T) {
+	db, err := InitDatabase(path.Join(t.TempDir(), "cache.db"))
+	require.NoError(t, err)
+	defer db.Close()
+
+	CacheTime = 10 * time.Minute
+
+	now := time.Now()
+	open := func(ctx context.Context, name string, _ feed.Search) (feed.Feed, error) {
+		return &feed.Static{FeedName: name, Posts: []feed.Post{
+			{Source: "tumblr", ID: "5", Author: name, Tags: []string{"art", "wip"}, Date: now},
+			{Source: "tumblr", ID: "4", Author: name, Tags: []string{"artist", "wip"}, Date: now.Add(-1 * time.Minute)},
+			{Source: "tumblr", ID: "3", Author: name, Tags: []string{"art"}, Date: now.Add(-2 * time.Minute)},
+			{Source: "tumblr", ID: "2", Author: name, Tags: []string{"100% art"}, Date: now.Add(-3 * time.Minute)},
+			{Source: "tumblr", ID: "1", Author: name, Tags: []string{"100x art", "wip"}, Date: now.Add(-4 * time.Minute)},
+		}}, nil
+	}
+
+	ids := func(search feed.Search) []string {
+		f, err := OpenCached(context.Background(), db, "staff", open, search)
+		require.NoError(t, err)
+		defer f.Close()
+
+		var ids []string
+		post, err := f.Next()
+		for err == nil {
+			ids = append(ids, post.ID)
+			post, err = f.Next()
+		}
+		require.ErrorIs(t, err, io.EOF)
+		return ids
+	}
+
+	require.Len(t, ids(feed.Search{ForceFresh: true}), 5, "uncached")
+	require.Equal(t, []string{"5", "3"}, ids(feed.Search{Tags: []string{"art"}}), "whole tags only")
+	require.Equal(t, []string{"5"}, ids(feed.Search{Tags: []string{"art", "wip"}}), "all tags")
+	require.Equal(t, []string{"2"}, ids(feed.Search{Tags: []string{"100% art"}}), "escaped")
+}
+
+func TestCachedDateRange(t *testing.T) {
+	db, err := InitDatabase(path.Join(t.TempDir(), "cache.db"))
+	require.NoError(t, err)
+	defer db.Close()
+
+	CacheTime = 10 * time.Minute
+
+	open := func(ctx context.Context, name string, _ feed.Search) (feed.Feed, error) {
+		posts := make([]feed.Post, 0, 12)
+		for month := 12; month >= 1; month-- {
+			posts = append(posts, feed.Post{Source: "tumblr", ID: fmt.Sprintf("%03d", month), Author: name, Tags: []string{"art"}, Date: time.Date(2023, time.Month(month), 15, 12, 0, 0, 0, time.UTC)})
+		}
+		return &feed.Static{FeedName: name, Posts: posts}, nil
+	}
+
+	ids := func(search feed.Search) []string {
+		f, err := OpenCached(context.Background(), db, "staff", open, search)
+		require.NoError(t, err)
+		defer f.Close()
+
+		var ids []string
+		post, err := f.Next()
+		for err == nil {
+			ids = append(ids, post.ID)
+			post, err = f.Next()
+		}
+		require.ErrorIs(t, err, io.EOF)
+		return ids
+	}
+
+	require.Len(t, ids(feed.Search{ForceFresh: true}), 12, "uncached")
+	require.Equal(t, []string{"005", "004", "003"}, ids(feed.ParseTerms("after:2023-03 before:2023-05")), "range")
+	require.Equal(t, []string{"002", "001"}, ids(feed.ParseTerms("before:2023-02-15")), "including the end")
+	require.Equal(t, []string{"012", "011"}, ids(feed.ParseTerms("#art after:2023-11")), "with tags")
+}
+
+func TestPagingBeyondCache(t *testing.T) {
+	db, err := InitDatabase(path.Join(t.TempDir(), "cache.db"))
+	require.NoError(t, err)
+	defer db.Close()
+
+	CacheTime = 10 * time.Minute
+
+	base := time.Now().Add(-time.Hour)
+	var opens int32
+	open := func(ctx context.Context, name string, search feed.Search) (feed.Feed, error) {
+		atomic.AddInt32(&opens, 1)
+
+		start := 100
+		if search.BeforeID != "" {
+			start = 70
+		}
+		posts := make([]feed.Post, 0, 30)
+		for i := 0; i < 30; i++ {
+			posts = append(posts, feed.Post{Source: "tumblr", ID: fmt.Sprintf("%03d", start-i), Author: name, Date: base.Add(time.Duration(start-i) * time.Second)})
+		}
+		return &feed.Static{FeedName: name, Posts: posts}, nil
+	}
+
+	readPosts := func(search feed.Search) []string {
+		f, err := OpenCached(context.Background(), db, "staff", open, search)
+		require.NoError(t, err)
+		defer f.Close()
+
+		ids := make([]string, 0, 30)
+		post, err := f.Next()
+		for err == nil {
+			ids = append(ids, post.ID)
+			post, err = f.Next()
+		}
+		require.ErrorIs(t, err, io.EOF)
+		return ids
+	}
+
+	require.Len(t, readPosts(feed.Search{ForceFresh: true, Limit: 30}), 30, "uncached")
+	require.Equal(t, int32(1), atomic.LoadInt32(&opens))
+
+	cursor := feed.Search{BeforeID: "071", BeforeDate: base.Add(71 * time.Second)}
+
+	ids := readPosts(cursor)
+	require.Equal(t, "070", ids[0], "older posts from source")
+	require.Equal(t, int32(2), atomic.LoadInt32(&opens), "paging beyond cache opens source")
+
+	ids = readPosts(cursor)
+	require.Equal(t, "070", ids[0], "older posts from cache")
+	require.Equal(t, int32(2), atomic.LoadInt32(&opens), "older posts are cached")
+}
+
+// pagedFeed is a feed that only returns older posts if SetCursor is called,
+// like sources that fetch the page after the cursor from upstream.
+type pagedFeed struct {
+	*feed.Static
+	older []feed.Post
+}
+
+func (pf *pagedFeed) SetCursor(id string) {
+	pf.Posts = pf.older
+}
+
+func TestSetCursor(t *testing.T) {
+	db, err := InitDatabase(path.Join(t.TempDir(), "cache.db"))
+	require.NoError(t, err)
+	defer db.Close()
+
+	base := time.Now().Add(-time.Hour)
+	makePosts := func(name string, start int) []feed.Post {
+		posts := make([]feed.Post, 0, 5)
+		for i := 0; i < 5; i++ {
+			posts = append(posts, feed.Post{Source: "tumblr", ID: fmt.Sprintf("%03d", start-i), Author: name, Date: base.Add(time.Duration(start-i) * time.Second)})
+		}
+		return posts
+	}
+	open := func(ctx context.Context, name string, search feed.Search) (feed.Feed, error) {
+		return &pagedFeed{Static: &feed.Static{FeedName: name, Posts: makePosts(name, 10)}, older: makePosts(name, 5)}, nil
+	}
+
+	f, err := OpenCached(context.Background(), db, "staff", open, feed.Search{ForceFresh: true, BeforeID: "006", BeforeDate: base.Add(6 * time.Second)})
+	require.NoError(t, err)
+	defer f.Close()
+
+	post, err := f.Next()
+	require.NoError(t, err)
+	require.Equal(t, "005", post.ID, "older posts from source")
+}
+
+func TestListPostsSince(t *testing.T) {
+	db, err := InitDatabase(path.Join(t.TempDir(), "cache.db"))
+	require.NoError(t, err)
+	defer db.Close()
+
+	date := time.Date(2022, time.June, 10, 0, 0, 0, 0, time.UTC)
+	open := func(ctx context.Context, name string, _ feed.Search) (feed.Feed, error) {
+		posts := make([]feed.Post, 0, 3)
+		for i := 0; i < 3; i++ {
+			posts = append(posts, feed.Post{Source: "tumblr", ID: fmt.Sprintf("%s-%d", name, i), Author: name, Date: date.Add(-time.Duration(i) * 24 * time.Hour)})
+		}
+		return &feed.Static{FeedName: name, Posts: posts}, nil
+	}
+
+	for _, name := range []string{"staff", "engineering", "changes"} {
+		f, err := OpenCached(context.Background(), db, name, open, feed.Search{ForceFresh: true})
+		require.NoError(t, err)
+		_, err = f.Next()
+		for err == nil {
+			_, err = f.Next()
+		}
+		require.NoError(t, f.Close())
+	}
+
+	posts, err := ListPostsSince(context.Background(), db, []string{"staff", "engineering"}, date.Add(-36*time.Hour), 10)
+	require.NoError(t, err)
+
+	ids := make([]string, 0, len(posts))
+	for _, post := range posts {
+		ids = append(ids, post.ID)
+	}
+	require.ElementsMatch(t, []string{"staff-0", "engineering-0", "staff-1", "engineering-1"}, ids)
+	require.Equal(t, "0", ids[0][len(ids[0])-1:], "newest first")
+
+	posts, err = ListPostsSince(context.Background(), db, []string{"staff"}, date.Add(-36*time.Hour), 1)
+	require.NoError(t, err)
+	require.Len(t, posts, 1, "limit")
+}
+
+func TestSearchPosts(t *testing.T) {
+	db, err := InitDatabase(path.Join(t.TempDir(), "cache.db"))
+	require.NoError(t, err)
+	defer db.Close()
+
+	now := time.Now()
+	open := func(ctx context.Context, name string, _ feed.Search) (feed.Feed, error) {
+		offset := time.Duration(len(name)) * time.Minute
+		return &feed.Static{FeedName: name, Posts: []feed.Post{
+			{Source: "tumblr", ID: "2", Author: name, Title: "Cats", DescriptionHTML: "<p>the cats of " + name + "</p>", Date: now.Add(offset)},
+			{Source: "tumblr", ID: "1", Author: name, DescriptionHTML: "<p>dogs and cats</p>", Tags: []string{"wip " + name}, Date: now.Add(-time.Hour + offset)},
+		}}, nil
+	}
+	for _, name := range []string{"staff", "engineering"} {
+		f, err := OpenCached(context.Background(), db, name, open, feed.Search{ForceFresh: true})
+		require.NoError(t, err)
+		for err == nil {
+			_, err = f.Next()
+		}
+		require.NoError(t, f.Close())
+	}
+
+	search := func(query string, limit int) []string {
+		posts, err := SearchPosts(context.Background(), db, query, limit)
+		require.NoError(t, err)
+
+		var ids []string
+		for _, post := range posts {
+			ids = append(ids, post.Author+"/"+post.ID)
+		}
+		return ids
+	}
+
+	require.Equal(t, []string{"engineering/2", "staff/2", "engineering/1", "staff/1"}, search("cats", 10), "newest first")
+	require.Equal(t, []string{"engineering/2", "staff/2"}, search("cats", 2), "limit")
+	require.Equal(t, []string{"engineering/1", "staff/1"}, search("dogs cats", 10), "all words")
+	require.Equal(t, []string{"staff/2", "staff/1"}, search("staff", 10), "text and tags")
+	require.Empty(t, search("birds", 10), "no match")
+	require.Empty(t, search("  ", 10), "empty query")
+	require.Empty(t, search(`"cats OR*`, 10), "no query syntax")
+
+	// updated posts are found by their new text only
+	open = func(ctx context.Context, name string, _ feed.Search) (feed.Feed, error) {
+		return &feed.Static{FeedName: name, Posts: []feed.Post{{Source: "tumblr", ID: "2", Author: name, DescriptionHTML: "<p>birds</p>", Date: now}}}, nil
+	}
+	f, err := OpenCached(context.Background(), db, "staff", open, feed.Search{ForceFresh: true})
+	require.NoError(t, err)
+	for err == nil {
+		_, err = f.Next()
+	}
+	require.NoError(t, f.Close())
+
+	require.Equal(t, []string{"staff/2"}, search("birds", 10), "updated")
+	require.Equal(t, []string{"engineering/2", "engineering/1", "staff/1"}, search("cats", 10), "old text")
+}
+
+func TestListPostsChronologically(t *testing.T) {
+	db, err := InitDatabase(path.Join(t.TempDir(), "cache.db"))
+	require.NoError(t, err)
+	defer db.Close()
+
+	date := time.Date(2022, time.June, 10, 0, 0, 0, 0, time.UTC)
+	open := func(ctx context.Context, name string, _ feed.Search) (feed.Feed, error) {
+		posts := make([]feed.Post, 0, 5)
+		for i := 5; i > 0; i-- {
+			posts = append(posts, feed.Post{Source: "tumblr", ID: fmt.Sprintf("%03d", i), Author: name, Date: date.Add(time.Duration(i/2) * time.Hour)})
+		}
+		return &feed.Static{FeedName: name, Posts: posts}, nil
+	}
+
+	f, err := OpenCached(context.Background(), db, "staff", open, feed.Search{ForceFresh: true})
+	require.NoError(t, err)
+	_, err = f.Next()
+	for err == nil {
+		_, err = f.Next()
+	}
+	require.NoError(t, f.Close())
+
+	ids := func(posts []*feed.Post) []string {
+		ids := make([]string, 0, len(posts))
+		for _, post := range posts {
+			ids = append(ids, post.ID)
+		}
+		return ids
+	}
+
+	posts, err := ListPostsChronologically(context.Background(), db, "staff", "", time.Time{}, 2)
+	require.NoError(t, err)
+	require.Equal(t, []string{"001", "002"}, ids(posts), "oldest first")
+
+	// 002 and 003 are posted at the same time
+	posts, err = ListPostsChronologically(context.Background(), db, "staff", posts[1].ID, posts[1].Date, 10)
+	require.NoError(t, err)
+	require.Equal(t, []string{"003", "004", "005"}, ids(posts), "after cursor")
+}
+
+func TestPagingNumericIDs(t *testing.T) {
+	db, err := InitDatabase(path.Join(t.TempDir(), "cache.db"))
+	require.NoError(t, err)
+	defer db.Close()
+
+	CacheTime = 10 * time.Minute
+
+	// all posted at once, with ids of different lengths
+	date := time.Date(2022, time.June, 10, 0, 0, 0, 0, time.UTC)
+	open := func(ctx context.Context, name string, _ feed.Search) (feed.Feed, error) {
+		return &feed.Static{FeedName: name, Posts: []feed.Post{
+			{Source: "tumblr", ID: "100", Author: name, Date: date},
+			{Source: "tumblr", ID: "99", Author: name, Date: date},
+			{Source: "tumblr", ID: "10", Author: name, Date: date},
+			{Source: "tumblr", ID: "9", Author: name, Date: date},
+		}}, nil
+	}
+
+	readIDs := func(search feed.Search) []string {
+		f, err := OpenCached(context.Background(), db, "staff", open, search)
+		require.NoError(t, err)
+		defer f.Close()
+
+		ids := make([]string, 0, 4)
+		post, err := f.Next()
+		for err == nil {
+			ids = append(ids, post.ID)
+			post, err = f.Next()
+		}
+		require.ErrorIs(t, err, io.EOF)
+		return ids
+	}
+
+	require.Equal(t, []string{"100", "99", "10", "9"}, readIDs(feed.Search{ForceFresh: true}), "uncached")
+	require.Equal(t, []string{"100", "99"}, readIDs(feed.Search{Limit: 2}), "cached, first page")
+	require.Equal(t, []string{"10", "9"}, readIDs(feed.Search{BeforeID: "99", BeforeDate: date, Limit: 2}), "cached, second page")
+
+	posts, err := ListPostsChronologically(context.Background(), db, "staff", "10", date, 10)
+	require.NoError(t, err)
+	require.Len(t, posts, 2, "chronologically")
+	require.Equal(t, "99", posts[0].ID, "chronologically")
+	require.Equal(t, "100", posts[1].ID, "chronologically")
+}
+
+func TestNewestPostDates(t *testing.T) {
+	db, err := InitDatabase(path.Join(t.TempDir(), "cache.db"))
+	require.NoError(t, err)
+	defer db.Close()
+
+	date := time.Date(2022, time.June, 10, 0, 0, 0, 0, time.UTC)
+	open := func(ctx context.Context, name string, _ feed.Search) (feed.Feed, error) {
+		posts := make([]feed.Post, 0, 3)
+		for i := 0; i < 3; i++ {
+			posts = append(posts, feed.Post{Source: "tumblr", ID: fmt.Sprintf("%s-%d", name, i), Author: name, Date: date.Add(-time.Duration(len(name)+i) * time.Hour)})
+		}
+		return &feed.Static{FeedName: name, Posts: posts}, nil
+	}
+
+	for _, name := range []string{"staff", "engineering"} {
+		f, err := OpenCached(context.Background(), db, name, open, feed.Search{ForceFresh: true})
+		require.NoError(t, err)
+		_, err = f.Next()
+		for err == nil {
+			_, err = f.Next()
+		}
+		require.NoError(t, f.Close())
+	}
+
+	dates, err := NewestPostDates(context.Background(), db, []string{"staff", "engineering", "uncached"})
+	require.NoError(t, err)
+	require.Len(t, dates, 2, "uncached feeds are skipped")
+	require.True(t, date.Add(-5*time.Hour).Equal(dates["staff"]), "staff")
+	require.True(t, date.Add(-11*time.Hour).Equal(dates["engineering"]), "engineering")
+}
+
+func TestSuggestFeeds(t *testing.T) {
+	db, err := InitDatabase(path.Join(t.TempDir(), "cache.db"))
+	require.NoError(t, err)
+	defer db.Close()
+
+	for _, name := range []string{"staff", "engineering", "changes", "stuff", "staffpicks"} {
+		_, err := db.Exec(`INSERT INTO feed_infos (name, url, cached_at, description, error) VALUES (?, ?, ?, ?, ?)`, name, "", time.Now(), "", "")
+		require.NoError(t, err)
+	}
+	_, err = db.Exec(`INSERT INTO feed_infos (name, url, cached_at, description, error) VALUES (?, ?, ?, ?, ?)`, "stafff", "", time.Now(), "", "unexpected status code: 404 (Not Found)")
+	require.NoError(t, err)
+
+	suggestions, err := SuggestFeeds(context.Background(), db, "stafff")
+	require.NoError(t, err)
+	require.Equal(t, []string{"staff", "stuff"}, suggestions)
+
+	suggestions, err = SuggestFeeds(context.Background(), db, "enginering")
+	require.NoError(t, err)
+	require.Equal(t, []string{"engineering"}, suggestions)
+
+	suggestions, err = SuggestFeeds(context.Background(), db, "something-else")
+	require.NoError(t, err)
+	require.Empty(t, suggestions)
+}
+
+func TestEditDistance(t *testing.T) {
+	require.Equal(t, 0, editDistance("staff", "staff"))
+	require.Equal(t, 1, editDistance("staff", "stuff"))
+	require.Equal(t, 1, editDistance("staff", "stafff"))
+	require.Equal(t, 3, editDistance("kitten", "sitting"))
+	require.Equal(t, 5, editDistance("", "staff"))
+}
+
+func TestListFeedsOlderThanPriority(t *testing.T) {
+	db, err := InitDatabase(path.Join(t.TempDir(), "cache.db"))
+	require.NoError(t, err)
+	defer db.Close()
+
+	now := time.Now()
+	for _, info := range []struct {
+		name     string
+		cachedAt time.Time
+	}{
+		{"stale", now.Add(-20 * time.Minute)},
+		{"stale-priority", now.Add(-20 * time.Minute)},
+		{"fresh", now.Add(-6 * time.Minute)},
+		{"fresh-priority", now.Add(-6 * time.Minute)},
+		{"very-fresh-priority", now.Add(-1 * time.Minute)},
+	} {
+		_, err := db.Exec(`INSERT INTO feed_infos (name, url, cached_at, description, error) VALUES (?, ?, ?, ?, ?)`, info.name, "", info.cachedAt, "", "")
+		require.NoError(t, err)
+	}
+
+	for _, name := range []string{"stale-priority", "fresh-priority", "very-fresh-priority"} {
+		require.NoError(t, SetFeedPriority(context.Background(), db, name, 1))
+	}
+	require.Error(t, SetFeedPriority(context.Background(), db, "uncached", 1), "uncached feed")
+
+	feeds, err := ListFeedsOlderThan(context.Background(), db, now.Add(-10*time.Minute), 10)
+	require.NoError(t, err)
+	require.Len(t, feeds, 3)
+	require.ElementsMatch(t, []string{"stale-priority", "fresh-priority"}, feeds[:2], "high priority stale feeds first")
+	require.Equal(t, "stale", feeds[2], "normal priority")
+
+	feeds, err = ListFeedsOlderThan(context.Background(), db, now.Add(-10*time.Minute), 1)
+	require.NoError(t, err)
+	require.Len(t, feeds, 1, "limit")
+	require.Contains(t, []string{"stale-priority", "fresh-priority"}, feeds[0], "limit prefers high priority")
+
+	// priority is kept when the feed is updated
+	f, err := OpenCached(context.Background(), db, "stale-priority", func(ctx context.Context, name string, _ feed.Search) (feed.Feed, error) {
+		return &feed.Static{FeedName: name, Posts: []feed.Post{{Source: "tumblr", ID: "1", Author: name, Date: now}}}, nil
+	}, feed.Search{ForceFresh: true})
+	require.NoError(t, err)
+	_, err = f.Next()
+	for err == nil {
+		_, err = f.Next()
+	}
+	require.NoError(t, f.Close())
+
+	var priority int
+	require.NoError(t, db.QueryRow(`SELECT priority FROM feed_infos WHERE name = ?`, "stale-priority").Scan(&priority))
+	require.Equal(t, 1, priority, "priority after update")
+}
+
+func TestCacheResult(t *testing.T) {
+	db, err := InitDatabase(path.Join(t.TempDir(), "cache.db"))
+	require.NoError(t, err)
+	defer db.Close()
+
+	CacheTime = 10 * time.Minute
+
+	var openErr error
+	open := func(ctx context.Context, name string, _ feed.Search) (feed.Feed, error) {
+		if openErr != nil {
+			return nil, openErr
+		}
+		return &feed.Static{FeedName: name, Posts: []feed.Post{{Source: "tumblr", ID: "100", Author: name, Date: time.Now()}}}, nil
+	}
+
+	result := func(name string, search feed.Search) string {
+		f, err := OpenCached(context.Background(), db, name, open, search)
+		if f != nil {
+			defer f.Close()
+			for err == nil {
+				_, err = f.Next()
+			}
+			require.ErrorIs(t, err, io.EOF)
+			err = nil
+		}
+		return CacheResult(f, err)
+	}
+
+	require.Equal(t, ResultLive, result("staff", feed.Search{}), "uncached")
+	require.Equal(t, ResultCached, result("staff", feed.Search{}), "cached")
+	require.Equal(t, ResultLive, result("staff", feed.Search{ForceFresh: true}), "fresh")
+
+	openErr = feed.StatusError{Code: 404}
+	require.Equal(t, ResultStale, result("staff", feed.Search{ForceFresh: true}), "not found")
+
+	openErr = errors.New("broken feed")
+	require.Equal(t, ResultError, result("unknown", feed.Search{}), "error")
+}
+
+func TestCacheTTL(t *testing.T) {
+	db, err := InitDatabase(path.Join(t.TempDir(), "cache.db"))
+	require.NoError(t, err)
+	defer db.Close()
+
+	// everything is stale unless the feed says otherwise
+	CacheTime = 0
+	defer func() { CacheTime = 10 * time.Minute }()
+
+	opened := map[string]int{}
+	open := func(ctx context.Context, name string, _ feed.Search) (feed.Feed, error) {
+		opened[name]++
+		f := &feed.Static{FeedName: name, Posts: []feed.Post{{Source: "ao3", ID: "100", Author: name, Date: time.Now()}}}
+		if name == "slow" {
+			f.FeedCacheTTL = time.Hour
+		}
+		return f, nil
+	}
+
+	result := func(name string) string {
+		f, err := OpenCached(context.Background(), db, name, open, feed.Search{})
+		require.NoError(t, err)
+		defer f.Close()
+		for err == nil {
+			_, err = f.Next()
+		}
+		require.ErrorIs(t, err, io.EOF)
+		return CacheResult(f, nil)
+	}
+
+	require.Equal(t, ResultLive, result("slow"), "uncached")
+	require.Equal(t, ResultCached, result("slow"), "within its ttl")
+	require.Equal(t, 1, opened["slow"])
+
+	require.Equal(t, ResultLive, result("fast"), "uncached")
+	require.Equal(t, ResultLive, result("fast"), "default ttl")
+	require.Equal(t, 2, opened["fast"])
+
+	_, err = db.Exec(`UPDATE feed_infos SET cached_at = ?`, time.Now().Add(-20*time.Minute))
+	require.NoError(t, err)
+	feeds, err := ListFeedsOlderThan(context.Background(), db, time.Now().Add(-10*time.Minute), 10)
+	require.NoError(t, err)
+	require.Equal(t, []string{"fast"}, feeds, "refreshed after their ttl only")
+}
+
+func TestFeedErrorPrivate(t *testing.T) {
+	db, err := InitDatabase(path.Join(t.TempDir(), "cache.db"))
+	require.NoError(t, err)
+	defer db.Close()
+
+	open := func(ctx context.Context, name string, _ feed.Search) (feed.Feed, error) {
+		return nil, fmt.Errorf("download: was redirected: %w", feed.ErrPrivate)
+	}
+
+	_, err = OpenCached(context.Background(), db, "secret", open, feed.Search{})
+	require.ErrorIs(t, err, feed.ErrPrivate, "uncached")
+
+	// the error is stored in the background
+	require.Eventually(t, func() bool {
+		var feedError *string
+		err := db.QueryRow(`SELECT error FROM feed_infos WHERE name = ?`, "secret").Scan(&feedError)
+		return err == nil && feedError != nil
+	}, time.Second, 10*time.Millisecond)
+
+	// nothing to show without cached posts
+	_, err = OpenCached(context.Background(), db, "secret", open, feed.Search{})
+	require.ErrorIs(t, err, feed.ErrPrivate, "cached without posts")
+
+	require.NoError(t, FeedError(&feed.Static{}), "other feeds")
+	require.EqualError(t, storedError("broken feed"), "broken feed")
+
+	// feeds that used to be public are served from the cache
+	isPrivate := false
+	open = func(ctx context.Context, name string, _ feed.Search) (feed.Feed, error) {
+		if isPrivate {
+			return nil, fmt.Errorf("download: was redirected: %w", feed.ErrPrivate)
+		}
+		return &feed.Static{FeedName: name, Posts: []feed.Post{{Source: "tumblr", ID: "1", Author: name, Date: time.Now()}}}, nil
+	}
+
+	posts := func(f feed.Feed) []*feed.Post {
+		var posts []*feed.Post
+		post, err := f.Next()
+		for err == nil {
+			posts = append(posts, post)
+			post, err = f.Next()
+		}
+		require.ErrorIs(t, err, io.EOF)
+		require.NoError(t, f.Close())
+		return posts
+	}
+
+	f, err := OpenCached(context.Background(), db, "formerly-public", open, feed.Search{})
+	require.NoError(t, err)
+	require.Len(t, posts(f), 1, "public")
+
+	isPrivate = true
+	f, err = OpenCached(context.Background(), db, "formerly-public", open, feed.Search{ForceFresh: true})
+	require.NoError(t, err, "private")
+	require.ErrorIs(t, FeedError(f), feed.ErrPrivate, "private")
+	require.Equal(t, "private", f.(feed.Notes).Notes(), "notes")
+	require.Equal(t, ResultStale, CacheResult(f, nil), "stale")
+	privatePosts := posts(f)
+	require.Len(t, privatePosts, 1, "cached posts")
+	require.Contains(t, privatePosts[0].Tags, "numblr:private", "marked")
+
+	require.Eventually(t, func() bool {
+		var feedError *string
+		err := db.QueryRow(`SELECT error FROM feed_infos WHERE name = ?`, "formerly-public").Scan(&feedError)
+		return err == nil && feedError != nil && *feedError != ""
+	}, time.Second, 10*time.Millisecond)
+
+	f, err = OpenCached(context.Background(), db, "formerly-public", open, feed.Search{})
+	require.NoError(t, err, "cached by error")
+	require.ErrorIs(t, FeedError(f), feed.ErrPrivate, "cached by error")
+	privatePosts = posts(f)
+	require.Len(t, privatePosts, 1, "cached by error")
+	require.Contains(t, privatePosts[0].Tags, "numblr:private", "marked when cached by error")
+}
+
+func TestNotModified(t *testing.T) {
+	db, err := InitDatabase(path.Join(t.TempDir(), "cache.db"))
+	require.NoError(t, err)
+	defer db.Close()
+
+	var searches []feed.Search
+	open := func(ctx context.Context, name string, search feed.Search) (feed.Feed, error) {
+		searches = append(searches, search)
+		if search.IfNoneMatch == `"v1"` {
+			return nil, feed.ErrNotModified
+		}
+		return &feed.Static{FeedName: name, FeedETag: `"v1"`, FeedLastModified: "Sat, 01 Jul 2023 00:00:00 GMT", Posts: []feed.Post{{Source: "web", ID: "1", Author: name, Date: time.Now()}}}, nil
+	}
+
+	result := func(search feed.Search) (string, int) {
+		f, err := OpenCached(context.Background(), db, "conditional", open, search)
+		require.NoError(t, err)
+		posts := 0
+		for err == nil {
+			_, err = f.Next()
+			posts++
+		}
+		require.ErrorIs(t, err, io.EOF)
+		require.NoError(t, f.Close())
+		return CacheResult(f, nil), posts - 1
+	}
+
+	res, posts := result(feed.Search{})
+	require.Equal(t, ResultLive, res, "uncached")
+	require.Equal(t, 1, posts, "uncached")
+	require.Equal(t, "", searches[0].IfNoneMatch, "nothing to validate")
+
+	_, err = db.Exec(`UPDATE feed_infos SET cached_at = ?`, time.Now().Add(-time.Hour))
+	require.NoError(t, err)
+
+	res, posts = result(feed.Search{ForceFresh: true})
+	require.Equal(t, ResultCached, res, "not modified")
+	require.Equal(t, 1, posts, "cached posts")
+	require.Len(t, searches, 2)
+	require.Equal(t, `"v1"`, searches[1].IfNoneMatch)
+	require.Equal(t, "Sat, 01 Jul 2023 00:00:00 GMT", searches[1].IfModifiedSince)
+
+	var cachedAt time.Time
+	err = db.QueryRow(`SELECT cached_at FROM feed_infos WHERE name = ?`, "conditional").Scan(&cachedAt)
+	require.NoError(t, err)
+	require.WithinDuration(t, time.Now(), cachedAt, time.Minute, "fresh again")
+
+	res, _ = result(feed.Search{})
+	require.Equal(t, ResultCached, res, "within cache time")
+	require.Len(t, searches, 2, "not fetched again")
+}
+
+func TestFullFallback(t *testing.T) {
+	db, err := InitDatabase(path.Join(t.TempDir(), "cache.db"))
+	require.NoError(t, err)
+	defer db.Close()
+
+	var openErr error
+	open := func(ctx context.Context, name string, search feed.Search) (feed.Feed, error) {
+		if openErr != nil {
+			return nil, openErr
+		}
+		description := "summary"
+		if search.Full {
+			description = "full text"
+		}
+		return &feed.Static{FeedName: name, Posts: []feed.Post{{Source: "ao3", ID: "1", Author: name, DescriptionHTML: description, Date: time.Now()}}}, nil
+	}
+
+	first := func(search feed.Search) *feed.Post {
+		f, err := OpenCached(context.Background(), db, "writer@ao3", open, search)
+		require.NoError(t, err)
+		defer f.Close()
+
+		post, err := f.Next()
+		require.NoError(t, err)
+		for err == nil {
+			_, err = f.Next()
+		}
+		return post
+	}
+
+	require.Equal(t, "summary", first(feed.Search{}).DescriptionHTML, "cached")
+	require.Equal(t, "full text", first(feed.Search{Full: true}).DescriptionHTML, "live")
+	require.Equal(t, "summary", first(feed.Search{}).DescriptionHTML, "full text is not cached")
+
+	openErr = fmt.Errorf("too slow")
+	require.Equal(t, "summary", first(feed.Search{Full: true}).DescriptionHTML, "falls back to the cache")
+}
+
+func TestLastSuccess(t *testing.T) {
+	db, err := InitDatabase(path.Join(t.TempDir(), "cache.db"))
+	require.NoError(t, err)
+	defer db.Close()
+
+	var openErr error
+	open := func(ctx context.Context, name string, _ feed.Search) (feed.Feed, error) {
+		if openErr != nil {
+			return nil, openErr
+		}
+		return &feed.Static{FeedName: name, Posts: []feed.Post{{Source: "web", ID: "1", Author: name, Date: time.Now()}}}, nil
+	}
+
+	f, err := OpenCached(context.Background(), db, "flaky", open, feed.Search{})
+	require.NoError(t, err)
+	for err == nil {
+		_, err = f.Next()
+	}
+	require.NoError(t, f.Close())
+
+	infos, err := ListFeedInfos(context.Background(), db, []string{"flaky"})
+	require.NoError(t, err)
+	require.Equal(t, "", infos["flaky"].Error)
+	require.WithinDuration(t, time.Now(), infos["flaky"].LastSuccessAt, time.Minute, "successful")
+	lastSuccess := infos["flaky"].LastSuccessAt
+
+	openErr = errors.New("broken feed")
+	_, err = OpenCached(context.Background(), db, "flaky", open, feed.Search{ForceFresh: true})
+	require.Error(t, err)
+
+	// the error is stored in the background
+	require.Eventually(t, func() bool {
+		infos, err = ListFeedInfos(context.Background(), db, []string{"flaky"})
+		return err == nil && infos["flaky"].Error != ""
+	}, time.Second, 10*time.Millisecond)
+	require.Equal(t, "broken feed", infos["flaky"].Error)
+	require.True(t, infos["flaky"].CachedAt.After(lastSuccess), "fetched again")
+	require.True(t, infos["flaky"].LastSuccessAt.Equal(lastSuccess), "last success is kept")
+}
+
+func TestPurgePosts(t *testing.T) {
+	db, err := InitDatabase(path.Join(t.TempDir(), "cache.db"))
+	require.NoError(t, err)
+	defer db.Close()
+
+	now := time.Now()
+	cache := func(name string, ages ...time.Duration) {
+		posts := make([]feed.Post, 0, len(ages))
+		for i, age := range ages {
+			posts = append(posts, feed.Post{Source: "web", ID: fmt.Sprint(i), Author: name, Title: fmt.Sprintf("post %d", i), Date: now.Add(-age)})
+		}
+		f, err := OpenCached(context.Background(), db, name, func(ctx context.Context, name string, _ feed.Search) (feed.Feed, error) {
+			return &feed.Static{FeedName: name, Posts: posts}, nil
+		}, feed.Search{ForceFresh: true})
+		require.NoError(t, err)
+		for err == nil {
+			_, err = f.Next()
+		}
+		require.NoError(t, f.Close())
+	}
+
+	day := 24 * time.Hour
+	cache("busy", 1*day, 2*day, 200*day, 300*day, 400*day)
+	cache("quiet", 250*day, 500*day, 600*day)
+	cache("recent", 1*day, 2*day)
+
+	n, err := PurgePosts(context.Background(), db, now.Add(-180*day), 2)
+	require.NoError(t, err)
+	require.Equal(t, int64(4), n)
+
+	counts := map[string]int{}
+	rows, err := db.Query(`SELECT author, COUNT(*) FROM posts GROUP BY author`)
+	require.NoError(t, err)
+	for rows.Next() {
+		var author string
+		var count int
+		require.NoError(t, rows.Scan(&author, &count))
+		counts[author] = count
+	}
+	require.NoError(t, rows.Err())
+	require.Equal(t, map[string]int{"busy": 2, "quiet": 2, "recent": 2}, counts, "newest posts are kept")
+
+	var plan []string
+	rows, err = db.Query(`EXPLAIN QUERY PLAN DELETE FROM posts WHERE rowid IN (`+purgedPosts+`)`, now, 2, 2)
+	require.NoError(t, err)
+	for rows.Next() {
+		var id, parent, notUsed int
+		var detail string
+		require.NoError(t, rows.Scan(&id, &parent, &notUsed, &detail))
+		plan = append(plan, detail)
+	}
+	require.NoError(t, rows.Err())
+	require.Contains(t, strings.Join(plan, "\n"), "USING COVERING INDEX posts_by_author_and_date (author=? AND date>?)", "newer posts are counted using the index")
+}
+
+func TestListFeedStats(t *testing.T) {
+	db, err := InitDatabase(path.Join(t.TempDir(), "cache.db"))
+	require.NoError(t, err)
+	defer db.Close()
+
+	open := func(ctx context.Context, name string, _ feed.Search) (feed.Feed, error) {
+		if name == "dead" {
+			return nil, errors.New("broken feed")
+		}
+		posts := []feed.Post{{Source: "web", ID: "1", Author: name, Date: time.Now()}}
+		if name == "busy" {
+			posts = append(posts, feed.Post{Source: "web", ID: "2", Author: name, Date: time.Now()})
+		}
+		return &feed.Static{FeedName: name, Posts: posts}, nil
+	}
+
+	for _, name := range []string{"busy", "quiet", "dead"} {
+		f, err := OpenCached(context.Background(), db, name, open, feed.Search{})
+		if name == "dead" {
+			require.Error(t, err)
+			continue
+		}
+		require.NoError(t, err)
+		for err == nil {
+			_, err = f.Next()
+		}
+		require.NoError(t, f.Close())
+	}
+
+	// the error is stored in the background
+	byName := map[string]FeedStats{}
+	require.Eventually(t, func() bool {
+		stats, err := ListFeedStats(context.Background(), db)
+		require.NoError(t, err)
+		for _, feedStats := range stats {
+			byName[feedStats.Name] = feedStats
+		}
+		return len(stats) == 3
+	}, time.Second, 10*time.Millisecond)
+
+	require.Equal(t, 2, byName["busy"].NumPosts)
+	require.Equal(t, 1, byName["quiet"].NumPosts)
+	require.Equal(t, 0, byName["dead"].NumPosts)
+	require.Equal(t, "broken feed", byName["dead"].Error)
+	require.Equal(t, "", byName["busy"].Error)
+}
+
+func TestRandomPost(t *testing.T) {
+	db, err := InitDatabase(path.Join(t.TempDir(), "cache.db"))
+	require.NoError(t, err)
+	defer db.Close()
+
+	post, err := RandomPost(context.Background(), db)
+	require.NoError(t, err)
+	require.Nil(t, post, "no posts")
+
+	f, err := OpenCached(context.Background(), db, "staff", func(ctx context.Context, name string, _ feed.Search) (feed.Feed, error) {
+		return &feed.Static{FeedName: name, Posts: []feed.Post{
+			{Source: "tumblr", ID: "2", Author: name, Tags: []string{"two"}, Date: time.Now()},
+			{Source: "tumblr", ID: "1", Author: name, Tags: []string{"one"}, Date: time.Now()},
+		}}, nil
+	}, feed.Search{})
+	require.NoError(t, err)
+	for err == nil {
+		_, err = f.Next()
+	}
+	require.NoError(t, f.Close())
+
+	seen := map[string]bool{}
+	for i := 0; i < 100; i++ {
+		post, err = RandomPost(context.Background(), db)
+		require.NoError(t, err)
+		require.NotNil(t, post)
+		require.Equal(t, "staff", post.Author)
+		seen[post.ID] = true
+	}
+	require.Equal(t, map[string]bool{"1": true, "2": true}, seen, "all posts are picked")
+}
+
+func TestCachedPost(t *testing.T) {
+	db, err := InitDatabase(path.Join(t.TempDir(), "cache.db"))
+	require.NoError(t, err)
+	defer db.Close()
+
+	f, err := OpenCached(context.Background(), db, "example.org", func(ctx context.Context, name string, _ feed.Search) (feed.Feed, error) {
+		return &feed.Static{FeedName: name, Posts: []feed.Post{
+			{Source: "web", ID: "https://example.org/2", Author: name, Title: "two", Tags: []string{"news"}, Date: time.Now()},
+			{Source: "web", ID: "https://example.org/1", Author: name, Title: "one", Date: time.Now()},
+		}}, nil
+	}, feed.Search{})
+	require.NoError(t, err)
+	for err == nil {
+		_, err = f.Next()
+	}
+	require.NoError(t, f.Close())
+
+	post, err := CachedPost(context.Background(), db, "example.org", "https://example.org/2")
+	require.NoError(t, err)
+	require.NotNil(t, post)
+	require.Equal(t, "two", post.Title)
+	require.Equal(t, []string{"news"}, post.Tags)
+
+	post, err = CachedPost(context.Background(), db, "example.org", "https://example.org/3")
+	require.NoError(t, err)
+	require.Nil(t, post, "not cached")
+
+	post, err = CachedPost(context.Background(), db, "other.org", "https://example.org/2")
+	require.NoError(t, err)
+	require.Nil(t, post, "other feed")
+}
@@ -0,0 +1,46 @@
+package feed
+
+import (
+	"fmt"
+	"html"
+	"regexp"
+)
+
+// emojiRE matches either an html tag (which is skipped) or a `:shortcode:`
+// with at least one letter in it, so that times like 12:30:00 are not
+// mistaken for shortcodes.
+var emojiRE = regexp.MustCompile(`<[^>]*>|:(\w*[a-zA-Z_]\w*):`)
+
+// ReplaceEmoji replaces `:shortcode:` custom emoji in postHTML with inline
+// images, as used on Mastodon, Misskey and the like.
+//
+// `emoji` maps shortcodes to image urls, usually as provided by the API of the
+// source.  Unknown shortcodes are left as they are, see StripEmoji.
+func ReplaceEmoji(postHTML string, emoji map[string]string) string {
+	if len(emoji) == 0 {
+		return postHTML
+	}
+
+	return emojiRE.ReplaceAllStringFunc(postHTML, func(repl string) string {
+		if repl[0] == '<' {
+			return repl
+		}
+
+		imageURL, ok := emoji[repl[1:len(repl)-1]]
+		if !ok {
+			return repl
+		}
+		return fmt.Sprintf(`<img class="emoji" src=%q alt=%q title=%q />`, html.EscapeString(imageURL), repl, repl)
+	})
+}
+
+// StripEmoji removes the `:shortcode:` custom emoji that were not replaced
+// by ReplaceEmoji from postHTML, e.g. for sources without emoji data.
+func StripEmoji(postHTML string) string {
+	return emojiRE.ReplaceAllStringFunc(postHTML, func(repl string) string {
+		if repl[0] == '<' {
+			return repl
+		}
+		return ""
+	})
+}
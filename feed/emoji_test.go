@@ -0,0 +1,43 @@
+package feed
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestReplaceEmoji(t *testing.T) {
+	emoji := map[string]string{"blobcat": "https://example.org/blobcat.png"}
+
+	testCases := []struct {
+		html     string
+		expected string
+	}{
+		{`<p>hi :blobcat:</p>`, `<p>hi <img class="emoji" src="https://example.org/blobcat.png" alt=":blobcat:" title=":blobcat:" /></p>`},
+		{`<p>hi :unknown:</p>`, `<p>hi :unknown:</p>`},
+		{`<a href="https://example.org/:blobcat:/">link</a>`, `<a href="https://example.org/:blobcat:/">link</a>`},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.html, func(t *testing.T) {
+			require.Equal(t, tc.expected, ReplaceEmoji(tc.html, emoji))
+		})
+	}
+}
+
+func TestStripEmoji(t *testing.T) {
+	testCases := []struct {
+		html     string
+		expected string
+	}{
+		{`<p>hi :unknown:</p>`, `<p>hi </p>`},
+		{`<p>at 12:30:00</p>`, `<p>at 12:30:00</p>`},
+		{`<a href="https://example.org/:blobcat:/">link</a>`, `<a href="https://example.org/:blobcat:/">link</a>`},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.html, func(t *testing.T) {
+			require.Equal(t, tc.expected, StripEmoji(tc.html))
+		})
+	}
+}
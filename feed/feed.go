@@ -37,6 +37,48 @@ type Notes interface {
 	Notes() string
 }
 
+// CacheTTL is an extension that Feeds might implement if they change more or
+// less often than most feeds.
+//
+// database.OpenCached uses it instead of database.CacheTime to decide if the
+// cached feed is stale, a CacheTTL of 0 means the default.
+type CacheTTL interface {
+	CacheTTL() time.Duration
+}
+
+// Validators is an extension that Feeds might implement if their source
+// sends an `ETag` or `Last-Modified` header.
+//
+// database.OpenCached stores them and passes them back in Search.IfNoneMatch
+// and Search.IfModifiedSince when the feed is refreshed.
+type Validators interface {
+	ETag() string
+	LastModified() string
+}
+
+// SetConditional makes `req` a conditional request if the search has the
+// validators of the cached feed.
+func SetConditional(req *http.Request, search Search) {
+	if search.IfNoneMatch != "" {
+		req.Header.Set("If-None-Match", search.IfNoneMatch)
+	}
+	if search.IfModifiedSince != "" {
+		req.Header.Set("If-Modified-Since", search.IfModifiedSince)
+	}
+}
+
+// Paginatable is an extension that Feeds might implement if they can fetch
+// older posts from their source directly.
+//
+// database.OpenCached calls SetCursor before the first call to `Next` if
+// there is a Search.BeforeID, so that sources with real APIs can fetch the
+// right page from upstream instead of fetching all posts and then skipping
+// the ones before the cursor.
+type Paginatable interface {
+	// SetCursor makes `Next` return posts after the post with `id`.
+	SetCursor(id string)
+}
+
 // Open is a function that opens a feed identified by `name`.
 //
 // All feeds currently implement this.
@@ -59,6 +101,10 @@ type Post struct {
 	Tags            []string `xml:"category"`
 	DateString      string   `xml:"pubDate"`
 	Date            time.Time
+
+	// NoteCount is the number of notes (likes, reblogs and replies) of
+	// Tumblr posts, if it is known.  It is not cached.
+	NoteCount int `json:",omitempty" xml:"-"`
 }
 
 var isReblogRE = regexp.MustCompile(`^\s*[-\w]+:`)
@@ -69,20 +115,198 @@ func (p Post) IsReblog() bool {
 	return isReblogRE.MatchString(p.Title) || strings.Contains(p.DescriptionHTML, `class="tumblr_blog"`)
 }
 
+// IsNewer returns true if post `a` should be listed before post `b`.
+//
+// Posts are ordered by date (descending), posts with identical dates are
+// ordered by ID and then by source so that the order is stable, e.g. when
+// paging through posts that were all posted at once.
+func IsNewer(a, b *Post) bool {
+	if !a.Date.Equal(b.Date) {
+		return a.Date.After(b.Date)
+	}
+	if a.ID != b.ID {
+		return compareIDs(a.ID, b.ID) > 0
+	}
+	return a.Source > b.Source
+}
+
+// compareIDs compares ids, numerically if both are numbers and as strings
+// otherwise.
+func compareIDs(a, b string) int {
+	if len(a) != len(b) && isNumeric(a) && isNumeric(b) {
+		if len(a) > len(b) {
+			return 1
+		}
+		return -1
+	}
+	return strings.Compare(a, b)
+}
+
+func isNumeric(s string) bool {
+	if s == "" {
+		return false
+	}
+	for _, ch := range s {
+		if ch < '0' || ch > '9' {
+			return false
+		}
+	}
+	return true
+}
+
 // Merge returns a special feed that merges the posts from the feeds and
 // presents them as a single Feed to iterate over.
 //
 // Each feed is assumed to be sorted already (by date descending).  Merge only
 // takes care to preserve the order that exists and returns the posts from all
 // feeds in order.
+//
+// Posts from different feeds with the same date are ordered by ID
+// (descending), see IsNewer.  The order does not depend on the order of the
+// feeds or on how quickly they load, so that paging with a `before` cursor
+// (see Search.IsAfterCursor) neither repeats nor skips posts of feeds that
+// only have dates without time, like AO3.
 func Merge(feeds ...Feed) Feed {
-	return &merger{feeds: feeds, posts: make([]*Post, len(feeds)), errors: make([]error, len(feeds))}
+	active := make([]int, len(feeds))
+	for i := range feeds {
+		active[i] = i
+	}
+	return &merger{feeds: feeds, active: active, posts: make([]*Post, len(feeds)), errors: make([]error, len(feeds))}
 }
 
+// MergeUnique is like Merge, but skips posts that have been returned before,
+// e.g. when a feed lists the same post twice.
+//
+// Posts are the same if they have the same Source, feed and ID, or the same
+// URL if they have no ID.  Only the last MergeUniqueLimit posts are
+// remembered.
+func MergeUnique(feeds ...Feed) Feed {
+	m := Merge(feeds...).(*merger)
+	m.seen = &seenPosts{limit: MergeUniqueLimit, keys: make(map[string]bool)}
+	return m
+}
+
+// MergeUniqueLimit is the number of posts that MergeUnique remembers to skip
+// posts it has returned before.
+var MergeUniqueLimit = 1000
+
+// MergePrefetch is the number of posts that merged feeds fetch from each feed
+// concurrently before returning the first post.
+//
+// This way one slow feed does not hold up every call to `Next` because it
+// only has to be waited for once.
+var MergePrefetch = 5
+
+// MergePrefetchConcurrency is the maximum number of feeds that are
+// prefetched concurrently.
+var MergePrefetchConcurrency = 10
+
 type merger struct {
-	feeds  []Feed
+	feeds []Feed
+	// active are the indices of the feeds that have not reached EOF yet, so
+	// that finished feeds do not have to be checked again.
+	active []int
 	posts  []*Post
 	errors []error
+
+	// seen are the posts that have been returned already, only set by
+	// MergeUnique.
+	seen *seenPosts
+
+	warmedUp bool
+}
+
+// seenPosts remembers the keys of the last `limit` posts.
+type seenPosts struct {
+	limit int
+	keys  map[string]bool
+	order []string
+	next  int
+}
+
+// add remembers the key of the post and returns true if it was seen before.
+//
+// Posts without ID or URL are never seen before.
+func (sp *seenPosts) add(post *Post) bool {
+	// IDs are only unique per feed, e.g. rss feeds often number their posts
+	key := post.Source + "\x00" + post.Author + "\x00" + post.ID
+	if post.ID == "" {
+		if post.URL == "" {
+			return false
+		}
+		key = "url\x00" + post.URL
+	}
+
+	if sp.keys[key] {
+		return true
+	}
+	if sp.limit <= 0 {
+		return false
+	}
+
+	if len(sp.order) < sp.limit {
+		sp.order = append(sp.order, key)
+	} else {
+		delete(sp.keys, sp.order[sp.next])
+		sp.order[sp.next] = key
+		sp.next = (sp.next + 1) % sp.limit
+	}
+	sp.keys[key] = true
+	return false
+}
+
+// warmUp prefetches the first MergePrefetch posts of each feed.
+func (m *merger) warmUp() {
+	m.warmedUp = true
+	if MergePrefetch <= 1 {
+		return
+	}
+
+	concurrent := make(chan bool, MergePrefetchConcurrency)
+	var wg sync.WaitGroup
+	wg.Add(len(m.feeds))
+	for i := range m.feeds {
+		go func(i int) {
+			defer wg.Done()
+
+			concurrent <- true
+			defer func() { <-concurrent }()
+
+			prefetched := &prefetchedFeed{Feed: m.feeds[i], posts: make([]*Post, 0, MergePrefetch)}
+			for len(prefetched.posts) < MergePrefetch {
+				post, err := prefetched.Feed.Next()
+				if err != nil {
+					prefetched.err = err
+					break
+				}
+				prefetched.posts = append(prefetched.posts, post)
+			}
+			m.feeds[i] = prefetched
+		}(i)
+	}
+	wg.Wait()
+}
+
+// prefetchedFeed returns the prefetched posts first, then the remaining posts
+// from the feed.
+type prefetchedFeed struct {
+	Feed
+	posts []*Post
+	err   error
+}
+
+func (pf *prefetchedFeed) Next() (*Post, error) {
+	if len(pf.posts) > 0 {
+		post := pf.posts[0]
+		pf.posts = pf.posts[1:]
+		return post, nil
+	}
+
+	if pf.err != nil {
+		return nil, pf.err
+	}
+
+	return pf.Feed.Next()
 }
 
 func (m *merger) Name() string {
@@ -111,42 +335,85 @@ func (m *merger) URL() string {
 	return ""
 }
 
+// SetCursor implements Paginatable.SetCursor for the feeds that support it.
+func (m *merger) SetCursor(id string) {
+	for _, f := range m.feeds {
+		if paginatable, ok := f.(Paginatable); ok {
+			paginatable.SetCursor(id)
+		}
+	}
+}
+
 func (m *merger) Next() (*Post, error) {
-	allErrors := false
-	for _, err := range m.errors {
-		allErrors = allErrors && err != nil
+	for {
+		post, err := m.next()
+		if err != nil || m.seen == nil || !m.seen.add(post) {
+			return post, err
+		}
 	}
-	if allErrors {
-		return nil, m.errors[0]
+}
+
+func (m *merger) next() (*Post, error) {
+	err := m.failed()
+	if err != nil {
+		return nil, err
 	}
 
-	var wg sync.WaitGroup
-	wg.Add(len(m.feeds))
-	for i := range m.feeds {
-		go func(i int) {
-			if m.posts[i] == nil && !errors.Is(m.errors[i], io.EOF) {
+	if !m.warmedUp {
+		m.warmUp()
+	}
+
+	pending := make([]int, 0, len(m.active))
+	for _, i := range m.active {
+		if m.posts[i] == nil {
+			pending = append(pending, i)
+		}
+	}
+
+	if len(pending) == 1 {
+		i := pending[0]
+		m.posts[i], m.errors[i] = m.feeds[i].Next()
+	} else {
+		var wg sync.WaitGroup
+		wg.Add(len(pending))
+		for _, i := range pending {
+			go func(i int) {
 				m.posts[i], m.errors[i] = m.feeds[i].Next()
-			}
-			wg.Done()
-		}(i)
+				wg.Done()
+			}(i)
+		}
+		wg.Wait()
 	}
-	wg.Wait()
+
+	active := m.active[:0]
+	for _, i := range m.active {
+		if m.posts[i] == nil && errors.Is(m.errors[i], io.EOF) {
+			continue
+		}
+		active = append(active, i)
+	}
+	m.active = active
 
 	postIdx := -1
 	var firstPost *Post
 
-	for i, post := range m.posts {
+	for _, i := range m.active {
+		post := m.posts[i]
 		if post == nil {
 			continue
 		}
 
-		if firstPost == nil || post.Date.After(firstPost.Date) {
+		if firstPost == nil || IsNewer(post, firstPost) {
 			postIdx = i
 			firstPost = post
 		}
 	}
 
 	if firstPost == nil {
+		err := m.failed()
+		if err != nil {
+			return nil, err
+		}
 		return nil, fmt.Errorf("no more posts: %w", io.EOF)
 	}
 
@@ -155,6 +422,25 @@ func (m *merger) Next() (*Post, error) {
 	return firstPost, nil
 }
 
+// failed returns the first error if all feeds failed with an error other than
+// io.EOF, and nil otherwise.
+func (m *merger) failed() error {
+	if len(m.errors) == 0 {
+		return nil
+	}
+
+	for _, err := range m.errors {
+		if err == nil || errors.Is(err, io.EOF) {
+			return nil
+		}
+	}
+
+	if len(m.errors) > 1 {
+		return fmt.Errorf("%w (and %d more errors)", m.errors[0], len(m.errors)-1)
+	}
+	return m.errors[0]
+}
+
 func (m *merger) Close() error {
 	var err error
 	numErrors := 0
@@ -171,13 +457,19 @@ func (m *merger) Close() error {
 }
 
 var _ Feed = &Static{}
+var _ Paginatable = &Static{}
+var _ CacheTTL = &Static{}
+var _ Validators = &Static{}
 
 // Static is a feed that contains exactly the Posts specified.
 type Static struct {
-	FeedName        string
-	FeedURL         string
-	FeedDescription string
-	Posts           []Post
+	FeedName         string
+	FeedURL          string
+	FeedDescription  string
+	FeedCacheTTL     time.Duration
+	FeedETag         string
+	FeedLastModified string
+	Posts            []Post
 }
 
 // Name implements Feed.Name
@@ -195,6 +487,31 @@ func (s *Static) URL() string {
 	return s.FeedURL
 }
 
+// CacheTTL implements CacheTTL.CacheTTL.
+func (s *Static) CacheTTL() time.Duration {
+	return s.FeedCacheTTL
+}
+
+// ETag implements Validators.ETag.
+func (s *Static) ETag() string {
+	return s.FeedETag
+}
+
+// LastModified implements Validators.LastModified.
+func (s *Static) LastModified() string {
+	return s.FeedLastModified
+}
+
+// SetCursor implements Paginatable.SetCursor.
+func (s *Static) SetCursor(id string) {
+	for i, post := range s.Posts {
+		if post.ID == id {
+			s.Posts = s.Posts[i+1:]
+			return
+		}
+	}
+}
+
 // Next implements Feed.Next.
 func (s *Static) Next() (*Post, error) {
 	if len(s.Posts) == 0 {
@@ -212,6 +529,14 @@ func (s *Static) Close() error {
 	return nil
 }
 
+// ErrPrivate is returned when opening a feed that exists, but that can only
+// be seen when logged in, e.g. private tumblr blogs.
+var ErrPrivate = errors.New("feed is private")
+
+// ErrNotModified is returned when opening a feed with Search.IfNoneMatch or
+// Search.IfModifiedSince if it has not changed since it was cached.
+var ErrNotModified = errors.New("feed not modified")
+
 var _ error = StatusError{}
 
 // StatusError is an error with an HTTP status code.
@@ -0,0 +1,267 @@
+package feed
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestMergeIdenticalTimestamps(t *testing.T) {
+	date := time.Date(2022, time.June, 1, 12, 0, 0, 0, time.UTC)
+
+	newFeeds := func() []Feed {
+		return []Feed{
+			&Static{FeedName: "a", Posts: []Post{
+				{Source: "tumblr", ID: "105", Date: date.Add(time.Hour)},
+				{Source: "tumblr", ID: "104", Date: date},
+				{Source: "tumblr", ID: "102", Date: date},
+				{Source: "tumblr", ID: "99", Date: date},
+			}},
+			&Static{FeedName: "b", Posts: []Post{
+				{Source: "tumblr", ID: "103", Date: date},
+				{Source: "tumblr", ID: "101", Date: date},
+				{Source: "tumblr", ID: "100", Date: date.Add(-time.Hour)},
+			}},
+		}
+	}
+
+	collect := func(search Search, limit int) []string {
+		merged := Merge(newFeeds()...)
+		defer merged.Close()
+
+		ids := make([]string, 0, limit)
+		post, err := merged.Next()
+		for err == nil && !search.IsAfterCursor(post) {
+			post, err = merged.Next()
+		}
+		for err == nil && len(ids) < limit {
+			ids = append(ids, post.ID)
+			post, err = merged.Next()
+		}
+		if err != nil {
+			require.True(t, errors.Is(err, io.EOF), "unexpected error: %s", err)
+		}
+		return ids
+	}
+
+	all := collect(Search{}, 10)
+	require.Equal(t, []string{"105", "104", "103", "102", "101", "99", "100"}, all, "merge order")
+	require.Equal(t, all, collect(Search{}, 10), "merge order is stable")
+
+	// page through using the date cursor, two posts at a time
+	paged := make([]string, 0, len(all))
+	search := Search{}
+	for {
+		page := collect(search, 2)
+		if len(page) == 0 {
+			break
+		}
+		paged = append(paged, page...)
+
+		lastID := page[len(page)-1]
+		search = Search{BeforeID: lastID, BeforeDate: date}
+		switch lastID {
+		case "105":
+			search.BeforeDate = date.Add(time.Hour)
+		case "100":
+			search.BeforeDate = date.Add(-time.Hour)
+		}
+	}
+	require.Equal(t, all, paged, "paging skipped or repeated posts")
+}
+
+func TestMergeSameDay(t *testing.T) {
+	day := time.Date(2022, time.June, 1, 0, 0, 0, 0, time.UTC)
+
+	a := []Post{
+		{Source: "rss", ID: "https://example.org/c", Date: day},
+		{Source: "rss", ID: "https://example.org/a", Date: day},
+	}
+	b := []Post{
+		{Source: "ao3", ID: "https://example.org/d", Date: day},
+		{Source: "ao3", ID: "https://example.org/b", Date: day},
+		{Source: "ao3", ID: "https://example.org/old", Date: day.Add(-24 * time.Hour)},
+	}
+
+	collect := func(feeds ...Feed) []string {
+		merged := Merge(feeds...)
+		defer merged.Close()
+
+		ids := make([]string, 0, 5)
+		post, err := merged.Next()
+		for err == nil {
+			ids = append(ids, post.ID)
+			post, err = merged.Next()
+		}
+		require.ErrorIs(t, err, io.EOF)
+		return ids
+	}
+
+	expected := []string{"https://example.org/d", "https://example.org/c", "https://example.org/b", "https://example.org/a", "https://example.org/old"}
+	require.Equal(t, expected, collect(&Static{Posts: a}, &Static{Posts: b}), "by id on the same day")
+	require.Equal(t, expected, collect(&Static{Posts: b}, &Static{Posts: a}), "independent of the order of the feeds")
+}
+
+func TestStaticSetCursor(t *testing.T) {
+	var f Feed = &Static{Posts: []Post{{ID: "3"}, {ID: "2"}, {ID: "1"}}}
+	f.(Paginatable).SetCursor("2")
+
+	post, err := f.Next()
+	require.NoError(t, err)
+	require.Equal(t, "1", post.ID)
+
+	_, err = f.Next()
+	require.ErrorIs(t, err, io.EOF)
+}
+
+func TestMergeUnevenFeeds(t *testing.T) {
+	date := time.Date(2022, time.June, 1, 12, 0, 0, 0, time.UTC)
+
+	feeds := []Feed{
+		&Static{FeedName: "empty"},
+		&Static{FeedName: "a", Posts: []Post{{ID: "3", Date: date.Add(3 * time.Hour)}, {ID: "1", Date: date.Add(time.Hour)}}},
+		&Static{FeedName: "b", Posts: []Post{{ID: "2", Date: date.Add(2 * time.Hour)}}},
+		&Static{FeedName: "also-empty"},
+	}
+
+	merged := Merge(feeds...)
+	defer merged.Close()
+
+	authors := make([]string, 0, 3)
+	post, err := merged.Next()
+	for err == nil {
+		authors = append(authors, post.Author)
+		post, err = merged.Next()
+	}
+	require.ErrorIs(t, err, io.EOF)
+	require.Equal(t, []string{"a", "b", "a"}, authors)
+
+	_, err = merged.Next()
+	require.ErrorIs(t, err, io.EOF, "still EOF after the end")
+}
+
+// failingFeed fails with err on every call to Next.
+type failingFeed struct {
+	Static
+	err error
+}
+
+func (ff *failingFeed) Next() (*Post, error) {
+	return nil, ff.err
+}
+
+func TestMergeAllErrors(t *testing.T) {
+	errA := errors.New("a is broken")
+	errB := errors.New("b is broken")
+
+	merged := Merge(&failingFeed{Static: Static{FeedName: "a"}, err: errA}, &failingFeed{Static: Static{FeedName: "b"}, err: errB})
+	defer merged.Close()
+
+	_, err := merged.Next()
+	require.ErrorIs(t, err, errA, "first call")
+	require.NotErrorIs(t, err, io.EOF, "first call")
+
+	_, err = merged.Next()
+	require.ErrorIs(t, err, errA, "second call")
+
+	// the posts of feeds that work are still returned
+	merged = Merge(&failingFeed{Static: Static{FeedName: "a"}, err: errA}, &Static{FeedName: "b", Posts: []Post{{ID: "1"}}})
+	defer merged.Close()
+
+	post, err := merged.Next()
+	require.NoError(t, err)
+	require.Equal(t, "1", post.ID)
+
+	_, err = merged.Next()
+	require.ErrorIs(t, err, io.EOF, "not all feeds failed")
+}
+
+func TestMergeUnique(t *testing.T) {
+	date := time.Date(2022, time.June, 1, 12, 0, 0, 0, time.UTC)
+
+	newFeeds := func() []Feed {
+		return []Feed{
+			&Static{FeedName: "blog", Posts: []Post{
+				{Source: "tumblr", ID: "3", Date: date.Add(3 * time.Hour)},
+				{Source: "tumblr", ID: "1", Date: date.Add(time.Hour)},
+			}},
+			&Static{FeedName: "list", Posts: []Post{
+				{Source: "tumblr", ID: "3", Date: date.Add(3 * time.Hour)},
+				{Source: "rss", ID: "3", Date: date.Add(2 * time.Hour)},
+				{Source: "rss", URL: "https://example.org/1", Date: date.Add(time.Hour)},
+				{Source: "rss", URL: "https://example.org/1", Date: date},
+			}},
+		}
+	}
+
+	collect := func(merged Feed) []string {
+		defer merged.Close()
+
+		posts := make([]string, 0, 6)
+		post, err := merged.Next()
+		for err == nil {
+			posts = append(posts, post.Author+"/"+post.Source+"/"+post.ID+post.URL)
+			post, err = merged.Next()
+		}
+		require.ErrorIs(t, err, io.EOF)
+		return posts
+	}
+
+	require.Len(t, collect(Merge(newFeeds()...)), 6, "raw merge keeps duplicates")
+	require.Equal(t, []string{"blog/tumblr/3", "list/tumblr/3", "list/rss/3", "blog/tumblr/1", "list/rss/https://example.org/1"}, collect(MergeUnique(newFeeds()...)), "unique per feed")
+
+	sameIDs := []Feed{
+		&Static{FeedName: "a", Posts: []Post{{Source: "rss", ID: "1", Date: date}}},
+		&Static{FeedName: "b", Posts: []Post{{Source: "rss", ID: "1", Date: date}}},
+	}
+	require.Equal(t, []string{"a/rss/1", "b/rss/1"}, collect(MergeUnique(sameIDs...)), "same ids in different feeds")
+
+	seen := &seenPosts{limit: 2, keys: make(map[string]bool)}
+	for _, id := range []string{"1", "2", "3"} {
+		require.False(t, seen.add(&Post{ID: id}), "new post %s", id)
+	}
+	require.True(t, seen.add(&Post{ID: "3"}), "seen recently")
+	require.False(t, seen.add(&Post{ID: "1"}), "forgotten")
+	require.Len(t, seen.keys, 2, "bounded")
+}
+
+// BenchmarkMergeMostlyFinished merges 300 feeds where only 10 have more
+// than a few posts, like a large list with a few very active accounts.
+func BenchmarkMergeMostlyFinished(b *testing.B) {
+	date := time.Date(2022, time.June, 1, 12, 0, 0, 0, time.UTC)
+
+	newFeeds := func() []Feed {
+		feeds := make([]Feed, 0, 300)
+		for i := 0; i < 300; i++ {
+			numPosts := 1
+			if i < 10 {
+				numPosts = 100
+			}
+			posts := make([]Post, 0, numPosts)
+			for j := 0; j < numPosts; j++ {
+				posts = append(posts, Post{Source: "tumblr", ID: fmt.Sprintf("%d-%d", i, j), Date: date.Add(-time.Duration(j*300+i) * time.Minute)})
+			}
+			feeds = append(feeds, &Static{FeedName: fmt.Sprintf("feed-%d", i), Posts: posts})
+		}
+		return feeds
+	}
+
+	b.ResetTimer()
+	for n := 0; n < b.N; n++ {
+		b.StopTimer()
+		merged := Merge(newFeeds()...)
+		b.StartTimer()
+
+		_, err := merged.Next()
+		for err == nil {
+			_, err = merged.Next()
+		}
+		if !errors.Is(err, io.EOF) {
+			b.Fatal(err)
+		}
+	}
+}
@@ -0,0 +1,48 @@
+package feed
+
+import (
+	"net/http"
+)
+
+// DefaultHeaders are the headers that are sent to hosts by default, e.g. to
+// get past age gates.
+var DefaultHeaders = map[string]http.Header{
+	"livejournal.com": {"Cookie": {"adult_explicit=1"}},
+	// reddit blocks generic user agents
+	"reddit.com": {"User-Agent": {"numblr/1.0 (+https://github.com/heyLu/numblr)"}},
+}
+
+// HeadersTransport sends additional headers to some hosts, e.g. cookies or a
+// Referer that are required to fetch feeds from them.
+type HeadersTransport struct {
+	// Headers maps hosts to the headers sent to them (and their subdomains).
+	Headers   map[string]http.Header
+	Transport http.RoundTripper
+}
+
+// RoundTrip implements http.RoundTripper.
+func (ht *HeadersTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	for host, headers := range ht.Headers {
+		if !MatchesHost(req.URL.Hostname(), []string{host}) {
+			continue
+		}
+
+		// requests must not be modified by round trippers
+		req = req.Clone(req.Context())
+		for key, vals := range headers {
+			if http.CanonicalHeaderKey(key) == "Cookie" && req.Header.Get("Cookie") != "" {
+				for _, val := range vals {
+					req.Header.Set("Cookie", req.Header.Get("Cookie")+"; "+val)
+				}
+				continue
+			}
+
+			req.Header.Del(key)
+			for _, val := range vals {
+				req.Header.Add(key, val)
+			}
+		}
+	}
+
+	return ht.Transport.RoundTrip(req)
+}
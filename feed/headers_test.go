@@ -0,0 +1,38 @@
+package feed
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestHeadersTransport(t *testing.T) {
+	var received http.Header
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		received = req.Header
+	}))
+	defer server.Close()
+
+	client := &http.Client{Transport: &HeadersTransport{
+		Headers: map[string]http.Header{
+			"127.0.0.1":   {"Referer": {"https://example.org/"}, "Cookie": {"age_verified=1"}},
+			"example.org": {"X-Other": {"nope"}},
+		},
+		Transport: http.DefaultTransport,
+	}}
+
+	req, err := http.NewRequest("GET", server.URL, nil)
+	require.NoError(t, err)
+	req.Header.Set("Cookie", "session=abc")
+
+	resp, err := client.Do(req)
+	require.NoError(t, err)
+	resp.Body.Close()
+
+	require.Equal(t, "https://example.org/", received.Get("Referer"), "referer")
+	require.Equal(t, "session=abc; age_verified=1", received.Get("Cookie"), "cookie")
+	require.Empty(t, received.Get("X-Other"), "other hosts")
+	require.Equal(t, "session=abc", req.Header.Get("Cookie"), "original request is unchanged")
+}
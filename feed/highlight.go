@@ -0,0 +1,97 @@
+package feed
+
+import (
+	"bytes"
+	"regexp"
+	"strings"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+// HighlightHTML wraps the text in postHTML that termsRE matches in `<mark>`.
+//
+// Only text is highlighted, tags and attributes are kept as they are so that
+// e.g. searching for "cat" does not break `<img src="cat.jpg" />`.
+func HighlightHTML(postHTML string, termsRE *regexp.Regexp) string {
+	if termsRE == nil || !termsRE.MatchString(postHTML) {
+		return postHTML
+	}
+
+	body := &html.Node{Type: html.ElementNode, Data: "body", DataAtom: atom.Body}
+	nodes, err := html.ParseFragment(strings.NewReader(postHTML), body)
+	if err != nil {
+		return postHTML
+	}
+	for _, node := range nodes {
+		body.AppendChild(node)
+	}
+
+	highlightChildren(body, termsRE)
+
+	buf := new(bytes.Buffer)
+	for node := body.FirstChild; node != nil; node = node.NextSibling {
+		err = html.Render(buf, node)
+		if err != nil {
+			return postHTML
+		}
+	}
+	return buf.String()
+}
+
+func highlightChildren(node *html.Node, termsRE *regexp.Regexp) {
+	for child := node.FirstChild; child != nil; {
+		// highlighting replaces the child
+		next := child.NextSibling
+
+		switch child.Type {
+		case html.TextNode:
+			highlightText(child, termsRE)
+		case html.ElementNode:
+			switch child.DataAtom {
+			case atom.Script, atom.Style, atom.Textarea, atom.Mark:
+			default:
+				highlightChildren(child, termsRE)
+			}
+		}
+
+		child = next
+	}
+}
+
+// highlightText replaces the text node with the text before, between and
+// after the matches and the matches wrapped in `<mark>`.
+func highlightText(node *html.Node, termsRE *regexp.Regexp) {
+	matches := termsRE.FindAllStringIndex(node.Data, -1)
+	if len(matches) == 0 {
+		return
+	}
+
+	text := node.Data
+	pos := 0
+	for _, match := range matches {
+		if match[0] == match[1] {
+			continue
+		}
+
+		if match[0] > pos {
+			node.Parent.InsertBefore(&html.Node{Type: html.TextNode, Data: text[pos:match[0]]}, node)
+		}
+
+		mark := &html.Node{Type: html.ElementNode, Data: "mark", DataAtom: atom.Mark}
+		mark.AppendChild(&html.Node{Type: html.TextNode, Data: text[match[0]:match[1]]})
+		node.Parent.InsertBefore(mark, node)
+
+		pos = match[1]
+	}
+
+	if pos == 0 {
+		// only empty matches
+		return
+	}
+
+	if pos < len(text) {
+		node.Parent.InsertBefore(&html.Node{Type: html.TextNode, Data: text[pos:]}, node)
+	}
+	node.Parent.RemoveChild(node)
+}
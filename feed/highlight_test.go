@@ -0,0 +1,23 @@
+package feed
+
+import (
+	"regexp"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestHighlightHTML(t *testing.T) {
+	catRE := regexp.MustCompile(`(?i)(cats?)`)
+
+	require.Equal(t, `<p>no match</p>`, HighlightHTML(`<p>no match</p>`, catRE), "unchanged")
+	require.Equal(t, `<p>cat</p>`, HighlightHTML(`<p>cat</p>`, nil), "no terms")
+
+	require.Equal(t, `<p>a <mark>cat</mark> and <mark>Cats</mark>, <b><mark>cat</mark>!</b></p>`, HighlightHTML(`<p>a cat and Cats, <b>cat!</b></p>`, catRE), "text")
+	require.Equal(t, `<p><img src="cat.jpg" alt="a dog"/></p>`, HighlightHTML(`<p><img src="cat.jpg" alt="a dog" /></p>`, catRE), "attributes")
+	require.Equal(t, `<a href="/cat"><mark>cat</mark></a>`, HighlightHTML(`<a href="/cat">cat</a>`, catRE), "links")
+	require.Equal(t, `<script>cat()</script><p>&lt;<mark>cat</mark>&gt;</p>`, HighlightHTML(`<script>cat()</script><p>&lt;cat&gt;</p>`, catRE), "escaped text")
+
+	phraseRE := regexp.MustCompile(`(?i)(fun\s+stuff)`)
+	require.Equal(t, "<p>some <mark>fun\n stuff</mark></p>", HighlightHTML("<p>some fun\n stuff</p>", phraseRE), "phrases")
+}
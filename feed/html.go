@@ -0,0 +1,49 @@
+package feed
+
+import (
+	"net/url"
+	"strings"
+
+	"golang.org/x/net/html"
+)
+
+// Attr returns the value of the attribute `key` of node, or "" if it does
+// not have it.
+func Attr(node *html.Node, key string) string {
+	for _, attr := range node.Attr {
+		if attr.Key == key {
+			return attr.Val
+		}
+	}
+	return ""
+}
+
+// TextContent returns the text of node and all of its children.
+func TextContent(node *html.Node) string {
+	if node.Type == html.TextNode {
+		return node.Data
+	}
+
+	buf := new(strings.Builder)
+	for child := node.FirstChild; child != nil; child = child.NextSibling {
+		buf.WriteString(TextContent(child))
+	}
+	return buf.String()
+}
+
+// MakeAbsolute makes the links and images in node absolute, as they would
+// not work relative to numblr.
+func MakeAbsolute(node *html.Node, pageURL *url.URL) {
+	for i, attr := range node.Attr {
+		if attr.Key == "href" || attr.Key == "src" {
+			u, err := pageURL.Parse(attr.Val)
+			if err == nil {
+				node.Attr[i].Val = u.String()
+			}
+		}
+	}
+
+	for child := node.FirstChild; child != nil; child = child.NextSibling {
+		MakeAbsolute(child, pageURL)
+	}
+}
@@ -0,0 +1,24 @@
+package feed
+
+import (
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"golang.org/x/net/html"
+)
+
+func TestMakeAbsolute(t *testing.T) {
+	node, err := html.Parse(strings.NewReader(`<p>Hello, <a href="/posts/old" title="old">the <em>old</em> post</a><img src="img/new.png"></p>`))
+	require.NoError(t, err)
+
+	pageURL, _ := url.Parse("https://example.org/posts/new")
+	MakeAbsolute(node, pageURL)
+
+	buf := new(strings.Builder)
+	require.NoError(t, html.Render(buf, node))
+	require.Contains(t, buf.String(), `<a href="https://example.org/posts/old" title="old">`, "links")
+	require.Contains(t, buf.String(), `<img src="https://example.org/posts/img/new.png"/>`, "images")
+	require.Equal(t, "Hello, the old post", TextContent(node))
+}
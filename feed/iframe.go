@@ -0,0 +1,77 @@
+package feed
+
+import (
+	"fmt"
+	"html"
+	"net/url"
+	"regexp"
+	"strings"
+)
+
+// iframeRE matches an `<iframe>` element, including its (usually empty)
+// content and closing tag.
+var iframeRE = regexp.MustCompile(`(?is)<iframe\b[^>]*>(.*?</iframe>)?`)
+var iframeAttrRE = regexp.MustCompile(`(?is)\s([-\w]+)(?:\s*=\s*("[^"]*"|'[^']*'|[^\s>]+))?`)
+
+// iframeSandbox is what allowed embeds are restricted to, enough for the
+// usual video and audio players to work.
+const iframeSandbox = "allow-scripts allow-same-origin allow-popups allow-presentation"
+
+// SanitizeIframes keeps `<iframe>` embeds in postHTML if their src is one of
+// `allowedHosts` (or a subdomain of one), and replaces all others with a
+// link to their src.  Embeds without a valid http(s) src are removed.
+//
+// Kept embeds are sandboxed and loaded lazily, with all attributes except
+// for the size, title and fullscreen permissions removed.
+func SanitizeIframes(postHTML string, allowedHosts []string) string {
+	return iframeRE.ReplaceAllStringFunc(postHTML, func(repl string) string {
+		openTag := repl
+		if idx := strings.Index(openTag, ">"); idx != -1 {
+			openTag = openTag[:idx]
+		}
+
+		attrs := make(map[string]string)
+		for _, match := range iframeAttrRE.FindAllStringSubmatch(openTag[len("<iframe"):], -1) {
+			val := strings.Trim(match[2], `"'`)
+			attrs[strings.ToLower(match[1])] = html.UnescapeString(val)
+		}
+
+		src := attrs["src"]
+		u, err := url.Parse(src)
+		if err != nil || u.Host == "" || (u.Scheme != "" && u.Scheme != "http" && u.Scheme != "https") {
+			return ""
+		}
+		u.Scheme = "https"
+
+		if !MatchesHost(u.Hostname(), allowedHosts) {
+			return fmt.Sprintf(`<p><a href="%s">embed from %s</a></p>`, html.EscapeString(u.String()), html.EscapeString(u.Hostname()))
+		}
+
+		res := fmt.Sprintf(`<iframe src="%s" sandbox=%q loading="lazy"`, html.EscapeString(u.String()), iframeSandbox)
+		for _, key := range []string{"width", "height", "title", "allow"} {
+			if val, ok := attrs[key]; ok {
+				res += fmt.Sprintf(` %s="%s"`, key, html.EscapeString(val))
+			}
+		}
+		if _, ok := attrs["allowfullscreen"]; ok {
+			res += ` allowfullscreen`
+		}
+		return res + `></iframe>`
+	})
+}
+
+// MatchesHost returns true if `host` is one of `allowedHosts`, or a subdomain
+// of one of them.
+func MatchesHost(host string, allowedHosts []string) bool {
+	host = strings.ToLower(host)
+	for _, allowed := range allowedHosts {
+		allowed = strings.ToLower(strings.TrimSpace(allowed))
+		if allowed == "" {
+			continue
+		}
+		if host == allowed || strings.HasSuffix(host, "."+allowed) {
+			return true
+		}
+	}
+	return false
+}
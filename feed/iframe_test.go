@@ -0,0 +1,39 @@
+package feed
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestSanitizeIframes(t *testing.T) {
+	allowed := []string{"youtube.com", "bandcamp.com"}
+
+	testCases := []struct {
+		html     string
+		expected string
+	}{
+		{`<p>no embeds</p>`, `<p>no embeds</p>`},
+		{
+			`<iframe width="560" height="315" src="https://www.youtube.com/embed/abc?start=1&amp;rel=0" frameborder="0" onload="alert(1)" allowfullscreen></iframe>`,
+			`<iframe src="https://www.youtube.com/embed/abc?start=1&amp;rel=0" sandbox="allow-scripts allow-same-origin allow-popups allow-presentation" loading="lazy" width="560" height="315" allowfullscreen></iframe>`,
+		},
+		{
+			`<iframe style="border: 0" src="//bandcamp.com/EmbeddedPlayer/album=123/"></iframe>`,
+			`<iframe src="https://bandcamp.com/EmbeddedPlayer/album=123/" sandbox="allow-scripts allow-same-origin allow-popups allow-presentation" loading="lazy"></iframe>`,
+		},
+		{
+			`<p>listen</p><iframe src="https://evil.example/player"></iframe>`,
+			`<p>listen</p><p><a href="https://evil.example/player">embed from evil.example</a></p>`,
+		},
+		{`<iframe src="https://notyoutube.com/embed/abc"></iframe>`, `<p><a href="https://notyoutube.com/embed/abc">embed from notyoutube.com</a></p>`},
+		{`<iframe src="javascript:alert(1)"></iframe>`, ``},
+		{`<iframe></iframe>`, ``},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.html, func(t *testing.T) {
+			require.Equal(t, tc.expected, SanitizeIframes(tc.html, allowed))
+		})
+	}
+}
@@ -0,0 +1,74 @@
+package feed
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+var imgTagRE = regexp.MustCompile(`(?i)<img\b[^>]*>`)
+var imgSizeRE = regexp.MustCompile(`(?i)\s(?:data-orig-)?(width|height)="(\d+)"`)
+var imgClassRE = regexp.MustCompile(`(?i)\sclass="([^"]*)"`)
+var imgTabindexRE = regexp.MustCompile(`(?i)\stabindex=`)
+
+// MarkTallImages adds the `tall` class to images in postHTML that are more
+// than `ratio` times as high as they are wide, e.g. long comics.
+//
+// Only images with both width and height attributes are considered.  Tall
+// images are also made focusable (if they are not already), so that they can
+// be expanded on click using `:focus` without any JavaScript.
+func MarkTallImages(postHTML string, ratio float64) string {
+	return imgTagRE.ReplaceAllStringFunc(postHTML, func(tag string) string {
+		width, height := imageSize(tag)
+		if width <= 0 || height <= 0 || float64(height)/float64(width) <= ratio {
+			return tag
+		}
+
+		if imgClassRE.MatchString(tag) {
+			tag = imgClassRE.ReplaceAllString(tag, ` class="$1 tall"`)
+		} else {
+			tag = "<img" + ` class="tall"` + tag[len("<img"):]
+		}
+		if imgTabindexRE.MatchString(tag) {
+			return tag
+		}
+		return "<img" + ` tabindex="0"` + tag[len("<img"):]
+	})
+}
+
+// DropSmallImages removes images in postHTML that are less than `minSize`
+// pixels wide or high, such as tracking pixels, spacers and icons.
+//
+// Images without a declared width or height are kept, as their size is not
+// known.
+func DropSmallImages(postHTML string, minSize int) string {
+	if minSize <= 0 {
+		return postHTML
+	}
+
+	return imgTagRE.ReplaceAllStringFunc(postHTML, func(tag string) string {
+		width, height := imageSize(tag)
+		if (width > 0 && width < minSize) || (height > 0 && height < minSize) {
+			return ""
+		}
+		return tag
+	})
+}
+
+// imageSize returns the declared width and height of the image tag, either
+// from the width and height attributes or from Tumblr's `data-orig-*`
+// attributes.  Sizes that are not declared are 0.
+func imageSize(tag string) (width int, height int) {
+	for _, match := range imgSizeRE.FindAllStringSubmatch(tag, -1) {
+		n, err := strconv.Atoi(match[2])
+		if err != nil {
+			continue
+		}
+		if strings.EqualFold(match[1], "width") {
+			width = n
+		} else {
+			height = n
+		}
+	}
+	return width, height
+}
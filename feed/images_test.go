@@ -0,0 +1,49 @@
+package feed
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestMarkTallImages(t *testing.T) {
+	testCases := []struct {
+		html     string
+		expected string
+	}{
+		{`<img src="a.jpg" width="500" height="500" />`, `<img src="a.jpg" width="500" height="500" />`},
+		{`<img src="a.jpg" />`, `<img src="a.jpg" />`},
+		{`<img src="a.jpg" width="500" height="3000" />`, `<img tabindex="0" class="tall" src="a.jpg" width="500" height="3000" />`},
+		{`<img class="comic" src="a.jpg" height="3000" width="500">`, `<img tabindex="0" class="comic tall" src="a.jpg" height="3000" width="500">`},
+		{`<p>text</p><img src="a.jpg" width="500" height="1000" />`, `<p>text</p><img src="a.jpg" width="500" height="1000" />`},
+		{`<img tabindex="0" src="a.jpg" width="500" height="3000" />`, `<img class="tall" tabindex="0" src="a.jpg" width="500" height="3000" />`},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.html, func(t *testing.T) {
+			require.Equal(t, tc.expected, MarkTallImages(tc.html, 2.5))
+		})
+	}
+}
+
+func TestDropSmallImages(t *testing.T) {
+	testCases := []struct {
+		html     string
+		expected string
+	}{
+		{`<p>pixel<img src="t.gif" width="1" height="1"></p>`, `<p>pixel</p>`},
+		{`<img src="spacer.gif" width="600" height="2" />`, ``},
+		{`<img src="icon.png" width="16" />`, ``},
+		{`<img src="a.jpg" data-orig-width="12" data-orig-height="12" />`, ``},
+		{`<img src="a.jpg" width="500" height="400" />`, `<img src="a.jpg" width="500" height="400" />`},
+		{`<img src="unknown.jpg" />`, `<img src="unknown.jpg" />`},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.html, func(t *testing.T) {
+			require.Equal(t, tc.expected, DropSmallImages(tc.html, 20))
+		})
+	}
+
+	require.Equal(t, `<img src="t.gif" width="1" height="1">`, DropSmallImages(`<img src="t.gif" width="1" height="1">`, 0), "disabled")
+}
@@ -0,0 +1,160 @@
+package lemmy
+
+import (
+	"context"
+	"fmt"
+	"html"
+	"net/url"
+	"regexp"
+	"strings"
+
+	"github.com/heyLu/numblr/feed"
+	"github.com/heyLu/numblr/feed/rss"
+)
+
+// Suffixes mark names as Lemmy communities, e.g. `technology@lemmy.world@lemmy`.
+var Suffixes = []string{"@lemmy"}
+
+// IsLemmy returns true if `name` has one of the Suffixes.
+func IsLemmy(name string) bool {
+	for _, suffix := range Suffixes {
+		if strings.HasSuffix(name, suffix) {
+			return true
+		}
+	}
+	return false
+}
+
+// FeedURL returns the url of the RSS feed of the community `name`, which is
+// `community@instance@lemmy`, with the newest posts first.
+//
+// Communities of other instances are `community@other.instance@instance@lemmy`,
+// as they can be followed from any instance.
+func FeedURL(name string) (string, error) {
+	name = strings.TrimPrefix(trimSuffixes(name), "!")
+
+	idx := strings.LastIndex(name, "@")
+	if idx == -1 {
+		return "", fmt.Errorf("unrecognized lemmy feed %q, expected community@instance@lemmy", name)
+	}
+	community, instance := name[:idx], name[idx+1:]
+	if community == "" || strings.ContainsAny(community, "/?#") || instance == "" || strings.ContainsAny(instance, "/?#") {
+		return "", fmt.Errorf("unrecognized lemmy feed %q, expected community@instance@lemmy", name)
+	}
+
+	return fmt.Sprintf("https://%s/feeds/c/%s.xml?sort=New", instance, url.PathEscape(community)), nil
+}
+
+func trimSuffixes(name string) string {
+	for _, suffix := range Suffixes {
+		name = strings.TrimSuffix(name, suffix)
+	}
+	return name
+}
+
+// Open opens the posts of the Lemmy community `name`, see FeedURL.
+func Open(ctx context.Context, name string, search feed.Search) (feed.Feed, error) {
+	feedURL, err := FeedURL(name)
+	if err != nil {
+		return nil, err
+	}
+
+	f, err := rss.Open(ctx, feedURL, search)
+	if err != nil {
+		return nil, err
+	}
+
+	return &lemmyRSS{name: name, feedURL: feedURL, RSS: f.(*rss.RSS)}, nil
+}
+
+type lemmyRSS struct {
+	name    string
+	feedURL string
+
+	*rss.RSS
+}
+
+func (lr *lemmyRSS) Name() string {
+	return lr.name
+}
+
+func (lr *lemmyRSS) URL() string {
+	return lr.feedURL
+}
+
+func (lr *lemmyRSS) Next() (*feed.Post, error) {
+	post, err := lr.RSS.Next()
+	if err != nil {
+		return nil, err
+	}
+
+	post.Source = "lemmy"
+	post.Author = lr.name
+	post.DescriptionHTML += footer(post.DescriptionHTML)
+
+	return post, nil
+}
+
+// communityRE matches the community in the description of posts, which
+// Lemmy starts with `submitted by <a>user</a> to <a>community</a>`.
+var communityRE = regexp.MustCompile(`to <a href="([^"]+)"`)
+
+// crossPostRE matches the `cross-posted from: ...` line that Lemmy adds to
+// cross-posts, which is either a link to the original post or the community
+// it was posted in.
+var crossPostRE = regexp.MustCompile(`(?i)cross-posted from:?\s*(?:<a [^>]*href="([^"]+)"[^>]*>([^<]+)</a>|!([\w.-]+@[\w.-]+))`)
+
+// footer returns the community that the post was posted in and the one it
+// was cross-posted from, if any.
+func footer(descriptionHTML string) string {
+	var parts []string
+
+	if match := communityRE.FindStringSubmatch(descriptionHTML); match != nil {
+		if community := CommunityFromURL(html.UnescapeString(match[1])); community != "" {
+			parts = append(parts, "in "+communityLink(community))
+		}
+	}
+
+	if match := crossPostRE.FindStringSubmatch(descriptionHTML); match != nil {
+		switch {
+		case match[3] != "":
+			parts = append(parts, "cross-posted from "+communityLink(match[3]))
+		case CommunityFromURL(html.UnescapeString(match[1])) != "":
+			parts = append(parts, "cross-posted from "+communityLink(CommunityFromURL(html.UnescapeString(match[1]))))
+		default:
+			parts = append(parts, fmt.Sprintf(`cross-posted from <a href="%s">%s</a>`, match[1], match[2]))
+		}
+	}
+
+	if len(parts) == 0 {
+		return ""
+	}
+	return `<p class="lemmy-community">` + strings.Join(parts, ", ") + `</p>`
+}
+
+// communityLink links to the community `community@instance` on numblr.
+func communityLink(community string) string {
+	return fmt.Sprintf(`<a href="/%s">!%s</a>`, html.EscapeString(community+"@lemmy"), html.EscapeString(community))
+}
+
+// CommunityFromURL returns the community `community@instance` at
+// `communityURL`, e.g. `https://instance/c/community`, or "" if it is not
+// the url of a community.
+func CommunityFromURL(communityURL string) string {
+	u, err := url.Parse(communityURL)
+	if err != nil || u.Host == "" {
+		return ""
+	}
+
+	parts := strings.Split(strings.Trim(u.Path, "/"), "/")
+	if len(parts) != 2 || parts[0] != "c" || parts[1] == "" {
+		return ""
+	}
+
+	// communities on other instances are `/c/community@other.instance`
+	community := parts[1]
+	if !strings.Contains(community, "@") {
+		community += "@" + u.Host
+	}
+	return community
+}
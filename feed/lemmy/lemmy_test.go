@@ -0,0 +1,64 @@
+package lemmy
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestFeedURL(t *testing.T) {
+	testCases := []struct {
+		name    string
+		feedURL string
+	}{
+		{"technology@lemmy.world@lemmy", "https://lemmy.world/feeds/c/technology.xml?sort=New"},
+		{"!technology@lemmy.world@lemmy", "https://lemmy.world/feeds/c/technology.xml?sort=New"},
+		{"technology@lemmy.world@lemmy.ml@lemmy", "https://lemmy.ml/feeds/c/technology@lemmy.world.xml?sort=New"},
+		{"technology@lemmy", ""},
+		{"@lemmy.world@lemmy", ""},
+		{"technology@@lemmy", ""},
+		{"tech/nology@lemmy.world@lemmy", ""},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			feedURL, err := FeedURL(tc.name)
+			if tc.feedURL == "" {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, tc.feedURL, feedURL)
+		})
+	}
+}
+
+func TestIsLemmy(t *testing.T) {
+	require.True(t, IsLemmy("technology@lemmy.world@lemmy"))
+	require.False(t, IsLemmy("technology@lemmy.world"), "mastodon account")
+	require.False(t, IsLemmy("golang@reddit"), "other source")
+}
+
+func TestCommunityFromURL(t *testing.T) {
+	require.Equal(t, "technology@lemmy.world", CommunityFromURL("https://lemmy.world/c/technology"), "local community")
+	require.Equal(t, "technology@lemmy.world", CommunityFromURL("https://lemmy.ml/c/technology@lemmy.world"), "remote community")
+	require.Equal(t, "", CommunityFromURL("https://lemmy.world/post/123"), "post")
+	require.Equal(t, "", CommunityFromURL("https://lemmy.world/c/technology/extra"), "not a community")
+	require.Equal(t, "", CommunityFromURL("/c/technology"), "relative url")
+}
+
+func TestFooter(t *testing.T) {
+	post := `submitted by <a href="https://lemmy.world/u/someone">someone</a> to <a href="https://lemmy.world/c/technology">technology</a><br>42 points | <a href="https://lemmy.world/post/123">7 comments</a>`
+	require.Equal(t, `<p class="lemmy-community">in <a href="/technology@lemmy.world@lemmy">!technology@lemmy.world</a></p>`, footer(post), "community")
+
+	crossPost := `submitted by <a href="https://lemmy.world/u/someone">someone</a> to <a href="https://lemmy.world/c/technology">technology</a><br><p>cross-posted from: <a href="https://lemmy.ml/post/456">https://lemmy.ml/post/456</a></p>`
+	require.Equal(t, `<p class="lemmy-community">in <a href="/technology@lemmy.world@lemmy">!technology@lemmy.world</a>, cross-posted from <a href="https://lemmy.ml/post/456">https://lemmy.ml/post/456</a></p>`, footer(crossPost), "cross-post of a post")
+
+	crossPost = `submitted by <a href="https://lemmy.world/u/someone">someone</a> to <a href="https://lemmy.world/c/technology">technology</a><br><p>cross-posted from: !linux@lemmy.ml</p>`
+	require.Contains(t, footer(crossPost), `cross-posted from <a href="/linux@lemmy.ml@lemmy">!linux@lemmy.ml</a>`, "cross-post from a community")
+
+	crossPost = `<p>Cross-posted from <a href="https://lemmy.ml/c/linux">linux</a></p>`
+	require.Equal(t, `<p class="lemmy-community">cross-posted from <a href="/linux@lemmy.ml@lemmy">!linux@lemmy.ml</a></p>`, footer(crossPost), "cross-post with a link to a community")
+
+	require.Equal(t, "", footer(`<p>just text</p>`), "neither")
+}
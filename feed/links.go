@@ -0,0 +1,96 @@
+package feed
+
+import (
+	"strings"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+// Link is a link in a post.
+type Link struct {
+	URL  string
+	Text string
+}
+
+// Media is an image, video or audio in a post.
+type Media struct {
+	// Type is the element the media is embedded with, i.e. `img`, `video` or
+	// `audio`.
+	Type string
+	URL  string
+}
+
+// ExtractLinks returns the outbound links and media in postHTML, in the order
+// they appear in the post, e.g. to list them without the text around them.
+//
+// Links without text (usually around images) and links to anchors within the
+// post are skipped, as are duplicate links and media.
+func ExtractLinks(postHTML string) ([]Link, []Media) {
+	links := make([]Link, 0, 5)
+	media := make([]Media, 0, 5)
+	seen := make(map[string]bool)
+
+	var link *Link
+	var mediaType string
+	tokenizer := html.NewTokenizer(strings.NewReader(postHTML))
+	for {
+		switch tokenizer.Next() {
+		case html.ErrorToken:
+			return links, media
+		case html.TextToken:
+			if link != nil {
+				link.Text += string(tokenizer.Text())
+			}
+		case html.StartTagToken, html.SelfClosingTagToken:
+			token := tokenizer.Token()
+			switch token.DataAtom {
+			case atom.A:
+				href := attr(token, "href")
+				if href != "" && !strings.HasPrefix(href, "#") && !strings.HasPrefix(href, "javascript:") {
+					link = &Link{URL: href}
+				}
+			case atom.Img:
+				addMedia(&media, seen, "img", attr(token, "src"))
+			case atom.Video, atom.Audio:
+				mediaType = token.Data
+				addMedia(&media, seen, mediaType, attr(token, "src"))
+			case atom.Source:
+				if mediaType != "" {
+					addMedia(&media, seen, mediaType, attr(token, "src"))
+				}
+			}
+		case html.EndTagToken:
+			switch tokenizer.Token().DataAtom {
+			case atom.A:
+				if link != nil {
+					link.Text = strings.Join(strings.Fields(link.Text), " ")
+					if link.Text != "" && !seen[link.URL] {
+						seen[link.URL] = true
+						links = append(links, *link)
+					}
+					link = nil
+				}
+			case atom.Video, atom.Audio:
+				mediaType = ""
+			}
+		}
+	}
+}
+
+func addMedia(media *[]Media, seen map[string]bool, mediaType string, src string) {
+	if src == "" || seen[src] {
+		return
+	}
+	seen[src] = true
+	*media = append(*media, Media{Type: mediaType, URL: src})
+}
+
+func attr(token html.Token, key string) string {
+	for _, attr := range token.Attr {
+		if attr.Key == key {
+			return attr.Val
+		}
+	}
+	return ""
+}
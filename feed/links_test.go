@@ -0,0 +1,32 @@
+package feed
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestExtractLinks(t *testing.T) {
+	postHTML := `<p>Read <a href="https://example.org/news?a=1&amp;b=2">the  <b>news</b></a> and
+<a href="#footnote">[1]</a>, also <a href="https://example.org/news?a=1&amp;b=2">again</a>.</p>
+<a href="https://example.org/full.jpg"><img src="https://example.org/thumb.jpg" /></a>
+<figure><video poster="https://example.org/poster.jpg"><source src="https://example.org/video.mp4" type="video/mp4"></video></figure>
+<audio src="https://example.org/song.mp3"></audio>
+<img src="https://example.org/thumb.jpg">
+<p><a href="/staff/post/123">a reblog</a></p>`
+
+	links, media := ExtractLinks(postHTML)
+	require.Equal(t, []Link{
+		{URL: "https://example.org/news?a=1&b=2", Text: "the news"},
+		{URL: "/staff/post/123", Text: "a reblog"},
+	}, links, "links")
+	require.Equal(t, []Media{
+		{Type: "img", URL: "https://example.org/thumb.jpg"},
+		{Type: "video", URL: "https://example.org/video.mp4"},
+		{Type: "audio", URL: "https://example.org/song.mp3"},
+	}, media, "media")
+
+	links, media = ExtractLinks(`<p>just prose</p>`)
+	require.Empty(t, links, "no links")
+	require.Empty(t, media, "no media")
+}
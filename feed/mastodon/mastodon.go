@@ -0,0 +1,336 @@
+package mastodon
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"html"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
+
+	lru "github.com/hashicorp/golang-lru"
+
+	"github.com/heyLu/numblr/feed"
+	"github.com/heyLu/numblr/feed/rss"
+)
+
+// Suffixes mark names as Mastodon feeds explicitly, e.g. `user@instance@masto`.
+var Suffixes = []string{"@masto", "@mastodon"}
+
+// accountRE matches names that look like accounts, e.g. `user@instance.tld`.
+var accountRE = regexp.MustCompile(`^[\w.-]+@[[:alnum:]-]+(\.[[:alnum:]-]+)+$`)
+
+// IsMastodon returns true if `name` is a Mastodon feed, i.e. a hashtag
+// timeline (`#tag@instance`), an account (`user@instance.tld`) or a name
+// with one of the Suffixes.
+func IsMastodon(name string) bool {
+	for _, suffix := range Suffixes {
+		if strings.HasSuffix(name, suffix) {
+			return true
+		}
+	}
+	return strings.HasPrefix(name, "#") && strings.Contains(name, "@") || accountRE.MatchString(name)
+}
+
+// FeedURL returns the url of the RSS feed for `name`, which is either the
+// hashtag timeline `#tag@instance` or the account `user@instance`, both with
+// an optional `@masto` suffix.
+func FeedURL(name string) (string, error) {
+	name = trimSuffixes(name)
+
+	user, instance, ok := strings.Cut(name, "@")
+	if !ok || user == "" || user == "#" || instance == "" || strings.ContainsAny(instance, "/@") {
+		return "", fmt.Errorf("unrecognized mastodon feed %q, expected user@instance or #tag@instance", name)
+	}
+
+	if strings.HasPrefix(user, "#") {
+		return fmt.Sprintf("https://%s/tags/%s.rss", instance, url.PathEscape(user[1:])), nil
+	}
+	return fmt.Sprintf("https://%s/@%s.rss", instance, url.PathEscape(user)), nil
+}
+
+func trimSuffixes(name string) string {
+	for _, suffix := range Suffixes {
+		name = strings.TrimSuffix(name, suffix)
+	}
+	return name
+}
+
+// Open opens the Mastodon feed `name`, see FeedURL.
+//
+// Accounts are looked up using WebFinger first, as they may live on another
+// host than the one in their name, e.g. `user@example.com` on
+// `social.example.com`.
+func Open(ctx context.Context, name string, search feed.Search) (feed.Feed, error) {
+	feedURL, err := FeedURL(name)
+	if err != nil {
+		return nil, err
+	}
+
+	if strings.HasPrefix(name, "#") {
+		f, err := rss.Open(ctx, feedURL, search)
+		if err != nil {
+			return nil, err
+		}
+		return &mastodonRSS{name: name, author: name, feedURL: feedURL, isTag: true, emoji: instanceEmoji(ctx, feedURL), RSS: f.(*rss.RSS)}, nil
+	}
+
+	account := trimSuffixes(name)
+	accounts := map[string]bool{strings.ToLower(account): true}
+	profileURL, err := webFinger(ctx, account)
+	if err != nil {
+		log.Printf("Error: webfinger for %s: %s", account, err)
+	} else {
+		feedURL = profileURL + ".rss"
+		accounts[strings.ToLower(accountFromURL(profileURL, 1))] = true
+	}
+
+	f, err := rss.Open(ctx, feedURL, search)
+	if err != nil && profileURL != "" {
+		// not Mastodon, but maybe a server that links to its feed
+		feedURL = profileURL
+		f, err = rss.Open(ctx, feedURL, search)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &mastodonRSS{name: name, author: account, feedURL: feedURL, accounts: accounts, emoji: instanceEmoji(ctx, feedURL), RSS: f.(*rss.RSS)}, nil
+}
+
+type mastodonRSS struct {
+	name    string
+	author  string
+	feedURL string
+	isTag   bool
+
+	// accounts are the names of the account of the feed, statuses of
+	// other accounts are boosts.
+	accounts map[string]bool
+
+	// emoji are the custom emoji of the instance, by shortcode.
+	emoji map[string]string
+
+	*rss.RSS
+}
+
+func (mr *mastodonRSS) Name() string {
+	return mr.name
+}
+
+func (mr *mastodonRSS) URL() string {
+	return mr.feedURL
+}
+
+func (mr *mastodonRSS) Next() (*feed.Post, error) {
+	post, err := mr.RSS.Next()
+	if err != nil {
+		return nil, err
+	}
+
+	account := AccountFromURL(post.URL)
+	switch {
+	case mr.isTag && account != "":
+		// posts in hashtag timelines are from all kinds of accounts, so
+		// link to the one that posted it
+		post.DescriptionHTML = fmt.Sprintf(`<p class="mastodon-account">by <a href="/%s">@%s</a></p>`, html.EscapeString(account), html.EscapeString(account)) + post.DescriptionHTML
+	case !mr.isTag && account != "" && !mr.accounts[strings.ToLower(account)]:
+		// boosts are marked like reblogs on Tumblr, so that `noreblogs`
+		// hides them
+		post.DescriptionHTML = fmt.Sprintf(`<p><a class="tumblr_blog" href="/%s">%s</a>:</p><blockquote>%s</blockquote>`, html.EscapeString(account), html.EscapeString(account), post.DescriptionHTML)
+	}
+
+	post.DescriptionHTML = feed.ReplaceEmoji(post.DescriptionHTML, mr.emoji)
+	post.Source = "mastodon"
+	post.Author = mr.author
+
+	return post, nil
+}
+
+// webFingerCache caches the profile pages of accounts.
+var webFingerCache, _ = lru.New(1000)
+
+// webFinger returns the profile page of `account` (`user@host`), as its
+// host announces it.
+//
+// See https://docs.joinmastodon.org/spec/webfinger/.
+func webFinger(ctx context.Context, account string) (string, error) {
+	if cached, ok := webFingerCache.Get(account); ok {
+		return cached.(string), nil
+	}
+
+	_, host, _ := strings.Cut(account, "@")
+
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	webFingerURL := "https://" + host + "/.well-known/webfinger?resource=" + url.QueryEscape("acct:"+account)
+	req, err := http.NewRequestWithContext(ctx, "GET", webFingerURL, nil)
+	if err != nil {
+		return "", fmt.Errorf("new request: %w", err)
+	}
+	req.Header.Set("Accept", "application/jrd+json")
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("download: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != 200 {
+		return "", fmt.Errorf("download: %w", feed.StatusError{Code: resp.StatusCode})
+	}
+
+	var resource struct {
+		Links []struct {
+			Rel  string `json:"rel"`
+			Href string `json:"href"`
+		} `json:"links"`
+	}
+	err = json.NewDecoder(io.LimitReader(resp.Body, 64*1024)).Decode(&resource)
+	if err != nil {
+		return "", fmt.Errorf("decode: %w", err)
+	}
+
+	for _, link := range resource.Links {
+		if link.Rel != "http://webfinger.net/rel/profile-page" {
+			continue
+		}
+
+		u, err := url.Parse(link.Href)
+		if err != nil || u.Scheme != "https" || u.Host == "" {
+			continue
+		}
+
+		profileURL := strings.TrimSuffix(u.String(), "/")
+		webFingerCache.Add(account, profileURL)
+		return profileURL, nil
+	}
+
+	return "", fmt.Errorf("no profile page")
+}
+
+// emojiCache caches the custom emoji of instances, or missingEmoji if they
+// could not be fetched.
+var emojiCache, _ = lru.New(100)
+
+// emojiFailureCacheTime is how long instances whose emoji could not be
+// fetched are not asked again.
+const emojiFailureCacheTime = 10 * time.Minute
+
+// missingEmoji is cached for instances whose emoji could not be fetched, so
+// that unreachable instances don't hold up every feed from them.
+type missingEmoji struct {
+	since time.Time
+}
+
+// instanceEmoji returns the custom emoji of the instance that serves
+// `feedURL`, or nil if they could not be fetched.
+func instanceEmoji(ctx context.Context, feedURL string) map[string]string {
+	u, err := url.Parse(feedURL)
+	if err != nil || u.Host == "" {
+		return nil
+	}
+
+	emoji, err := customEmoji(ctx, u.Host)
+	if err != nil {
+		log.Printf("Error: custom emoji of %s: %s", u.Host, err)
+	}
+	return emoji
+}
+
+// customEmoji returns the image urls of the custom emoji of the instance at
+// `host`, by shortcode.
+//
+// Instances that answer without emoji (e.g. because they are not Mastodon)
+// are remembered as having none, instances whose emoji could not be fetched
+// for emojiFailureCacheTime.
+//
+// See https://docs.joinmastodon.org/methods/custom_emojis/.
+func customEmoji(ctx context.Context, host string) (map[string]string, error) {
+	if cached, ok := emojiCache.Get(host); ok {
+		switch cached := cached.(type) {
+		case map[string]string:
+			return cached, nil
+		case missingEmoji:
+			if time.Since(cached.since) < emojiFailureCacheTime {
+				return nil, nil
+			}
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, "GET", "https://"+host+"/api/v1/custom_emojis", nil)
+	if err != nil {
+		return nil, fmt.Errorf("new request: %w", err)
+	}
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		emojiCache.Add(host, missingEmoji{since: time.Now()})
+		return nil, fmt.Errorf("download: %w", err)
+	}
+	defer resp.Body.Close()
+
+	emoji := map[string]string{}
+	if resp.StatusCode != 200 {
+		emojiCache.Add(host, emoji)
+		return emoji, nil
+	}
+
+	var customEmojis []struct {
+		Shortcode string `json:"shortcode"`
+		URL       string `json:"url"`
+	}
+	err = json.NewDecoder(io.LimitReader(resp.Body, 4*1024*1024)).Decode(&customEmojis)
+	if err != nil {
+		emojiCache.Add(host, missingEmoji{since: time.Now()})
+		return nil, fmt.Errorf("decode: %w", err)
+	}
+
+	for _, customEmoji := range customEmojis {
+		u, err := url.Parse(customEmoji.URL)
+		if customEmoji.Shortcode == "" || err != nil || (u.Scheme != "https" && u.Scheme != "http") {
+			continue
+		}
+		emoji[customEmoji.Shortcode] = customEmoji.URL
+	}
+	emojiCache.Add(host, emoji)
+	return emoji, nil
+}
+
+// AccountFromURL returns the account `user@instance` that posted the status
+// at `statusURL`, e.g. `https://instance/@user/123`, or "" if it is not the
+// url of a status.
+func AccountFromURL(statusURL string) string {
+	return accountFromURL(statusURL, 2)
+}
+
+// accountFromURL returns the account of the url if its path starts with
+// `/@user` and has at least `minParts` parts.
+func accountFromURL(accountURL string, minParts int) string {
+	u, err := url.Parse(accountURL)
+	if err != nil || u.Host == "" {
+		return ""
+	}
+
+	parts := strings.Split(strings.Trim(u.Path, "/"), "/")
+	if len(parts) < minParts || !strings.HasPrefix(parts[0], "@") || len(parts[0]) < 2 {
+		return ""
+	}
+
+	// accounts on other instances are `/@user@other.instance/123`
+	account := parts[0][1:]
+	if !strings.Contains(account, "@") {
+		account += "@" + u.Host
+	}
+	return account
+}
@@ -0,0 +1,144 @@
+package mastodon
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestFeedURL(t *testing.T) {
+	testCases := []struct {
+		name    string
+		feedURL string
+	}{
+		{"#art@mastodon.art", "https://mastodon.art/tags/art.rss"},
+		{"#art@mastodon.art@masto", "https://mastodon.art/tags/art.rss"},
+		{"#MosaicMonday@mastodon.social@mastodon", "https://mastodon.social/tags/MosaicMonday.rss"},
+		{"someone@mastodon.social@masto", "https://mastodon.social/@someone.rss"},
+		{"someone@mastodon.social", "https://mastodon.social/@someone.rss"},
+		{"#@mastodon.social", ""},
+		{"#art", ""},
+		{"@mastodon.social@masto", ""},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			feedURL, err := FeedURL(tc.name)
+			if tc.feedURL == "" {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, tc.feedURL, feedURL)
+		})
+	}
+}
+
+func TestIsMastodon(t *testing.T) {
+	require.True(t, IsMastodon("#art@mastodon.art"), "hashtag")
+	require.True(t, IsMastodon("someone@mastodon.social@masto"), "account with suffix")
+	require.True(t, IsMastodon("someone@mastodon.social"), "account without suffix")
+	require.False(t, IsMastodon("#art"), "tag without instance")
+	require.False(t, IsMastodon("someone@t"), "other source")
+	require.False(t, IsMastodon("https://example.com/@someone"), "url")
+}
+
+func TestAccountFromURL(t *testing.T) {
+	require.Equal(t, "someone@mastodon.social", AccountFromURL("https://mastodon.social/@someone/109876543210"), "local account")
+	require.Equal(t, "someone@other.instance", AccountFromURL("https://mastodon.social/@someone@other.instance/109876543210"), "remote account")
+	require.Equal(t, "", AccountFromURL("https://mastodon.social/tags/art"), "not a status")
+	require.Equal(t, "", AccountFromURL("https://mastodon.social/@someone"), "profile")
+	require.Equal(t, "someone@social.example.com", accountFromURL("https://social.example.com/@someone", 1), "profile")
+}
+
+func TestWebFinger(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		require.Equal(t, "/.well-known/webfinger", req.URL.Path)
+		if req.URL.Query().Get("resource") != "acct:someone@"+req.Host {
+			http.NotFound(w, req)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/jrd+json")
+		fmt.Fprint(w, `{"subject":"acct:someone@example.com","links":[{"rel":"self","type":"application/activity+json","href":"https://social.example.com/users/someone"},{"rel":"http://webfinger.net/rel/profile-page","type":"text/html","href":"https://social.example.com/@someone"}]}`)
+	}))
+	defer server.Close()
+
+	origTransport := http.DefaultClient.Transport
+	http.DefaultClient.Transport = server.Client().Transport
+	defer func() {
+		http.DefaultClient.Transport = origTransport
+	}()
+
+	host := strings.TrimPrefix(server.URL, "https://")
+
+	profileURL, err := webFinger(context.Background(), "someone@"+host)
+	require.NoError(t, err)
+	require.Equal(t, "https://social.example.com/@someone", profileURL)
+
+	_, err = webFinger(context.Background(), "nobody@"+host)
+	require.Error(t, err, "unknown account")
+}
+
+func TestCustomEmoji(t *testing.T) {
+	requests := 0
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		requests++
+		require.Equal(t, "/api/v1/custom_emojis", req.URL.Path)
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprint(w, `[{"shortcode":"blobcat","url":"https://files.example.com/blobcat.png","static_url":"https://files.example.com/blobcat-static.png"},{"shortcode":"evil","url":"javascript:alert(1)"}]`)
+	}))
+	defer server.Close()
+
+	origTransport := http.DefaultClient.Transport
+	http.DefaultClient.Transport = server.Client().Transport
+	defer func() {
+		http.DefaultClient.Transport = origTransport
+	}()
+
+	host := strings.TrimPrefix(server.URL, "https://")
+
+	emoji, err := customEmoji(context.Background(), host)
+	require.NoError(t, err)
+	require.Equal(t, map[string]string{"blobcat": "https://files.example.com/blobcat.png"}, emoji)
+
+	emoji = instanceEmoji(context.Background(), "https://"+host+"/@someone.rss")
+	require.Equal(t, "https://files.example.com/blobcat.png", emoji["blobcat"])
+	require.Equal(t, 1, requests, "cached")
+}
+
+func TestCustomEmojiFailures(t *testing.T) {
+	requests := 0
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		requests++
+		fmt.Fprint(w, `<html>not an api</html>`)
+	}))
+	defer server.Close()
+
+	origTransport := http.DefaultClient.Transport
+	http.DefaultClient.Transport = server.Client().Transport
+	defer func() {
+		http.DefaultClient.Transport = origTransport
+	}()
+
+	host := strings.TrimPrefix(server.URL, "https://")
+
+	_, err := customEmoji(context.Background(), host)
+	require.Error(t, err)
+
+	emoji, err := customEmoji(context.Background(), host)
+	require.NoError(t, err, "failure is cached")
+	require.Empty(t, emoji)
+	require.Equal(t, 1, requests, "not asked again")
+
+	emojiCache.Add(host, missingEmoji{since: time.Now().Add(-emojiFailureCacheTime)})
+	_, err = customEmoji(context.Background(), host)
+	require.Error(t, err)
+	require.Equal(t, 2, requests, "asked again later")
+}
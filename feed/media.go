@@ -0,0 +1,43 @@
+package feed
+
+import (
+	"html"
+	"regexp"
+	"strings"
+)
+
+var mediaTagRE = regexp.MustCompile(`(?i)<(img|video|audio|source|track)\b[^>]*>`)
+var mediaAttrRE = regexp.MustCompile(`(?i)(\s(?:src|poster|srcset)=)("[^"]*"|'[^']*')`)
+
+// RewriteMediaURLs replaces the urls of images, videos, audio and subtitles
+// in postHTML with the result of `rewrite`, including all candidates in
+// `srcset`.
+//
+// `rewrite` gets and returns unescaped urls, e.g. to send them through a
+// proxy.
+func RewriteMediaURLs(postHTML string, rewrite func(mediaURL string) string) string {
+	return mediaTagRE.ReplaceAllStringFunc(postHTML, func(tag string) string {
+		return mediaAttrRE.ReplaceAllStringFunc(tag, func(attr string) string {
+			parts := mediaAttrRE.FindStringSubmatch(attr)
+			quote := parts[2][:1]
+			val := html.UnescapeString(parts[2][1 : len(parts[2])-1])
+
+			if strings.HasPrefix(strings.ToLower(strings.TrimSpace(parts[1])), "srcset") {
+				candidates := strings.Split(val, ",")
+				for i, candidate := range candidates {
+					fields := strings.Fields(candidate)
+					if len(fields) == 0 {
+						continue
+					}
+					fields[0] = rewrite(fields[0])
+					candidates[i] = strings.Join(fields, " ")
+				}
+				val = strings.Join(candidates, ", ")
+			} else {
+				val = rewrite(val)
+			}
+
+			return parts[1] + quote + html.EscapeString(val) + quote
+		})
+	})
+}
@@ -0,0 +1,32 @@
+package feed
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestRewriteMediaURLs(t *testing.T) {
+	rewrite := func(mediaURL string) string {
+		return "/img-proxy?url=" + mediaURL
+	}
+
+	testCases := []struct {
+		html     string
+		expected string
+	}{
+		{`<p>no media</p>`, `<p>no media</p>`},
+		{`<img src="https://64.media.tumblr.com/a.jpg" alt="a"/>`, `<img src="/img-proxy?url=https://64.media.tumblr.com/a.jpg" alt="a"/>`},
+		{`<img srcset="https://example.org/a.jpg 400w, https://example.org/b.jpg 800w" src='https://example.org/a.jpg?x=1&amp;y=2'>`, `<img srcset="/img-proxy?url=https://example.org/a.jpg 400w, /img-proxy?url=https://example.org/b.jpg 800w" src='/img-proxy?url=https://example.org/a.jpg?x=1&amp;y=2'>`},
+		{`<video poster="https://example.org/p.jpg"><source src="https://example.org/v.mp4" type="video/mp4"></video>`, `<video poster="/img-proxy?url=https://example.org/p.jpg"><source src="/img-proxy?url=https://example.org/v.mp4" type="video/mp4"></video>`},
+		{`<track kind="captions" src="https://example.org/en.vtt" />`, `<track kind="captions" src="/img-proxy?url=https://example.org/en.vtt" />`},
+		{`<a href="https://example.org/a.jpg">link</a>`, `<a href="https://example.org/a.jpg">link</a>`},
+		{`<iframe src="https://example.org/embed"></iframe>`, `<iframe src="https://example.org/embed"></iframe>`},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.html, func(t *testing.T) {
+			require.Equal(t, tc.expected, RewriteMediaURLs(tc.html, rewrite))
+		})
+	}
+}
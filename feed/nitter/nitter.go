@@ -54,10 +54,22 @@ func (nr *nitterRSS) Next() (*feed.Post, error) {
 
 	// skip pinned posts as they mess up post sorting (for now)
 	if strings.HasPrefix(post.Title, "<h1>Pinned: ") {
-		return nr.RSS.Next()
+		return nr.Next()
 	}
 
-	// TODO: render nitter posts nicer
+	var mediaURLs []string
+	if item := nr.RSS.FeedItem(); item != nil {
+		for _, content := range item.Extensions["media"]["content"] {
+			if content.Attrs["url"] != "" {
+				mediaURLs = append(mediaURLs, content.Attrs["url"])
+			}
+		}
+	}
+	post.DescriptionHTML = RenderMedia(post.DescriptionHTML, post.URL, mediaURLs)
+
+	if IsRedundantTitle(post.Title, post.DescriptionHTML) {
+		post.Title = ""
+	}
 
 	post.Source = "twitter"
 	post.Author = nr.name
@@ -0,0 +1,88 @@
+package nitter
+
+import (
+	"fmt"
+	"html"
+	"regexp"
+	"strings"
+)
+
+// nitterStyleRE matches the inline styles nitter adds to media in its feeds,
+// which make them tiny.
+var nitterStyleRE = regexp.MustCompile(`\s*style="max-width:\s*250px;?"`)
+
+// nitterGifRE matches gifs, which nitter renders as (slightly broken) videos.
+var nitterGifRE = regexp.MustCompile(`(?s)<video poster="([^"]*)"[^>]*>\s*<source src="([^"]*)" type="video/mp4"[^<]*(?:</source>)?\s*</video>`)
+
+// nitterImagesRE matches consecutive images, i.e. galleries of multiple
+// photos.
+var nitterImagesRE = regexp.MustCompile(`(?:\s*<img [^>]*>)+`)
+var nitterImageSrcRE = regexp.MustCompile(`<img [^>]*src="([^"]*)"`)
+
+// nitterQuoteRE matches the link to a quoted tweet at the end of a tweet.
+var nitterQuoteRE = regexp.MustCompile(`<p><a href="([^"]*/status/\d+)[^"]*">[^<]*</a></p>\s*$`)
+
+// RenderMedia turns the media in the `descriptionHTML` of a nitter feed item
+// into proper images and videos.
+//
+// Multiple images are shown as a gallery, gifs are shown as looping videos and
+// videos (which nitter only includes as a thumbnail) link to the tweet at
+// `postURL`.  `mediaURLs` are additional media, e.g. from media namespaces in
+// the feed, which are added unless they are already part of the tweet.
+func RenderMedia(descriptionHTML string, postURL string, mediaURLs []string) string {
+	descriptionHTML = nitterStyleRE.ReplaceAllString(descriptionHTML, "")
+
+	for _, mediaURL := range mediaURLs {
+		if strings.Contains(descriptionHTML, html.EscapeString(mediaURL)) || strings.Contains(descriptionHTML, mediaURL) {
+			continue
+		}
+
+		if isVideoURL(mediaURL) {
+			descriptionHTML += fmt.Sprintf(`<video controls preload="metadata" src="%s"></video>`, html.EscapeString(mediaURL))
+		} else {
+			descriptionHTML += fmt.Sprintf(`<img src="%s" />`, html.EscapeString(mediaURL))
+		}
+	}
+
+	descriptionHTML = nitterGifRE.ReplaceAllString(descriptionHTML, `<video poster="$1" autoplay muted loop playsinline><source src="$2" type="video/mp4" /></video>`)
+
+	descriptionHTML = nitterImagesRE.ReplaceAllStringFunc(descriptionHTML, func(images string) string {
+		images = strings.TrimSpace(images)
+
+		srcs := nitterImageSrcRE.FindAllStringSubmatch(images, -1)
+		if len(srcs) == 1 && strings.Contains(srcs[0][1], "video_thumb") {
+			return fmt.Sprintf(`<figure class="video">%s<figcaption><a href="%s">▶ play video</a></figcaption></figure>`, images, html.EscapeString(postURL))
+		}
+		if len(srcs) > 1 {
+			return `<div class="gallery">` + images + `</div>`
+		}
+		return images
+	})
+
+	descriptionHTML = nitterQuoteRE.ReplaceAllString(descriptionHTML, `<p class="quote"><a href="$1">quoted tweet</a></p>`)
+
+	return descriptionHTML
+}
+
+func isVideoURL(mediaURL string) bool {
+	mediaURL = strings.ToLower(mediaURL)
+	if idx := strings.Index(mediaURL, "?"); idx != -1 {
+		mediaURL = mediaURL[:idx]
+	}
+	return strings.HasSuffix(mediaURL, ".mp4") || strings.HasSuffix(mediaURL, ".m3u8") || strings.HasSuffix(mediaURL, ".webm")
+}
+
+var tagRE = regexp.MustCompile(`<[^>]+>`)
+
+// IsRedundantTitle returns true if the title only repeats the text of the
+// tweet, as nitter uses the full text as the title of feed items.
+//
+// Titles that add something, e.g. who retweeted a tweet, are not redundant.
+func IsRedundantTitle(titleHTML string, descriptionHTML string) bool {
+	title := plainText(titleHTML)
+	return title == "" || strings.HasPrefix(plainText(descriptionHTML), title)
+}
+
+func plainText(s string) string {
+	return strings.Join(strings.Fields(html.UnescapeString(tagRE.ReplaceAllString(s, " "))), " ")
+}
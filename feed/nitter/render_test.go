@@ -0,0 +1,67 @@
+package nitter
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// mediaTweetFixture is the description of a tweet with multiple images in a
+// nitter feed, followed by a quoted tweet.
+const mediaTweetFixture = `<p>look at these <a href="https://nitter.net/search?q=%23cats">#cats</a></p>
+<img src="https://nitter.net/pic/media%2FFoo1.jpg" style="max-width:250px;" />
+<img src="https://nitter.net/pic/media%2FFoo2.jpg" style="max-width:250px;" />
+<p><a href="https://nitter.net/someone/status/1234#m">nitter.net/someone/status/1234#m</a></p>`
+
+func TestRenderMedia(t *testing.T) {
+	rendered := RenderMedia(mediaTweetFixture, "https://nitter.net/me/status/1", nil)
+	require.NotContains(t, rendered, "max-width", "styles")
+	require.Contains(t, rendered, `<div class="gallery"><img src="https://nitter.net/pic/media%2FFoo1.jpg" />
+<img src="https://nitter.net/pic/media%2FFoo2.jpg" /></div>`, "gallery")
+	require.Contains(t, rendered, `<p class="quote"><a href="https://nitter.net/someone/status/1234">quoted tweet</a></p>`, "quote")
+
+	testCases := []struct {
+		name      string
+		html      string
+		mediaURLs []string
+		expected  string
+	}{
+		{
+			"single image",
+			`<p>hi</p><img src="https://nitter.net/pic/media%2FFoo.jpg" style="max-width:250px;" />`,
+			nil,
+			`<p>hi</p><img src="https://nitter.net/pic/media%2FFoo.jpg" />`,
+		},
+		{
+			"video",
+			`<p>hi</p><img src="https://nitter.net/pic/ext_tw_video_thumb%2F1%2Fpu%2Fimg%2FFoo.jpg" style="max-width:250px;" />`,
+			nil,
+			`<p>hi</p><figure class="video"><img src="https://nitter.net/pic/ext_tw_video_thumb%2F1%2Fpu%2Fimg%2FFoo.jpg" /><figcaption><a href="https://nitter.net/me/status/1">▶ play video</a></figcaption></figure>`,
+		},
+		{
+			"gif",
+			`<video poster="https://nitter.net/pic/thumb.jpg" autoplay muted loop style="max-width:250px;">
+  <source src="https://nitter.net/pic/video.mp4" type="video/mp4"</source></video>`,
+			nil,
+			`<video poster="https://nitter.net/pic/thumb.jpg" autoplay muted loop playsinline><source src="https://nitter.net/pic/video.mp4" type="video/mp4" /></video>`,
+		},
+		{
+			"media namespace",
+			`<p>hi</p><img src="https://nitter.net/pic/a.jpg" />`,
+			[]string{"https://nitter.net/pic/a.jpg", "https://video.twimg.com/b.mp4?tag=1"},
+			`<p>hi</p><img src="https://nitter.net/pic/a.jpg" /><video controls preload="metadata" src="https://video.twimg.com/b.mp4?tag=1"></video>`,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			require.Equal(t, tc.expected, RenderMedia(tc.html, "https://nitter.net/me/status/1", tc.mediaURLs))
+		})
+	}
+}
+
+func TestIsRedundantTitle(t *testing.T) {
+	require.True(t, IsRedundantTitle("<h1>look at these #cats</h1>", mediaTweetFixture), "same text")
+	require.True(t, IsRedundantTitle("<h1>it&#39;s   fine</h1>", "<p>it's fine<br>\nreally</p>"), "whitespace and entities")
+	require.False(t, IsRedundantTitle("<h1>RT by @someone: look at these #cats</h1>", mediaTweetFixture), "retweet")
+}
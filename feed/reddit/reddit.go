@@ -0,0 +1,228 @@
+package reddit
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"html"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/heyLu/numblr/feed"
+)
+
+// Suffixes mark names as Reddit feeds, e.g. `golang@reddit`.
+var Suffixes = []string{"@reddit"}
+
+// BaseURL is where Reddit is fetched from.
+var BaseURL = "https://www.reddit.com"
+
+// maxLimit is the maximum number of posts Reddit lists at once.
+const maxLimit = 100
+
+// IsReddit returns true if `name` has one of the Suffixes.
+func IsReddit(name string) bool {
+	for _, suffix := range Suffixes {
+		if strings.HasSuffix(name, suffix) {
+			return true
+		}
+	}
+	return false
+}
+
+// ListingURL returns the url of the JSON listing for `name`, which is
+// either a subreddit (`golang@reddit`) or the posts of a user
+// (`u_spez@reddit`).
+func ListingURL(name string) (string, error) {
+	for _, suffix := range Suffixes {
+		name = strings.TrimSuffix(name, suffix)
+	}
+	name = strings.TrimPrefix(name, "r/")
+	if strings.HasPrefix(name, "u/") {
+		name = "u_" + name[2:]
+	}
+
+	if name == "" || name == "u_" || strings.ContainsAny(name, "/?#@") {
+		return "", fmt.Errorf("unrecognized reddit feed %q, expected subreddit@reddit or u_user@reddit", name)
+	}
+
+	if strings.HasPrefix(name, "u_") {
+		return BaseURL + "/user/" + url.PathEscape(name[2:]) + "/submitted/.json", nil
+	}
+	return BaseURL + "/r/" + url.PathEscape(name) + "/.json", nil
+}
+
+// Open opens the posts of a subreddit or user, see ListingURL.
+//
+// Reddit blocks generic user agents, see feed.DefaultHeaders.
+func Open(ctx context.Context, name string, search feed.Search) (feed.Feed, error) {
+	listingURL, err := ListingURL(name)
+	if err != nil {
+		return nil, err
+	}
+
+	limit := search.Limit
+	if limit <= 0 {
+		limit = feed.DefaultLimit
+	}
+	if limit > maxLimit {
+		limit = maxLimit
+	}
+
+	// raw_json returns html that is not escaped (again)
+	params := url.Values{"limit": {fmt.Sprint(limit)}, "raw_json": {"1"}}
+	req, err := http.NewRequestWithContext(ctx, "GET", listingURL+"?"+params.Encode(), nil)
+	if err != nil {
+		return nil, fmt.Errorf("new request: %w", err)
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("fetching %q: %w", name, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusForbidden {
+		var reason struct {
+			Reason string `json:"reason"`
+		}
+		_ = json.NewDecoder(io.LimitReader(resp.Body, 64*1024)).Decode(&reason)
+		if reason.Reason == "private" {
+			return nil, fmt.Errorf("%s: %w", name, feed.ErrPrivate)
+		}
+	}
+	if resp.StatusCode != 200 {
+		return nil, feed.StatusError{Code: resp.StatusCode}
+	}
+
+	var l listing
+	err = json.NewDecoder(resp.Body).Decode(&l)
+	if err != nil {
+		return nil, fmt.Errorf("decode: %w", err)
+	}
+
+	posts := make([]post, 0, len(l.Data.Children))
+	for _, child := range l.Data.Children {
+		// pinned posts are not in order and would mess up sorting, other
+		// kinds are e.g. subreddits that Reddit suggests instead
+		if child.Kind != "t3" || child.Data.Stickied {
+			continue
+		}
+		posts = append(posts, child.Data)
+	}
+
+	return &reddit{name: name, listingURL: listingURL, isUser: strings.Contains(listingURL, "/user/"), posts: posts}, nil
+}
+
+type listing struct {
+	Data struct {
+		Children []struct {
+			Kind string `json:"kind"`
+			Data post   `json:"data"`
+		} `json:"children"`
+	} `json:"data"`
+}
+
+type post struct {
+	ID           string  `json:"id"`
+	Title        string  `json:"title"`
+	Author       string  `json:"author"`
+	Subreddit    string  `json:"subreddit"`
+	Permalink    string  `json:"permalink"`
+	URL          string  `json:"url"`
+	Domain       string  `json:"domain"`
+	IsSelf       bool    `json:"is_self"`
+	SelftextHTML string  `json:"selftext_html"`
+	Thumbnail    string  `json:"thumbnail"`
+	PostHint     string  `json:"post_hint"`
+	Score        int     `json:"score"`
+	NumComments  int     `json:"num_comments"`
+	CreatedUTC   float64 `json:"created_utc"`
+	Flair        string  `json:"link_flair_text"`
+	Stickied     bool    `json:"stickied"`
+}
+
+type reddit struct {
+	name       string
+	listingURL string
+	isUser     bool
+	posts      []post
+}
+
+func (r *reddit) Name() string {
+	return r.name
+}
+
+func (r *reddit) Description() string {
+	return ""
+}
+
+func (r *reddit) URL() string {
+	return strings.TrimSuffix(r.listingURL, ".json")
+}
+
+func (r *reddit) Next() (*feed.Post, error) {
+	if len(r.posts) == 0 {
+		return nil, io.EOF
+	}
+
+	p := r.posts[0]
+	r.posts = r.posts[1:]
+
+	postURL := BaseURL + p.Permalink
+	date := time.Unix(int64(p.CreatedUTC), 0).UTC()
+
+	var tags []string
+	if p.Flair != "" {
+		tags = append(tags, p.Flair)
+	}
+
+	return &feed.Post{
+		Source:          "reddit",
+		ID:              p.ID,
+		Author:          r.name,
+		URL:             postURL,
+		Title:           "<h1>" + html.EscapeString(p.Title) + "</h1>",
+		DescriptionHTML: r.render(p, postURL),
+		Tags:            tags,
+		DateString:      date.Format(time.RFC3339),
+		Date:            date,
+	}, nil
+}
+
+// render renders the post with its text, image or thumbnail, and score.
+func (r *reddit) render(p post, postURL string) string {
+	buf := new(strings.Builder)
+	if r.isUser {
+		fmt.Fprintf(buf, `<p class="reddit-subreddit">in <a href="/%s">r/%s</a></p>`, html.EscapeString(p.Subreddit+"@reddit"), html.EscapeString(p.Subreddit))
+	} else {
+		fmt.Fprintf(buf, `<p class="reddit-author">by <a href="/%s">u/%s</a></p>`, html.EscapeString("u_"+p.Author+"@reddit"), html.EscapeString(p.Author))
+	}
+
+	switch {
+	case p.PostHint == "image":
+		fmt.Fprintf(buf, `<img src="%s" />`, html.EscapeString(p.URL))
+	case !p.IsSelf && isThumbnailURL(p.Thumbnail):
+		fmt.Fprintf(buf, `<p><a href="%s"><img class="thumbnail" src="%s" alt="" /> %s</a></p>`, html.EscapeString(p.URL), html.EscapeString(p.Thumbnail), html.EscapeString(p.Domain))
+	case !p.IsSelf:
+		fmt.Fprintf(buf, `<p><a href="%s">%s</a></p>`, html.EscapeString(p.URL), html.EscapeString(p.Domain))
+	}
+
+	buf.WriteString(p.SelftextHTML)
+
+	fmt.Fprintf(buf, `<p class="reddit-score">%d points, <a href="%s">%d comments</a></p>`, p.Score, html.EscapeString(postURL), p.NumComments)
+	return buf.String()
+}
+
+// isThumbnailURL returns true if the thumbnail is an image, Reddit uses
+// e.g. `self` or `nsfw` for posts without one.
+func isThumbnailURL(thumbnail string) bool {
+	return strings.HasPrefix(thumbnail, "https://")
+}
+
+func (r *reddit) Close() error {
+	return nil
+}
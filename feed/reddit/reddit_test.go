@@ -0,0 +1,104 @@
+package reddit
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/heyLu/numblr/feed"
+)
+
+const listingFixture = `{"kind":"Listing","data":{"after":"t3_c","children":[
+{"kind":"t3","data":{"id":"s","title":"Rules","author":"mod","subreddit":"golang","permalink":"/r/golang/comments/s/rules/","is_self":true,"selftext_html":"<p>be nice</p>","thumbnail":"self","score":1,"num_comments":0,"created_utc":1700000000.0,"stickied":true}},
+{"kind":"t3","data":{"id":"a","title":"Go 1.22 & you","author":"gopher","subreddit":"golang","permalink":"/r/golang/comments/a/go_122/","url":"https://www.reddit.com/r/golang/comments/a/go_122/","domain":"self.golang","is_self":true,"selftext_html":"<div class=\"md\"><p>what changed?</p></div>","thumbnail":"self","score":42,"num_comments":7,"created_utc":1709290800.0,"link_flair_text":"discussion"}},
+{"kind":"t3","data":{"id":"b","title":"A gopher","author":"artist","subreddit":"golang","permalink":"/r/golang/comments/b/a_gopher/","url":"https://i.redd.it/gopher.png","domain":"i.redd.it","is_self":false,"post_hint":"image","thumbnail":"https://b.thumbs.redditmedia.com/gopher.jpg","score":100,"num_comments":3,"created_utc":1709287200.0}},
+{"kind":"t3","data":{"id":"c","title":"Release notes","author":"gopher","subreddit":"golang","permalink":"/r/golang/comments/c/release_notes/","url":"https://go.dev/doc/go1.22","domain":"go.dev","is_self":false,"post_hint":"link","thumbnail":"https://b.thumbs.redditmedia.com/go.jpg","score":5,"num_comments":1,"created_utc":1709283600.0}}
+]}}`
+
+func TestOpen(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		switch req.URL.Path {
+		case "/r/golang/.json":
+			assert.Equal(t, "1", req.URL.Query().Get("raw_json"), "raw_json")
+			assert.Equal(t, fmt.Sprint(feed.DefaultLimit), req.URL.Query().Get("limit"), "limit")
+			fmt.Fprint(w, listingFixture)
+		case "/r/secret/.json":
+			w.WriteHeader(http.StatusForbidden)
+			fmt.Fprint(w, `{"reason":"private","message":"Forbidden","error":403}`)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+			fmt.Fprint(w, `{"message":"Not Found","error":404}`)
+		}
+	}))
+	defer server.Close()
+
+	origBaseURL := BaseURL
+	BaseURL = server.URL
+	defer func() {
+		BaseURL = origBaseURL
+	}()
+
+	f, err := Open(context.Background(), "golang@reddit", feed.Search{})
+	require.NoError(t, err, "open")
+	assert.Equal(t, server.URL+"/r/golang/", f.URL(), "url")
+
+	self, err := f.Next()
+	require.NoError(t, err, "self post")
+	assert.Equal(t, "a", self.ID, "stickied posts are skipped")
+	assert.Equal(t, "golang@reddit", self.Author, "author")
+	assert.Equal(t, server.URL+"/r/golang/comments/a/go_122/", self.URL, "url")
+	assert.Equal(t, "<h1>Go 1.22 &amp; you</h1>", self.Title, "title")
+	assert.Equal(t, []string{"discussion"}, self.Tags, "flair")
+	assert.Equal(t, time.Date(2024, 3, 1, 11, 0, 0, 0, time.UTC), self.Date, "date")
+	assert.Contains(t, self.DescriptionHTML, `<a href="/u_gopher@reddit">u/gopher</a>`, "author link")
+	assert.Contains(t, self.DescriptionHTML, `<p>what changed?</p>`, "self text")
+	assert.Contains(t, self.DescriptionHTML, `42 points`, "score")
+	assert.Contains(t, self.DescriptionHTML, `7 comments`, "comments")
+
+	image, err := f.Next()
+	require.NoError(t, err, "image post")
+	assert.Empty(t, image.Tags, "no flair")
+	assert.Contains(t, image.DescriptionHTML, `<img src="https://i.redd.it/gopher.png" />`, "image")
+	assert.NotContains(t, image.DescriptionHTML, "thumbs.redditmedia.com", "no thumbnail")
+
+	link, err := f.Next()
+	require.NoError(t, err, "link post")
+	assert.Contains(t, link.DescriptionHTML, `<img class="thumbnail" src="https://b.thumbs.redditmedia.com/go.jpg" alt="" /> go.dev</a>`, "thumbnail")
+	assert.Contains(t, link.DescriptionHTML, `href="https://go.dev/doc/go1.22"`, "link")
+
+	_, err = f.Next()
+	assert.Equal(t, io.EOF, err, "end")
+
+	_, err = Open(context.Background(), "secret@reddit", feed.Search{})
+	assert.True(t, errors.Is(err, feed.ErrPrivate), "private: %s", err)
+
+	_, err = Open(context.Background(), "u_nobody@reddit", feed.Search{})
+	assert.Equal(t, feed.StatusError{Code: http.StatusNotFound}, err, "not found")
+}
+
+func TestListingURL(t *testing.T) {
+	for name, expected := range map[string]string{
+		"golang@reddit":   "https://www.reddit.com/r/golang/.json",
+		"r/golang@reddit": "https://www.reddit.com/r/golang/.json",
+		"u_spez@reddit":   "https://www.reddit.com/user/spez/submitted/.json",
+		"u/spez@reddit":   "https://www.reddit.com/user/spez/submitted/.json",
+	} {
+		listingURL, err := ListingURL(name)
+		assert.NoError(t, err, name)
+		assert.Equal(t, expected, listingURL, name)
+	}
+
+	for _, name := range []string{"@reddit", "u_@reddit", "golang/top@reddit"} {
+		_, err := ListingURL(name)
+		assert.Error(t, err, name)
+	}
+}
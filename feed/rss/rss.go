@@ -3,6 +3,7 @@ package rss
 import (
 	"bytes"
 	"context"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
@@ -13,26 +14,30 @@ import (
 	"github.com/andybalholm/cascadia"
 	"github.com/heyLu/numblr/feed"
 	"github.com/mmcdole/gofeed"
+	"github.com/mmcdole/gofeed/atom"
 	"golang.org/x/net/html"
 )
 
-func init() {
-	if http.DefaultClient.Jar == nil {
-		cookiesPerDomain := make(map[string][]*http.Cookie)
-		cookiesPerDomain["livejournal.com"] = []*http.Cookie{
-			{Name: "adult_explicit", Value: "1"},
-		}
-		http.DefaultClient.Jar = domainCookieJar(cookiesPerDomain)
-	}
-}
-
 var relAlternateMatcher = cascadia.MustCompile(`link[rel=alternate]`)
 
+// ErrNoFeed is returned by Open if the page at `name` is not a feed and does
+// not link to one.
+var ErrNoFeed = errors.New("no feed found")
+
 // Open opens the RSS feed at `name`, trying to find it automatically using
 // `rel=alternate` links.
-func Open(ctx context.Context, name string, _ feed.Search) (feed.Feed, error) {
+//
+// When paging (if the search has a BeforeID), the feed follows `rel=next`
+// links to older pages until there are enough posts before the cursor.
+//
+// Feeds are fetched conditionally if the search has the validators of the
+// cached feed, returning feed.ErrNotModified if it did not change.
+func Open(ctx context.Context, name string, search feed.Search) (feed.Feed, error) {
 	feedURL := name
-	if strings.Contains(name, "@") {
+	// `user@host` is the feed of the profile at `host/@user`, e.g. on
+	// Mastodon
+	isURL := strings.HasPrefix(name, "http://") || strings.HasPrefix(name, "https://")
+	if strings.Contains(name, "@") && !isURL {
 		parts := strings.SplitN(name, "@", 2)
 		if len(parts) == 0 {
 			return nil, fmt.Errorf("unrecognized feed %q", name)
@@ -53,16 +58,23 @@ func Open(ctx context.Context, name string, _ feed.Search) (feed.Feed, error) {
 	if err != nil {
 		return nil, fmt.Errorf("new request: %w", err)
 	}
+	feed.SetConditional(req, search)
 	resp, err := http.DefaultClient.Do(req)
 	if err != nil {
 		return nil, fmt.Errorf("open: %w", err)
 	}
 	defer resp.Body.Close()
 
+	if resp.StatusCode == http.StatusNotModified {
+		return nil, feed.ErrNotModified
+	}
 	if resp.StatusCode != 200 {
 		return nil, feed.StatusError{Code: resp.StatusCode}
 	}
 
+	etag := resp.Header.Get("ETag")
+	lastModified := resp.Header.Get("Last-Modified")
+
 	buf := new(bytes.Buffer)
 	_, err = io.Copy(buf, resp.Body)
 	if err != nil {
@@ -99,7 +111,7 @@ func Open(ctx context.Context, name string, _ feed.Search) (feed.Feed, error) {
 		}
 
 		if !found {
-			return nil, fmt.Errorf("no feed found")
+			return nil, ErrNoFeed
 		}
 
 		feedURL, err := baseURL.Parse(url)
@@ -125,15 +137,104 @@ func Open(ctx context.Context, name string, _ feed.Search) (feed.Feed, error) {
 		}
 
 		r = strings.NewReader(buf.String())
+		baseURL = feedURL
+
+		// the validators are the ones of the page, which might not change
+		// when the feed does
+		etag, lastModified = "", ""
+	}
+
+	parsed, nextURL, err := parseFeed(r)
+	if err != nil {
+		return nil, err
+	}
+
+	limit := search.Limit
+	if limit <= 0 {
+		limit = feed.DefaultLimit
 	}
 
+	return &RSS{name: name, feed: parsed, ctx: ctx, search: search, limit: limit, pageURL: baseURL, nextURL: nextURL, etag: etag, lastModified: lastModified}, nil
+}
+
+// MaxPages is the maximum number of pages that are fetched from feeds that
+// are paged using `rel=next` links.
+var MaxPages = 10
+
+// parseFeed parses the feed in `r`, and returns the `rel=next` link to the
+// next page if there is one.
+func parseFeed(r io.Reader) (*gofeed.Feed, string, error) {
+	translator := &pagedAtomTranslator{}
 	parser := gofeed.NewParser()
-	feed, err := parser.Parse(r)
+	parser.AtomTranslator = translator
+	parsed, err := parser.Parse(r)
+	if err != nil {
+		return nil, "", fmt.Errorf("parse: %w", err)
+	}
+
+	nextURL := translator.nextURL
+	if nextURL == "" {
+		// rss feeds can contain atom links as well
+		for _, link := range parsed.Extensions["atom"]["link"] {
+			if link.Attrs["rel"] == "next" {
+				nextURL = link.Attrs["href"]
+			}
+		}
+	}
+
+	return parsed, nextURL, nil
+}
+
+// pagedAtomTranslator remembers the `rel=next` link of an atom feed, which
+// is not part of the translated feed.
+type pagedAtomTranslator struct {
+	gofeed.DefaultAtomTranslator
+	nextURL string
+}
+
+func (pat *pagedAtomTranslator) Translate(parsed interface{}) (*gofeed.Feed, error) {
+	if atomFeed, ok := parsed.(*atom.Feed); ok {
+		for _, link := range atomFeed.Links {
+			if link.Rel == "next" {
+				pat.nextURL = link.Href
+			}
+		}
+	}
+	return pat.DefaultAtomTranslator.Translate(parsed)
+}
+
+// fetchPage fetches and parses the page at `nextURL`, relative to the
+// current page.
+func (rss *RSS) fetchPage(nextURL string) error {
+	pageURL, err := rss.pageURL.Parse(nextURL)
+	if err != nil {
+		return fmt.Errorf("invalid next page %q: %w", nextURL, err)
+	}
+
+	req, err := http.NewRequestWithContext(rss.ctx, "GET", pageURL.String(), nil)
+	if err != nil {
+		return fmt.Errorf("new request: %w", err)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("open next page: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != 200 {
+		return fmt.Errorf("open next page: %w", feed.StatusError{Code: resp.StatusCode})
+	}
+
+	parsed, next, err := parseFeed(resp.Body)
 	if err != nil {
-		return nil, fmt.Errorf("parse: %w", err)
+		return err
 	}
 
-	return &RSS{name: name, feed: feed}, nil
+	rss.feed.Items = parsed.Items
+	rss.pageURL = pageURL
+	rss.nextURL = next
+	rss.pages++
+	return nil
 }
 
 func hasAttribute(node *html.Node, attrName, attrValue string) bool {
@@ -150,6 +251,17 @@ type RSS struct {
 	name string
 	feed *gofeed.Feed
 	item *gofeed.Item
+
+	ctx     context.Context
+	search  feed.Search
+	limit   int
+	found   int
+	pages   int
+	pageURL *url.URL
+	nextURL string
+
+	etag         string
+	lastModified string
 }
 
 // Name implements Feed.Name.
@@ -167,10 +279,38 @@ func (rss *RSS) URL() string {
 	return rss.feed.Link
 }
 
+// ETag implements feed.Validators.ETag.
+func (rss *RSS) ETag() string {
+	return rss.etag
+}
+
+// LastModified implements feed.Validators.LastModified.
+func (rss *RSS) LastModified() string {
+	return rss.lastModified
+}
+
+// SetCursor implements feed.Paginatable.SetCursor.
+func (rss *RSS) SetCursor(id string) {
+	if id != rss.search.BeforeID {
+		rss.search.BeforeID = id
+		rss.search.BeforeDate = time.Time{}
+	}
+}
+
 // Next implements Feed.Next.
 func (rss *RSS) Next() (*feed.Post, error) {
 	if len(rss.feed.Items) == 0 {
-		return nil, io.EOF
+		if rss.search.BeforeID == "" || rss.nextURL == "" || rss.found >= rss.limit || rss.pages+1 >= MaxPages {
+			return nil, io.EOF
+		}
+
+		err := rss.fetchPage(rss.nextURL)
+		if err != nil {
+			return nil, err
+		}
+		if len(rss.feed.Items) == 0 {
+			return nil, io.EOF
+		}
 	}
 
 	item := rss.feed.Items[0]
@@ -197,12 +337,15 @@ func (rss *RSS) Next() (*feed.Post, error) {
 	if content == "" {
 		content = item.Description
 	}
+	if imageURL := itemImage(item); imageURL != "" && !strings.Contains(content, imageURL) {
+		content = fmt.Sprintf(`<img src="%s" />`, html.EscapeString(imageURL)) + content
+	}
 	for _, encl := range item.Enclosures {
 		if strings.HasPrefix(encl.Type, "image") {
 			content += fmt.Sprintf(`<img src="%s" />`, encl.URL)
 		}
 	}
-	return &feed.Post{
+	post := &feed.Post{
 		Source:          "web",
 		ID:              item.GUID,
 		Author:          rss.name,
@@ -213,7 +356,35 @@ func (rss *RSS) Next() (*feed.Post, error) {
 		Tags:            item.Categories,
 		DateString:      dateString,
 		Date:            *date,
-	}, nil
+	}
+	if rss.search.IsAfterCursor(post) {
+		rss.found++
+	}
+	return post, nil
+}
+
+// itemImage returns the url of the art of a single item, as used by podcasts
+// (`itunes:image`) and photo feeds (`media:thumbnail` and `media:content`).
+//
+// Image enclosures are not included, as they are shown separately.
+func itemImage(item *gofeed.Item) string {
+	if item.ITunesExt != nil && item.ITunesExt.Image != "" {
+		return item.ITunesExt.Image
+	}
+
+	media := item.Extensions["media"]
+	for _, thumbnail := range media["thumbnail"] {
+		if thumbnail.Attrs["url"] != "" {
+			return thumbnail.Attrs["url"]
+		}
+	}
+	for _, content := range media["content"] {
+		if strings.HasPrefix(content.Attrs["type"], "image") || content.Attrs["medium"] == "image" {
+			return content.Attrs["url"]
+		}
+	}
+
+	return ""
 }
 
 // FeedItem returns the current gofeed.Item, as navigated to using `Next`.
@@ -225,22 +396,3 @@ func (rss *RSS) FeedItem() *gofeed.Item {
 func (rss *RSS) Close() error {
 	return nil
 }
-
-type domainCookieJar map[string][]*http.Cookie
-
-func (dcj domainCookieJar) SetCookies(u *url.URL, cookies []*http.Cookie) {}
-
-func (dcj domainCookieJar) Cookies(u *url.URL) []*http.Cookie {
-	cookies, ok := dcj[u.Host]
-	if ok {
-		return cookies
-	}
-	domainParts := strings.SplitN(u.Host, ".", 2)
-	for i := range domainParts {
-		cookies, ok := dcj[strings.Join(domainParts[i:], ".")]
-		if ok {
-			return cookies
-		}
-	}
-	return nil
-}
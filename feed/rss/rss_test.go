@@ -0,0 +1,151 @@
+package rss
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/heyLu/numblr/feed"
+)
+
+const atomPage1 = `<?xml version="1.0" encoding="utf-8"?>
+<feed xmlns="http://www.w3.org/2005/Atom">
+	<title>paged</title>
+	<id>urn:paged</id>
+	<updated>2022-06-04T00:00:00Z</updated>
+	<link rel="alternate" href="https://example.org/" />
+	<link rel="next" href="/feed.atom?page=2" />
+	<entry><id>urn:paged:4</id><title>four</title><link href="https://example.org/4" /><updated>2022-06-04T00:00:00Z</updated><content type="html">four</content></entry>
+	<entry><id>urn:paged:3</id><title>three</title><link href="https://example.org/3" /><updated>2022-06-03T00:00:00Z</updated><content type="html">three</content></entry>
+</feed>`
+
+const atomPage2 = `<?xml version="1.0" encoding="utf-8"?>
+<feed xmlns="http://www.w3.org/2005/Atom">
+	<title>paged</title>
+	<id>urn:paged</id>
+	<updated>2022-06-04T00:00:00Z</updated>
+	<link rel="alternate" href="https://example.org/" />
+	<entry><id>urn:paged:2</id><title>two</title><link href="https://example.org/2" /><updated>2022-06-02T00:00:00Z</updated><content type="html">two</content></entry>
+	<entry><id>urn:paged:1</id><title>one</title><link href="https://example.org/1" /><updated>2022-06-01T00:00:00Z</updated><content type="html">one</content></entry>
+</feed>`
+
+func TestPagedAtom(t *testing.T) {
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		requests++
+		w.Header().Set("Content-Type", "application/atom+xml")
+		if req.URL.Query().Get("page") == "2" {
+			fmt.Fprint(w, atomPage2)
+			return
+		}
+		fmt.Fprint(w, atomPage1)
+	}))
+	defer server.Close()
+
+	collect := func(search feed.Search, cursor string) []string {
+		f, err := Open(context.Background(), server.URL+"/feed.atom", search)
+		require.NoError(t, err)
+		defer f.Close()
+		if cursor != "" {
+			f.(feed.Paginatable).SetCursor(cursor)
+		}
+
+		ids := make([]string, 0, 4)
+		post, err := f.Next()
+		for err == nil {
+			ids = append(ids, post.ID)
+			post, err = f.Next()
+		}
+		require.True(t, errors.Is(err, io.EOF), "expected EOF, but got %s", err)
+		return ids
+	}
+
+	require.Equal(t, []string{"urn:paged:4", "urn:paged:3"}, collect(feed.Search{}, ""), "first page only")
+	require.Equal(t, 1, requests, "next page is not fetched without a cursor")
+
+	requests = 0
+	cursor := feed.Search{BeforeID: "urn:paged:3", BeforeDate: time.Date(2022, time.June, 3, 0, 0, 0, 0, time.UTC), Limit: 2}
+	require.Equal(t, []string{"urn:paged:4", "urn:paged:3", "urn:paged:2", "urn:paged:1"}, collect(cursor, ""), "both pages")
+	require.Equal(t, 2, requests, "next page is fetched when paging")
+
+	requests = 0
+	require.Equal(t, []string{"urn:paged:4", "urn:paged:3", "urn:paged:2", "urn:paged:1"}, collect(feed.Search{Limit: 2}, "urn:paged:3"), "SetCursor")
+	require.Equal(t, 2, requests, "next page is fetched after SetCursor")
+}
+
+const podcastRSS = `<?xml version="1.0" encoding="utf-8"?>
+<rss version="2.0" xmlns:itunes="http://www.itunes.com/dtds/podcast-1.0.dtd" xmlns:media="http://search.yahoo.com/mrss/">
+<channel>
+	<title>podcast</title>
+	<link>https://example.org/</link>
+	<itunes:image href="https://example.org/podcast.jpg" />
+	<item><guid>ep3</guid><title>three</title><link>https://example.org/3</link><description>episode three</description><itunes:image href="https://example.org/3.jpg" /></item>
+	<item><guid>ep2</guid><title>two</title><link>https://example.org/2</link><description>episode two</description><media:thumbnail url="https://example.org/2-thumb.jpg" /></item>
+	<item><guid>ep1</guid><title>one</title><link>https://example.org/1</link><description>episode one</description><media:content url="https://example.org/1.mp3" type="audio/mpeg" /><media:content url="https://example.org/1.jpg" medium="image" /></item>
+	<item><guid>ep0</guid><title>zero</title><link>https://example.org/0</link><description>&lt;img src="https://example.org/0.jpg" /&gt; episode zero</description><media:thumbnail url="https://example.org/0.jpg" /></item>
+</channel>
+</rss>`
+
+func TestItemImages(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set("Content-Type", "application/rss+xml")
+		fmt.Fprint(w, podcastRSS)
+	}))
+	defer server.Close()
+
+	f, err := Open(context.Background(), server.URL+"/feed.rss", feed.Search{})
+	require.NoError(t, err)
+	defer f.Close()
+
+	descriptions := make([]string, 0, 4)
+	post, err := f.Next()
+	for err == nil {
+		descriptions = append(descriptions, post.DescriptionHTML)
+		post, err = f.Next()
+	}
+	require.True(t, errors.Is(err, io.EOF), "expected EOF, but got %s", err)
+
+	require.Equal(t, []string{
+		`<img src="https://example.org/3.jpg" />episode three`,
+		`<img src="https://example.org/2-thumb.jpg" />episode two`,
+		`<img src="https://example.org/1.jpg" />episode one`,
+		`<img src="https://example.org/0.jpg" /> episode zero`,
+	}, descriptions)
+}
+
+func TestConditional(t *testing.T) {
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		requests++
+		if req.Header.Get("If-None-Match") == `"page-1"` {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Header().Set("ETag", `"page-1"`)
+		w.Header().Set("Last-Modified", "Sat, 04 Jun 2022 00:00:00 GMT")
+		w.Header().Set("Content-Type", "application/atom+xml")
+		fmt.Fprint(w, atomPage1)
+	}))
+	defer server.Close()
+
+	f, err := Open(context.Background(), server.URL+"/feed.atom", feed.Search{})
+	require.NoError(t, err)
+	require.NoError(t, f.Close())
+	require.Equal(t, `"page-1"`, f.(feed.Validators).ETag())
+	require.Equal(t, "Sat, 04 Jun 2022 00:00:00 GMT", f.(feed.Validators).LastModified())
+
+	_, err = Open(context.Background(), server.URL+"/feed.atom", feed.Search{IfNoneMatch: `"page-1"`})
+	require.ErrorIs(t, err, feed.ErrNotModified, "unchanged")
+
+	f, err = Open(context.Background(), server.URL+"/feed.atom", feed.Search{IfNoneMatch: `"page-0"`})
+	require.NoError(t, err, "changed")
+	require.NoError(t, f.Close())
+	require.Equal(t, 3, requests)
+}
@@ -0,0 +1,370 @@
+// Package scraper reads blogs that have no feeds from their (paginated) html,
+// using css selectors that are configured per site.
+package scraper
+
+import (
+	"bytes"
+	"context"
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/andybalholm/cascadia"
+	lru "github.com/hashicorp/golang-lru"
+	"golang.org/x/net/html"
+
+	"github.com/heyLu/numblr/feed"
+)
+
+// Config are the css selectors used to find posts on the pages of a site.
+type Config struct {
+	// Post matches the elements containing a post.
+	Post string `json:"post"`
+	// Title matches the title within a post (optional).
+	Title string `json:"title"`
+	// Body matches the content of a post, the whole post if not set.
+	Body string `json:"body"`
+	// Date matches the date of a post, either from the `datetime`
+	// attribute or from its text.
+	Date string `json:"date"`
+	// DateFormat is the format of the date, as used by time.Parse.  RFC3339
+	// and `2006-01-02` are tried if it is not set.
+	DateFormat string `json:"date_format"`
+	// Link matches the link to the post, the first link in the post if not
+	// set.
+	Link string `json:"link"`
+	// Next matches the link to the next page of (older) posts (optional).
+	Next string `json:"next"`
+
+	post, title, body, date, link, next cascadia.Selector
+}
+
+// Configs maps hosts to the configuration used to scrape them, which are
+// the Builtin ones unless configured otherwise.
+var Configs = Builtin()
+
+//go:embed builtin-config.json
+var builtinConfig string
+
+// Builtin returns the configurations for sites that can be read without
+// configuring anything, see builtin-config.json.
+func Builtin() map[string]*Config {
+	configs, err := LoadConfigs(strings.NewReader(builtinConfig))
+	if err != nil {
+		panic(fmt.Sprintf("invalid builtin config: %s", err))
+	}
+	return configs
+}
+
+// LoadConfigs parses the per-host configurations as JSON from `r`, see
+// example-config.json.
+func LoadConfigs(r io.Reader) (map[string]*Config, error) {
+	var configs map[string]*Config
+	err := json.NewDecoder(r).Decode(&configs)
+	if err != nil {
+		return nil, fmt.Errorf("decode: %w", err)
+	}
+
+	for host, config := range configs {
+		err := config.compile()
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", host, err)
+		}
+	}
+
+	return configs, nil
+}
+
+func (c *Config) compile() error {
+	if c.Post == "" {
+		return fmt.Errorf("post selector is required")
+	}
+
+	for _, sel := range []struct {
+		raw      string
+		compiled *cascadia.Selector
+	}{
+		{c.Post, &c.post},
+		{c.Title, &c.title},
+		{c.Body, &c.body},
+		{c.Date, &c.date},
+		{c.Link, &c.link},
+		{c.Next, &c.next},
+	} {
+		if sel.raw == "" {
+			continue
+		}
+
+		compiled, err := cascadia.Compile(sel.raw)
+		if err != nil {
+			return fmt.Errorf("invalid selector %q: %w", sel.raw, err)
+		}
+		*sel.compiled = compiled
+	}
+
+	return nil
+}
+
+// Matches returns true if there is a configuration for the site of the feed
+// `name`.
+func Matches(name string) bool {
+	_, _, ok := configFor(name)
+	return ok
+}
+
+func configFor(name string) (*Config, *url.URL, bool) {
+	if !strings.HasPrefix(name, "http") {
+		name = "https://" + name
+	}
+
+	u, err := url.Parse(name)
+	if err != nil {
+		return nil, nil, false
+	}
+
+	config, ok := Configs[u.Hostname()]
+	return config, u, ok
+}
+
+// MaxPages is the maximum number of pages that are fetched when paging.
+var MaxPages = 10
+
+// Open opens the blog at `name` (a url, with or without the scheme) using
+// the configuration for its host.
+//
+// When paging (if the search has a BeforeID), the feed follows the next links
+// to older pages until there are enough posts before the cursor.
+func Open(ctx context.Context, name string, search feed.Search) (feed.Feed, error) {
+	config, pageURL, ok := configFor(name)
+	if !ok {
+		return nil, fmt.Errorf("no scraper config for %q", name)
+	}
+
+	limit := search.Limit
+	if limit <= 0 {
+		limit = feed.DefaultLimit
+	}
+
+	s := &scraper{
+		name:   name,
+		url:    pageURL.String(),
+		config: config,
+		ctx:    ctx,
+		search: search,
+		limit:  limit,
+	}
+
+	err := s.fetchPage(pageURL)
+	if err != nil {
+		return nil, err
+	}
+	s.pages = 0
+
+	return s, nil
+}
+
+type scraper struct {
+	name   string
+	url    string
+	config *Config
+
+	ctx     context.Context
+	search  feed.Search
+	limit   int
+	found   int
+	pages   int
+	posts   []*feed.Post
+	nextURL *url.URL
+
+	// undatedSince is the date of the first undated post, see
+	// firstSeen.  undated is the number of undated posts so far.
+	undatedSince time.Time
+	undated      int
+}
+
+// firstSeen remembers the dates of posts without one by url, so that they
+// don't move to the top every time the page is fetched.
+var firstSeen, _ = lru.New(10000)
+
+func (s *scraper) fetchPage(pageURL *url.URL) error {
+	req, err := http.NewRequestWithContext(s.ctx, "GET", pageURL.String(), nil)
+	if err != nil {
+		return fmt.Errorf("new request: %w", err)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("fetching %q: %w", pageURL, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != 200 {
+		return feed.StatusError{Code: resp.StatusCode}
+	}
+
+	node, err := html.Parse(resp.Body)
+	if err != nil {
+		return fmt.Errorf("parse: %w", err)
+	}
+
+	s.posts = s.config.parsePosts(node, pageURL)
+	for _, post := range s.posts {
+		if !post.Date.IsZero() {
+			continue
+		}
+
+		if s.undatedSince.IsZero() {
+			s.undatedSince = time.Now().UTC()
+			if lastModified, err := http.ParseTime(resp.Header.Get("Last-Modified")); err == nil {
+				s.undatedSince = lastModified.UTC()
+			}
+		}
+
+		// posts that are seen for the first time keep the order of the
+		// pages
+		date := s.undatedSince.Add(-time.Duration(s.undated) * time.Second)
+		if cached, ok := firstSeen.Get(post.ID); ok {
+			date = cached.(time.Time)
+		} else {
+			firstSeen.Add(post.ID, date)
+		}
+		post.Date = date
+		post.DateString = date.Format(time.RFC3339)
+		s.undated++
+	}
+	s.nextURL = nil
+	if s.config.next != nil {
+		if next := cascadia.Query(node, s.config.next); next != nil {
+			nextURL, err := pageURL.Parse(feed.Attr(next, "href"))
+			if err == nil && feed.Attr(next, "href") != "" {
+				s.nextURL = nextURL
+			}
+		}
+	}
+	s.pages++
+
+	return nil
+}
+
+// parsePosts returns the posts on the page, skipping everything that does
+// not have a link to the post.  Posts without a date have a zero Date.
+func (c *Config) parsePosts(node *html.Node, pageURL *url.URL) []*feed.Post {
+	postNodes := cascadia.QueryAll(node, c.post)
+	posts := make([]*feed.Post, 0, len(postNodes))
+	for _, postNode := range postNodes {
+		var link *html.Node
+		if c.link != nil {
+			link = cascadia.Query(postNode, c.link)
+		} else {
+			link = cascadia.Query(postNode, linkMatcher)
+		}
+		if link == nil || feed.Attr(link, "href") == "" {
+			continue
+		}
+		postURL, err := pageURL.Parse(feed.Attr(link, "href"))
+		if err != nil {
+			continue
+		}
+
+		post := &feed.Post{
+			Source: "scraper",
+			ID:     postURL.String(),
+			URL:    postURL.String(),
+		}
+
+		if c.title != nil {
+			if title := cascadia.Query(postNode, c.title); title != nil {
+				post.Title = fmt.Sprintf("<h1>%s</h1>", html.EscapeString(strings.TrimSpace(feed.TextContent(title))))
+			}
+		}
+
+		bodyNodes := []*html.Node{postNode}
+		if c.body != nil {
+			bodyNodes = cascadia.QueryAll(postNode, c.body)
+		}
+		buf := new(bytes.Buffer)
+		for _, bodyNode := range bodyNodes {
+			feed.MakeAbsolute(bodyNode, pageURL)
+			err := html.Render(buf, bodyNode)
+			if err != nil {
+				continue
+			}
+		}
+		post.DescriptionHTML = buf.String()
+
+		if c.date != nil {
+			if date := cascadia.Query(postNode, c.date); date != nil {
+				post.DateString = feed.Attr(date, "datetime")
+				if post.DateString == "" {
+					post.DateString = strings.TrimSpace(feed.TextContent(date))
+				}
+				post.Date = c.parseDate(post.DateString)
+			}
+		}
+		posts = append(posts, post)
+	}
+
+	return posts
+}
+
+func (c *Config) parseDate(dateString string) time.Time {
+	formats := []string{time.RFC3339, "2006-01-02"}
+	if c.DateFormat != "" {
+		formats = []string{c.DateFormat}
+	}
+
+	for _, format := range formats {
+		date, err := time.Parse(format, dateString)
+		if err == nil {
+			return date.UTC()
+		}
+	}
+	return time.Time{}
+}
+
+var linkMatcher = cascadia.MustCompile("a[href]")
+
+func (s *scraper) Name() string {
+	return s.name
+}
+
+func (s *scraper) Description() string {
+	return ""
+}
+
+func (s *scraper) URL() string {
+	return s.url
+}
+
+func (s *scraper) Next() (*feed.Post, error) {
+	if len(s.posts) == 0 {
+		if s.search.BeforeID == "" || s.nextURL == nil || s.found >= s.limit || s.pages+1 >= MaxPages {
+			return nil, io.EOF
+		}
+
+		err := s.fetchPage(s.nextURL)
+		if err != nil {
+			return nil, fmt.Errorf("next page: %w", err)
+		}
+		if len(s.posts) == 0 {
+			return nil, io.EOF
+		}
+	}
+
+	post := s.posts[0]
+	s.posts = s.posts[1:]
+
+	post.Author = s.name
+	if s.search.IsAfterCursor(post) {
+		s.found++
+	}
+	return post, nil
+}
+
+func (s *scraper) Close() error {
+	return nil
+}
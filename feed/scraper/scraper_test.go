@@ -0,0 +1,194 @@
+package scraper
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/heyLu/numblr/feed"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/net/html"
+)
+
+func TestScraper(t *testing.T) {
+	f, err := os.Open("example-config.json")
+	require.NoError(t, err, "open config")
+	defer f.Close()
+
+	configs, err := LoadConfigs(f)
+	require.NoError(t, err, "load config")
+	require.Contains(t, configs, "blog.example.org")
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		switch req.URL.Query().Get("page") {
+		case "":
+			io.WriteString(w, page1Fixture)
+		case "2":
+			io.WriteString(w, page2Fixture)
+		default:
+			http.NotFound(w, req)
+		}
+	}))
+	defer server.Close()
+
+	Configs = map[string]*Config{"127.0.0.1": configs["blog.example.org"]}
+	defer func() { Configs = Builtin() }()
+
+	require.True(t, Matches(server.URL), "matches")
+	require.False(t, Matches("blog.example.org"), "not configured")
+
+	blog, err := Open(context.Background(), server.URL, feed.Search{})
+	require.NoError(t, err, "open")
+
+	post, err := blog.Next()
+	require.NoError(t, err, "next")
+	assert.Equal(t, server.URL+"/posts/2", post.ID, "id")
+	assert.Equal(t, server.URL+"/posts/2", post.URL, "url")
+	assert.Equal(t, server.URL, post.Author, "author")
+	assert.Equal(t, "<h1>Second &amp; last</h1>", post.Title, "title")
+	assert.Equal(t, `<div class="entry-content"><p>Hello <img src="`+server.URL+`/img/hi.png"/></p></div>`, post.DescriptionHTML, "body")
+	assert.Equal(t, time.Date(2024, time.March, 2, 10, 0, 0, 0, time.UTC), post.Date, "date")
+
+	post, err = blog.Next()
+	require.NoError(t, err, "next")
+	assert.Equal(t, server.URL+"/posts/1", post.ID, "id")
+
+	_, err = blog.Next()
+	assert.Equal(t, io.EOF, err, "only the first page without paging")
+
+	blog, err = Open(context.Background(), server.URL, feed.Search{BeforeID: server.URL + "/posts/1"})
+	require.NoError(t, err, "open paging")
+
+	ids := []string{}
+	for {
+		post, err := blog.Next()
+		if err == io.EOF {
+			break
+		}
+		require.NoError(t, err, "next")
+		ids = append(ids, post.ID)
+	}
+	assert.Equal(t, []string{server.URL + "/posts/2", server.URL + "/posts/1", server.URL + "/posts/0"}, ids, "follows next link")
+}
+
+func TestLoadConfigsInvalid(t *testing.T) {
+	_, err := LoadConfigs(strings.NewReader(`{"example.org": {"title": "h1"}}`))
+	assert.Error(t, err, "post selector is required")
+
+	_, err = LoadConfigs(strings.NewReader(`{"example.org": {"post": "article[", "title": "h1"}}`))
+	assert.Error(t, err, "invalid selector")
+}
+
+func TestUndatedPosts(t *testing.T) {
+	f, err := os.Open("example-config.json")
+	require.NoError(t, err, "open config")
+	defer f.Close()
+
+	configs, err := LoadConfigs(f)
+	require.NoError(t, err, "load config")
+
+	lastModified := time.Date(2024, time.March, 2, 10, 0, 0, 0, time.UTC)
+	posts := []string{"b", "a"}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set("Last-Modified", lastModified.Format(http.TimeFormat))
+		io.WriteString(w, "<!doctype html><html><body>")
+		for _, post := range posts {
+			io.WriteString(w, `<article class="post"><h2 class="entry-title"><a href="/posts/`+post+`">`+post+`</a></h2></article>`)
+		}
+		io.WriteString(w, "</body></html>")
+	}))
+	defer server.Close()
+
+	Configs = map[string]*Config{"127.0.0.1": configs["blog.example.org"]}
+	defer func() { Configs = Builtin() }()
+
+	dates := func() map[string]time.Time {
+		blog, err := Open(context.Background(), server.URL, feed.Search{})
+		require.NoError(t, err, "open")
+
+		dates := make(map[string]time.Time)
+		for {
+			post, err := blog.Next()
+			if err == io.EOF {
+				break
+			}
+			require.NoError(t, err, "next")
+			dates[strings.TrimPrefix(post.ID, server.URL+"/posts/")] = post.Date
+		}
+		return dates
+	}
+
+	expected := map[string]time.Time{"b": lastModified, "a": lastModified.Add(-time.Second)}
+	require.Equal(t, expected, dates(), "last modified, in page order")
+
+	lastModified = lastModified.Add(time.Hour)
+	posts = []string{"c", "b", "a"}
+	expected["c"] = lastModified
+	require.Equal(t, expected, dates(), "dates stay the same")
+}
+
+func TestBuiltin(t *testing.T) {
+	require.True(t, Matches("lite.cnn.com"), "cnn")
+	require.True(t, Matches("https://text.npr.org/"), "npr")
+
+	pageURL, err := url.Parse("https://text.npr.org/")
+	require.NoError(t, err)
+
+	node, err := html.Parse(strings.NewReader(nprFixture))
+	require.NoError(t, err)
+
+	posts := Configs["text.npr.org"].parsePosts(node, pageURL)
+	require.Len(t, posts, 2)
+	assert.Equal(t, "https://text.npr.org/nx-s1-1234", posts[0].URL, "url")
+	assert.Equal(t, "<h1>A headline</h1>", posts[0].Title, "title")
+	assert.Equal(t, "https://text.npr.org/nx-s1-5678", posts[1].URL, "url")
+}
+
+const nprFixture = `<!doctype html>
+<html>
+<body>
+<header><ul><li><a href="/">News</a></li></ul></header>
+<main>
+<ul>
+	<li><a class="topic-title" href="/nx-s1-1234">A headline</a></li>
+	<li><a class="topic-title" href="/nx-s1-5678">Another headline</a></li>
+</ul>
+</main>
+</body>
+</html>`
+
+const page1Fixture = `<!doctype html>
+<html>
+<body>
+<article class="post">
+	<h2 class="entry-title"><a href="/posts/2">Second &amp; last</a></h2>
+	<time datetime="2024-03-02T10:00:00Z">March 2nd</time>
+	<div class="entry-content"><p>Hello <img src="/img/hi.png"></p></div>
+</article>
+<article class="post">
+	<h2 class="entry-title"><a href="/posts/1">First</a></h2>
+	<time datetime="2024-03-01">March 1st</time>
+	<div class="entry-content"><p>First post!</p></div>
+</article>
+<article class="post"><p>Not a post, there is no link.</p></article>
+<a class="older-posts" href="/?page=2">Older posts</a>
+</body>
+</html>`
+
+const page2Fixture = `<!doctype html>
+<html>
+<body>
+<article class="post">
+	<h2 class="entry-title"><a href="/posts/0">Zeroth</a></h2>
+	<time datetime="2024-02-01">February 1st</time>
+	<div class="entry-content"><p>Before everything.</p></div>
+</article>
+</body>
+</html>`
@@ -8,24 +8,79 @@ import (
 	"net/url"
 	"regexp"
 	"strings"
+	"time"
 )
 
+// DefaultLimit is the number of posts that are shown by default.
+const DefaultLimit = 20
+
+// MaxLimit is the maximum number of posts that are read at once, larger
+// limits are reduced to it.
+const MaxLimit = 200
+
 // Search represents a search in a feed.
 type Search struct {
 	IsActive bool
 
 	BeforeID string
-
-	NoReblogs    bool
-	Skip         bool
-	Terms        []string
+	// BeforeDate is the date of the post with BeforeID, if known.
+	//
+	// Together with BeforeID it is a stable cursor, even if multiple
+	// posts were posted at the same time.
+	BeforeDate time.Time
+
+	// After and Before limit the posts to the ones posted in that time,
+	// including both ends.  They are set using `after:2023-01-01` and
+	// `before:2023-12-31`.
+	After  time.Time
+	Before time.Time
+
+	// CaseSensitive matches terms only with the case they were searched
+	// with, instead of ignoring it.
+	CaseSensitive bool
+	// Substring matches terms within words as well, instead of only whole
+	// words.
+	Substring bool
+
+	// Authors limits the posts to the ones by any of these feeds, set
+	// using `from:author`.
+	Authors []string
+
+	NoReblogs bool
+	Skip      bool
+	// Terms must all be in the post.
+	Terms []string
+	// AnyTerms are groups of terms that were joined by `OR`, at least one
+	// term of each group must be in the post.
+	AnyTerms     [][]string
 	Tags         []string
 	ExcludeTerms []string
 	ExcludeTags  []string
 
 	ForceFresh bool
 
-	termsRE         *regexp.Regexp
+	// IfNoneMatch and IfModifiedSince are the ETag and Last-Modified of the
+	// cached feed, see Validators.  Sources that support them make a
+	// conditional request and return ErrNotModified if nothing changed.
+	IfNoneMatch     string
+	IfModifiedSince string
+
+	// Full asks for the full text of posts instead of a summary, for
+	// sources that only list summaries (e.g. AO3 works).
+	Full bool
+
+	// MinAge hides posts that are newer than it, e.g. to not see posts
+	// that are still being edited.  It applies even if the search is not
+	// active.
+	MinAge time.Duration
+
+	// Limit is the number of posts that will be shown, or DefaultLimit if
+	// it is not set.  It is at most MaxLimit.
+	Limit int
+
+	// termREs match terms as whole words, unless they are not valid
+	// regular expressions
+	termREs         map[string]*regexp.Regexp
 	excludedTermsRE *regexp.Regexp
 }
 
@@ -41,6 +96,9 @@ func (s *Search) String() string {
 	for _, term := range s.Terms {
 		fmt.Fprint(buf, " "+term)
 	}
+	for _, group := range s.AnyTerms {
+		fmt.Fprint(buf, " "+strings.Join(group, " OR "))
+	}
 	for _, term := range s.ExcludeTerms {
 		fmt.Fprint(buf, " -"+term)
 	}
@@ -50,12 +108,50 @@ func (s *Search) String() string {
 	for _, tag := range s.ExcludeTags {
 		fmt.Fprint(buf, " -#"+tag)
 	}
+	for _, author := range s.Authors {
+		fmt.Fprint(buf, " from:"+author)
+	}
+	if !s.After.IsZero() {
+		fmt.Fprint(buf, " after:"+s.After.Format("2006-01-02"))
+	}
+	if !s.Before.IsZero() {
+		fmt.Fprint(buf, " before:"+s.Before.Format("2006-01-02"))
+	}
 
 	return buf.String()
 }
 
+// AllTerms returns the Terms and AnyTerms, e.g. to highlight them.
+func (s *Search) AllTerms() []string {
+	terms := append([]string{}, s.Terms...)
+	for _, group := range s.AnyTerms {
+		terms = append(terms, group...)
+	}
+	return terms
+}
+
+// IsAfterCursor returns true if the post comes after the BeforeID (and
+// BeforeDate) cursor.
+//
+// If BeforeDate is not set, only the ids are compared.
+func (s *Search) IsAfterCursor(p *Post) bool {
+	if s.BeforeID == "" {
+		return true
+	}
+
+	if s.BeforeDate.IsZero() {
+		return compareIDs(p.ID, s.BeforeID) < 0
+	}
+
+	return IsNewer(&Post{Source: p.Source, ID: s.BeforeID, Date: s.BeforeDate}, p)
+}
+
 // Matches returns true if the post matches the search.
 func (s *Search) Matches(p *Post) bool {
+	if s.MinAge > 0 && time.Since(p.Date) < s.MinAge {
+		return false
+	}
+
 	if !s.IsActive {
 		return true
 	}
@@ -64,6 +160,17 @@ func (s *Search) Matches(p *Post) bool {
 		return false
 	}
 
+	if len(s.Authors) > 0 && !contains(s.Authors, strings.ToLower(p.Author)) {
+		return false
+	}
+
+	if !s.After.IsZero() && p.Date.Before(s.After) {
+		return false
+	}
+	if !s.Before.IsZero() && p.Date.After(s.Before) {
+		return false
+	}
+
 	for _, tag := range p.Tags {
 		for _, exclude := range s.ExcludeTags {
 			if tag == exclude {
@@ -79,16 +186,23 @@ func (s *Search) Matches(p *Post) bool {
 		}
 	}
 
-	if s.termsRE != nil {
-		if !s.termsRE.MatchString(p.Title) && !s.termsRE.MatchString(p.DescriptionHTML) {
+	for _, term := range s.Terms {
+		if !s.matchesTerm(p, term) {
 			return false
 		}
-	} else {
-		for _, term := range s.Terms {
-			if !strings.Contains(strings.ToLower(p.Title), term) && !strings.Contains(strings.ToLower(p.DescriptionHTML), term) {
-				return false
+	}
+
+	for _, group := range s.AnyTerms {
+		matchesAny := false
+		for _, term := range group {
+			if s.matchesTerm(p, term) {
+				matchesAny = true
+				break
 			}
 		}
+		if !matchesAny {
+			return false
+		}
 	}
 
 	if s.excludedTermsRE != nil {
@@ -98,7 +212,7 @@ func (s *Search) Matches(p *Post) bool {
 
 	} else {
 		for _, term := range s.ExcludeTerms {
-			if strings.Contains(strings.ToLower(p.Title), term) || strings.Contains(strings.ToLower(p.DescriptionHTML), term) {
+			if s.containsTerm(p, term) {
 				return false
 			}
 		}
@@ -107,6 +221,22 @@ func (s *Search) Matches(p *Post) bool {
 	return true
 }
 
+func (s *Search) matchesTerm(p *Post, term string) bool {
+	if termRE := s.termREs[term]; termRE != nil {
+		return termRE.MatchString(p.Title) || termRE.MatchString(p.DescriptionHTML)
+	}
+	return s.containsTerm(p, term)
+}
+
+// containsTerm is the fallback for terms that are not valid regular
+// expressions, which matches them anywhere.
+func (s *Search) containsTerm(p *Post, term string) bool {
+	if s.CaseSensitive {
+		return strings.Contains(p.Title, term) || strings.Contains(p.DescriptionHTML, term)
+	}
+	return strings.Contains(strings.ToLower(p.Title), term) || strings.Contains(strings.ToLower(p.DescriptionHTML), term)
+}
+
 func contains(xs []string, contain string) bool {
 	for _, x := range xs {
 		if strings.ToLower(x) == contain {
@@ -122,15 +252,27 @@ func contains(xs []string, contain string) bool {
 func FromRequest(req *http.Request) Search {
 	beforeParam := req.URL.Query().Get("before")
 	forceFresh := req.URL.Query().Get("fresh") != ""
+	full := req.URL.Query().Get("full") != ""
 
 	rawSearch := req.URL.Query().Get("search")
 	if beforeParam == "" && rawSearch == "" {
-		return Search{ForceFresh: forceFresh}
+		return Search{ForceFresh: forceFresh, Full: full}
 	}
 
-	search := ParseTerms(rawSearch)
+	search := parseTerms(rawSearch, req.URL.Query().Get("cs") != "", req.URL.Query().Get("sub") != "")
 	search.BeforeID = beforeParam
 	search.ForceFresh = forceFresh
+	search.Full = full
+
+	beforeDateParam := req.URL.Query().Get("before-date")
+	if beforeDateParam != "" {
+		beforeDate, err := time.Parse(time.RFC3339Nano, beforeDateParam)
+		if err != nil {
+			log.Printf("invalid before-date %q: %s", beforeDateParam, err)
+		} else {
+			search.BeforeDate = beforeDate
+		}
+	}
 
 	return search
 }
@@ -138,13 +280,36 @@ func FromRequest(req *http.Request) Search {
 const quoteChars = `"'`
 
 // ParseTerms parses the search terms from the given string.
+//
+// Terms joined by `OR` or `|` (e.g. `cats OR dogs`, `cats|dogs`) are
+// grouped into AnyTerms, all other terms are required.
 func ParseTerms(rawSearch string) Search {
+	return parseTerms(rawSearch, false, false)
+}
+
+func parseTerms(rawSearch string, caseSensitive bool, substring bool) Search {
 	search := Search{
-		IsActive:     true,
-		Terms:        make([]string, 0, 1),
-		Tags:         make([]string, 0, 1),
-		ExcludeTags:  make([]string, 0, 1),
-		ExcludeTerms: make([]string, 0, 1),
+		IsActive:      true,
+		CaseSensitive: caseSensitive,
+		Substring:     substring,
+		Terms:         make([]string, 0, 1),
+		Tags:          make([]string, 0, 1),
+		ExcludeTags:   make([]string, 0, 1),
+		ExcludeTerms:  make([]string, 0, 1),
+	}
+
+	// groups of terms that are joined by `OR`, see AnyTerms
+	groups := make([][]string, 0, 1)
+	lastWasTerm := false
+	joinNext := false
+	addTerm := func(term string) {
+		if joinNext {
+			groups[len(groups)-1] = append(groups[len(groups)-1], term)
+		} else {
+			groups = append(groups, []string{term})
+		}
+		lastWasTerm = true
+		joinNext = false
 	}
 
 	for len(rawSearch) > 0 {
@@ -160,12 +325,21 @@ func ParseTerms(rawSearch string) Search {
 			rawSearch = rawSearch[1:]
 		}
 
+		// a quote only starts a quoted term at the start of a term, quotes
+		// within terms (`don't`) or without a matching quote are kept as is
 		var searchTerm string
-
-		spaceIdx := strings.IndexAny(rawSearch, ` `)
-		quoteIdx := strings.IndexAny(rawSearch, quoteChars)
-
-		if quoteIdx == -1 {
+		quoted := false
+		if len(rawSearch) > 0 && strings.IndexByte(quoteChars, rawSearch[0]) != -1 {
+			closeIdx := strings.IndexByte(rawSearch[1:], rawSearch[0])
+			if closeIdx != -1 {
+				// text directly after the closing quote is the next term
+				searchTerm = rawSearch[1 : closeIdx+1]
+				rawSearch = rawSearch[closeIdx+2:]
+				quoted = true
+			}
+		}
+		if !quoted {
+			spaceIdx := strings.IndexByte(rawSearch, ' ')
 			if spaceIdx == -1 {
 				searchTerm = rawSearch
 				rawSearch = ""
@@ -173,46 +347,70 @@ func ParseTerms(rawSearch string) Search {
 				searchTerm = rawSearch[:spaceIdx]
 				rawSearch = rawSearch[spaceIdx+1:]
 			}
-		} else {
-			if spaceIdx != -1 && spaceIdx < quoteIdx { // space before quote
-				searchTerm = rawSearch[:spaceIdx]
-				rawSearch = rawSearch[spaceIdx+1:]
-			} else {
-				nextQuoteIdx := strings.IndexByte(rawSearch[quoteIdx+1:], rawSearch[quoteIdx]) // matching quote
-				if nextQuoteIdx == -1 {                                                        // unmatched quote
-					if spaceIdx == -1 {
-						searchTerm = rawSearch
-						rawSearch = ""
-					} else {
-						searchTerm = rawSearch[:spaceIdx]
-						rawSearch = rawSearch[spaceIdx+1:]
-					}
-				} else {
-					searchTerm = rawSearch[quoteIdx+1 : nextQuoteIdx+1]
-					rawSearch = rawSearch[nextQuoteIdx+2:]
-				}
-			}
 		}
 
 		if len(searchTerm) == 0 {
 			continue
 		}
 
-		if searchTerm == "noreblog" || searchTerm == "noreblogs" {
+		// `a OR b`, `a | b` and `a|b` all join the terms next to them
+		if !quoted && !exclude && !tag && (searchTerm == "OR" || strings.Contains(searchTerm, "|")) {
+			parts := strings.Split(searchTerm, "|")
+			if searchTerm == "OR" {
+				parts = []string{"", ""}
+			}
+			for i, part := range parts {
+				if i > 0 {
+					joinNext = lastWasTerm
+				}
+				if part != "" {
+					addTerm(normalizeTerm(part, caseSensitive))
+				}
+			}
+			continue
+		}
+
+		// quoted keywords are searched for literally
+		if !quoted && (searchTerm == "noreblog" || searchTerm == "noreblogs") {
 			search.NoReblogs = true
+			lastWasTerm = false
+			joinNext = false
 			continue
 		}
-		if searchTerm == "skip" {
+		if !quoted && searchTerm == "skip" {
 			search.Skip = true
+			lastWasTerm = false
+			joinNext = false
 			continue
 		}
-
-		unescaped, err := url.QueryUnescape(searchTerm)
-		if err == nil {
-			searchTerm = unescaped
+		if !quoted && !exclude && !tag && strings.HasPrefix(searchTerm, "from:") && len(searchTerm) > len("from:") {
+			search.Authors = append(search.Authors, normalizeTerm(strings.TrimPrefix(searchTerm, "from:"), false))
+			lastWasTerm = false
+			joinNext = false
+			continue
+		}
+		if !quoted && !exclude && !tag && (strings.HasPrefix(searchTerm, "after:") || strings.HasPrefix(searchTerm, "before:")) {
+			keyword, date, _ := strings.Cut(searchTerm, ":")
+			start, end, ok := parsePeriod(date)
+			if ok {
+				if keyword == "after" {
+					search.After = start
+				} else {
+					search.Before = end
+				}
+				lastWasTerm = false
+				joinNext = false
+				continue
+			}
 		}
 
-		searchTerm = strings.ToLower(searchTerm)
+		// tags are always compared ignoring case
+		searchTerm = normalizeTerm(searchTerm, caseSensitive && !tag)
+
+		if exclude || tag {
+			lastWasTerm = false
+			joinNext = false
+		}
 
 		switch {
 		case exclude && tag:
@@ -222,26 +420,135 @@ func ParseTerms(rawSearch string) Search {
 		case exclude:
 			search.ExcludeTerms = append(search.ExcludeTerms, searchTerm)
 		default:
-			search.Terms = append(search.Terms, searchTerm)
+			addTerm(searchTerm)
 		}
 	}
 
-	if len(search.Terms) > 0 {
-		termsRE, err := regexp.Compile(`(?i)\b(` + strings.Join(search.Terms, "|") + `)\b`)
-		if err == nil {
-			search.termsRE = termsRE
+	for _, group := range groups {
+		if len(group) == 1 {
+			search.Terms = append(search.Terms, group[0])
 		} else {
-			log.Printf("invalid search terms %q: %s", search.Terms, err)
+			search.AnyTerms = append(search.AnyTerms, group)
 		}
 	}
-	if len(search.ExcludeTerms) > 0 {
-		excludedTermsRE, err := regexp.Compile(`(?i)\b(` + strings.Join(search.ExcludeTerms, "|") + `)\b`)
+
+	search.compile()
+
+	return search
+}
+
+// parsePeriod parses a year (`2023`), month (`2023-01`) or day
+// (`2023-01-01`) and returns its first and last moment in UTC.
+func parsePeriod(date string) (time.Time, time.Time, bool) {
+	for _, period := range []struct {
+		layout string
+		years  int
+		months int
+		days   int
+	}{
+		{"2006", 1, 0, 0},
+		{"2006-01", 0, 1, 0},
+		{"2006-01-02", 0, 0, 1},
+	} {
+		start, err := time.Parse(period.layout, date)
+		if err != nil {
+			continue
+		}
+		end := start.AddDate(period.years, period.months, period.days).Add(-time.Nanosecond)
+		return start, end, true
+	}
+	return time.Time{}, time.Time{}, false
+}
+
+func normalizeTerm(term string, keepCase bool) string {
+	unescaped, err := url.QueryUnescape(term)
+	if err == nil {
+		term = unescaped
+	}
+	if keepCase {
+		return term
+	}
+	return strings.ToLower(term)
+}
+
+// With returns a copy of the search that additionally filters by everything
+// in `defaults`, e.g. to apply default filters for a source on top of what
+// the user searched for.
+//
+// The cursor, limit, freshness and minimum age are kept from the original
+// search, as are how terms are matched and the authors if it has any.
+func (s *Search) With(defaults Search) Search {
+	if !defaults.IsActive {
+		return *s
+	}
+
+	merged := *s
+	merged.IsActive = true
+	merged.NoReblogs = s.NoReblogs || defaults.NoReblogs
+	merged.Skip = s.Skip || defaults.Skip
+	merged.Terms = appendMissing(append([]string{}, s.Terms...), defaults.Terms)
+	merged.AnyTerms = append(append([][]string{}, s.AnyTerms...), defaults.AnyTerms...)
+	merged.Tags = appendMissing(append([]string{}, s.Tags...), defaults.Tags)
+	merged.ExcludeTerms = appendMissing(append([]string{}, s.ExcludeTerms...), defaults.ExcludeTerms)
+	merged.ExcludeTags = appendMissing(append([]string{}, s.ExcludeTags...), defaults.ExcludeTags)
+	if len(merged.Authors) == 0 {
+		merged.Authors = defaults.Authors
+	}
+	if defaults.After.After(merged.After) {
+		merged.After = defaults.After
+	}
+	if !defaults.Before.IsZero() && (merged.Before.IsZero() || defaults.Before.Before(merged.Before)) {
+		merged.Before = defaults.Before
+	}
+
+	merged.termREs = nil
+	merged.excludedTermsRE = nil
+	merged.compile()
+
+	return merged
+}
+
+func appendMissing(xs []string, ys []string) []string {
+	for _, y := range ys {
+		if !contains(xs, y) {
+			xs = append(xs, y)
+		}
+	}
+	return xs
+}
+
+// termPattern returns the regular expression that matches any of the terms,
+// depending on CaseSensitive and Substring.
+func (s *Search) termPattern(terms ...string) string {
+	pattern := `(` + strings.Join(terms, "|") + `)`
+	if !s.Substring {
+		pattern = `\b` + pattern + `\b`
+	}
+	if !s.CaseSensitive {
+		pattern = `(?i)` + pattern
+	}
+	return pattern
+}
+
+func (s *Search) compile() {
+	terms := s.AllTerms()
+	if len(terms) > 0 {
+		s.termREs = make(map[string]*regexp.Regexp, len(terms))
+		for _, term := range terms {
+			termRE, err := regexp.Compile(s.termPattern(term))
+			if err != nil {
+				log.Printf("invalid search term %q: %s", term, err)
+				continue
+			}
+			s.termREs[term] = termRE
+		}
+	}
+	if len(s.ExcludeTerms) > 0 {
+		excludedTermsRE, err := regexp.Compile(s.termPattern(s.ExcludeTerms...))
 		if err == nil {
-			search.excludedTermsRE = excludedTermsRE
+			s.excludedTermsRE = excludedTermsRE
 		} else {
-			log.Printf("invalid exclude terms %q: %s", search.ExcludeTerms, err)
+			log.Printf("invalid exclude terms %q: %s", s.ExcludeTerms, err)
 		}
 	}
-
-	return search
 }
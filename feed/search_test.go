@@ -1,7 +1,9 @@
 package feed
 
 import (
+	"net/http/httptest"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/require"
 )
@@ -21,6 +23,15 @@ func TestParseTerms(t *testing.T) {
 		{`"one quoted" not quoted "two quoted" "three quoted"`, Search{Terms: []string{"one quoted", "not", "quoted", "two quoted", "three quoted"}, Tags: []string{}, ExcludeTerms: []string{}, ExcludeTags: []string{}}},
 		{`"'"`, Search{Terms: []string{"'"}, Tags: []string{}, ExcludeTerms: []string{}, ExcludeTags: []string{}}},
 		{`unmatched " quotes are a thing`, Search{Terms: []string{"unmatched", "\"", "quotes", "are", "a", "thing"}, Tags: []string{}, ExcludeTerms: []string{}, ExcludeTags: []string{}}},
+		{`trailing quote"`, Search{Terms: []string{"trailing", "quote\""}, Tags: []string{}, ExcludeTerms: []string{}, ExcludeTags: []string{}}},
+		{`"unmatched at start`, Search{Terms: []string{"\"unmatched", "at", "start"}, Tags: []string{}, ExcludeTerms: []string{}, ExcludeTags: []string{}}},
+		// quotes within terms
+		{`don't won't`, Search{Terms: []string{"don't", "won't"}, Tags: []string{}, ExcludeTerms: []string{}, ExcludeTags: []string{}}},
+		{`foo"bar baz"`, Search{Terms: []string{"foo\"bar", "baz\""}, Tags: []string{}, ExcludeTerms: []string{}, ExcludeTags: []string{}}},
+		{`#"a b"c`, Search{Terms: []string{"c"}, Tags: []string{"a b"}, ExcludeTerms: []string{}, ExcludeTags: []string{}}},
+		{`-'a b'`, Search{Terms: []string{}, Tags: []string{}, ExcludeTerms: []string{"a b"}, ExcludeTags: []string{}}},
+		// quoted keywords
+		{`"noreblogs" "skip"`, Search{Terms: []string{"noreblogs", "skip"}, Tags: []string{}, ExcludeTerms: []string{}, ExcludeTags: []string{}}},
 		// exclusions
 		{`-excluded`, Search{Terms: []string{}, Tags: []string{}, ExcludeTerms: []string{"excluded"}, ExcludeTags: []string{}}},
 		{`-multiple -excluded`, Search{Terms: []string{}, Tags: []string{}, ExcludeTerms: []string{"multiple", "excluded"}, ExcludeTags: []string{}}},
@@ -30,15 +41,169 @@ func TestParseTerms(t *testing.T) {
 		{`#tags #work`, Search{Terms: []string{}, Tags: []string{"tags", "work"}, ExcludeTerms: []string{}, ExcludeTags: []string{}}},
 		{`#tags #work -#including-exclusions`, Search{Terms: []string{}, Tags: []string{"tags", "work"}, ExcludeTerms: []string{}, ExcludeTags: []string{"including-exclusions"}}},
 		{`#"multiple word tags" can be hacked`, Search{Terms: []string{"can", "be", "hacked"}, Tags: []string{"multiple word tags"}, ExcludeTerms: []string{}, ExcludeTags: []string{}}},
+		// or
+		{`cats OR dogs`, Search{Terms: []string{}, AnyTerms: [][]string{{"cats", "dogs"}}, Tags: []string{}, ExcludeTerms: []string{}, ExcludeTags: []string{}}},
+		{`cats | dogs`, Search{Terms: []string{}, AnyTerms: [][]string{{"cats", "dogs"}}, Tags: []string{}, ExcludeTerms: []string{}, ExcludeTags: []string{}}},
+		{`cats|dogs|birds`, Search{Terms: []string{}, AnyTerms: [][]string{{"cats", "dogs", "birds"}}, Tags: []string{}, ExcludeTerms: []string{}, ExcludeTags: []string{}}},
+		{`cats| dogs |birds`, Search{Terms: []string{}, AnyTerms: [][]string{{"cats", "dogs", "birds"}}, Tags: []string{}, ExcludeTerms: []string{}, ExcludeTags: []string{}}},
+		{`pets cats OR dogs OR "guinea pigs" food`, Search{Terms: []string{"pets", "food"}, AnyTerms: [][]string{{"cats", "dogs", "guinea pigs"}}, Tags: []string{}, ExcludeTerms: []string{}, ExcludeTags: []string{}}},
+		{`a OR b c OR d`, Search{Terms: []string{}, AnyTerms: [][]string{{"a", "b"}, {"c", "d"}}, Tags: []string{}, ExcludeTerms: []string{}, ExcludeTags: []string{}}},
+		{`cats or dogs`, Search{Terms: []string{"cats", "or", "dogs"}, Tags: []string{}, ExcludeTerms: []string{}, ExcludeTags: []string{}}},
+		{`cats "OR" dogs`, Search{Terms: []string{"cats", "or", "dogs"}, Tags: []string{}, ExcludeTerms: []string{}, ExcludeTags: []string{}}},
+		{`OR cats OR`, Search{Terms: []string{"cats"}, Tags: []string{}, ExcludeTerms: []string{}, ExcludeTags: []string{}}},
+		{`#art OR cats`, Search{Terms: []string{"cats"}, Tags: []string{"art"}, ExcludeTerms: []string{}, ExcludeTags: []string{}}},
+		{`cats OR -dogs birds`, Search{Terms: []string{"cats", "birds"}, Tags: []string{}, ExcludeTerms: []string{"dogs"}, ExcludeTags: []string{}}},
 	}
 
 	for _, testCase := range testCases {
 		t.Run(testCase.raw, func(t *testing.T) {
 			search := ParseTerms(testCase.raw)
 			require.Equal(t, testCase.search.Terms, search.Terms, "terms not equal")
+			require.Equal(t, testCase.search.AnyTerms, search.AnyTerms, "any terms not equal")
 			require.Equal(t, testCase.search.Tags, search.Tags, "tags not equal")
 			require.Equal(t, testCase.search.ExcludeTerms, search.ExcludeTerms, "excluded terms not equal")
 			require.Equal(t, testCase.search.ExcludeTags, search.ExcludeTags, "excluded tags not equal")
 		})
 	}
 }
+
+func TestSearchMatchesOr(t *testing.T) {
+	search := ParseTerms("pets cats OR dogs")
+	require.True(t, search.Matches(&Post{DescriptionHTML: "pets like cats"}), "one of the alternatives")
+	require.True(t, search.Matches(&Post{Title: "Dogs", DescriptionHTML: "are pets"}), "other alternative")
+	require.False(t, search.Matches(&Post{DescriptionHTML: "pets like birds"}), "none of the alternatives")
+	require.False(t, search.Matches(&Post{DescriptionHTML: "cats and dogs"}), "missing required term")
+
+	search = ParseTerms("cats dogs")
+	require.True(t, search.Matches(&Post{DescriptionHTML: "cats and dogs"}), "all terms")
+	require.False(t, search.Matches(&Post{DescriptionHTML: "only cats"}), "all terms are required")
+
+	search = ParseTerms("(cats OR dogs")
+	require.True(t, search.Matches(&Post{DescriptionHTML: "pets (cats, mostly)"}), "invalid regexp")
+	require.Equal(t, []string{"(cats", "dogs"}, search.AllTerms(), "all terms")
+	require.Equal(t, " (cats OR dogs", search.String(), "string")
+}
+
+func TestSearchDateRange(t *testing.T) {
+	date := func(s string) time.Time {
+		d, err := time.Parse(time.RFC3339Nano, s)
+		require.NoError(t, err)
+		return d
+	}
+
+	testCases := []struct {
+		raw    string
+		after  time.Time
+		before time.Time
+		terms  []string
+	}{
+		{`after:2023-01-01`, date("2023-01-01T00:00:00Z"), time.Time{}, []string{}},
+		{`before:2023-12-31`, time.Time{}, date("2023-12-31T23:59:59.999999999Z"), []string{}},
+		{`after:2023 before:2023`, date("2023-01-01T00:00:00Z"), date("2023-12-31T23:59:59.999999999Z"), []string{}},
+		{`after:2024-02 before:2024-02`, date("2024-02-01T00:00:00Z"), date("2024-02-29T23:59:59.999999999Z"), []string{}},
+		{`cats after:2023-06-15 dogs`, date("2023-06-15T00:00:00Z"), time.Time{}, []string{"cats", "dogs"}},
+		{`after:yesterday "before:2023"`, time.Time{}, time.Time{}, []string{"after:yesterday", "before:2023"}},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.raw, func(t *testing.T) {
+			search := ParseTerms(testCase.raw)
+			require.Equal(t, testCase.after, search.After, "after not equal")
+			require.Equal(t, testCase.before, search.Before, "before not equal")
+			require.Equal(t, testCase.terms, search.Terms, "terms not equal")
+		})
+	}
+
+	search := ParseTerms("after:2023-01 before:2023-01")
+	require.False(t, search.Matches(&Post{Date: date("2022-12-31T23:59:59Z")}), "before the range")
+	require.True(t, search.Matches(&Post{Date: date("2023-01-01T00:00:00Z")}), "start of the range")
+	require.True(t, search.Matches(&Post{Date: date("2023-01-31T23:59:59Z")}), "end of the range")
+	require.False(t, search.Matches(&Post{Date: date("2023-02-01T00:00:00Z")}), "after the range")
+	require.Equal(t, " after:2023-01-01 before:2023-01-31", search.String(), "string")
+
+	merged := search.With(ParseTerms("after:2023-01-15"))
+	require.Equal(t, date("2023-01-15T00:00:00Z"), merged.After, "later start")
+	require.Equal(t, search.Before, merged.Before, "kept end")
+}
+
+func TestSearchAuthors(t *testing.T) {
+	search := ParseTerms("from:staff cats from:Engineering")
+	require.Equal(t, []string{"staff", "engineering"}, search.Authors, "authors")
+	require.Equal(t, []string{"cats"}, search.Terms, "terms")
+	require.Equal(t, " cats from:staff from:engineering", search.String(), "string")
+
+	require.True(t, search.Matches(&Post{Author: "staff", Title: "cats"}), "first author")
+	require.True(t, search.Matches(&Post{Author: "engineering", Title: "cats"}), "any of the authors")
+	require.False(t, search.Matches(&Post{Author: "xkcd.com", Title: "cats"}), "other author")
+	require.False(t, search.Matches(&Post{Author: "staff", Title: "dogs"}), "still needs the terms")
+
+	require.Equal(t, []string{"from:", "from:staff"}, ParseTerms(`from: "from:staff"`).Terms, "not authors")
+	require.Empty(t, ParseTerms(`-from:staff`).Authors, "excluded")
+
+	merged := search.With(ParseTerms("from:xkcd.com"))
+	require.Equal(t, []string{"staff", "engineering"}, merged.Authors, "kept authors")
+}
+
+func TestSearchCaseAndSubstring(t *testing.T) {
+	search := FromRequest(httptest.NewRequest("GET", "/staff?search=CAT", nil))
+	require.Equal(t, []string{"cat"}, search.Terms, "lowercase by default")
+	require.True(t, search.Matches(&Post{Title: "a cat"}), "any case")
+	require.False(t, search.Matches(&Post{Title: "categories"}), "whole words")
+
+	search = FromRequest(httptest.NewRequest("GET", "/staff?search=CAT+-NO&cs=1", nil))
+	require.Equal(t, []string{"CAT"}, search.Terms, "case kept")
+	require.True(t, search.Matches(&Post{Title: "a CAT"}), "same case")
+	require.False(t, search.Matches(&Post{Title: "a cat"}), "other case")
+	require.False(t, search.Matches(&Post{Title: "a CAT, NO"}), "excluded with same case")
+	require.True(t, search.Matches(&Post{Title: "a CAT, no"}), "excluded with other case")
+
+	search = FromRequest(httptest.NewRequest("GET", "/staff?search=cat+%23Art&sub=1", nil))
+	require.Equal(t, []string{"art"}, search.Tags, "tags ignore case")
+	require.True(t, search.Matches(&Post{Title: "Categories", Tags: []string{"art"}}), "within words")
+
+	search = FromRequest(httptest.NewRequest("GET", "/staff?search=(CAT&cs=1&sub=1", nil))
+	require.True(t, search.Matches(&Post{Title: "(CATegories"}), "invalid regexp")
+	require.False(t, search.Matches(&Post{Title: "(categories"}), "invalid regexp, other case")
+}
+
+func TestSearchWith(t *testing.T) {
+	defaults := ParseTerms("noreblogs -#spoilers")
+
+	search := ParseTerms("#art -#spoilers")
+	search.BeforeID = "123"
+	search.Limit = 5
+
+	merged := search.With(defaults)
+	require.True(t, merged.IsActive, "active")
+	require.True(t, merged.NoReblogs, "noreblogs")
+	require.Equal(t, []string{"art"}, merged.Tags, "tags")
+	require.Equal(t, []string{"spoilers"}, merged.ExcludeTags, "excluded tags")
+	require.Equal(t, "123", merged.BeforeID, "cursor")
+	require.Equal(t, 5, merged.Limit, "limit")
+	require.False(t, search.NoReblogs, "original search is unchanged")
+
+	inactive := Search{BeforeID: "123"}
+	merged = inactive.With(defaults)
+	require.True(t, merged.IsActive, "active")
+	require.True(t, merged.Matches(&Post{Tags: []string{"art"}}), "matches")
+	require.False(t, merged.Matches(&Post{Tags: []string{"spoilers"}}), "excluded")
+
+	require.Equal(t, inactive, inactive.With(Search{}), "inactive defaults")
+}
+
+func TestSearchMinAge(t *testing.T) {
+	search := Search{MinAge: 15 * time.Minute}
+	require.True(t, search.Matches(&Post{Date: time.Now().Add(-time.Hour)}), "old post")
+	require.False(t, search.Matches(&Post{Date: time.Now().Add(-time.Minute)}), "new post")
+	require.False(t, search.Matches(&Post{Date: time.Now().Add(time.Hour)}), "post from the future")
+
+	withTerms := ParseTerms("art")
+	withTerms.MinAge = 15 * time.Minute
+	require.False(t, withTerms.Matches(&Post{Title: "art", Date: time.Now()}), "new post matching the search")
+	require.True(t, withTerms.Matches(&Post{Title: "art", Date: time.Now().Add(-time.Hour)}), "old post matching the search")
+
+	merged := search.With(ParseTerms("noreblogs"))
+	require.Equal(t, 15*time.Minute, merged.MinAge, "kept when merging")
+
+	require.True(t, (&Search{}).Matches(&Post{Date: time.Now()}), "no delay")
+}
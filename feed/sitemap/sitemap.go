@@ -0,0 +1,376 @@
+// Package sitemap reads sites without feeds using their `sitemap.xml`, as a
+// last resort.
+package sitemap
+
+import (
+	"bytes"
+	"context"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/andybalholm/cascadia"
+	lru "github.com/hashicorp/golang-lru"
+	"golang.org/x/net/html"
+
+	"github.com/heyLu/numblr/feed"
+)
+
+// MaxConcurrentFetches is the maximum number of pages that are fetched at
+// once for one sitemap.
+var MaxConcurrentFetches = 4
+
+// maxPageSize is the maximum number of bytes read from a sitemap or page.
+const maxPageSize = 10 * 1024 * 1024
+
+// fetchTimeout is how long connecting to a site may take at most.
+const fetchTimeout = 10 * time.Second
+
+// sitemapClient fetches sitemaps and pages, only from public addresses as
+// the urls are from the site, see feed.RejectPrivateAddresses.
+var sitemapClient = &http.Client{
+	Transport: &http.Transport{
+		Proxy:               http.ProxyFromEnvironment,
+		DialContext:         (&net.Dialer{Timeout: fetchTimeout, Control: feed.RejectPrivateAddresses}).DialContext,
+		TLSHandshakeTimeout: fetchTimeout,
+	},
+}
+
+// pageCache caches the extracted pages by url and last modification, as
+// pages rarely change once they are published.
+var pageCache, _ = lru.New(1000)
+
+type urlSet struct {
+	URLs []sitemapURL `xml:"url"`
+}
+
+type sitemapIndex struct {
+	Sitemaps []sitemapURL `xml:"sitemap"`
+}
+
+type sitemapURL struct {
+	Loc     string `xml:"loc"`
+	LastMod string `xml:"lastmod"`
+
+	lastMod time.Time
+}
+
+// Open opens the site at `name` using its sitemap, from the `Sitemap:` in
+// its robots.txt or at `/sitemap.xml`.
+//
+// The most recently modified pages are fetched and the main content of each
+// of them is extracted.
+func Open(ctx context.Context, name string, search feed.Search) (feed.Feed, error) {
+	siteURL := name
+	if !strings.HasPrefix(siteURL, "http") {
+		siteURL = "https://" + siteURL
+	}
+	baseURL, err := url.Parse(siteURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid url %q: %w", siteURL, err)
+	}
+
+	urls, err := fetchSitemap(ctx, findSitemap(ctx, baseURL), 0)
+	if err != nil {
+		return nil, err
+	}
+
+	sort.SliceStable(urls, func(i, j int) bool {
+		return urls[i].lastMod.After(urls[j].lastMod)
+	})
+
+	limit := search.Limit
+	if limit <= 0 {
+		limit = feed.DefaultLimit
+	}
+
+	pages := make([]sitemapURL, 0, limit)
+	for _, u := range urls {
+		if len(pages) >= limit {
+			break
+		}
+		if !search.BeforeDate.IsZero() && !u.lastMod.Before(search.BeforeDate) {
+			continue
+		}
+		pages = append(pages, u)
+	}
+
+	posts := make([]feed.Post, len(pages))
+	var wg sync.WaitGroup
+	sem := make(chan bool, MaxConcurrentFetches)
+	for i, page := range pages {
+		wg.Add(1)
+		go func(i int, page sitemapURL) {
+			defer wg.Done()
+			sem <- true
+			defer func() { <-sem }()
+
+			post, err := fetchPost(ctx, page)
+			if err != nil {
+				log.Printf("Error: sitemap %q: %s", name, err)
+				return
+			}
+			post.Author = name
+			posts[i] = *post
+		}(i, page)
+	}
+	wg.Wait()
+
+	found := make([]feed.Post, 0, len(posts))
+	for _, post := range posts {
+		if post.ID != "" {
+			found = append(found, post)
+		}
+	}
+	// the publication dates of the pages might be in a different order
+	// than their modification dates
+	sort.SliceStable(found, func(i, j int) bool {
+		return feed.IsNewer(&found[i], &found[j])
+	})
+	if len(pages) > 0 && len(found) == 0 {
+		return nil, fmt.Errorf("no pages could be fetched")
+	}
+
+	return &feed.Static{
+		FeedName: name,
+		FeedURL:  baseURL.String(),
+		Posts:    found,
+	}, nil
+}
+
+// findSitemap returns the url of the sitemap of the site, from the
+// `Sitemap:` in the robots.txt if there is one.
+func findSitemap(ctx context.Context, baseURL *url.URL) string {
+	sitemapURL, _ := baseURL.Parse("/sitemap.xml")
+
+	robotsURL, _ := baseURL.Parse("/robots.txt")
+	body, err := fetch(ctx, robotsURL.String())
+	if err != nil {
+		return sitemapURL.String()
+	}
+
+	for _, line := range strings.Split(string(body), "\n") {
+		key, val, ok := strings.Cut(line, ":")
+		if ok && strings.EqualFold(strings.TrimSpace(key), "sitemap") {
+			u, err := baseURL.Parse(strings.TrimSpace(val))
+			if err == nil {
+				return u.String()
+			}
+		}
+	}
+
+	return sitemapURL.String()
+}
+
+// fetchSitemap returns the urls in the sitemap at `sitemapURL`.  For sitemap
+// indexes, the urls of the most recently modified sitemap are returned.
+func fetchSitemap(ctx context.Context, sitemapURL string, depth int) ([]sitemapURL, error) {
+	body, err := fetch(ctx, sitemapURL)
+	if err != nil {
+		return nil, fmt.Errorf("sitemap: %w", err)
+	}
+
+	var index sitemapIndex
+	err = xml.Unmarshal(body, &index)
+	if err == nil && len(index.Sitemaps) > 0 {
+		if depth > 0 {
+			return nil, fmt.Errorf("sitemap: nested sitemap index at %q", sitemapURL)
+		}
+
+		parseLastMods(index.Sitemaps)
+		newest := index.Sitemaps[0]
+		for _, sitemap := range index.Sitemaps[1:] {
+			if sitemap.lastMod.After(newest.lastMod) {
+				newest = sitemap
+			}
+		}
+		return fetchSitemap(ctx, newest.Loc, depth+1)
+	}
+
+	var set urlSet
+	err = xml.Unmarshal(body, &set)
+	if err != nil {
+		return nil, fmt.Errorf("sitemap: parse %q: %w", sitemapURL, err)
+	}
+	if len(set.URLs) == 0 {
+		return nil, fmt.Errorf("sitemap: no urls in %q", sitemapURL)
+	}
+
+	parseLastMods(set.URLs)
+	return set.URLs, nil
+}
+
+func parseLastMods(urls []sitemapURL) {
+	for i := range urls {
+		urls[i].Loc = strings.TrimSpace(urls[i].Loc)
+		urls[i].lastMod = parseDate(strings.TrimSpace(urls[i].LastMod))
+	}
+}
+
+// parseDate parses the W3C datetime formats used in sitemaps, returning the
+// zero time if the date is missing or invalid.
+func parseDate(s string) time.Time {
+	for _, format := range []string{time.RFC3339, "2006-01-02T15:04Z07:00", "2006-01-02"} {
+		t, err := time.Parse(format, s)
+		if err == nil {
+			return t.UTC()
+		}
+	}
+	return time.Time{}
+}
+
+func fetch(ctx context.Context, u string) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", u, nil)
+	if err != nil {
+		return nil, fmt.Errorf("new request: %w", err)
+	}
+	resp, err := sitemapClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("fetch %q: %w", u, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != 200 {
+		return nil, feed.StatusError{Code: resp.StatusCode}
+	}
+
+	buf := new(bytes.Buffer)
+	_, err = io.Copy(buf, &io.LimitedReader{R: resp.Body, N: maxPageSize})
+	if err != nil {
+		return nil, fmt.Errorf("read %q: %w", u, err)
+	}
+	return buf.Bytes(), nil
+}
+
+var titleMatcher = cascadia.MustCompile(`meta[property="og:title"], title`)
+var publishedMatcher = cascadia.MustCompile(`meta[property="article:published_time"], time[datetime]`)
+var contentMatchers = []cascadia.Matcher{
+	cascadia.MustCompile(`article`),
+	cascadia.MustCompile(`main`),
+	cascadia.MustCompile(`[role="main"]`),
+}
+var paragraphMatcher = cascadia.MustCompile(`p`)
+var unwantedMatcher = cascadia.MustCompile(`script, style, noscript, nav, header, footer, aside, form, iframe`)
+
+// fetchPost fetches the page and extracts its title and main content.
+func fetchPost(ctx context.Context, page sitemapURL) (*feed.Post, error) {
+	cacheKey := page.Loc + "\x00" + page.LastMod
+	if cached, ok := pageCache.Get(cacheKey); ok {
+		post := *cached.(*feed.Post)
+		return &post, nil
+	}
+
+	pageURL, err := url.Parse(page.Loc)
+	if err != nil {
+		return nil, fmt.Errorf("invalid url %q: %w", page.Loc, err)
+	}
+
+	body, err := fetch(ctx, page.Loc)
+	if err != nil {
+		return nil, err
+	}
+
+	node, err := html.Parse(bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("parse %q: %w", page.Loc, err)
+	}
+
+	post := extract(node, pageURL)
+	if post.Date.IsZero() {
+		post.Date = page.lastMod
+	}
+	if post.Date.IsZero() {
+		post.Date = time.Now().UTC()
+	}
+	post.DateString = post.Date.Format(time.RFC3339)
+
+	pageCache.Add(cacheKey, post)
+
+	copied := *post
+	return &copied, nil
+}
+
+// extract returns the title and main content of the page, which is the
+// `<article>` or `<main>` if there is one, or the element with the most
+// paragraphs otherwise.
+func extract(node *html.Node, pageURL *url.URL) *feed.Post {
+	post := &feed.Post{
+		Source: "web",
+		ID:     pageURL.String(),
+		URL:    pageURL.String(),
+	}
+
+	if title := cascadia.Query(node, titleMatcher); title != nil {
+		text := feed.Attr(title, "content")
+		if title.Data == "title" {
+			text = feed.TextContent(title)
+		}
+		post.Title = fmt.Sprintf("<h1>%s</h1>", html.EscapeString(strings.TrimSpace(text)))
+	}
+
+	if published := cascadia.Query(node, publishedMatcher); published != nil {
+		date := feed.Attr(published, "content")
+		if date == "" {
+			date = feed.Attr(published, "datetime")
+		}
+		post.Date = parseDate(date)
+	}
+
+	var content *html.Node
+	for _, matcher := range contentMatchers {
+		content = cascadia.Query(node, matcher)
+		if content != nil {
+			break
+		}
+	}
+	if content == nil {
+		content = mostParagraphs(node)
+	}
+	if content == nil {
+		return post
+	}
+
+	for _, unwanted := range cascadia.QueryAll(content, unwantedMatcher) {
+		if unwanted.Parent != nil {
+			unwanted.Parent.RemoveChild(unwanted)
+		}
+	}
+	feed.MakeAbsolute(content, pageURL)
+
+	buf := new(bytes.Buffer)
+	for child := content.FirstChild; child != nil; child = child.NextSibling {
+		err := html.Render(buf, child)
+		if err != nil {
+			break
+		}
+	}
+	post.DescriptionHTML = strings.TrimSpace(buf.String())
+
+	return post
+}
+
+// mostParagraphs returns the element that directly contains the most
+// paragraphs.
+func mostParagraphs(node *html.Node) *html.Node {
+	counts := make(map[*html.Node]int)
+	var best *html.Node
+	for _, p := range cascadia.QueryAll(node, paragraphMatcher) {
+		if p.Parent == nil {
+			continue
+		}
+
+		counts[p.Parent]++
+		if best == nil || counts[p.Parent] > counts[best] {
+			best = p.Parent
+		}
+	}
+	return best
+}
@@ -0,0 +1,130 @@
+package sitemap
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/heyLu/numblr/feed"
+)
+
+const robotsFixture = `User-agent: *
+Disallow: /admin
+Sitemap: /sitemaps/index.xml
+`
+
+const indexFixture = `<?xml version="1.0" encoding="UTF-8"?>
+<sitemapindex xmlns="http://www.sitemaps.org/schemas/sitemap/0.9">
+	<sitemap><loc>%[1]s/sitemaps/old.xml</loc><lastmod>2019-01-01</lastmod></sitemap>
+	<sitemap><loc>%[1]s/sitemaps/posts.xml</loc><lastmod>2022-06-02T10:00:00+00:00</lastmod></sitemap>
+</sitemapindex>`
+
+const postsFixture = `<?xml version="1.0" encoding="UTF-8"?>
+<urlset xmlns="http://www.sitemaps.org/schemas/sitemap/0.9">
+	<url><loc>%[1]s/about</loc><lastmod>2020-01-01</lastmod></url>
+	<url><loc>%[1]s/posts/new</loc><lastmod>2022-06-02</lastmod></url>
+	<url><loc>%[1]s/posts/old</loc><lastmod>2022-05-01</lastmod></url>
+</urlset>`
+
+const newPostFixture = `<html>
+<head><title>A new post</title></head>
+<body>
+<nav><a href="/">home</a></nav>
+<article>
+	<header>A new post, by someone</header>
+	<p>Hello, <a href="/posts/old">the old post</a> was old.</p>
+	<img src="/img/new.png">
+	<script>alert("nope")</script>
+</article>
+<footer>copyright</footer>
+</body>
+</html>`
+
+const oldPostFixture = `<html>
+<head><meta property="og:title" content="An old post"><meta property="article:published_time" content="2022-04-30T12:00:00Z"></head>
+<body>
+<div class="sidebar"><p>links</p></div>
+<div class="text"><p>one</p><p>two</p><p>three</p></div>
+</body>
+</html>`
+
+func TestSitemap(t *testing.T) {
+	requests := 0
+	var server *httptest.Server
+	server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		requests++
+		switch req.URL.Path {
+		case "/robots.txt":
+			io.WriteString(w, robotsFixture)
+		case "/sitemaps/index.xml":
+			fmt.Fprintf(w, indexFixture, server.URL)
+		case "/sitemaps/posts.xml":
+			fmt.Fprintf(w, postsFixture, server.URL)
+		case "/posts/new":
+			io.WriteString(w, newPostFixture)
+		case "/posts/old":
+			io.WriteString(w, oldPostFixture)
+		default:
+			http.NotFound(w, req)
+		}
+	}))
+	defer server.Close()
+
+	feed.AllowPrivateAddresses = true
+	defer func() {
+		feed.AllowPrivateAddresses = false
+	}()
+
+	f, err := Open(context.Background(), server.URL, feed.Search{Limit: 2})
+	require.NoError(t, err, "open")
+
+	post, err := f.Next()
+	require.NoError(t, err, "next")
+	assert.Equal(t, server.URL+"/posts/new", post.ID, "id")
+	assert.Equal(t, server.URL, post.Author, "author")
+	assert.Equal(t, "<h1>A new post</h1>", post.Title, "title")
+	assert.Equal(t, time.Date(2022, time.June, 2, 0, 0, 0, 0, time.UTC), post.Date, "date from lastmod")
+	assert.Contains(t, post.DescriptionHTML, `<a href="`+server.URL+`/posts/old">the old post</a>`, "absolute links")
+	assert.Contains(t, post.DescriptionHTML, `<img src="`+server.URL+`/img/new.png"/>`, "absolute images")
+	assert.NotContains(t, post.DescriptionHTML, "script", "scripts are removed")
+	assert.NotContains(t, post.DescriptionHTML, "by someone", "headers are removed")
+
+	post, err = f.Next()
+	require.NoError(t, err, "next")
+	assert.Equal(t, server.URL+"/posts/old", post.ID, "id")
+	assert.Equal(t, "<h1>An old post</h1>", post.Title, "title from og:title")
+	assert.Equal(t, time.Date(2022, time.April, 30, 12, 0, 0, 0, time.UTC), post.Date, "published date")
+	assert.Equal(t, "<p>one</p><p>two</p><p>three</p>", post.DescriptionHTML, "element with the most paragraphs")
+
+	_, err = f.Next()
+	assert.Equal(t, io.EOF, err, "limited to two pages")
+
+	requests = 0
+	_, err = Open(context.Background(), server.URL, feed.Search{Limit: 2})
+	require.NoError(t, err, "open again")
+	assert.Equal(t, 3, requests, "pages are cached")
+}
+
+func TestSitemapPrivateAddresses(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		fmt.Fprintf(w, postsFixture, "http://127.0.0.1")
+	}))
+	defer server.Close()
+
+	_, err := Open(context.Background(), server.URL, feed.Search{Limit: 2})
+	require.ErrorContains(t, err, "not a public address", "loopback")
+}
+
+func TestParseDate(t *testing.T) {
+	assert.Equal(t, time.Date(2022, time.June, 2, 0, 0, 0, 0, time.UTC), parseDate("2022-06-02"))
+	assert.Equal(t, time.Date(2022, time.June, 2, 8, 0, 0, 0, time.UTC), parseDate("2022-06-02T10:00+02:00"))
+	assert.Equal(t, time.Date(2022, time.June, 2, 10, 0, 30, 0, time.UTC), parseDate("2022-06-02T10:00:30Z"))
+	assert.True(t, parseDate("yesterday").IsZero())
+}
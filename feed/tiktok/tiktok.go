@@ -52,15 +52,35 @@ func canDoTiktokRequest() error {
 	return nil
 }
 
+// APIURL is the web api that older posts of accounts are fetched from, once
+// the ones embedded in the page are exhausted.
+var APIURL = "https://www.tiktok.com/api/post/item_list/"
+
+// MaxPages is the maximum number of pages that are fetched from the web api
+// when paging beyond the posts embedded in the page.
+var MaxPages = 5
+
 var accountDataMatcher = cascadia.MustCompile("script#SIGI_STATE")
+var universalDataMatcher = cascadia.MustCompile("script#__UNIVERSAL_DATA_FOR_REHYDRATION__")
 var accountRefRE = regexp.MustCompile(`@(([A-Z]\w+ [A-Z])?\w+)`)
 var tagRE = regexp.MustCompile(`#(\w+)`)
 
 type tiktok struct {
-	name string
+	ctx    context.Context
+	client *http.Client
+	name   string
+	search feed.Search
+	limit  int
 
 	accountData tiktokAccountData
 	postIDs     []string
+
+	// cursor is the date of the oldest post so far in milliseconds, older
+	// posts are fetched from the web api starting there.
+	cursor  int64
+	hasMore bool
+	pages   int
+	found   int
 }
 
 type tiktokAccountData struct {
@@ -78,44 +98,104 @@ type tiktokAccountData struct {
 			List []string `json:"list"`
 		} `json:"challenge"`
 	} `json:"ItemList"`
-	ItemModule map[string]struct {
-		ID          string `json:"id"`
-		Description string `json:"desc"`
-		CreateTime  string `json:"createTime"`
-		Video       struct {
-			Width         int    `json:"width"`
-			Height        int    `json:"height"`
-			Cover         string `json:"cover"`
-			PlayAddr      string `json:"playAddr"`
-			SubtitleInfos []struct {
-				LanguageID       string `json:"LanguageID"`
-				LanguageCodeName string `json:"LanguageCodeName"`
-				URL              string `json:"Url"`
-				Format           string `json:"Format"`
-				Source           string `json:"Source"`
-			} `json:"subtitleInfos"`
-		} `json:"video"`
-		Author string `json:"author"`
-		Music  struct {
-			Title      string `json:"title"`
-			PlayURL    string `json:"playUrl"`
-			AuthorName string `json:"authorName"`
-			Album      string `json:"album"`
-		} `json:"music"`
-		Stats struct {
-			DiggCount    int `json:"diggCount"`
-			ShareCount   int `json:"shareCount"`
-			CommentCount int `json:"commentCount"`
-			PlayCount    int `json:"playCount"`
-		} `json:"stats"`
-	} `json:"ItemModule"`
-	UserPage struct {
+	ItemModule map[string]tiktokItem `json:"ItemModule"`
+	UserPage   struct {
 		UniqueID string `json:"uniqueId"`
+		SecUID   string `json:"secUid"`
 	} `json:"UserPage"`
 }
 
+type tiktokItem struct {
+	ID          string `json:"id"`
+	Description string `json:"desc"`
+	CreateTime  string `json:"createTime"`
+	Video       struct {
+		Width         int    `json:"width"`
+		Height        int    `json:"height"`
+		Cover         string `json:"cover"`
+		PlayAddr      string `json:"playAddr"`
+		SubtitleInfos []struct {
+			LanguageID       string `json:"LanguageID"`
+			LanguageCodeName string `json:"LanguageCodeName"`
+			URL              string `json:"Url"`
+			Format           string `json:"Format"`
+			Source           string `json:"Source"`
+		} `json:"subtitleInfos"`
+	} `json:"video"`
+	Author string `json:"author"`
+	Music  struct {
+		Title      string `json:"title"`
+		PlayURL    string `json:"playUrl"`
+		AuthorName string `json:"authorName"`
+		Album      string `json:"album"`
+	} `json:"music"`
+	Stats struct {
+		DiggCount    int `json:"diggCount"`
+		ShareCount   int `json:"shareCount"`
+		CommentCount int `json:"commentCount"`
+		PlayCount    int `json:"playCount"`
+	} `json:"stats"`
+}
+
+// tiktokItemStruct is how the newer formats and the web api describe posts,
+// with a numeric timestamp and the author as an object.
+type tiktokItemStruct struct {
+	tiktokItem
+	CreateTime json.Number `json:"createTime"`
+	Author     struct {
+		UniqueID     string `json:"uniqueId"`
+		AvatarLarger string `json:"avatarLarger"`
+	} `json:"author"`
+}
+
+func (is tiktokItemStruct) item() tiktokItem {
+	item := is.tiktokItem
+	item.CreateTime = is.CreateTime.String()
+	item.Author = is.Author.UniqueID
+	return item
+}
+
+// tiktokItemList is the response of the web api for older posts.
+type tiktokItemList struct {
+	ItemList []tiktokItemStruct `json:"itemList"`
+	Cursor   json.Number        `json:"cursor"`
+	HasMore  bool               `json:"hasMore"`
+}
+
+// tiktokUniversalData is the newer format TikTok embeds into its pages, in
+// `script#__UNIVERSAL_DATA_FOR_REHYDRATION__`.
+type tiktokUniversalData struct {
+	DefaultScope struct {
+		UserDetail struct {
+			UserInfo struct {
+				User struct {
+					UniqueID     string `json:"uniqueId"`
+					SecUID       string `json:"secUid"`
+					Signature    string `json:"signature"`
+					AvatarLarger string `json:"avatarLarger"`
+				} `json:"user"`
+			} `json:"userInfo"`
+			ShareMeta struct {
+				Description string `json:"desc"`
+			} `json:"shareMeta"`
+		} `json:"webapp.user-detail"`
+		VideoDetail struct {
+			ItemInfo struct {
+				ItemStruct tiktokItemStruct `json:"itemStruct"`
+			} `json:"itemInfo"`
+			ShareMeta struct {
+				Description string `json:"desc"`
+			} `json:"shareMeta"`
+		} `json:"webapp.video-detail"`
+	} `json:"__DEFAULT_SCOPE__"`
+}
+
 // Open fetches the feed for user `name` from TikTok.
-func Open(ctx context.Context, name string, _ feed.Search) (feed.Feed, error) {
+//
+// If the search has a BeforeID the feed returns posts before it, fetching
+// older posts from the web api once the ones embedded in the page are
+// exhausted.
+func Open(ctx context.Context, name string, search feed.Search) (feed.Feed, error) {
 	nameIdx := strings.Index(name, "@")
 	if !strings.Contains(name, "https://") && nameIdx != -1 {
 		name = "https://www.tiktok.com/@" + name[:nameIdx]
@@ -130,10 +210,9 @@ func Open(ctx context.Context, name string, _ feed.Search) (feed.Feed, error) {
 	if err != nil {
 		return nil, fmt.Errorf("new request: %w", err)
 	}
-	req.Header.Set("Accept", "*/*")
-	req.Header.Set("User-Agent", "Mozilla/5.0 (X11; Linux x86_64; rv:100.0) Gecko/20100101 Firefox/100.0")
-	req.Header.Set("Referer", "https://www.tiktok.com/")
+	setHeaders(req)
 
+	// the web api needs the cookies set by the page
 	httpClient := &http.Client{}
 	httpClient.Jar, _ = cookiejar.New(nil)
 
@@ -152,18 +231,10 @@ func Open(ctx context.Context, name string, _ feed.Search) (feed.Feed, error) {
 		return nil, fmt.Errorf("parse feed: %w", err)
 	}
 
-	accountDataEl := cascadia.QueryAll(node, accountDataMatcher)
-	if len(accountDataEl) != 1 {
-		buf := new(bytes.Buffer)
-		_ = html.Render(buf, node)
-		log.Printf("could not find account data in %q", buf.String())
-		return nil, fmt.Errorf("could not find account data, %d matches", len(accountDataEl))
-	}
-
-	var accountData tiktokAccountData
-	err = json.Unmarshal([]byte(accountDataEl[0].FirstChild.Data), &accountData)
+	accountData, err := parseAccountData(node)
 	if err != nil {
-		return nil, fmt.Errorf("parse account data: %w", err)
+		log.Printf("could not find account data for %q: %s", name, err)
+		return nil, err
 	}
 
 	if accountData.UserPage.UniqueID != "" {
@@ -171,6 +242,8 @@ func Open(ctx context.Context, name string, _ feed.Search) (feed.Feed, error) {
 	}
 
 	postIDs := accountData.ItemList.UserPost.List
+	// only accounts can be paged, but not tags or single videos
+	isAccount := len(postIDs) > 0 && accountData.UserPage.SecUID != ""
 	if len(postIDs) == 0 {
 		postIDs = accountData.ItemList.Challenge.List
 	}
@@ -178,12 +251,109 @@ func Open(ctx context.Context, name string, _ feed.Search) (feed.Feed, error) {
 		return nil, fmt.Errorf("no posts found, unsupported page?")
 	}
 
-	return &tiktok{
-		name: name,
+	limit := search.Limit
+	if limit <= 0 {
+		limit = feed.DefaultLimit
+	}
+
+	tt := &tiktok{
+		ctx:    ctx,
+		client: httpClient,
+		name:   name,
+		search: search,
+		limit:  limit,
 
 		accountData: accountData,
 		postIDs:     postIDs,
-	}, nil
+
+		hasMore: isAccount && search.BeforeID != "",
+	}
+	if tt.hasMore {
+		tt.cursor = beforeCursor(search)
+		for _, id := range postIDs {
+			createTime, err := strconv.ParseInt(accountData.ItemModule[id].CreateTime, 10, 64)
+			if err == nil && createTime*1000 < tt.cursor {
+				tt.cursor = createTime * 1000
+			}
+		}
+	}
+	return tt, nil
+}
+
+func setHeaders(req *http.Request) {
+	req.Header.Set("Accept", "*/*")
+	req.Header.Set("User-Agent", "Mozilla/5.0 (X11; Linux x86_64; rv:100.0) Gecko/20100101 Firefox/100.0")
+	req.Header.Set("Referer", "https://www.tiktok.com/")
+}
+
+// beforeCursor returns the cursor of the web api for posts before the
+// search cursor, which is a date in milliseconds.
+//
+// TikTok ids start with the time the post was created, so the date can be
+// derived from the id if it is not known.
+func beforeCursor(search feed.Search) int64 {
+	if !search.BeforeDate.IsZero() {
+		return search.BeforeDate.UnixMilli()
+	}
+
+	id, err := strconv.ParseUint(search.BeforeID, 10, 64)
+	if err != nil {
+		return time.Now().UnixMilli()
+	}
+	return int64(id>>32) * 1000
+}
+
+// parseAccountData finds the account data embedded in a TikTok page, trying
+// the older `SIGI_STATE` and then the newer universal data format.
+func parseAccountData(node *html.Node) (tiktokAccountData, error) {
+	var accountData tiktokAccountData
+
+	accountDataEl := cascadia.Query(node, accountDataMatcher)
+	if accountDataEl != nil && accountDataEl.FirstChild != nil {
+		err := json.Unmarshal([]byte(accountDataEl.FirstChild.Data), &accountData)
+		if err == nil {
+			return accountData, nil
+		}
+		log.Printf("Error: parse SIGI_STATE: %s", err)
+	}
+
+	universalDataEl := cascadia.Query(node, universalDataMatcher)
+	if universalDataEl == nil || universalDataEl.FirstChild == nil {
+		return accountData, fmt.Errorf("could not find account data (neither SIGI_STATE nor __UNIVERSAL_DATA_FOR_REHYDRATION__)")
+	}
+
+	var universalData tiktokUniversalData
+	err := json.Unmarshal([]byte(universalDataEl.FirstChild.Data), &universalData)
+	if err != nil {
+		return accountData, fmt.Errorf("parse universal data: %w", err)
+	}
+
+	userDetail := universalData.DefaultScope.UserDetail
+	accountData.UserPage.UniqueID = userDetail.UserInfo.User.UniqueID
+	accountData.UserPage.SecUID = userDetail.UserInfo.User.SecUID
+	accountData.SharingMeta.Value.Description = userDetail.ShareMeta.Description
+	if accountData.SharingMeta.Value.Description == "" {
+		accountData.SharingMeta.Value.Description = userDetail.UserInfo.User.Signature
+	}
+	accountData.SharingMeta.Value.Image = userDetail.UserInfo.User.AvatarLarger
+
+	videoDetail := universalData.DefaultScope.VideoDetail
+	itemStruct := videoDetail.ItemInfo.ItemStruct
+	if itemStruct.ID != "" {
+		item := itemStruct.item()
+
+		accountData.ItemModule = map[string]tiktokItem{item.ID: item}
+		accountData.ItemList.UserPost.List = []string{item.ID}
+
+		if accountData.SharingMeta.Value.Description == "" {
+			accountData.SharingMeta.Value.Description = videoDetail.ShareMeta.Description
+		}
+		if accountData.SharingMeta.Value.Image == "" {
+			accountData.SharingMeta.Value.Image = itemStruct.Author.AvatarLarger
+		}
+	}
+
+	return accountData, nil
 }
 
 func (tt *tiktok) Name() string {
@@ -199,13 +369,100 @@ func (tt *tiktok) URL() string {
 }
 
 func (tt *tiktok) Next() (*feed.Post, error) {
-	if len(tt.postIDs) == 0 {
-		return nil, io.EOF
+	for tt.search.BeforeID == "" || tt.found < tt.limit {
+		if len(tt.postIDs) == 0 {
+			if !tt.hasMore {
+				return nil, io.EOF
+			}
+
+			err := tt.fetchOlder()
+			if err != nil {
+				return nil, err
+			}
+			continue
+		}
+
+		id := tt.postIDs[0]
+		tt.postIDs = tt.postIDs[1:]
+
+		post, err := tt.post(id)
+		if err != nil {
+			return nil, err
+		}
+		if !tt.search.IsAfterCursor(post) {
+			continue
+		}
+
+		tt.found++
+		return post, nil
+	}
+
+	return nil, io.EOF
+}
+
+// fetchOlder fetches the posts before the cursor from the web api.
+func (tt *tiktok) fetchOlder() error {
+	if tt.pages >= MaxPages {
+		tt.hasMore = false
+		return nil
 	}
 
-	id := tt.postIDs[0]
-	tt.postIDs = tt.postIDs[1:]
+	err := canDoTiktokRequest()
+	if err != nil {
+		return err
+	}
+
+	params := url.Values{}
+	params.Set("aid", "1988")
+	params.Set("count", "30")
+	params.Set("cursor", strconv.FormatInt(tt.cursor, 10))
+	params.Set("secUid", tt.accountData.UserPage.SecUID)
+
+	req, err := http.NewRequestWithContext(tt.ctx, "GET", APIURL+"?"+params.Encode(), nil)
+	if err != nil {
+		return fmt.Errorf("new request: %w", err)
+	}
+	setHeaders(req)
+
+	resp, err := tt.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("fetching page %d: %w", tt.pages+1, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != 200 {
+		return fmt.Errorf("fetching page %d: %w", tt.pages+1, feed.StatusError{Code: resp.StatusCode})
+	}
+
+	var itemList tiktokItemList
+	err = json.NewDecoder(resp.Body).Decode(&itemList)
+	if err != nil {
+		// the api responds with an empty body if it does not like the request
+		return fmt.Errorf("decode page %d: %w", tt.pages+1, err)
+	}
+
+	tt.pages++
+
+	if tt.accountData.ItemModule == nil {
+		tt.accountData.ItemModule = make(map[string]tiktokItem, len(itemList.ItemList))
+	}
+	for _, itemStruct := range itemList.ItemList {
+		// posts embedded in the page may be older than the cursor
+		if _, seen := tt.accountData.ItemModule[itemStruct.ID]; seen {
+			continue
+		}
+
+		tt.accountData.ItemModule[itemStruct.ID] = itemStruct.item()
+		tt.postIDs = append(tt.postIDs, itemStruct.ID)
+	}
+
+	cursor, err := itemList.Cursor.Int64()
+	tt.hasMore = itemList.HasMore && len(itemList.ItemList) > 0 && err == nil && cursor < tt.cursor
+	tt.cursor = cursor
+	return nil
+}
 
+func (tt *tiktok) post(id string) (*feed.Post, error) {
 	postData, ok := tt.accountData.ItemModule[id]
 	if !ok {
 		return nil, fmt.Errorf("missing post details for post %q", id)
@@ -231,11 +488,11 @@ func (tt *tiktok) Next() (*feed.Post, error) {
 			label += " (" + subtitle.Source + ")"
 		}
 
-		// note: proxy is necessary because `track` src must be same-origin (crossorigin does not work because of tiktok's CORS headers)
+		// note: `track` src must be same-origin (crossorigin does not work because of tiktok's CORS headers), so subtitles only work with `-proxy-images`
 		if subtitle.LanguageCodeName == "eng-US" {
-			fmt.Fprintf(buf, `	<track default kind="captions" srclang="en" label=%q src=%q />`, label, "/proxy?url="+subtitle.URL)
+			fmt.Fprintf(buf, `	<track default kind="captions" srclang="en" label="%s" src="%s" />`, html.EscapeString(label), html.EscapeString(subtitle.URL))
 		} else {
-			fmt.Fprintf(buf, `	<track kind="captions" label=%q src=%q />`, label, "/proxy?url="+subtitle.URL)
+			fmt.Fprintf(buf, `	<track kind="captions" label="%s" src="%s" />`, html.EscapeString(label), html.EscapeString(subtitle.URL))
 		}
 		fmt.Fprintln(buf)
 
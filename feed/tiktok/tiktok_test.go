@@ -0,0 +1,117 @@
+package tiktok
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"golang.org/x/net/html"
+
+	"github.com/heyLu/numblr/feed"
+)
+
+const universalDataFixture = `<!DOCTYPE html>
+<html><head><title>TikTok</title></head><body>
+<script id="__UNIVERSAL_DATA_FOR_REHYDRATION__" type="application/json">{"__DEFAULT_SCOPE__":{"webapp.app-context":{"language":"en"},"webapp.video-detail":{"itemInfo":{"itemStruct":{"id":"7312345678901234567","desc":"making coffee #coffee with @someone","createTime":"1702000000","video":{"width":576,"height":1024,"cover":"https://p16-sign.tiktokcdn.com/cover.jpeg","playAddr":"https://v16-webapp.tiktok.com/video.mp4","subtitleInfos":[]},"author":{"uniqueId":"lilnasx","nickname":"Lil Nas X","avatarLarger":"https://p16-sign.tiktokcdn.com/avatar.jpeg"},"music":{"title":"original sound","playUrl":"https://sf16.tiktokcdn.com/music.mp3","authorName":"Lil Nas X","album":""},"stats":{"diggCount":10,"shareCount":2,"commentCount":3,"playCount":100}}},"shareMeta":{"title":"Lil Nas X on TikTok","desc":"making coffee"}}}}</script>
+</body></html>`
+
+func TestParseUniversalData(t *testing.T) {
+	node, err := html.Parse(strings.NewReader(universalDataFixture))
+	require.NoError(t, err)
+
+	accountData, err := parseAccountData(node)
+	require.NoError(t, err)
+
+	require.Equal(t, []string{"7312345678901234567"}, accountData.ItemList.UserPost.List, "post ids")
+	require.Equal(t, "https://p16-sign.tiktokcdn.com/avatar.jpeg", accountData.SharingMeta.Value.Image, "avatar")
+
+	tt := &tiktok{name: "lilnasx@tiktok", accountData: accountData, postIDs: accountData.ItemList.UserPost.List}
+	post, err := tt.Next()
+	require.NoError(t, err)
+
+	require.Equal(t, "7312345678901234567", post.ID, "id")
+	require.Equal(t, "lilnasx@tiktok", post.Author, "author")
+	require.Equal(t, "https://www.tiktok.com/@lilnasx/video/7312345678901234567", post.URL, "url")
+	require.Equal(t, int64(1702000000), post.Date.Unix(), "date")
+	require.Equal(t, []string{"coffee"}, post.Tags, "tags")
+	require.Contains(t, post.DescriptionHTML, `src="https://v16-webapp.tiktok.com/video.mp4"`, "video")
+}
+
+func TestParseMissingAccountData(t *testing.T) {
+	node, err := html.Parse(strings.NewReader(`<html><body><p>please verify you are human</p></body></html>`))
+	require.NoError(t, err)
+
+	_, err = parseAccountData(node)
+	require.Error(t, err)
+}
+
+// tiktokID returns an id for a post created at `createTime`, like TikTok's.
+func tiktokID(createTime int64, n int) string {
+	return fmt.Sprint(uint64(createTime)<<32 | uint64(n))
+}
+
+func TestNextFetchesOlderPosts(t *testing.T) {
+	pages := map[string]string{
+		"1702000000000": fmt.Sprintf(`{"itemList":[{"id":%q,"desc":"second","createTime":1701000000,"author":{"uniqueId":"lilnasx"}}],"cursor":"1701000000000","hasMore":true}`, tiktokID(1701000000, 2)),
+		"1701000000000": fmt.Sprintf(`{"itemList":[{"id":%q,"desc":"third","createTime":1700000000,"author":{"uniqueId":"lilnasx"}}],"cursor":"1700000000000","hasMore":false}`, tiktokID(1700000000, 3)),
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		require.Equal(t, "MS4wLjABAAAA", req.URL.Query().Get("secUid"), "secUid")
+		page, ok := pages[req.URL.Query().Get("cursor")]
+		if !ok {
+			http.NotFound(w, req)
+			return
+		}
+		fmt.Fprint(w, page)
+	}))
+	defer server.Close()
+
+	origAPIURL := APIURL
+	APIURL = server.URL
+	defer func() {
+		APIURL = origAPIURL
+	}()
+
+	newestID := tiktokID(1703000000, 0)
+	firstID := tiktokID(1702000000, 1)
+	var accountData tiktokAccountData
+	accountData.UserPage.SecUID = "MS4wLjABAAAA"
+	accountData.ItemModule = map[string]tiktokItem{
+		newestID: {ID: newestID, CreateTime: "1703000000", Author: "lilnasx"},
+		firstID:  {ID: firstID, CreateTime: "1702000000", Author: "lilnasx"},
+	}
+
+	search := feed.Search{BeforeID: newestID}
+	tt := &tiktok{
+		ctx:    context.Background(),
+		client: server.Client(),
+		name:   "lilnasx@tiktok",
+		search: search,
+		limit:  10,
+
+		accountData: accountData,
+		postIDs:     []string{newestID, firstID},
+
+		cursor:  1702000000000,
+		hasMore: true,
+	}
+
+	var ids []string
+	post, err := tt.Next()
+	for err == nil {
+		ids = append(ids, post.ID)
+		post, err = tt.Next()
+	}
+	require.ErrorIs(t, err, io.EOF)
+	require.Equal(t, []string{firstID, tiktokID(1701000000, 2), tiktokID(1700000000, 3)}, ids, "posts before the cursor, then older pages")
+	require.Equal(t, 2, tt.pages, "pages")
+}
+
+func TestBeforeCursor(t *testing.T) {
+	require.Equal(t, int64(1702000000000), beforeCursor(feed.Search{BeforeID: tiktokID(1702000000, 42)}), "from id")
+}
@@ -0,0 +1,107 @@
+package feed
+
+import (
+	"bytes"
+	"strings"
+	"unicode/utf8"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+// TruncateHTML shortens postHTML to at most `maxSize` bytes, cutting it at
+// element boundaries so that the result is still well-formed html.  It
+// returns true if postHTML had to be truncated.
+//
+// Elements that are too large are kept with as many of their children as
+// fit, so that the beginning of e.g. a long reblog chain is still there.  If
+// postHTML can't be parsed it is cut as text instead, see truncateRaw.
+func TruncateHTML(postHTML string, maxSize int) (string, bool) {
+	if maxSize <= 0 || len(postHTML) <= maxSize {
+		return postHTML, false
+	}
+
+	body := &html.Node{Type: html.ElementNode, Data: "body", DataAtom: atom.Body}
+	nodes, err := html.ParseFragment(strings.NewReader(postHTML), body)
+	if err != nil {
+		return truncateRaw(postHTML, maxSize), true
+	}
+	for _, node := range nodes {
+		body.AppendChild(node)
+	}
+
+	truncateChildren(body, maxSize)
+
+	buf := new(bytes.Buffer)
+	for node := body.FirstChild; node != nil; node = node.NextSibling {
+		err = html.Render(buf, node)
+		if err != nil {
+			return truncateRaw(postHTML, maxSize), true
+		}
+	}
+	return buf.String(), true
+}
+
+// truncateRaw cuts postHTML to at most `maxSize` bytes without splitting
+// characters or leaving a tag open at the end.
+func truncateRaw(postHTML string, maxSize int) string {
+	cut := maxSize
+	for cut > 0 && !utf8.RuneStart(postHTML[cut]) {
+		cut--
+	}
+	truncated := postHTML[:cut]
+	if i := strings.LastIndexByte(truncated, '<'); i > strings.LastIndexByte(truncated, '>') {
+		truncated = truncated[:i]
+	}
+	return truncated
+}
+
+// truncateChildren removes the children of `node` that don't fit into
+// `budget` bytes when rendered, descending into the first child that does
+// not fit.  It returns the number of bytes the remaining children use.
+func truncateChildren(node *html.Node, budget int) int {
+	used := 0
+	for child := node.FirstChild; child != nil; child = child.NextSibling {
+		size := renderedSize(child)
+		if used+size <= budget {
+			used += size
+			continue
+		}
+
+		keep := false
+		if child.Type == html.ElementNode && child.FirstChild != nil {
+			overhead := renderedSize(&html.Node{Type: child.Type, Data: child.Data, DataAtom: child.DataAtom, Namespace: child.Namespace, Attr: child.Attr})
+			if used+overhead < budget {
+				used += overhead + truncateChildren(child, budget-used-overhead)
+				keep = true
+			}
+		}
+
+		removeFrom(node, child, keep)
+		break
+	}
+	return used
+}
+
+// removeFrom removes `child` and all following children from `node`, or only
+// the following children if `keep` is true.
+func removeFrom(node *html.Node, child *html.Node, keep bool) {
+	remove := child
+	if keep {
+		remove = child.NextSibling
+	}
+	for remove != nil {
+		next := remove.NextSibling
+		node.RemoveChild(remove)
+		remove = next
+	}
+}
+
+func renderedSize(node *html.Node) int {
+	buf := new(bytes.Buffer)
+	err := html.Render(buf, node)
+	if err != nil {
+		return 0
+	}
+	return buf.Len()
+}
@@ -0,0 +1,41 @@
+package feed
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"golang.org/x/net/html"
+)
+
+func TestTruncateHTML(t *testing.T) {
+	short := `<p>short post</p>`
+	truncated, isTruncated := TruncateHTML(short, 100)
+	require.False(t, isTruncated, "short")
+	require.Equal(t, short, truncated, "short")
+
+	truncated, isTruncated = TruncateHTML(short, 0)
+	require.False(t, isTruncated, "no limit")
+	require.Equal(t, short, truncated, "no limit")
+
+	long := `<p>first</p><p>second</p>` + strings.Repeat(`<p>more</p>`, 100)
+	truncated, isTruncated = TruncateHTML(long, 30)
+	require.True(t, isTruncated, "long")
+	require.Equal(t, `<p>first</p><p>second</p>`, truncated, "cut between elements")
+
+	nested := `<p><a class="tumblr_blog" href="https://staff.tumblr.com/post/1">staff</a>:</p><blockquote><p>original</p>` + strings.Repeat(`<blockquote><p>reblog</p>`, 100) + strings.Repeat(`</blockquote>`, 101)
+	truncated, isTruncated = TruncateHTML(nested, 200)
+	require.True(t, isTruncated, "nested")
+	require.LessOrEqual(t, len(truncated), 200, "size")
+	require.True(t, strings.HasPrefix(truncated, `<p><a class="tumblr_blog" href="https://staff.tumblr.com/post/1">staff</a>:</p><blockquote><p>original</p><blockquote>`), "keeps the start of large elements: %s", truncated)
+	require.True(t, strings.HasSuffix(truncated, `</blockquote></blockquote>`), "closes elements: %s", truncated)
+	_, err := html.Parse(strings.NewReader(truncated))
+	require.NoError(t, err, "valid html")
+}
+
+func TestTruncateRaw(t *testing.T) {
+	require.Equal(t, "<p>abc", truncateRaw("<p>abcdef</p>", 6), "cut text")
+	require.Equal(t, "<p>", truncateRaw("<p>äöü</p>", 4), "utf-8 boundary")
+	require.Equal(t, "<p>ä", truncateRaw("<p>äöü</p>", 6), "utf-8 boundary")
+	require.Equal(t, "<p>first</p>", truncateRaw(`<p>first</p><a href="https://example.org">`, 20), "no open tags")
+}
@@ -0,0 +1,311 @@
+package tumblr
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"mime"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	lru "github.com/hashicorp/golang-lru"
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+
+	"github.com/heyLu/numblr/feed"
+)
+
+// LinkPreviews enables fetching previews for link posts, see
+// addLinkPreview.
+var LinkPreviews = false
+
+// maxPreviewSize is the maximum number of bytes read from a linked page,
+// the preview is in its head which usually comes well before that.
+const maxPreviewSize = 256 * 1024
+
+// previewTimeout limits how long fetching one preview may take, so that
+// slow sites don't hold up the rest of the feed.
+const previewTimeout = 5 * time.Second
+
+// maxLinkPostText is the maximum length of the text that is not part of
+// the link for a post to still be considered a link post.
+const maxLinkPostText = 200
+
+// maxPreviewFetches is the maximum number of previews that are fetched
+// concurrently, more are skipped until the feed is read again.
+const maxPreviewFetches = 4
+
+// previewCache caches the previews by url, including failed ones which
+// are stored as nil so that they are not retried for every post.
+var previewCache, _ = lru.New(1000)
+
+// previewFetches limits the concurrent fetches, see maxPreviewFetches.
+var previewFetches = make(chan bool, maxPreviewFetches)
+
+// pendingPreviews are the urls whose previews are being fetched.
+var pendingPreviews sync.Map
+
+// previewClient fetches previews, only from public addresses as the urls are
+// from posts, see feed.RejectPrivateAddresses.
+var previewClient = &http.Client{
+	Transport: &http.Transport{
+		DialContext:         (&net.Dialer{Timeout: previewTimeout, Control: feed.RejectPrivateAddresses}).DialContext,
+		TLSHandshakeTimeout: previewTimeout,
+	},
+}
+
+// addLinkPreview appends a link card with the title, description and image
+// of the linked page to link posts, see linkPostURL.
+//
+// Only previews that have been fetched before are added, others are fetched
+// in the background so that reading the feed is not held up by the linked
+// sites.  They are added when the feed is read again.
+//
+// `title` is the title of the post as it is in the feed, before it is
+// formatted.
+func addLinkPreview(post *feed.Post, title string) {
+	if !LinkPreviews {
+		return
+	}
+
+	linkURL := linkPostURL(post, title)
+	if linkURL == "" {
+		return
+	}
+
+	cached, ok := previewCache.Get(linkURL)
+	if !ok {
+		go fetchPreview(linkURL)
+		return
+	}
+
+	block := cached.(*npfBlock)
+	if block == nil {
+		return
+	}
+
+	post.DescriptionHTML += renderNPFBlock(*block)
+}
+
+// linkPostURL returns the url a link post links to, or "" if the post is
+// not a link post.
+//
+// Link posts have a url as their title, or content that consists mostly of
+// a single link.  Reblogs, posts with images and posts that already have a
+// link card are not link posts.
+func linkPostURL(post *feed.Post, title string) string {
+	if strings.Contains(post.DescriptionHTML, "link-card") {
+		return ""
+	}
+
+	// checked first, as urls look like reblogs (`https:`)
+	if u := webURL(strings.TrimSpace(title)); u != "" {
+		return u
+	}
+
+	if post.IsReblog() {
+		return ""
+	}
+
+	body := &html.Node{Type: html.ElementNode, Data: "body", DataAtom: atom.Body}
+	nodes, err := html.ParseFragment(strings.NewReader(post.DescriptionHTML), body)
+	if err != nil {
+		return ""
+	}
+
+	var links []string
+	textLen := 0
+	hasMedia := false
+	var f func(node *html.Node, inLink bool)
+	f = func(node *html.Node, inLink bool) {
+		switch {
+		case node.Type == html.TextNode && !inLink:
+			textLen += len(strings.TrimSpace(node.Data))
+		case isElement(node, "img") || isElement(node, "video") || isElement(node, "iframe"):
+			hasMedia = true
+		case isElement(node, "a"):
+			href := webURL(getAttribute(node, "href"))
+			if href != "" && !isTumblrURL(href) {
+				links = append(links, href)
+			}
+			inLink = true
+		}
+
+		for child := node.FirstChild; child != nil; child = child.NextSibling {
+			f(child, inLink)
+		}
+	}
+	for _, node := range nodes {
+		f(node, false)
+	}
+
+	if hasMedia || len(links) != 1 || textLen > maxLinkPostText {
+		return ""
+	}
+	return links[0]
+}
+
+// webURL returns `s` normalized if it is a http(s) url, or "" otherwise.
+func webURL(s string) string {
+	u, err := url.Parse(s)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return ""
+	}
+	return u.String()
+}
+
+// isTumblrURL returns true if `u` links to Tumblr itself, e.g. mentions.
+func isTumblrURL(u string) bool {
+	parsed, err := url.Parse(u)
+	if err != nil {
+		return false
+	}
+	return feed.MatchesHost(parsed.Hostname(), []string{"tumblr.com", "tmblr.co"})
+}
+
+// fetchPreview fetches the preview of the page at `linkURL` into the
+// previewCache, unless too many previews are being fetched already.
+func fetchPreview(linkURL string) {
+	select {
+	case previewFetches <- true:
+		defer func() { <-previewFetches }()
+	default:
+		return
+	}
+
+	if _, pending := pendingPreviews.LoadOrStore(linkURL, true); pending {
+		return
+	}
+	defer pendingPreviews.Delete(linkURL)
+
+	block, err := fetchPreviewUncached(context.Background(), linkURL)
+	if err != nil {
+		log.Printf("Error: link preview for %s: %s", linkURL, err)
+	}
+	previewCache.Add(linkURL, block)
+}
+
+// fetchPreviewUncached returns the preview of the page at `linkURL` from its
+// OpenGraph tags or title, or nil if it has neither.
+func fetchPreviewUncached(ctx context.Context, linkURL string) (*npfBlock, error) {
+	ctx, cancel := context.WithTimeout(ctx, previewTimeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, "GET", linkURL, nil)
+	if err != nil {
+		return nil, fmt.Errorf("new request: %w", err)
+	}
+
+	resp, err := previewClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("download: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != 200 {
+		return nil, fmt.Errorf("download: %w", feed.StatusError{Code: resp.StatusCode})
+	}
+
+	mediaType, _, _ := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+	if mediaType != "text/html" && mediaType != "application/xhtml+xml" {
+		return nil, nil
+	}
+
+	block := parsePreview(io.LimitReader(resp.Body, maxPreviewSize))
+	if block == nil {
+		return nil, nil
+	}
+
+	block.URL = linkURL
+	if block.DisplayURL == "" {
+		block.DisplayURL = resp.Request.URL.Hostname()
+	}
+	if len(block.Poster) > 0 {
+		imageURL, err := resp.Request.URL.Parse(block.Poster[0].URL)
+		if err != nil || (imageURL.Scheme != "http" && imageURL.Scheme != "https") {
+			block.Poster = nil
+		} else {
+			block.Poster[0].URL = imageURL.String()
+		}
+	}
+	return block, nil
+}
+
+// parsePreview reads the OpenGraph tags and title from the head of the
+// page, or returns nil if it has neither.
+func parsePreview(r io.Reader) *npfBlock {
+	block := &npfBlock{Type: "link"}
+	var title string
+
+	tokenizer := html.NewTokenizer(r)
+	inTitle := false
+	for {
+		tokenType := tokenizer.Next()
+		switch tokenType {
+		case html.ErrorToken:
+			return finishPreview(block, title)
+		case html.TextToken:
+			if inTitle && title == "" {
+				title = strings.TrimSpace(html.UnescapeString(string(tokenizer.Text())))
+			}
+		case html.EndTagToken:
+			name, _ := tokenizer.TagName()
+			switch string(name) {
+			case "title":
+				inTitle = false
+			case "head":
+				return finishPreview(block, title)
+			}
+		case html.StartTagToken, html.SelfClosingTagToken:
+			name, hasAttr := tokenizer.TagName()
+			switch string(name) {
+			case "title":
+				inTitle = tokenType == html.StartTagToken
+			case "body":
+				return finishPreview(block, title)
+			case "meta":
+				var property, content string
+				for hasAttr {
+					var key, val []byte
+					key, val, hasAttr = tokenizer.TagAttr()
+					switch string(key) {
+					case "property", "name":
+						property = string(val)
+					case "content":
+						content = strings.TrimSpace(string(val))
+					}
+				}
+
+				switch property {
+				case "og:title":
+					block.Title = content
+				case "og:description":
+					block.Description = content
+				case "og:site_name":
+					block.SiteName = content
+				case "og:image":
+					if len(block.Poster) == 0 && content != "" {
+						block.Poster = append(block.Poster, struct {
+							URL string `json:"url"`
+						}{URL: content})
+					}
+				}
+			}
+		}
+	}
+}
+
+func finishPreview(block *npfBlock, title string) *npfBlock {
+	if block.Title == "" {
+		block.Title = title
+	}
+	if block.Title == "" {
+		return nil
+	}
+	return block
+}
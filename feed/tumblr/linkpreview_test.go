@@ -0,0 +1,102 @@
+package tumblr
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/heyLu/numblr/feed"
+)
+
+func TestLinkPostURL(t *testing.T) {
+	testCases := []struct {
+		name            string
+		title           string
+		descriptionHTML string
+		url             string
+	}{
+		{"url as title", "https://example.org/article", `<p>nice</p>`, "https://example.org/article"},
+		{"single link", "An article", `<p><a href="https://example.org/article">An article</a></p><p>worth reading</p>`, "https://example.org/article"},
+		{"text post", "Thoughts", `<p>just some thoughts, no links</p>`, ""},
+		{"multiple links", "Links", `<p><a href="https://example.org/a">a</a> and <a href="https://example.org/b">b</a></p>`, ""},
+		{"photo", "Photo", `<img src="https://64.media.tumblr.com/photo.jpg"/><p><a href="https://example.org/article">source</a></p>`, ""},
+		{"mention", "Hi", `<p><a class="tumblelog" href="https://tmblr.co/abc">@staff</a></p>`, ""},
+		{"link card", "Card", `<blockquote class="link-card"><a href="https://example.org/article"><strong>An article</strong></a></blockquote>`, ""},
+		{"long text", "Essay", fmt.Sprintf(`<p>%0300d</p><p><a href="https://example.org/article">source</a></p>`, 0), ""},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			post := &feed.Post{Title: tc.title, DescriptionHTML: tc.descriptionHTML}
+			require.Equal(t, tc.url, linkPostURL(post, tc.title))
+		})
+	}
+}
+
+func TestAddLinkPreview(t *testing.T) {
+	var requests int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		switch req.URL.Path {
+		case "/article":
+			fmt.Fprint(w, `<html><head><title>ignored</title><meta property="og:title" content="An article"><meta property="og:description" content="It is about things."><meta property="og:image" content="/poster.jpg"></head><body><meta property="og:title" content="too late"></body></html>`)
+		case "/untitled":
+			fmt.Fprint(w, `<html><head></head><body>nothing</body></html>`)
+		default:
+			http.NotFound(w, req)
+		}
+	}))
+	defer server.Close()
+
+	LinkPreviews = true
+	feed.AllowPrivateAddresses = true
+	defer func() {
+		LinkPreviews = false
+		feed.AllowPrivateAddresses = false
+	}()
+
+	// fetched in the background, without holding up the feed
+	addPreview := func(post *feed.Post, title string) {
+		linkURL := linkPostURL(post, title)
+		addLinkPreview(post, title)
+		require.Eventually(t, func() bool { return previewCache.Contains(linkURL) }, time.Second, time.Millisecond, "fetched")
+		addLinkPreview(post, title)
+	}
+
+	post := &feed.Post{URL: "https://staff.tumblr.com/post/1", DescriptionHTML: fmt.Sprintf(`<p><a href="%s/article">An article</a></p>`, server.URL)}
+	addLinkPreview(post, "An article")
+	require.NotContains(t, post.DescriptionHTML, "link-card", "not fetched yet")
+	addPreview(post, "An article")
+	require.Contains(t, post.DescriptionHTML, fmt.Sprintf(`<blockquote class="link-card"><a href="%s/article"><img src="%s/poster.jpg" alt="" /><strong>An article</strong></a><p>It is about things.</p>`, server.URL, server.URL))
+
+	// cached
+	post = &feed.Post{URL: "https://staff.tumblr.com/post/2", DescriptionHTML: ""}
+	addLinkPreview(post, server.URL+"/article")
+	require.Contains(t, post.DescriptionHTML, "link-card", "link card from cache")
+	require.Equal(t, int32(1), atomic.LoadInt32(&requests), "requests")
+
+	for _, path := range []string{"/untitled", "/missing"} {
+		post = &feed.Post{DescriptionHTML: "<p>nothing to see</p>"}
+		addPreview(post, server.URL+path)
+		require.Equal(t, "<p>nothing to see</p>", post.DescriptionHTML, path)
+	}
+}
+
+func TestPreviewPrivateAddresses(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		fmt.Fprint(w, `<html><head><title>internal</title></head></html>`)
+	}))
+	defer server.Close()
+
+	_, err := fetchPreviewUncached(context.Background(), server.URL+"/admin")
+	require.ErrorContains(t, err, "not a public address", "loopback")
+
+}
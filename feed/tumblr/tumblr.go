@@ -3,34 +3,62 @@ package tumblr
 import (
 	"bytes"
 	"context"
+	"encoding/json"
 	"encoding/xml"
+	"errors"
 	"fmt"
 	"io"
 	"log"
 	"net/http"
+	"net/url"
 	"regexp"
 	"strings"
 	"time"
 
 	"github.com/heyLu/numblr/feed"
 	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
 )
 
 // TumblrDate is the date format used in Tumblr's RSS feeds
 const TumblrDate = "Mon, 2 Jan 2006 15:04:05 -0700"
 
+// MaxBackfillPages is the maximum number of pages that are fetched when
+// paging beyond the posts in the RSS feed.
+var MaxBackfillPages = 10
+
 // Open opens a new Feed for tumblr account `name`.
-func Open(ctx context.Context, name string, _ feed.Search) (feed.Feed, error) {
+//
+// If the search has a BeforeID (or the cursor is set later using SetCursor)
+// the feed returns posts before it, fetching older pages if they are not
+// part of the RSS feed anymore.
+func Open(ctx context.Context, name string, search feed.Search) (feed.Feed, error) {
 	nameIdx := strings.Index(name, "@")
 	if nameIdx != -1 {
 		name = name[:nameIdx]
 	}
-	rssURL := fmt.Sprintf("https://%s.tumblr.com/rss", name)
+
+	tmblr, err := openRSS(ctx, name, fmt.Sprintf("https://%s.tumblr.com/rss", name), search)
+	if err != nil {
+		return nil, err
+	}
+
+	limit := search.Limit
+	if limit <= 0 {
+		limit = feed.DefaultLimit
+	}
+	return &tumblrBackfill{ctx: ctx, search: search, limit: limit, page: 1, current: tmblr}, nil
+}
+
+// openRSS opens the RSS feed at `rssURL`, conditionally if the search has the
+// validators of the cached feed.
+func openRSS(ctx context.Context, name string, rssURL string, search feed.Search) (*tumblrRSS, error) {
 	req, err := http.NewRequestWithContext(ctx, "GET", rssURL, nil)
 	if err != nil {
 		return nil, fmt.Errorf("new request: %w", err)
 	}
 	req.Header.Set("User-Agent", "numblr")
+	feed.SetConditional(req, search)
 
 	resp, err := http.DefaultClient.Do(req)
 	if err != nil {
@@ -38,12 +66,15 @@ func Open(ctx context.Context, name string, _ feed.Search) (feed.Feed, error) {
 	}
 	defer resp.Body.Close()
 
+	if resp.StatusCode == http.StatusNotModified {
+		return nil, feed.ErrNotModified
+	}
 	if resp.StatusCode != 200 {
 		return nil, fmt.Errorf("download: %w", feed.StatusError{Code: resp.StatusCode})
 	}
 
 	if strings.HasPrefix(resp.Request.URL.Host, "www.tumblr.com") {
-		return nil, fmt.Errorf("download: was redirected, feed likely private (%s)", resp.Request.URL)
+		return nil, fmt.Errorf("download: was redirected to %s: %w", resp.Request.URL, feed.ErrPrivate)
 	}
 
 	var title string
@@ -97,7 +128,7 @@ func Open(ctx context.Context, name string, _ feed.Search) (feed.Feed, error) {
 		}
 	}
 
-	tmblr := &tumblrRSS{name: name, description: description, r: io.NopCloser(buf), dec: dec, dateFormat: TumblrDate}
+	tmblr := &tumblrRSS{name: name, description: description, r: io.NopCloser(buf), dec: dec, dateFormat: TumblrDate, etag: resp.Header.Get("ETag"), lastModified: resp.Header.Get("Last-Modified")}
 	go func() {
 		time.Sleep(15 * time.Second)
 		if !tmblr.closed {
@@ -107,6 +138,96 @@ func Open(ctx context.Context, name string, _ feed.Search) (feed.Feed, error) {
 	return tmblr, nil
 }
 
+// tumblrBackfill returns the posts before the search cursor, first from the
+// RSS feed and then from older pages at `/page/N/rss` until there are enough
+// posts.  Without a cursor it only returns the posts of the RSS feed.
+type tumblrBackfill struct {
+	ctx    context.Context
+	search feed.Search
+	limit  int
+
+	page      int
+	pagePosts int
+	found     int
+	current   *tumblrRSS
+}
+
+func (tb *tumblrBackfill) Name() string {
+	return tb.current.Name()
+}
+
+func (tb *tumblrBackfill) Description() string {
+	return tb.current.Description()
+}
+
+func (tb *tumblrBackfill) URL() string {
+	return tb.current.URL()
+}
+
+// ETag implements feed.Validators.ETag.
+func (tb *tumblrBackfill) ETag() string {
+	return tb.current.ETag()
+}
+
+// LastModified implements feed.Validators.LastModified.
+func (tb *tumblrBackfill) LastModified() string {
+	return tb.current.LastModified()
+}
+
+// SetCursor implements feed.Paginatable.SetCursor.
+func (tb *tumblrBackfill) SetCursor(id string) {
+	if id != tb.search.BeforeID {
+		tb.search.BeforeID = id
+		tb.search.BeforeDate = time.Time{}
+	}
+}
+
+func (tb *tumblrBackfill) Next() (*feed.Post, error) {
+	if tb.search.BeforeID == "" {
+		return tb.current.Next()
+	}
+
+	for tb.found < tb.limit {
+		post, err := tb.current.Next()
+		if err == nil {
+			tb.pagePosts++
+			if !tb.search.IsAfterCursor(post) {
+				continue
+			}
+
+			tb.found++
+			return post, nil
+		}
+
+		if !errors.Is(err, io.EOF) {
+			return nil, err
+		}
+		if tb.pagePosts == 0 || tb.page >= MaxBackfillPages {
+			return nil, io.EOF
+		}
+
+		nextPage, err := openRSS(tb.ctx, tb.current.name, fmt.Sprintf("https://%s.tumblr.com/page/%d/rss", tb.current.name, tb.page+1), feed.Search{})
+		if err != nil {
+			return nil, fmt.Errorf("backfill page %d: %w", tb.page+1, err)
+		}
+
+		err = tb.current.Close()
+		if err != nil {
+			log.Printf("Error: closing page %d of %s: %s", tb.page, tb.current.name, err)
+		}
+
+		tb.current = nextPage
+		tb.page++
+		tb.pagePosts = 0
+	}
+
+	return nil, io.EOF
+}
+
+func (tb *tumblrBackfill) Close() error {
+	return tb.current.Close()
+}
+
 type tumblrRSS struct {
 	name        string
 	description string
@@ -114,6 +235,17 @@ type tumblrRSS struct {
 	dec         *xml.Decoder
 	dateFormat  string
 	closed      bool
+
+	etag         string
+	lastModified string
+}
+
+func (tr *tumblrRSS) ETag() string {
+	return tr.etag
+}
+
+func (tr *tumblrRSS) LastModified() string {
+	return tr.lastModified
 }
 
 func (tr *tumblrRSS) Name() string {
@@ -169,6 +301,8 @@ func (tr *tumblrRSS) Next() (*feed.Post, error) {
 
 	// TODO: improve reblog support (take reblog-from title/description?)
 
+	title := post.Title
+
 	// format questions properly
 	if tumblrQuestionRE.MatchString(post.Title) {
 		post.Title = `<blockquote class="question">` + post.Title + `</blockquote>`
@@ -176,6 +310,13 @@ func (tr *tumblrRSS) Next() (*feed.Post, error) {
 		post.Title = `<h1>` + post.Title + `</h1>`
 	}
 
+	err = Process(&post)
+	if err != nil {
+		log.Printf("Error: processing %s: %s", post.URL, err)
+	}
+
+	addLinkPreview(&post, title)
+
 	return &post, nil
 }
 
@@ -184,6 +325,266 @@ func (tr *tumblrRSS) Close() error {
 	return tr.r.Close()
 }
 
+// Process applies the Tumblr-specific processing to a post that is done
+// before it is cached, e.g. unwrapping redirect links and rendering NPF
+// blocks.
+//
+// It is safe to call it multiple times on the same post, e.g. to reprocess
+// posts that have been cached before the processing was improved.  Note that
+// reblogs are flattened when rendering, see FlattenReblogs.
+func Process(post *feed.Post) error {
+	post.DescriptionHTML = strings.Replace(post.DescriptionHTML, "https://href.li/?", "", -1)
+	post.DescriptionHTML = tumblrRedirectRE.ReplaceAllStringFunc(post.DescriptionHTML, func(repl string) string {
+		u, err := url.Parse(html.UnescapeString(repl))
+		if err != nil {
+			return repl
+		}
+
+		redirect := u.Query().Get("z")
+		if redirect == "" {
+			return repl
+		}
+
+		return html.EscapeString(redirect)
+	})
+
+	descriptionHTML, err := renderNPFBlocks(post.DescriptionHTML)
+	if err != nil {
+		return fmt.Errorf("render npf blocks: %w", err)
+	}
+	post.DescriptionHTML = descriptionHTML
+
+	return nil
+}
+
+var tumblrRedirectRE = regexp.MustCompile(`https?://t.umblr.com/redirect\?[^" ]+`)
+
+// npfBlock is the JSON data of an NPF content block, which Tumblr includes
+// in the `data-npf` attribute of blocks it can't render in RSS feeds.
+//
+// See https://www.tumblr.com/docs/npf#content-blocks.
+type npfBlock struct {
+	Type string `json:"type"`
+
+	// link blocks
+	URL         string `json:"url"`
+	DisplayURL  string `json:"display_url"`
+	Title       string `json:"title"`
+	Description string `json:"description"`
+	SiteName    string `json:"site_name"`
+	Poster      []struct {
+		URL string `json:"url"`
+	} `json:"poster"`
+
+	// poll blocks
+	Question string      `json:"question"`
+	Answers  []npfAnswer `json:"answers"`
+	// Results are the votes per answer by client_id, which are only there
+	// if Tumblr included them, like the poll results api does.
+	Results map[string]int `json:"results"`
+}
+
+type npfAnswer struct {
+	ClientID   string `json:"client_id"`
+	AnswerText string `json:"answer_text"`
+}
+
+// renderNPFBlocks replaces elements with `data-npf` attributes with html for
+// the link and poll blocks they contain.
+//
+// Polls that only come as `<div class="tmblr-poll">` markup are rendered
+// from the text of the markup, see pollFromHTML.
+func renderNPFBlocks(descriptionHTML string) (string, error) {
+	if !strings.Contains(descriptionHTML, "data-npf") && !strings.Contains(descriptionHTML, "tmblr-poll") {
+		return descriptionHTML, nil
+	}
+
+	body := &html.Node{Type: html.ElementNode, Data: "body", DataAtom: atom.Body}
+	nodes, err := html.ParseFragment(strings.NewReader(descriptionHTML), body)
+	if err != nil {
+		return descriptionHTML, fmt.Errorf("parse html: %w", err)
+	}
+	for _, node := range nodes {
+		body.AppendChild(node)
+	}
+
+	var f func(*html.Node)
+	f = func(node *html.Node) {
+		for child := node.FirstChild; child != nil; {
+			next := child.NextSibling
+
+			var block npfBlock
+			npfData := getAttribute(child, "data-npf")
+			switch {
+			case npfData != "":
+				err := json.Unmarshal([]byte(npfData), &block)
+				if err != nil {
+					log.Printf("Error: invalid npf block %q: %s", npfData, err)
+					child = next
+					continue
+				}
+			case hasClass(child, "tmblr-poll"):
+				block = pollFromHTML(child)
+			default:
+				f(child)
+				child = next
+				continue
+			}
+
+			replacement, err := html.ParseFragment(strings.NewReader(renderNPFBlock(block)), node)
+			if err != nil {
+				log.Printf("Error: render npf block %q: %s", npfData, err)
+				child = next
+				continue
+			}
+			for _, replacementNode := range replacement {
+				node.InsertBefore(replacementNode, child)
+			}
+			node.RemoveChild(child)
+
+			child = next
+		}
+	}
+	f(body)
+
+	buf := new(bytes.Buffer)
+	for node := body.FirstChild; node != nil; node = node.NextSibling {
+		err = html.Render(buf, node)
+		if err != nil {
+			return descriptionHTML, fmt.Errorf("render html: %w", err)
+		}
+	}
+
+	return buf.String(), nil
+}
+
+func renderNPFBlock(block npfBlock) string {
+	buf := new(bytes.Buffer)
+	switch block.Type {
+	case "link":
+		// the urls come from the post, so only links to websites are kept
+		linkURL := webURL(block.URL)
+		title := block.Title
+		if title == "" {
+			title = block.URL
+		}
+		site := block.SiteName
+		if site == "" {
+			site = block.DisplayURL
+		}
+
+		fmt.Fprint(buf, `<blockquote class="link-card">`)
+		if linkURL != "" {
+			fmt.Fprintf(buf, `<a href="%s">`, html.EscapeString(linkURL))
+		}
+		if len(block.Poster) > 0 && webURL(block.Poster[0].URL) != "" {
+			fmt.Fprintf(buf, `<img src="%s" alt="" />`, html.EscapeString(webURL(block.Poster[0].URL)))
+		}
+		fmt.Fprintf(buf, `<strong>%s</strong>`, html.EscapeString(title))
+		if linkURL != "" {
+			fmt.Fprint(buf, `</a>`)
+		}
+		if block.Description != "" {
+			fmt.Fprintf(buf, `<p>%s</p>`, html.EscapeString(block.Description))
+		}
+		if site != "" {
+			fmt.Fprintf(buf, `<p><small>%s</small></p>`, html.EscapeString(site))
+		}
+		fmt.Fprint(buf, `</blockquote>`)
+	case "poll":
+		if len(block.Answers) == 0 {
+			question := ""
+			if block.Question != "" {
+				question = ": " + html.EscapeString(block.Question)
+			}
+			fmt.Fprintf(buf, `<p class="poll">Poll%s <small>(see the post on Tumblr)</small></p>`, question)
+			break
+		}
+
+		fmt.Fprintf(buf, `<figure class="poll"><figcaption>Poll: %s</figcaption><ul>`, html.EscapeString(block.Question))
+		for _, answer := range block.Answers {
+			if votes, hasVotes := block.Results[answer.ClientID]; hasVotes {
+				fmt.Fprintf(buf, `<li>%s <small>(%d votes)</small></li>`, html.EscapeString(answer.AnswerText), votes)
+			} else {
+				fmt.Fprintf(buf, `<li>%s</li>`, html.EscapeString(answer.AnswerText))
+			}
+		}
+		fmt.Fprint(buf, `</ul></figure>`)
+	default:
+		fmt.Fprintf(buf, `<p><small>(unsupported "%s" block, see the post on Tumblr)</small></p>`, html.EscapeString(block.Type))
+	}
+	return buf.String()
+}
+
+// pollFromHTML returns the question and answers of a poll that Tumblr only
+// included as markup, which are the heading or `poll-question` and the list
+// items or `poll-answer` elements.
+func pollFromHTML(node *html.Node) npfBlock {
+	block := npfBlock{Type: "poll"}
+
+	var f func(*html.Node)
+	f = func(node *html.Node) {
+		for child := node.FirstChild; child != nil; child = child.NextSibling {
+			if child.Type != html.ElementNode {
+				continue
+			}
+
+			switch {
+			case block.Question == "" && (hasClass(child, "poll-question") || isHeading(child)):
+				block.Question = strings.TrimSpace(textContent(child))
+			case isElement(child, "li") || hasClass(child, "poll-answer"):
+				answer := strings.TrimSpace(textContent(child))
+				if answer != "" {
+					block.Answers = append(block.Answers, npfAnswer{AnswerText: answer})
+				}
+			default:
+				f(child)
+			}
+		}
+	}
+	f(node)
+
+	return block
+}
+
+func isHeading(node *html.Node) bool {
+	switch node.DataAtom {
+	case atom.H1, atom.H2, atom.H3, atom.H4, atom.H5, atom.H6:
+		return true
+	}
+	return false
+}
+
+func textContent(node *html.Node) string {
+	if node.Type == html.TextNode {
+		return node.Data
+	}
+
+	buf := new(strings.Builder)
+	for child := node.FirstChild; child != nil; child = child.NextSibling {
+		buf.WriteString(textContent(child))
+	}
+	return buf.String()
+}
+
+func getAttribute(node *html.Node, attrName string) string {
+	if node.Type != html.ElementNode {
+		return ""
+	}
+	for _, attr := range node.Attr {
+		if attr.Key == attrName {
+			return attr.Val
+		}
+	}
+	return ""
+}
+
+// OwnBlogs are the names of the blogs of the person running numblr.
+//
+// FlattenReblogs drops the top-level attribution of reblogs if it is one of
+// them, as it is redundant when following your own blog.
+var OwnBlogs = map[string]bool{}
+
 // FlattenReblogs flattens the nested blockquotes from Tumblr into a flat
 // structure where each reblog is in a blockquote at one level, oldest-first.
 func FlattenReblogs(reblogHTML string) (flattenedHTML string, err error) {
@@ -193,6 +594,7 @@ func FlattenReblogs(reblogHTML string) (flattenedHTML string, err error) {
 	}
 
 	var root *html.Node
+	var ownAttribution *html.Node
 
 	var f func(*html.Node, *html.Node)
 	f = func(parent *html.Node, node *html.Node) {
@@ -203,6 +605,10 @@ func FlattenReblogs(reblogHTML string) (flattenedHTML string, err error) {
 
 			if root == nil {
 				root = reblog.Parent
+
+				if OwnBlogs[attributionName(node)] {
+					ownAttribution = node
+				}
 			}
 
 			if isElement(reblogChild, "p") && isElement(reblogContent, "blockquote") { // p blockquote > (p blockquote)
@@ -226,6 +632,10 @@ func FlattenReblogs(reblogHTML string) (flattenedHTML string, err error) {
 		return reblogHTML, fmt.Errorf("invalid reblog structure: %q", reblogHTML)
 	}
 
+	if ownAttribution != nil && ownAttribution.Parent != nil {
+		ownAttribution.Parent.RemoveChild(ownAttribution)
+	}
+
 	buf := new(bytes.Buffer)
 	for node := root; node != nil; node = node.NextSibling {
 		err = html.Render(buf, root)
@@ -237,6 +647,200 @@ func FlattenReblogs(reblogHTML string) (flattenedHTML string, err error) {
 	return buf.String(), nil
 }
 
+// CollapseReblogs wraps the comments between the original post and the
+// newest comment of flattened reblogs in `<details>`, if the reblog has more
+// than maxLevels quote levels.
+//
+// The original post is the deepest blockquote with an attribution, and the
+// newest comment is what follows the outermost blockquote around it, see
+// FlattenReblogs.
+func CollapseReblogs(flattenedHTML string, maxLevels int) (string, error) {
+	doc, err := html.Parse(strings.NewReader(flattenedHTML))
+	if err != nil {
+		return flattenedHTML, fmt.Errorf("parse html: %w", err)
+	}
+
+	body := findElement(doc, atom.Body)
+	if body == nil {
+		return flattenedHTML, nil
+	}
+
+	var original *html.Node
+	originalDepth := -1
+	attributions := 0
+	var f func(*html.Node, int)
+	f = func(node *html.Node, depth int) {
+		for child := node.FirstChild; child != nil; child = child.NextSibling {
+			if !isElement(child, "blockquote") {
+				if isElement(child, "p") && attributionName(child) != "" {
+					attributions++
+				}
+				f(child, depth)
+				continue
+			}
+
+			prev := previousElementSibling(child)
+			if depth > originalDepth && isElement(prev, "p") && attributionName(prev) != "" {
+				original = child
+				originalDepth = depth
+			}
+			f(child, depth+1)
+		}
+	}
+	f(body, 0)
+
+	if original == nil || attributions <= maxLevels {
+		return flattenedHTML, nil
+	}
+
+	// the blockquotes around the original post, from the outermost one
+	var path []*html.Node
+	for node := original; node != body; node = node.Parent {
+		path = append([]*html.Node{node}, path...)
+	}
+
+	// the newest comment is after the outermost blockquote that has one
+	newest := len(path)
+	for i, node := range path {
+		if !isBlank(siblingsAfter(node)) {
+			newest = i
+			break
+		}
+	}
+
+	var collapsed []*html.Node
+	for i, node := range path {
+		for sibling := node.Parent.FirstChild; sibling != node; sibling = sibling.NextSibling {
+			if i == len(path)-1 && sibling == previousElementSibling(original) {
+				break
+			}
+			collapsed = append(collapsed, sibling)
+		}
+	}
+	for i := len(path) - 1; i > newest; i-- {
+		collapsed = append(collapsed, siblingsAfter(path[i])...)
+	}
+	if isBlank(collapsed) {
+		return flattenedHTML, nil
+	}
+
+	details := &html.Node{Type: html.ElementNode, Data: "details", DataAtom: atom.Details}
+	summary := &html.Node{Type: html.ElementNode, Data: "summary", DataAtom: atom.Summary}
+	details.AppendChild(summary)
+	collapsedAttributions := 0
+	for _, node := range collapsed {
+		if isElement(node, "p") && attributionName(node) != "" {
+			collapsedAttributions++
+		}
+		node.Parent.RemoveChild(node)
+		details.AppendChild(node)
+	}
+	summary.AppendChild(&html.Node{Type: html.TextNode, Data: fmt.Sprintf("%d more reblogs", collapsedAttributions)})
+	original.Parent.InsertBefore(details, original.NextSibling)
+
+	buf := new(bytes.Buffer)
+	for node := body.FirstChild; node != nil; node = node.NextSibling {
+		err = html.Render(buf, node)
+		if err != nil {
+			return flattenedHTML, fmt.Errorf("render html: %w", err)
+		}
+	}
+
+	return buf.String(), nil
+}
+
+func siblingsAfter(node *html.Node) []*html.Node {
+	var siblings []*html.Node
+	for sibling := node.NextSibling; sibling != nil; sibling = sibling.NextSibling {
+		siblings = append(siblings, sibling)
+	}
+	return siblings
+}
+
+// isBlank returns true if the nodes only contain whitespace.
+func isBlank(nodes []*html.Node) bool {
+	for _, node := range nodes {
+		if node.Type != html.TextNode || strings.TrimSpace(node.Data) != "" {
+			return false
+		}
+	}
+	return true
+}
+
+func findElement(node *html.Node, element atom.Atom) *html.Node {
+	if node.Type == html.ElementNode && node.DataAtom == element {
+		return node
+	}
+
+	for child := node.FirstChild; child != nil; child = child.NextSibling {
+		found := findElement(child, element)
+		if found != nil {
+			return found
+		}
+	}
+	return nil
+}
+
+// ReblogSource returns the name of the account that originally posted a
+// reblog, i.e. the root of the reblog chain.
+//
+// That is the deepest nested `tumblr_blog` link, which works for both the
+// nested reblogs from Tumblr and flattened ones.  It returns "" if the reblog
+// source could not be found.
+func ReblogSource(reblogHTML string) string {
+	node, err := html.Parse(strings.NewReader(reblogHTML))
+	if err != nil {
+		return ""
+	}
+
+	source := ""
+	sourceDepth := -1
+
+	var f func(*html.Node, int)
+	f = func(node *html.Node, depth int) {
+		if isElement(node, "blockquote") {
+			depth++
+		}
+
+		if isElement(node, "a") && hasClass(node, "tumblr_blog") && depth > sourceDepth && node.FirstChild != nil && node.FirstChild.Type == html.TextNode {
+			source = node.FirstChild.Data
+			sourceDepth = depth
+		}
+
+		for child := node.FirstChild; child != nil; child = child.NextSibling {
+			f(child, depth)
+		}
+	}
+	f(node, 0)
+
+	return source
+}
+
+// attributionName returns the name of the account in a `<p><a
+// class="tumblr_blog">name</a>:</p>` attribution, or "" if the paragraph is
+// not an attribution.
+func attributionName(node *html.Node) string {
+	for child := node.FirstChild; child != nil; child = child.NextSibling {
+		if isElement(child, "a") && hasClass(child, "tumblr_blog") && child.FirstChild != nil && child.FirstChild.Type == html.TextNode {
+			return child.FirstChild.Data
+		}
+	}
+	return ""
+}
+
+func hasClass(node *html.Node, class string) bool {
+	for _, attr := range node.Attr {
+		if attr.Key == "class" {
+			for _, c := range strings.Fields(attr.Val) {
+				if c == class {
+					return true
+				}
+			}
+		}
+	}
+	return false
+}
+
 func nextElementSibling(node *html.Node) *html.Node {
 	if node == nil {
 		return nil
@@ -250,6 +854,15 @@ func nextElementSibling(node *html.Node) *html.Node {
 	return nil
 }
 
+func previousElementSibling(node *html.Node) *html.Node {
+	for prev := node.PrevSibling; prev != nil; prev = prev.PrevSibling {
+		if prev.Type == html.ElementNode {
+			return prev
+		}
+	}
+	return nil
+}
+
 func firstElementChild(node *html.Node) *html.Node {
 	for next := node.FirstChild; next != nil; next = next.NextSibling {
 		if next.Type == html.ElementNode {
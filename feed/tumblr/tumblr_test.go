@@ -1,22 +1,32 @@
 package tumblr
 
 import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
 	"os"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/require"
 	"golang.org/x/net/html"
+
+	"github.com/heyLu/numblr/feed"
 )
 
+var reblogFixtures = []string{
+	`<p><a href="https://april-thelightfury115.tumblr.com/post/628962798765998080/lytefoot-vivithefolle-headcanonsandmore" class="tumblr_blog">april-thelightfury115</a>:</p> <blockquote><p><a href="https://lytefoot.tumblr.com/post/627529363045384192/vivithefolle-headcanonsandmore" class="tumblr_blog">lytefoot</a>:</p> <blockquote> <p><a href="https://vivithefolle.tumblr.com/post/627528961548795904/headcanonsandmore-evitoxytrash-i-found-these" class="tumblr_blog">vivithefolle</a>:</p> <blockquote> <p><a href="https://headcanonsandmore.tumblr.com/post/627528598568435712/evitoxytrash-i-found-these-in-my-notes-and" class="tumblr_blog">headcanonsandmore</a>:</p> <blockquote> <p><a href="https://evitoxytrash.tumblr.com/post/627470558410555392/i-found-these-in-my-notes-and-honestly-they-are" class="tumblr_blog">evitoxytrash</a>:</p> <blockquote> <p>I found these in my notes, and honestly, they are pure gold…</p> <p><br/></p> <p>—</p> <p>Teddy, into a hairbrush: YOOOOOOO I’ll tell you what I want, what I really really want</p> <p>Harry, into a different hairbrush: So tell me what you want what you really really want</p> <p>Remus, walking into the room: Harry</p> <p>Remus: What the fuck have you done to my child</p> <p>—</p> <p>*3am* </p> <p>Percy: What is all that racket</p> <p>*ball hits the window* </p> <p>Percy: *looks out the window to see his dumbass husband hosting Quidditch practice for their children* </p> <p>Percy: OLIVER IT IS THREE IN THE FUCKING MORNING</p> <p>—</p> <p>*procession music starts playing* </p> <p>Hermione: *comes out in a tux* </p> <p>Molly: …</p> <p>Ron: *struts down the aisle in a wedding dress* </p> <p>Molly: RONALD</p> <p>-</p> <p>Lee: *puts his child in a crib while Fred films* </p> <p>Crib: *turns into a rubber chicken* </p> <p>Lee: lmao</p> <p>—</p> <p>Angelina: George, don’t you <i>dare</i> cause a piece of furniture to turn into a rubber chicken</p> <p>George, frantically disabling all the transfiguration charms he had put on the table and chairs: Why would I ever do that? </p> <p>—</p> <p>*procession music starts playing* </p> <p>Lee: *comes out in nice pajamas*</p> <p>Fred: *comes out in nice pajamas as well* </p> <p>Molly: FREDERICK</p> <p>—</p> <p>Charlie, writing a letter: Dear mum,</p> <p>Charlie: I don’t know why you’re asking me, since you have seven kids</p> <p>Charlie: But since you want grandbabies</p> <p>Charlie: Here you go</p> <p>Charlie: *sends a picture of a dragon in a diaper*</p> <p>Charlie: Love, Charlie</p> </blockquote> <p><b>I, for one, think Ron would look <i>amazing</i> in a wedding dress. </b></p> </blockquote> <p>We need more pics of Romione weddings with Ron in a wedding dress.</p> <p>Scratch that we need more pictures of Ron in general.</p> </blockquote> <p>All of this is frickin <i>gold</i>.</p> </blockquote> <p>YES</p></blockquote>`,
+	`<p><a class="tumblr_blog" href="https://slytherco.tumblr.com/post/628881174844112896" target="_blank">slytherco</a>:</p><blockquote><figure class="tmblr-full" data-orig-height="2048" data-orig-width="1310"><img src="https://64.media.tumblr.com/683043a5a4c233c57fb42777dc44d713/65e71f4f39b89922-c9/s640x960/c8b047d310aa9b761e4d7f8e618822a7d04d1b1b.png" data-orig-height="2048" data-orig-width="1310"/></figure><p>I drew a naked Draco as a gift for <a class="tumblelog" href="https://tmblr.co/mijEE2qDDKca6_nfIAcd3mw" target="_blank">@shealwaysreads</a> because she deserves the world and all the naked, pensive boys. Enjoy him, babes. 💕💕</p><p>The fur is either fake or thrifted, obviously.</p><p>I hope you like him, it&rsquo;s my first time trying to colour kinda-gold, will try to improve.</p><p>[<a href="http://slytherco.tumblr.com/tagged/my+art" target="_blank">my other art</a>]</p></blockquote><p>This is so cool!! The textures are just wow! Your style really shines here (yes pun intended!)</p>`,
+	`<p><a class="tumblr_blog" href="https://sum-stuff13.tumblr.com/post/629258204002631681">sum-stuff13</a>:</p><blockquote><p><a class="tumblelog" href="https://tmblr.co/m9HCYkOsRynYxZCrU2SW-xw">@rorybutnotgilmore</a> </p><p><a class="tumblelog" href="https://tmblr.co/mV1McY9Paj-oKMv5AuDVTbw">@irisbellemoon</a> </p><p><a class="tumblr_blog" href="https://teamtrickster.tumblr.com/post/629257635786539008">teamtrickster</a>:</p><blockquote><p><span class="npf_color_ross">WE WILL ABSOLUTELY HELP THIS PERSON GET A DAGGER -Loki</span></p><p><a class="tumblr_blog" href="https://xspiderfanx.tumblr.com/post/629257528334860288">xspiderfanx</a>:</p><blockquote><p><a class="tumblr_blog" href="https://transzukostanblog.tumblr.com/post/629245937078927360">transzukostanblog</a>:</p><blockquote><p><a class="tumblr_blog" href="https://ab0masum.tumblr.com/post/629184557210566656">ab0masum</a>:</p><blockquote><p><a class="tumblr_blog" href="https://awkward-finger-guns.tumblr.com/post/629184248473124864">awkward-finger-guns</a>:</p><blockquote><p><a class="tumblr_blog" href="https://frustratedasatruar.tumblr.com/post/629183290750959616">frustratedasatruar</a>:</p><blockquote><p>So this post was originally made on September 11th 2020. I am reblogging on September 13th of the same year. At the time my computer first loaded this post it was at ten-thousand-one-hundred-and-eighty-two notes. By the time I’d scrolled down to it and chose to open it in a new tab so I could check when it was originally made, it had increased to 10,191 notes. When I noticed this as I was preparing to reblog, I reloaded the page and found that the number had reached 10,198.</p><p>What I’m sayig is that somewhere, someone’s mother is quite likely approaching the realization that they may actually be compelled to live up to their end of this little bargain.</p><p><a class="tumblr_blog" href="https://red-gay-tree.tumblr.com/post/629180469719728128">red-gay-tree</a>:</p><blockquote><p><a class="tumblr_blog" href="https://mama-dubh.tumblr.com/post/629155802454867968">mama-dubh</a>:</p><blockquote><p><a class="tumblr_blog" href="https://the-turtleduck-pond.tumblr.com/post/628994287286337536">the-turtleduck-pond</a>:</p><blockquote><p><a class="tumblr_blog" href="https://unfried-mouth-wheat.tumblr.com/post/628994053434933248">unfried-mouth-wheat</a>:</p><blockquote><p><a class="tumblr_blog" href="https://awkward-finger-guns.tumblr.com/post/628984617332064256">awkward-finger-guns</a>:</p><blockquote><p>YALYALLLL YALLLL YAL</p><p><br/></p><p>MY MOM SAID IF I COULD GET 100,000 NOTES I CAN GET A DAGGER</p><p><br/></p><p>PLEASE HELP ME</p><p>IM NOT ALLOWED TO REBLOG OR SPAM MY OWN POST SO HELP ME OUT GUSY</p><p>PLEASE I WANT A DAGGER</p></blockquote><p>this seems like a good cause</p></blockquote><p>Time to put my blog to interesting use.</p></blockquote><p>@tilltheendwilliwrite​ Can we help this lovely out? </p></blockquote><p><a class="tumblelog" href="https://tmblr.co/msUDMFBURtvB4bWig0dsWzQ">@bittergayvvitch</a> </p></blockquote><p>I am now about to hit reblog, but before I do I’m reloading the page one last time. In the time it has taken me to type this, the number has reached 10,205.</p></blockquote><p>were only 1/10 th of the way there but yeah, my mom is kinda scared now</p></blockquote><p>Haha yeah we&rsquo;re getting you a dagger.</p></blockquote><p>I approve of this cause</p></blockquote><p><a class="tumblelog" href="https://tmblr.co/mGJJ-_9S3jxHk9jFV6hVlSw">@teamtrickster</a> let&rsquo;s help this person get a dagger</p></blockquote><p><span class="npf_color_monica">YES!!! -Gabriel</span></p></blockquote><p>Guys come on pls. We gotta get her a dagger </p></blockquote>`,
+}
+
 func TestFlattenReblogs(t *testing.T) {
-	reblogs := []string{
-		`<p><a href="https://april-thelightfury115.tumblr.com/post/628962798765998080/lytefoot-vivithefolle-headcanonsandmore" class="tumblr_blog">april-thelightfury115</a>:</p> <blockquote><p><a href="https://lytefoot.tumblr.com/post/627529363045384192/vivithefolle-headcanonsandmore" class="tumblr_blog">lytefoot</a>:</p> <blockquote> <p><a href="https://vivithefolle.tumblr.com/post/627528961548795904/headcanonsandmore-evitoxytrash-i-found-these" class="tumblr_blog">vivithefolle</a>:</p> <blockquote> <p><a href="https://headcanonsandmore.tumblr.com/post/627528598568435712/evitoxytrash-i-found-these-in-my-notes-and" class="tumblr_blog">headcanonsandmore</a>:</p> <blockquote> <p><a href="https://evitoxytrash.tumblr.com/post/627470558410555392/i-found-these-in-my-notes-and-honestly-they-are" class="tumblr_blog">evitoxytrash</a>:</p> <blockquote> <p>I found these in my notes, and honestly, they are pure gold…</p> <p><br/></p> <p>—</p> <p>Teddy, into a hairbrush: YOOOOOOO I’ll tell you what I want, what I really really want</p> <p>Harry, into a different hairbrush: So tell me what you want what you really really want</p> <p>Remus, walking into the room: Harry</p> <p>Remus: What the fuck have you done to my child</p> <p>—</p> <p>*3am* </p> <p>Percy: What is all that racket</p> <p>*ball hits the window* </p> <p>Percy: *looks out the window to see his dumbass husband hosting Quidditch practice for their children* </p> <p>Percy: OLIVER IT IS THREE IN THE FUCKING MORNING</p> <p>—</p> <p>*procession music starts playing* </p> <p>Hermione: *comes out in a tux* </p> <p>Molly: …</p> <p>Ron: *struts down the aisle in a wedding dress* </p> <p>Molly: RONALD</p> <p>-</p> <p>Lee: *puts his child in a crib while Fred films* </p> <p>Crib: *turns into a rubber chicken* </p> <p>Lee: lmao</p> <p>—</p> <p>Angelina: George, don’t you <i>dare</i> cause a piece of furniture to turn into a rubber chicken</p> <p>George, frantically disabling all the transfiguration charms he had put on the table and chairs: Why would I ever do that? </p> <p>—</p> <p>*procession music starts playing* </p> <p>Lee: *comes out in nice pajamas*</p> <p>Fred: *comes out in nice pajamas as well* </p> <p>Molly: FREDERICK</p> <p>—</p> <p>Charlie, writing a letter: Dear mum,</p> <p>Charlie: I don’t know why you’re asking me, since you have seven kids</p> <p>Charlie: But since you want grandbabies</p> <p>Charlie: Here you go</p> <p>Charlie: *sends a picture of a dragon in a diaper*</p> <p>Charlie: Love, Charlie</p> </blockquote> <p><b>I, for one, think Ron would look <i>amazing</i> in a wedding dress. </b></p> </blockquote> <p>We need more pics of Romione weddings with Ron in a wedding dress.</p> <p>Scratch that we need more pictures of Ron in general.</p> </blockquote> <p>All of this is frickin <i>gold</i>.</p> </blockquote> <p>YES</p></blockquote>`,
-		`<p><a class="tumblr_blog" href="https://slytherco.tumblr.com/post/628881174844112896" target="_blank">slytherco</a>:</p><blockquote><figure class="tmblr-full" data-orig-height="2048" data-orig-width="1310"><img src="https://64.media.tumblr.com/683043a5a4c233c57fb42777dc44d713/65e71f4f39b89922-c9/s640x960/c8b047d310aa9b761e4d7f8e618822a7d04d1b1b.png" data-orig-height="2048" data-orig-width="1310"/></figure><p>I drew a naked Draco as a gift for <a class="tumblelog" href="https://tmblr.co/mijEE2qDDKca6_nfIAcd3mw" target="_blank">@shealwaysreads</a> because she deserves the world and all the naked, pensive boys. Enjoy him, babes. 💕💕</p><p>The fur is either fake or thrifted, obviously.</p><p>I hope you like him, it&rsquo;s my first time trying to colour kinda-gold, will try to improve.</p><p>[<a href="http://slytherco.tumblr.com/tagged/my+art" target="_blank">my other art</a>]</p></blockquote><p>This is so cool!! The textures are just wow! Your style really shines here (yes pun intended!)</p>`,
-		`<p><a class="tumblr_blog" href="https://sum-stuff13.tumblr.com/post/629258204002631681">sum-stuff13</a>:</p><blockquote><p><a class="tumblelog" href="https://tmblr.co/m9HCYkOsRynYxZCrU2SW-xw">@rorybutnotgilmore</a> </p><p><a class="tumblelog" href="https://tmblr.co/mV1McY9Paj-oKMv5AuDVTbw">@irisbellemoon</a> </p><p><a class="tumblr_blog" href="https://teamtrickster.tumblr.com/post/629257635786539008">teamtrickster</a>:</p><blockquote><p><span class="npf_color_ross">WE WILL ABSOLUTELY HELP THIS PERSON GET A DAGGER -Loki</span></p><p><a class="tumblr_blog" href="https://xspiderfanx.tumblr.com/post/629257528334860288">xspiderfanx</a>:</p><blockquote><p><a class="tumblr_blog" href="https://transzukostanblog.tumblr.com/post/629245937078927360">transzukostanblog</a>:</p><blockquote><p><a class="tumblr_blog" href="https://ab0masum.tumblr.com/post/629184557210566656">ab0masum</a>:</p><blockquote><p><a class="tumblr_blog" href="https://awkward-finger-guns.tumblr.com/post/629184248473124864">awkward-finger-guns</a>:</p><blockquote><p><a class="tumblr_blog" href="https://frustratedasatruar.tumblr.com/post/629183290750959616">frustratedasatruar</a>:</p><blockquote><p>So this post was originally made on September 11th 2020. I am reblogging on September 13th of the same year. At the time my computer first loaded this post it was at ten-thousand-one-hundred-and-eighty-two notes. By the time I’d scrolled down to it and chose to open it in a new tab so I could check when it was originally made, it had increased to 10,191 notes. When I noticed this as I was preparing to reblog, I reloaded the page and found that the number had reached 10,198.</p><p>What I’m sayig is that somewhere, someone’s mother is quite likely approaching the realization that they may actually be compelled to live up to their end of this little bargain.</p><p><a class="tumblr_blog" href="https://red-gay-tree.tumblr.com/post/629180469719728128">red-gay-tree</a>:</p><blockquote><p><a class="tumblr_blog" href="https://mama-dubh.tumblr.com/post/629155802454867968">mama-dubh</a>:</p><blockquote><p><a class="tumblr_blog" href="https://the-turtleduck-pond.tumblr.com/post/628994287286337536">the-turtleduck-pond</a>:</p><blockquote><p><a class="tumblr_blog" href="https://unfried-mouth-wheat.tumblr.com/post/628994053434933248">unfried-mouth-wheat</a>:</p><blockquote><p><a class="tumblr_blog" href="https://awkward-finger-guns.tumblr.com/post/628984617332064256">awkward-finger-guns</a>:</p><blockquote><p>YALYALLLL YALLLL YAL</p><p><br/></p><p>MY MOM SAID IF I COULD GET 100,000 NOTES I CAN GET A DAGGER</p><p><br/></p><p>PLEASE HELP ME</p><p>IM NOT ALLOWED TO REBLOG OR SPAM MY OWN POST SO HELP ME OUT GUSY</p><p>PLEASE I WANT A DAGGER</p></blockquote><p>this seems like a good cause</p></blockquote><p>Time to put my blog to interesting use.</p></blockquote><p>@tilltheendwilliwrite​ Can we help this lovely out? </p></blockquote><p><a class="tumblelog" href="https://tmblr.co/msUDMFBURtvB4bWig0dsWzQ">@bittergayvvitch</a> </p></blockquote><p>I am now about to hit reblog, but before I do I’m reloading the page one last time. In the time it has taken me to type this, the number has reached 10,205.</p></blockquote><p>were only 1/10 th of the way there but yeah, my mom is kinda scared now</p></blockquote><p>Haha yeah we&rsquo;re getting you a dagger.</p></blockquote><p>I approve of this cause</p></blockquote><p><a class="tumblelog" href="https://tmblr.co/mGJJ-_9S3jxHk9jFV6hVlSw">@teamtrickster</a> let&rsquo;s help this person get a dagger</p></blockquote><p><span class="npf_color_monica">YES!!! -Gabriel</span></p></blockquote><p>Guys come on pls. We gotta get her a dagger </p></blockquote>`,
-	}
 
-	for _, reblog := range reblogs {
+	for _, reblog := range reblogFixtures {
 		t.Run(reblog, func(t *testing.T) {
 			flattened, err := FlattenReblogs(reblog)
 			require.NoError(t, err, "flatten")
@@ -48,3 +58,274 @@ func TestFlattenReblogs(t *testing.T) {
 		})
 	}
 }
+
+func TestFlattenReblogsOwnBlogs(t *testing.T) {
+	reblog := `<p><a class="tumblr_blog" href="https://me.tumblr.com/post/2">me</a>:</p><blockquote><p><a class="tumblr_blog" href="https://other.tumblr.com/post/1">other</a>:</p><blockquote><p>original</p></blockquote><p>my comment</p></blockquote><p>my archive</p>`
+
+	flattened, err := FlattenReblogs(reblog)
+	require.NoError(t, err)
+	require.Contains(t, flattened, `>me</a>:</p><p>my comment</p>`, "attribution without own blogs")
+
+	OwnBlogs = map[string]bool{"me": true}
+	defer func() {
+		OwnBlogs = map[string]bool{}
+	}()
+
+	flattened, err = FlattenReblogs(reblog)
+	require.NoError(t, err)
+	require.NotContains(t, flattened, `>me</a>:</p>`, "own attribution")
+	require.Contains(t, flattened, `>other</a>:</p><blockquote><p>original</p></blockquote><p>my comment</p>`, "other attributions are kept")
+	require.Contains(t, flattened, `<p>my archive</p>`, "content")
+
+	flattened, err = FlattenReblogs(`<p><a class="tumblr_blog" href="https://other.tumblr.com/post/1">other</a>:</p><blockquote><p><a class="tumblr_blog" href="https://me.tumblr.com/post/2">me</a>:</p><blockquote><p>original</p></blockquote><p>their comment</p></blockquote>`)
+	require.NoError(t, err)
+	require.Contains(t, flattened, `>me</a>:</p><blockquote><p>original</p></blockquote>`, "own attributions further down are kept")
+}
+
+func TestCollapseReblogs(t *testing.T) {
+	flattened, err := FlattenReblogs(reblogFixtures[2])
+	require.NoError(t, err, "flatten")
+
+	collapsed, err := CollapseReblogs(flattened, 3)
+	require.NoError(t, err, "collapse")
+
+	original := strings.Index(collapsed, "PLEASE I WANT A DAGGER")
+	details := strings.Index(collapsed, "<details><summary>11 more reblogs</summary>")
+	newest := strings.Index(collapsed, "Guys come on pls")
+	require.True(t, original != -1 && details != -1 && newest != -1, "missing parts: %s", collapsed)
+	require.True(t, original < details, "original post before the collapsed reblogs")
+	require.True(t, details < strings.Index(collapsed, "this seems like a good cause"), "oldest comment collapsed")
+	require.True(t, strings.Index(collapsed, "</details>") < newest, "newest comment after the collapsed reblogs")
+
+	_, err = html.Parse(strings.NewReader(collapsed))
+	require.NoError(t, err, "parse collapsed html")
+
+	notCollapsed, err := CollapseReblogs(flattened, 20)
+	require.NoError(t, err)
+	require.Equal(t, flattened, notCollapsed, "fewer levels than the maximum")
+
+	flattened, err = FlattenReblogs(`<p><a class="tumblr_blog" href="https://b.tumblr.com/post/2">b</a>:</p><blockquote><p><a class="tumblr_blog" href="https://a.tumblr.com/post/1">a</a>:</p><blockquote><p>original</p></blockquote><p>first comment</p></blockquote><p>newest comment</p>`)
+	require.NoError(t, err)
+	collapsed, err = CollapseReblogs(flattened, 1)
+	require.NoError(t, err)
+	require.Contains(t, collapsed, `<blockquote><p>original</p></blockquote><details><summary>1 more reblogs</summary><p><a class="tumblr_blog" href="https://b.tumblr.com/post/2">b</a>:</p><p>first comment</p></details></blockquote><p>newest comment</p>`, "collapsed")
+}
+
+func TestProcessNPFBlocks(t *testing.T) {
+	post := feed.Post{
+		DescriptionHTML: `<p>look at this:</p><div class="npf_link" data-npf='{"type":"link","url":"https://example.org/article","display_url":"example.org/article","title":"An article","description":"It is about things.","site_name":"example.org","poster":[{"url":"https://64.media.tumblr.com/poster.jpg","type":"image/jpeg","width":540,"height":300}]}'></div><div class="poll-post" data-npf='{"type":"poll","question":"Cats or dogs?","answers":[{"client_id":"1","answer_text":"cats"},{"client_id":"2","answer_text":"dogs"}]}'></div>`,
+	}
+
+	err := Process(&post)
+	require.NoError(t, err)
+
+	require.NotContains(t, post.DescriptionHTML, "data-npf", "npf blocks should be replaced")
+	require.Contains(t, post.DescriptionHTML, `<p>look at this:</p>`)
+	require.Contains(t, post.DescriptionHTML, `<a href="https://example.org/article"><img src="https://64.media.tumblr.com/poster.jpg" alt=""/><strong>An article</strong></a>`, "link card")
+	require.Contains(t, post.DescriptionHTML, `<p>It is about things.</p>`, "link description")
+	require.Contains(t, post.DescriptionHTML, `<figcaption>Poll: Cats or dogs?</figcaption><ul><li>cats</li><li>dogs</li></ul>`, "poll")
+
+	processedHTML := post.DescriptionHTML
+	err = Process(&post)
+	require.NoError(t, err)
+	require.Equal(t, processedHTML, post.DescriptionHTML, "processing twice should not change anything")
+}
+
+func TestRenderNPFBlockEscapes(t *testing.T) {
+	var block npfBlock
+	err := json.Unmarshal([]byte(`{"type":"link","url":"https://x.example/a?\"onmouseover=alert(1)//","title":"title","poster":[{"url":"https://x.example/a.png?\"onerror=alert(1)//"}]}`), &block)
+	require.NoError(t, err)
+	rendered := renderNPFBlock(block)
+	require.Contains(t, rendered, `<a href="https://x.example/a?&#34;onmouseover=alert(1)//">`, "link")
+	require.Contains(t, rendered, `<img src="https://x.example/a.png?&#34;onerror=alert(1)//" alt="" />`, "poster")
+
+	err = json.Unmarshal([]byte(`{"type":"link","url":"javascript:alert(1)","title":"title","poster":[{"url":"javascript:alert(2)"}]}`), &block)
+	require.NoError(t, err)
+	rendered = renderNPFBlock(block)
+	require.NotContains(t, rendered, "javascript:", "only links to websites")
+	require.Contains(t, rendered, `<strong>title</strong>`, "title without link")
+}
+
+func TestReblogSource(t *testing.T) {
+	sources := []string{"evitoxytrash", "slytherco", "awkward-finger-guns"}
+
+	for i, reblog := range reblogFixtures {
+		t.Run(sources[i], func(t *testing.T) {
+			require.Equal(t, sources[i], ReblogSource(reblog), "reblog source")
+
+			flattened, err := FlattenReblogs(reblog)
+			require.NoError(t, err, "flatten")
+			require.Equal(t, sources[i], ReblogSource(flattened), "reblog source after flattening")
+		})
+	}
+}
+
+// pagesTransport serves RSS pages with 3 posts each, with post ids counting
+// down from 100 on the first page.
+type pagesTransport struct {
+	requested []string
+}
+
+func (pt *pagesTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	pt.requested = append(pt.requested, req.URL.Path)
+
+	page := 1
+	if req.URL.Path != "/rss" {
+		_, err := fmt.Sscanf(req.URL.Path, "/page/%d/rss", &page)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	buf := new(strings.Builder)
+	fmt.Fprint(buf, `<?xml version="1.0" encoding="UTF-8"?><rss version="2.0"><channel><title>staff</title><description>the staff</description><link>https://staff.tumblr.com/</link>`)
+	for i := 0; i < 3; i++ {
+		id := 100 - (page-1)*3 - i
+		date := time.Date(2022, time.June, 1, 0, 0, id, 0, time.UTC).Format(TumblrDate)
+		fmt.Fprintf(buf, `<item><title>post %d</title><description>&lt;p&gt;post %d&lt;/p&gt;</description><link>https://staff.tumblr.com/post/%d</link><guid>https://staff.tumblr.com/post/%d</guid><pubDate>%s</pubDate></item>`, id, id, id, id, date)
+	}
+	fmt.Fprint(buf, `</channel></rss>`)
+
+	return &http.Response{
+		StatusCode: http.StatusOK,
+		Body:       io.NopCloser(strings.NewReader(buf.String())),
+		Request:    req,
+	}, nil
+}
+
+func TestBackfill(t *testing.T) {
+	transport := &pagesTransport{}
+	origTransport := http.DefaultClient.Transport
+	http.DefaultClient.Transport = transport
+	defer func() {
+		http.DefaultClient.Transport = origTransport
+	}()
+
+	f, err := Open(context.Background(), "staff", feed.Search{BeforeID: "96", Limit: 4})
+	require.NoError(t, err)
+	defer f.Close()
+
+	ids := make([]string, 0, 4)
+	post, err := f.Next()
+	for err == nil {
+		ids = append(ids, post.ID)
+		post, err = f.Next()
+	}
+	require.True(t, errors.Is(err, io.EOF), "expected EOF, but got %s", err)
+
+	require.Equal(t, []string{"95", "94", "93", "92"}, ids, "posts before cursor")
+	require.Equal(t, []string{"/rss", "/page/2/rss", "/page/3/rss"}, transport.requested, "requested pages")
+
+	transport.requested = nil
+	f, err = Open(context.Background(), "staff", feed.Search{Limit: 4})
+	require.NoError(t, err)
+	defer f.Close()
+	f.(feed.Paginatable).SetCursor("96")
+
+	ids = ids[:0]
+	post, err = f.Next()
+	for err == nil {
+		ids = append(ids, post.ID)
+		post, err = f.Next()
+	}
+	require.True(t, errors.Is(err, io.EOF), "expected EOF, but got %s", err)
+
+	require.Equal(t, []string{"95", "94", "93", "92"}, ids, "SetCursor")
+	require.Equal(t, []string{"/rss", "/page/2/rss", "/page/3/rss"}, transport.requested, "SetCursor")
+}
+
+// pollFixtures are the descriptions of poll posts, with the poll as NPF data
+// including the results and as plain markup.
+var pollFixtures = []string{
+	`<p>settle this once and for all</p><div class="poll-post" data-npf='{"type":"poll","client_id":"5c1d2a6e","question":"which is the best season?","answers":[{"client_id":"a1","answer_text":"spring"},{"client_id":"a2","answer_text":"autumn"},{"client_id":"a3","answer_text":"winter &amp; snow"}],"settings":{"multiple_choice":false,"close_status":"closed-after","expire_after":604800,"source":"tumblr"},"results":{"a1":12,"a2":40,"a3":3}}'></div>`,
+	`<div class="tmblr-poll"><h2>tea or coffee?</h2><ul><li><span>tea</span></li><li>coffee</li><li> </li></ul></div><p>asking for a friend</p>`,
+	`<div class="tmblr-poll"></div>`,
+}
+
+type staticTransport string
+
+func (st staticTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	return &http.Response{
+		StatusCode: http.StatusOK,
+		Body:       io.NopCloser(strings.NewReader(string(st))),
+		Request:    req,
+	}, nil
+}
+
+func TestPolls(t *testing.T) {
+	buf := new(strings.Builder)
+	fmt.Fprint(buf, `<?xml version="1.0" encoding="UTF-8"?><rss version="2.0"><channel><title>staff</title><description>the staff</description><link>https://staff.tumblr.com/</link>`)
+	for i, poll := range pollFixtures {
+		id := 100 - i
+		date := time.Date(2023, time.March, 1, 0, 0, id, 0, time.UTC).Format(TumblrDate)
+		fmt.Fprintf(buf, `<item><title>poll %d</title><description>%s</description><link>https://staff.tumblr.com/post/%d</link><guid>https://staff.tumblr.com/post/%d</guid><pubDate>%s</pubDate></item>`, id, html.EscapeString(poll), id, id, date)
+	}
+	fmt.Fprint(buf, `</channel></rss>`)
+
+	origTransport := http.DefaultClient.Transport
+	http.DefaultClient.Transport = staticTransport(buf.String())
+	defer func() {
+		http.DefaultClient.Transport = origTransport
+	}()
+
+	f, err := Open(context.Background(), "staff", feed.Search{})
+	require.NoError(t, err)
+	defer f.Close()
+
+	post, err := f.Next()
+	require.NoError(t, err)
+	require.NotContains(t, post.DescriptionHTML, "data-npf", "npf poll should be replaced")
+	require.Contains(t, post.DescriptionHTML, `<p>settle this once and for all</p>`)
+	require.Contains(t, post.DescriptionHTML, `<figcaption>Poll: which is the best season?</figcaption><ul><li>spring <small>(12 votes)</small></li><li>autumn <small>(40 votes)</small></li><li>winter &amp; snow <small>(3 votes)</small></li></ul>`, "npf poll with results")
+
+	post, err = f.Next()
+	require.NoError(t, err)
+	require.NotContains(t, post.DescriptionHTML, "tmblr-poll", "poll markup should be replaced")
+	require.Contains(t, post.DescriptionHTML, `<figcaption>Poll: tea or coffee?</figcaption><ul><li>tea</li><li>coffee</li></ul>`, "poll from markup")
+	require.Contains(t, post.DescriptionHTML, `<p>asking for a friend</p>`)
+
+	post, err = f.Next()
+	require.NoError(t, err)
+	require.Contains(t, post.DescriptionHTML, `<p class="poll">Poll <small>(see the post on Tumblr)</small></p>`, "empty poll")
+
+	_, err = f.Next()
+	require.True(t, errors.Is(err, io.EOF), "expected EOF, but got %s", err)
+}
+
+type conditionalTransport struct {
+	etag string
+	rss  string
+}
+
+func (ct conditionalTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.Header.Get("If-None-Match") == ct.etag {
+		return &http.Response{StatusCode: http.StatusNotModified, Body: io.NopCloser(strings.NewReader("")), Request: req}, nil
+	}
+	return &http.Response{
+		StatusCode: http.StatusOK,
+		Header:     http.Header{"Etag": {ct.etag}, "Last-Modified": {"Sat, 01 Jul 2023 00:00:00 GMT"}},
+		Body:       io.NopCloser(strings.NewReader(ct.rss)),
+		Request:    req,
+	}, nil
+}
+
+func TestConditional(t *testing.T) {
+	origTransport := http.DefaultClient.Transport
+	http.DefaultClient.Transport = conditionalTransport{etag: `"v1"`, rss: `<?xml version="1.0" encoding="UTF-8"?><rss version="2.0"><channel><title>staff</title><description>the staff</description><link>https://staff.tumblr.com/</link></channel></rss>`}
+	defer func() {
+		http.DefaultClient.Transport = origTransport
+	}()
+
+	f, err := Open(context.Background(), "staff", feed.Search{})
+	require.NoError(t, err)
+	require.NoError(t, f.Close())
+	require.Equal(t, `"v1"`, f.(feed.Validators).ETag())
+	require.Equal(t, "Sat, 01 Jul 2023 00:00:00 GMT", f.(feed.Validators).LastModified())
+
+	_, err = Open(context.Background(), "staff", feed.Search{IfNoneMatch: `"v1"`})
+	require.ErrorIs(t, err, feed.ErrNotModified, "unchanged")
+
+	f, err = Open(context.Background(), "staff", feed.Search{IfNoneMatch: `"v0"`})
+	require.NoError(t, err, "changed")
+	require.NoError(t, f.Close())
+}
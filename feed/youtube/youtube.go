@@ -6,6 +6,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"io"
+	"log"
 	"net/http"
 	"net/url"
 	"strconv"
@@ -16,11 +17,47 @@ import (
 	"github.com/heyLu/numblr/feed/rss"
 )
 
+// Timeout is how long opening YouTube feeds may take, as channels are looked
+// up by their name first.
+const Timeout = 20 * time.Second
+
 // maxResultSize is the maximum amount of bytes to read from a YouTube
 // search result page.
 const maxResultSize = 300 * 1000 * 1000
 
-var searchResultStart = []byte(`{"primaryContents":{"sectionListRenderer":{"contents":[{"itemSectionRenderer":{"contents":`)
+// searchResultMarkers are the places in a search result page after which
+// the results are, from the most to the least specific.  YouTube changes its
+// markup often, so there are several of them.
+var searchResultMarkers = [][]byte{
+	[]byte(`{"primaryContents":{"sectionListRenderer":{"contents":[{"itemSectionRenderer":{"contents":`),
+	[]byte(`"itemSectionRenderer":{"contents":`),
+}
+
+// jsonCandidates returns the content directly after every occurrence of the
+// markers in content, in the order of the markers.
+func jsonCandidates(content []byte, markers [][]byte) [][]byte {
+	candidates := make([][]byte, 0, len(markers))
+	seen := make(map[int]bool)
+	for _, marker := range markers {
+		rest := content
+		offset := 0
+		for {
+			idx := bytes.Index(rest, marker)
+			if idx == -1 {
+				break
+			}
+
+			start := offset + idx + len(marker)
+			if !seen[start] {
+				seen[start] = true
+				candidates = append(candidates, content[start:])
+			}
+			rest = rest[idx+len(marker):]
+			offset += idx + len(marker)
+		}
+	}
+	return candidates
+}
 
 // Open creates a new feed for YouTube.
 func Open(ctx context.Context, name string, search feed.Search) (feed.Feed, error) {
@@ -46,43 +83,25 @@ func Open(ctx context.Context, name string, search feed.Search) (feed.Feed, erro
 		return nil, fmt.Errorf("reading search results: %w", err)
 	}
 
-	content := buf.Bytes()
-	searchResultsIdx := bytes.Index(content, searchResultStart)
-	if searchResultsIdx == -1 {
-		return nil, fmt.Errorf("invalid search results: %q not found", searchResultStart)
-	}
-
-	buf.Reset()
-	_, err = buf.Write(content[searchResultsIdx+len(searchResultStart):])
+	channel, err := parseSearchResults(buf.Bytes())
 	if err != nil {
-		return nil, fmt.Errorf("truncating search results: %w", err)
-	}
-
-	var results []youtubeChannel
-	dec := json.NewDecoder(buf)
-	err = dec.Decode(&results)
-	if err != nil {
-		return nil, fmt.Errorf("parsing search results: %w", err)
+		return nil, err
 	}
-
-	if len(results) == 0 {
+	if channel == nil {
 		return nil, fmt.Errorf("no channel %q found", name)
 	}
 
-	channelID := results[0].ChannelRenderer.ChannelID
-	if channelID == "" {
-		return nil, fmt.Errorf("no channel %q found (empty channel id)", name)
-	}
+	channelID := channel.ChannelRenderer.ChannelID
 
 	baseURL, _ := url.Parse("https://www.youtube.com")
-	channelURL, err := url.Parse(results[0].ChannelRenderer.NavigationEndpoint.BrowseEndpoint.CanonicalBaseURL)
+	channelURL, err := url.Parse(channel.ChannelRenderer.NavigationEndpoint.BrowseEndpoint.CanonicalBaseURL)
 	if err != nil {
 		return nil, fmt.Errorf("invalid channel url: %w", err)
 	}
 	channelURL = baseURL.ResolveReference(channelURL)
 
 	var avatarURL string
-	thumbnails := results[0].ChannelRenderer.Thumbnail.Thumbnails
+	thumbnails := channel.ChannelRenderer.Thumbnail.Thumbnails
 	if len(thumbnails) > 0 {
 		thumbnailURL, err := url.Parse(thumbnails[len(thumbnails)-1].URL)
 		if err != nil {
@@ -91,34 +110,105 @@ func Open(ctx context.Context, name string, search feed.Search) (feed.Feed, erro
 		avatarURL = baseURL.ResolveReference(thumbnailURL).String()
 	}
 
-	req, err = http.NewRequestWithContext(ctx, "GET", "https://youtube.com/channel/"+url.QueryEscape(channelID)+"/community", nil)
+	// community posts are optional, if they can't be fetched or parsed the
+	// videos are still shown
+	communityPosts, err := fetchCommunityPosts(ctx, name, channelID, avatarURL)
+	if err != nil {
+		log.Printf("Error: youtube %q: %s", name, err)
+	}
+
+	ytFeed, err := rss.Open(ctx, "https://www.youtube.com/feeds/videos.xml?channel_id="+url.QueryEscape(channelID), search)
+	if err != nil {
+		return nil, err
+	}
+
+	merged := feed.Merge(&feed.Static{
+		FeedName:        name + "@youtube",
+		FeedURL:         channelURL.String(),
+		FeedDescription: ytFeed.Description(),
+		Posts:           communityPosts,
+	}, &youtubeRSS{name: name, url: channelURL.String(), avatarURL: avatarURL, RSS: ytFeed.(*rss.RSS)})
+	return &channelFeed{Feed: merged, url: channelURL.String(), description: ytFeed.Description()}, nil
+}
+
+// channelFeed is the merged feed of the community posts and videos of a
+// channel, which has the url and description of the channel.
+type channelFeed struct {
+	feed.Feed
+
+	url         string
+	description string
+}
+
+func (cf *channelFeed) URL() string {
+	return cf.url
+}
+
+func (cf *channelFeed) Description() string {
+	return cf.description
+}
+
+// SetCursor implements feed.Paginatable.
+func (cf *channelFeed) SetCursor(id string) {
+	if paginatable, ok := cf.Feed.(feed.Paginatable); ok {
+		paginatable.SetCursor(id)
+	}
+}
+
+// parseSearchResults returns the first channel in the search result page
+// `content`, or nil if there is none.
+func parseSearchResults(content []byte) (*youtubeChannel, error) {
+	candidates := jsonCandidates(content, searchResultMarkers)
+	if len(candidates) == 0 {
+		return nil, fmt.Errorf("invalid search results: none of %q found", searchResultMarkers)
+	}
+
+	var lastErr error
+	decoded := false
+	for _, candidate := range candidates {
+		var results []youtubeChannel
+		err := json.NewDecoder(bytes.NewReader(candidate)).Decode(&results)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		decoded = true
+
+		for _, result := range results {
+			if result.ChannelRenderer.ChannelID != "" {
+				return &result, nil
+			}
+		}
+	}
+	if !decoded {
+		return nil, fmt.Errorf("parsing search results: %w", lastErr)
+	}
+
+	return nil, nil
+}
+
+func fetchCommunityPosts(ctx context.Context, name string, channelID string, avatarURL string) ([]feed.Post, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", "https://youtube.com/channel/"+url.QueryEscape(channelID)+"/community", nil)
 	if err != nil {
 		return nil, fmt.Errorf("new request: %w", err)
 	}
 	req.Header.Set("Accept-Language", "en-UK")
 
-	resp, err = http.DefaultClient.Do(req)
+	resp, err := http.DefaultClient.Do(req)
 	if err != nil {
 		return nil, fmt.Errorf("fetching community posts: %w", err)
 	}
 	defer resp.Body.Close()
 
-	communityPosts, err := parseCommunityPosts(name, avatarURL, resp.Body)
-	if err != nil {
-		return nil, fmt.Errorf("parsing community posts: %w", err)
+	if resp.StatusCode != 200 {
+		return nil, fmt.Errorf("fetching community posts: %w", feed.StatusError{Code: resp.StatusCode})
 	}
 
-	ytFeed, err := rss.Open(ctx, "https://www.youtube.com/feeds/videos.xml?channel_id="+url.QueryEscape(channelID), search)
+	communityPosts, err := parseCommunityPosts(name, avatarURL, resp.Body)
 	if err != nil {
-		return nil, err
+		return nil, fmt.Errorf("parsing community posts: %w", err)
 	}
-
-	return feed.Merge(&feed.Static{
-		FeedName:        name + "@youtube",
-		FeedURL:         channelURL.String(),
-		FeedDescription: ytFeed.Description(),
-		Posts:           communityPosts,
-	}, &youtubeRSS{name: name, url: channelURL.String(), avatarURL: avatarURL, RSS: ytFeed.(*rss.RSS)}), nil
+	return communityPosts, nil
 }
 
 type youtubeRSS struct {
@@ -231,29 +321,38 @@ func parseCommunityPosts(author string, avatarURL string, r io.Reader) ([]feed.P
 		return nil, fmt.Errorf("reading search results: %w", err)
 	}
 
-	content := buf.Bytes()
-	communityPostsIdx := bytes.Index(content, youtubeCommunityPostsStart)
-	if communityPostsIdx == -1 {
-		return nil, fmt.Errorf("invalid search results: %q not found", youtubeCommunityPostsStart)
-	}
-
-	buf.Reset()
-	_, err = buf.Write(content[communityPostsIdx+len(youtubeCommunityPostsStart):])
-	if err != nil {
-		return nil, fmt.Errorf("truncating search results: %w", err)
+	candidates := jsonCandidates(buf.Bytes(), youtubeCommunityPostsMarkers)
+	if len(candidates) == 0 {
+		return nil, fmt.Errorf("invalid community posts: none of %q found", youtubeCommunityPostsMarkers)
 	}
 
+	// use the first candidate that contains posts, e.g. other sections
+	// might come before the posts
 	var results []youtubeCommunityPost
-	dec := json.NewDecoder(buf)
-	err = dec.Decode(&results)
-	if err != nil {
-		return nil, fmt.Errorf("parsing search results: %w", err)
+	var lastErr error
+	decoded := false
+	for _, candidate := range candidates {
+		var candidateResults []youtubeCommunityPost
+		err := json.NewDecoder(bytes.NewReader(candidate)).Decode(&candidateResults)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		decoded = true
+
+		if hasCommunityPosts(candidateResults) {
+			results = candidateResults
+			break
+		}
+	}
+	if !decoded {
+		return nil, fmt.Errorf("parsing community posts: %w", lastErr)
 	}
 
 	posts := make([]feed.Post, 0, len(results))
 	for _, result := range results {
 		data := result.BackstagePostThreadRenderer.Post.BackstagePostRenderer
-		if data.PostID == "" {
+		if data.PostID == "" || len(data.PublishedTimeText.Runs) == 0 {
 			continue // non backstagePostRenderer
 		}
 
@@ -284,7 +383,22 @@ func parseCommunityPosts(author string, avatarURL string, r io.Reader) ([]feed.P
 	return posts, nil
 }
 
-var youtubeCommunityPostsStart = []byte(`{"itemSectionRenderer":{"contents":`)
+// youtubeCommunityPostsMarkers are the places in a community page after
+// which the posts might be.
+var youtubeCommunityPostsMarkers = [][]byte{
+	[]byte(`{"itemSectionRenderer":{"contents":`),
+	[]byte(`"itemSectionRenderer":{"contents":`),
+	[]byte(`"richGridRenderer":{"contents":`),
+}
+
+func hasCommunityPosts(results []youtubeCommunityPost) bool {
+	for _, result := range results {
+		if result.BackstagePostThreadRenderer.Post.BackstagePostRenderer.PostID != "" {
+			return true
+		}
+	}
+	return false
+}
 
 // youtubeCommunityPost is the internal JSON format that YouTube uses to
 // render community posts on their website.
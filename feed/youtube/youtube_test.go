@@ -0,0 +1,91 @@
+package youtube
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/heyLu/numblr/feed"
+)
+
+// fixtureTransport responds to requests with the fixture for their path, or
+// with a 404 if there is none.
+type fixtureTransport map[string]string
+
+func (ft fixtureTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	rec := httptest.NewRecorder()
+	fixture, ok := ft[req.URL.Path]
+	if !ok {
+		http.NotFound(rec, req)
+	} else {
+		_, _ = io.WriteString(rec, fixture)
+	}
+	return rec.Result(), nil
+}
+
+const searchFixture = `<html><script>var ytInitialData = {"contents":{"twoColumnSearchResultsRenderer":{"primaryContents":{"sectionListRenderer":{"contents":[{"itemSectionRenderer":{"contents":[{"channelRenderer":{"channelId":"UC123","title":{"simpleText":"Example"},"navigationEndpoint":{"browseEndpoint":{"canonicalBaseUrl":"/@example"}},"thumbnail":{"thumbnails":[{"url":"//yt3.ggpht.com/example=s88","width":88,"height":88}]}}}]}}]}}}};</script></html>`
+
+const videosFixture = `<?xml version="1.0" encoding="UTF-8"?>
+<feed xmlns:yt="http://www.youtube.com/xml/schemas/2015" xmlns:media="http://search.yahoo.com/mrss/" xmlns="http://www.w3.org/2005/Atom">
+	<title>Example</title>
+	<link rel="alternate" href="https://www.youtube.com/channel/UC123"/>
+	<entry>
+		<id>yt:video:abc</id>
+		<title>A video</title>
+		<link rel="alternate" href="https://www.youtube.com/watch?v=abc"/>
+		<published>2022-06-01T12:00:00+00:00</published>
+		<media:group>
+			<media:title>A video</media:title>
+			<media:thumbnail url="https://i1.ytimg.com/vi/abc/hqdefault.jpg" width="480" height="360"/>
+			<media:description>Watch this</media:description>
+		</media:group>
+	</entry>
+</feed>`
+
+func TestOpenWithoutCommunityPosts(t *testing.T) {
+	transport := http.DefaultClient.Transport
+	defer func() { http.DefaultClient.Transport = transport }()
+
+	http.DefaultClient.Transport = fixtureTransport{
+		"/results":                 searchFixture,
+		"/channel/UC123/community": `<html>no posts here, youtube changed things again</html>`,
+		"/feeds/videos.xml":        videosFixture,
+	}
+
+	f, err := Open(context.Background(), "example@youtube", feed.Search{})
+	require.NoError(t, err, "open")
+	defer f.Close()
+
+	require.Equal(t, "example@youtube", f.Name())
+	require.Equal(t, "https://www.youtube.com/@example", f.URL())
+
+	post, err := f.Next()
+	require.NoError(t, err, "next")
+	require.Equal(t, "yt:video:abc", post.ID)
+	require.Equal(t, "youtube", post.Source)
+	require.Equal(t, "https://yt3.ggpht.com/example=s88", post.AvatarURL)
+	require.Contains(t, post.DescriptionHTML, "Watch this")
+
+	_, err = f.Next()
+	require.True(t, errors.Is(err, io.EOF), "expected EOF, but got %s", err)
+}
+
+func TestParseCommunityPosts(t *testing.T) {
+	// the posts are not in the first section, and not at the usual marker
+	page := `{"itemSectionRenderer":{"contents":[{"messageRenderer":{}}]}}, "richGridRenderer":{"contents":[{"backstagePostThreadRenderer":{"post":{"backstagePostRenderer":{"postId":"Ugx1","contentText":{"runs":[{"text":"hello "},{"text":"there"}]},"publishedTimeText":{"runs":[{"text":"2 days ago"}]}}}}}]}`
+
+	posts, err := parseCommunityPosts("example", "", strings.NewReader(page))
+	require.NoError(t, err)
+	require.Len(t, posts, 1)
+	require.Equal(t, "Ugx1", posts[0].ID)
+	require.Equal(t, "hello there", posts[0].DescriptionHTML)
+
+	_, err = parseCommunityPosts("example", "", strings.NewReader(`<html></html>`))
+	require.Error(t, err, "no markers")
+}
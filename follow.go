@@ -0,0 +1,131 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// followedFeeds returns the feeds that are saved in the cookie of the list,
+// or in the main cookie if `list` is empty.
+//
+// Like on the pages without a cookie, the default feeds are followed
+// initially.
+func followedFeeds(req *http.Request, list string) []string {
+	cookieName := CookieName
+	if list != "" {
+		cookieName = CookieName + "-list-" + list
+	}
+
+	cookie, err := req.Cookie(cookieName)
+	if err != nil || cookie.Value == "" {
+		return strings.Split(config.DefaultFeed, ",")
+	}
+	return strings.Split(cookie.Value, ",")
+}
+
+// isFollowed returns true if `feedName` is in the feeds, with or without a
+// search.
+func isFollowed(feeds []string, feedName string) bool {
+	for _, followed := range feeds {
+		name, _ := splitFeedSearch(strings.TrimSpace(followed))
+		if name == feedName {
+			return true
+		}
+	}
+	return false
+}
+
+// dedupeFeeds returns the feeds without duplicates and the names of them.
+//
+// Feeds are compared by name, with or without a search, so that following
+// one twice does not show every post twice.
+func dedupeFeeds(feeds []string) ([]string, map[string]bool) {
+	seen := make(map[string]bool, len(feeds))
+	unique := make([]string, 0, len(feeds))
+	for _, followed := range feeds {
+		followed = strings.TrimSpace(followed)
+		name, _ := splitFeedSearch(followed)
+		if followed == "" || seen[name] {
+			continue
+		}
+		seen[name] = true
+		unique = append(unique, followed)
+	}
+	return unique, seen
+}
+
+// HandleFollow adds the `feed` to the followed feeds of the `list` (or the
+// main ones), unless it is followed already.
+func HandleFollow(w http.ResponseWriter, req *http.Request) {
+	setFollowed(w, req, true)
+}
+
+// HandleUnfollow removes the `feed` from the followed feeds of the `list`
+// (or the main ones).
+func HandleUnfollow(w http.ResponseWriter, req *http.Request) {
+	setFollowed(w, req, false)
+}
+
+func setFollowed(w http.ResponseWriter, req *http.Request, follow bool) {
+	feedName := strings.TrimSpace(req.FormValue("feed"))
+	if feedName == "" || strings.Contains(feedName, ",") {
+		http.Error(w, fmt.Sprintf("Error: invalid feed %q", feedName), http.StatusBadRequest)
+		return
+	}
+
+	list := req.FormValue("list")
+
+	feeds, seen := dedupeFeeds(followedFeeds(req, list))
+	if follow && !seen[feedName] {
+		feeds = append(feeds, feedName)
+	}
+	if !follow {
+		kept := make([]string, 0, len(feeds))
+		for _, followed := range feeds {
+			if name, _ := splitFeedSearch(followed); name != feedName {
+				kept = append(kept, followed)
+			}
+		}
+		feeds = kept
+	}
+
+	redirect := req.FormValue("redirect")
+	if !strings.HasPrefix(redirect, "/") || strings.HasPrefix(redirect, "//") {
+		redirect = "/"
+	}
+
+	saveFollowedFeeds(w, list, feeds)
+	http.Redirect(w, req, redirect, http.StatusSeeOther)
+}
+
+// saveFollowedFeeds saves the feeds in the cookie of the list, or in the
+// main cookie if `list` is empty, see followedFeeds.
+func saveFollowedFeeds(w http.ResponseWriter, list string, feeds []string) {
+	cookieName := CookieName
+	if list != "" {
+		cookieName = CookieName + "-list-" + list
+	}
+
+	cookie := &http.Cookie{
+		Name:     cookieName,
+		Value:    strings.Join(feeds, ","),
+		Path:     "/",
+		MaxAge:   365 * 24 * 60 * 60, // one year
+		SameSite: http.SameSiteLaxMode,
+		HttpOnly: true,
+	}
+	if cookie.Value == "" {
+		// no feeds at all are the default feeds
+		cookie.MaxAge = -1
+	}
+	http.SetCookie(w, cookie)
+}
+
+func followForm(feedName string, list string, follow bool, redirect string) string {
+	action, label := "/follow", "follow"
+	if !follow {
+		action, label = "/unfollow", "unfollow"
+	}
+	return fmt.Sprintf(`<form class="follow" method="POST" action=%q><input type="hidden" name="feed" value=%q /><input type="hidden" name="list" value=%q /><input type="hidden" name="redirect" value=%q /><input type="submit" value=%q /></form>`, action, feedName, list, redirect, label)
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func postFollow(handler http.HandlerFunc, form url.Values, cookies ...*http.Cookie) *http.Response {
+	req := httptest.NewRequest("POST", "/follow", strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	for _, cookie := range cookies {
+		req.AddCookie(cookie)
+	}
+	w := httptest.NewRecorder()
+	handler(w, req)
+	return w.Result()
+}
+
+func TestHandleFollow(t *testing.T) {
+	origDefaultFeed := config.DefaultFeed
+	config.DefaultFeed = "staff"
+	defer func() {
+		config.DefaultFeed = origDefaultFeed
+	}()
+
+	resp := postFollow(HandleFollow, url.Values{"feed": {"engineering"}, "redirect": {"/engineering"}})
+	assert.Equal(t, http.StatusSeeOther, resp.StatusCode)
+	assert.Equal(t, "/engineering", resp.Header.Get("Location"))
+	require.Len(t, resp.Cookies(), 1)
+	assert.Equal(t, CookieName, resp.Cookies()[0].Name)
+	assert.Equal(t, "staff,engineering", resp.Cookies()[0].Value, "added to the default feeds")
+
+	resp = postFollow(HandleFollow, url.Values{"feed": {"staff"}}, &http.Cookie{Name: CookieName, Value: "staff noreblogs,engineering,engineering"})
+	require.Len(t, resp.Cookies(), 1)
+	assert.Equal(t, "staff noreblogs,engineering", resp.Cookies()[0].Value, "deduplicated")
+
+	resp = postFollow(HandleFollow, url.Values{"feed": {"xkcd.com"}, "list": {"comics"}, "redirect": {"//evil.example"}})
+	assert.Equal(t, "/", resp.Header.Get("Location"), "only local redirects")
+	require.Len(t, resp.Cookies(), 1)
+	assert.Equal(t, CookieName+"-list-comics", resp.Cookies()[0].Name)
+
+	resp = postFollow(HandleUnfollow, url.Values{"feed": {"staff"}}, &http.Cookie{Name: CookieName, Value: "staff noreblogs,engineering"})
+	require.Len(t, resp.Cookies(), 1)
+	assert.Equal(t, "engineering", resp.Cookies()[0].Value, "removed with its search")
+
+	resp = postFollow(HandleFollow, url.Values{"feed": {"a,b"}})
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+}
+
+func TestIsFollowed(t *testing.T) {
+	feeds := []string{"staff noreblogs", "someone@twitter", " engineering"}
+	assert.True(t, isFollowed(feeds, "staff"))
+	assert.True(t, isFollowed(feeds, "engineering"))
+	assert.False(t, isFollowed(feeds, "someone"))
+}
@@ -15,6 +15,7 @@ require (
 	github.com/stretchr/testify v1.10.0
 	github.com/yuin/goldmark v1.7.8
 	golang.org/x/net v0.34.0
+	golang.org/x/sync v0.10.0
 )
 
 require (
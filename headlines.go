@@ -0,0 +1,130 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"html"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/heyLu/numblr/feed"
+	"github.com/heyLu/numblr/feed/anything"
+)
+
+// DefaultHeadlines is the number of posts shown on the headlines page,
+// `?limit=` shows up to MaxHeadlines.
+const DefaultHeadlines = 50
+
+// MaxHeadlines is the maximum number of posts on one headlines page.
+const MaxHeadlines = 200
+
+// HandleHeadlines renders only the author, first line, date and link of
+// the posts of the selected feeds, newest first, for skimming many feeds
+// quickly.
+func HandleHeadlines(w http.ResponseWriter, req *http.Request) {
+	settings := SettingsFromRequest(req)
+	feedNames := uniqueFeeds(settings.SelectedFeeds)
+
+	limit := DefaultHeadlines
+	if limitParam := req.URL.Query().Get("limit"); limitParam != "" {
+		l, err := strconv.Atoi(limitParam)
+		if err != nil || l <= 0 {
+			http.Error(w, fmt.Sprintf("Error: invalid limit %q", limitParam), http.StatusBadRequest)
+			return
+		}
+		limit = l
+		if limit > MaxHeadlines {
+			limit = MaxHeadlines
+		}
+	}
+
+	search := feed.FromRequest(req)
+	search.Limit = limit
+	search.MinAge = DelayFromRequest(req)
+
+	feeds, failed := openFeeds(req.Context(), feedNames, search)
+	defer func() {
+		for _, f := range feeds {
+			err := f.Close()
+			if err != nil {
+				log.Printf("Error: closing %s: %s", f.Name(), err)
+			}
+		}
+	}()
+
+	merged := mergeFeeds(feeds...)
+	posts := make([]*feed.Post, 0, limit)
+	for len(posts) < limit {
+		post, err := merged.Next()
+		if err != nil {
+			break
+		}
+
+		if !search.IsAfterCursor(post) || !search.Matches(post) {
+			continue
+		}
+		if filter, hasFilter := settings.Searches[post.Author]; hasFilter && filter.Skip && !filter.Matches(post) {
+			continue
+		}
+
+		posts = append(posts, post)
+	}
+
+	title := "headlines of " + strings.Join(feedNames, ",")
+	htmlPrelude(w, req, html.EscapeString(title), fmt.Sprintf("The newest posts of %d feeds", len(feedNames)), "/favicon.png")
+
+	fmt.Fprintf(w, `<header><h1>headlines</h1><h2>%d posts of %d feeds</h2></header>`, len(posts), len(feedNames))
+	if len(failed) > 0 {
+		fmt.Fprintf(w, `<p class="error">could not load %s</p>`, html.EscapeString(strings.Join(failed, ", ")))
+	}
+
+	fmt.Fprintln(w, `<ul class="digest headlines">`)
+	for _, post := range posts {
+		fmt.Fprintf(w, `<li><a class="author" href="/%s">%s</a>: <a href=%q>%s</a> <time datetime=%q>%s</time></li>
+`, html.EscapeString(post.Author), html.EscapeString(displayAuthor(post)), post.URL, html.EscapeString(postSummary(post)), post.Date.Format(time.RFC3339), post.Date.Format("2006-01-02 15:04"))
+	}
+	fmt.Fprintln(w, `</ul>`)
+
+	if len(posts) == limit {
+		fmt.Fprintf(w, `<p class="next-page"><a href=%q rel="next">more headlines</a></p>`, nextPageURL(req.URL, posts[len(posts)-1], false))
+	}
+}
+
+// openFeeds opens the feeds concurrently, returning the ones that could be
+// opened and the names of those that failed.
+func openFeeds(ctx context.Context, feedNames []string, search feed.Search) ([]feed.Feed, []string) {
+	var mu sync.Mutex
+	feeds := make([]feed.Feed, 0, len(feedNames))
+	var failed []string
+
+	var wg sync.WaitGroup
+	wg.Add(len(feedNames))
+	for _, feedName := range feedNames {
+		go func(feedName string) {
+			defer wg.Done()
+
+			// not opened in HandleTumblr either
+			if strings.HasPrefix(feedName, ":") {
+				return
+			}
+
+			f, err := anything.Open(ctx, feedName, cacheFn, search)
+
+			mu.Lock()
+			defer mu.Unlock()
+			if err != nil {
+				log.Printf("Error: opening %s: %s", feedName, err)
+				failed = append(failed, feedName)
+				return
+			}
+			feeds = append(feeds, f)
+		}(feedName)
+	}
+	wg.Wait()
+
+	return feeds, failed
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"context"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/heyLu/numblr/feed"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHandleHeadlines(t *testing.T) {
+	date := time.Date(2022, time.June, 1, 12, 0, 0, 0, time.UTC)
+
+	origCacheFn := cacheFn
+	cacheFn = func(ctx context.Context, name string, uncachedFn feed.Open, search feed.Search) (feed.Feed, error) {
+		offset := time.Duration(len(name)) * time.Minute
+		return &feed.Static{FeedName: name, Posts: []feed.Post{
+			{Source: "tumblr", ID: "2", Author: name, URL: "https://" + name + ".tumblr.com/post/2", Title: "second post by " + name, DescriptionHTML: `<p><img src="https://example.com/image.png" /></p>`, Date: date.Add(offset)},
+			{Source: "tumblr", ID: "1", Author: name, URL: "https://" + name + ".tumblr.com/post/1", DescriptionHTML: "<p>first post by " + name + "</p>", Date: date.Add(-time.Hour + offset)},
+		}}, nil
+	}
+	defer func() {
+		cacheFn = origCacheFn
+	}()
+
+	router := chi.NewRouter()
+	router.Get("/{feeds}/headlines", HandleHeadlines)
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("GET", "/staff,engineering/headlines", nil))
+	body := w.Body.String()
+
+	assert.Equal(t, 200, w.Code)
+	assert.NotContains(t, body, "image.png", "no media")
+	order := []string{"second post by engineering", "second post by staff", "first post by engineering", "first post by staff"}
+	for i := 1; i < len(order); i++ {
+		assert.Less(t, strings.Index(body, order[i-1]), strings.Index(body, order[i]), "sorted by date")
+	}
+	assert.NotContains(t, body, `rel="next"`, "no more posts")
+
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("GET", "/staff,engineering/headlines?limit=3", nil))
+	body = w.Body.String()
+	assert.NotContains(t, body, "first post by staff", "limit")
+	assert.Contains(t, body, `rel="next"`, "next page")
+
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("GET", "/staff/headlines?limit=nope", nil))
+	assert.Equal(t, 400, w.Code, "invalid limit")
+}
+
+func TestHandleHeadlinesEscapesFeeds(t *testing.T) {
+	origCacheFn := cacheFn
+	cacheFn = func(ctx context.Context, name string, uncachedFn feed.Open, search feed.Search) (feed.Feed, error) {
+		return &feed.Static{FeedName: name}, nil
+	}
+	defer func() {
+		cacheFn = origCacheFn
+	}()
+
+	router := chi.NewRouter()
+	router.Get("/{feeds}/headlines", HandleHeadlines)
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("GET", "/"+url.PathEscape(`"><script>alert(1)</script>`)+"/headlines", nil))
+	assert.NotContains(t, w.Body.String(), "<script>", "escaped")
+	assert.Contains(t, w.Body.String(), `<title>headlines of &#34;&gt;&lt;script&gt;`, "title")
+}
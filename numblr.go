@@ -2,13 +2,23 @@ package main
 
 import (
 	"bytes"
+	"compress/gzip"
 	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"database/sql"
 	_ "embed"
+	"encoding/base64"
+	"encoding/json"
 	"errors"
 	"flag"
 	"fmt"
+	"hash/fnv"
 	"io"
 	"log"
+	"mime"
 	"net/http"
 	"net/http/pprof"
 	"net/url"
@@ -20,8 +30,10 @@ import (
 	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"syscall"
 	"time"
+	"unicode"
 
 	"github.com/NYTimes/gziphandler"
 	"github.com/go-chi/chi/v5"
@@ -32,9 +44,11 @@ import (
 
 	"github.com/heyLu/numblr/feed"
 	"github.com/heyLu/numblr/feed/anything"
+	"github.com/heyLu/numblr/feed/ao3"
 	"github.com/heyLu/numblr/feed/bibliogram"
 	"github.com/heyLu/numblr/feed/database"
 	"github.com/heyLu/numblr/feed/nitter"
+	"github.com/heyLu/numblr/feed/scraper"
 	"github.com/heyLu/numblr/feed/tumblr"
 )
 
@@ -43,14 +57,11 @@ var imgRE = regexp.MustCompile(`<img `)
 var origWidthHeightRE = regexp.MustCompile(`data-orig-width="(\d+)" data-orig-height="(\d+)"`)
 var origHeightWidthRE = regexp.MustCompile(`data-orig-height="(\d+)" data-orig-width="(\d+)"`)
 var blankLinksRE = regexp.MustCompile(` target="_blank"`)
-var linkRE = regexp.MustCompile(`<a `)
 var tumblrReblogLinkRE = regexp.MustCompile(`<a ([^>]*)href="(https?://[^.]+\.tumblr.com([^" ]+)?)"([^>]*)>([-\w]+)</a>\s*:`) // <a>account</a>:
 var tumblrAccountLinkRE = regexp.MustCompile(`<a ([^>]*)href="[^"]+"([^>]*)>@([-\w]+)</a>`)                                   // @<account>
 var tumblrLinksRE = regexp.MustCompile(`https?://([^.]+).t?umblr.com([^" ]+)?`)
 var instagramLinksRE = regexp.MustCompile(`https?://(www\.)?instagram.com/([^/" ]+)[^" ]*`)
 var altTextRE = regexp.MustCompile(`alt="([^"]+)"|alt='([^']+)'`)
-var videoRE = regexp.MustCompile(`<video `)
-var autoplayRE = regexp.MustCompile(` autoplay="autoplay"`)
 
 const CookieName = "numbl"
 const UserAgent = "numblr"
@@ -65,20 +76,109 @@ var config struct {
 	AppDisplayMode string
 
 	CollectStats bool
+	// Metrics serves Prometheus metrics at `/metrics`.
+	Metrics bool
 
 	MaxConcurrentFeeds int
+
+	// Events enables streaming new posts to pages, see HandleEvents.
+	Events           bool
+	EventsInterval   time.Duration
+	EventsMaxStreams int
+
+	// WarmFeeds are feeds that are fetched on startup in addition to the
+	// default feeds, see warmFeedNames.
+	WarmFeeds string
+
+	// FeedHeaders is a JSON file with additional headers to send to hosts
+	// when fetching feeds, see loadFeedHeaders.
+	FeedHeaders string
+
+	// AvatarFallback is an image to show for feeds without an avatar,
+	// instead of one with the first letter of their name.
+	AvatarFallback string
+
+	// ScraperConfig is a JSON file with the css selectors used to read
+	// sites without feeds, see feed/scraper/example-config.json.  It
+	// extends (and overrides) the built-in ones.
+	ScraperConfig string
+
+	GzipLevel int
+
+	RateLimit      int
+	TrustedProxies string
+
+	AdminToken string
+
+	StripEmojiShortcodes bool
+
+	// BaseURL is the public url numblr is reachable at, used for absolute
+	// links.  If it is empty, it is reconstructed from the request.
+	BaseURL string
+
+	ShareTargets          string
+	ShareMastodonInstance string
+
+	IframeAllowlist string
+
+	MinImageSize int
+
+	// Delay hides posts that are newer than it by default, see
+	// DelayFromRequest.
+	Delay time.Duration
+
+	// Dedupe skips posts that were shown before when merging feeds, see
+	// feed.MergeUnique.
+	Dedupe bool
+
+	// FeedAliases are names that open another feed, see anything.Resolvers.
+	FeedAliases map[string]string
+
+	// DisableSources are the sources that feeds can't be opened from, see
+	// anything.Disabled.
+	DisableSources string
+
+	// SourceDefaults are searches that are always applied to feeds from
+	// a source, e.g. `noreblogs` for twitter.
+	SourceDefaults map[string]feed.Search
+
+	// AuthorAliases are names for people with accounts on multiple sources,
+	// mapping the name to the feeds of the accounts.
+	AuthorAliases map[string][]string
+
+	ProxyImages        bool
+	ProxyImagesHosts   string
+	ProxyImagesMaxSize int64
+	// ProxyImagesSecret signs the urls of proxied images, so that only
+	// images in posts can be fetched through numblr.
+	ProxyImagesSecret string
 }
 
 const CacheTime = 10 * time.Minute
 const AvatarSize = 32
 const AvatarCacheTime = 30 * 24 * time.Hour
 
+// AvatarFallbackCacheTime is how long feeds without an avatar are
+// remembered, after that it is looked for again.
+const AvatarFallbackCacheTime = 24 * time.Hour
+
 const GroupPostsNumber = 5
 const TagsCollapseCount = 20
 
+// ReblogsCollapseCount is the number of quote levels above which the
+// comments between the original post and the newest comment of reblogs are
+// collapsed.
+const ReblogsCollapseCount = 3
+
 //go:embed favicon.png
 var FaviconPNGBytes []byte
 
+// AvatarFallbackSVGBytes is the avatar shown for feeds that don't have one
+// and no letters in their name, unless -avatar-fallback is set.
+//
+//go:embed avatar.svg
+var AvatarFallbackSVGBytes []byte
+
 //go:embed README.md
 var ReadmeBytes []byte
 
@@ -89,9 +189,16 @@ var ChangelogBytes []byte
 var HelpBytes []byte
 
 var cacheFn feed.OpenCached = nil
+var cacheDB *sql.DB
 
 var avatarCache *lru.Cache
 
+// avatarFallback is the image served when a feed has no avatar, or when it
+// could not be fetched.
+var avatarFallback = AvatarFallbackSVGBytes
+var avatarFallbackType = "image/svg+xml"
+var imageProxyCache *lru.Cache
+
 type userAgentTransport struct {
 	UserAgent string
 	Transport http.RoundTripper
@@ -102,6 +209,98 @@ func (uat *userAgentTransport) RoundTrip(req *http.Request) (*http.Response, err
 	return uat.Transport.RoundTrip(req)
 }
 
+func isSource(source string) bool {
+	for _, known := range anything.Sources() {
+		if source == known {
+			return true
+		}
+	}
+	return false
+}
+
+// loadFeedHeaders returns the default headers that are sent to hosts when
+// fetching feeds, with the headers in the JSON file at `path` added.
+//
+// The file maps hosts to headers, e.g. `{"example.org": {"Referer":
+// "https://example.org/"}}`.
+func loadFeedHeaders(path string) (map[string]http.Header, error) {
+	headers := make(map[string]http.Header, len(feed.DefaultHeaders))
+	for host, hostHeaders := range feed.DefaultHeaders {
+		headers[host] = hostHeaders.Clone()
+	}
+
+	if path == "" {
+		return headers, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read: %w", err)
+	}
+
+	var configured map[string]map[string]string
+	err = json.Unmarshal(data, &configured)
+	if err != nil {
+		return nil, fmt.Errorf("parse %s: %w", path, err)
+	}
+
+	for host, hostHeaders := range configured {
+		if headers[host] == nil {
+			headers[host] = make(http.Header)
+		}
+		for key, val := range hostHeaders {
+			headers[host].Set(key, val)
+		}
+	}
+
+	return headers, nil
+}
+
+// warmFeedNames returns the feeds to fetch on startup, the default feeds
+// followed by those in `warmFeeds`.
+//
+// `warmFeeds` is either the path to a file with one feed per line (empty
+// lines and lines starting with `#` are ignored), or comma-separated feeds.
+func warmFeedNames(defaultFeed string, warmFeeds string) ([]string, error) {
+	names := strings.Split(defaultFeed, ",")
+
+	if warmFeeds != "" {
+		data, err := os.ReadFile(warmFeeds)
+		switch {
+		case err == nil:
+			for _, line := range strings.Split(string(data), "\n") {
+				line = strings.TrimSpace(line)
+				if line == "" || strings.HasPrefix(line, "#") {
+					continue
+				}
+				names = append(names, line)
+			}
+		case errors.Is(err, os.ErrNotExist) && !strings.ContainsAny(warmFeeds, "/\\"):
+			names = append(names, strings.Split(warmFeeds, ",")...)
+		default:
+			return nil, fmt.Errorf("read: %w", err)
+		}
+	}
+
+	return uniqueFeeds(names), nil
+}
+
+// uniqueFeeds returns the feeds without duplicates and empty names, in the
+// order they were first given.
+func uniqueFeeds(names []string) []string {
+	seen := make(map[string]bool, len(names))
+	feeds := make([]string, 0, len(names))
+	for _, name := range names {
+		name = strings.TrimSpace(name)
+		if name == "" || seen[name] {
+			continue
+		}
+		seen[name] = true
+		feeds = append(feeds, name)
+	}
+	return feeds
+}
+
 func main() {
 	flag.StringVar(&config.Addr, "addr", "localhost:5555", "Address to listen on")
 	flag.StringVar(&config.DatabasePath, "db", "", "Database path to use")
@@ -109,15 +308,156 @@ func main() {
 	flag.StringVar(&config.DefaultFeed, "default", "staff,engineering", "Default feeds to view")
 	flag.StringVar(&config.AppDisplayMode, "app-display", "browser", "Display mode to use when installed as an app")
 	flag.BoolVar(&config.CollectStats, "stats", false, "Whether to collect anonymized stats (num cached feeds & posts, recent errors & user agents")
+	flag.BoolVar(&config.Metrics, "metrics", false, "Whether to serve Prometheus metrics at /metrics (views, feed opens, errors and durations by source)")
 	flag.IntVar(&config.MaxConcurrentFeeds, "max-concurrent-feeds", 100, "Maximum feeds to refresh concurrently in the background")
+	flag.BoolVar(&config.Events, "events", false, "Show new posts on pages without reloading, using a stream of events")
+	flag.DurationVar(&config.EventsInterval, "events-interval", 2*time.Minute, "How often feeds are checked for new posts when streaming events")
+	flag.IntVar(&config.EventsMaxStreams, "events-max-streams", 100, "Maximum number of event streams open at once")
+	flag.StringVar(&config.WarmFeeds, "warm-feeds", "", "Comma-separated feeds or a file with one feed per line to fetch on startup, in addition to the default feeds")
+	flag.StringVar(&config.FeedHeaders, "feed-headers", "", "JSON file with headers to send to hosts when fetching feeds, e.g. {\"example.org\": {\"Referer\": \"https://example.org/\"}}")
+	flag.StringVar(&config.AvatarFallback, "avatar-fallback", "", "Image to show for feeds without an avatar (the first letter of their name by default)")
+	flag.StringVar(&config.ScraperConfig, "scraper-config", "", "JSON file mapping hosts to css selectors for reading sites without feeds")
+	flag.IntVar(&config.GzipLevel, "gzip-level", gzip.DefaultCompression, "Compression level for responses, from 1 (fastest) to 9 (smallest)")
+	flag.IntVar(&config.RateLimit, "rate-limit", 0, "Maximum requests per minute per client ip (disabled if 0)")
+	flag.StringVar(&config.TrustedProxies, "trusted-proxies", "", "Comma-separated ips or cidrs of proxies whose X-Forwarded-For header is used for rate limiting")
+	flag.StringVar(&config.AdminToken, "admin-token", "", "Token required to use the /admin endpoints (disabled if empty)")
+	flag.BoolVar(&config.StripEmojiShortcodes, "strip-emoji-shortcodes", false, "Remove unknown :shortcode: custom emoji from posts")
+	flag.StringVar(&config.BaseURL, "base-url", "", "Public base url for absolute links, e.g. https://numblr.example (reconstructed from requests if empty)")
+	flag.StringVar(&config.ShareTargets, "share-targets", "", "Comma-separated share links to show for each post (email, mastodon)")
+	flag.StringVar(&config.ShareMastodonInstance, "share-mastodon-instance", "mastodon.social", "Mastodon instance to use for share links")
+	flag.StringVar(&config.IframeAllowlist, "iframe-allowlist", "youtube.com,youtube-nocookie.com,player.vimeo.com,open.spotify.com,bandcamp.com,w.soundcloud.com", "Comma-separated hosts whose iframe embeds are kept in posts (others are replaced with links)")
+	flag.IntVar(&config.MinImageSize, "min-image-size", 2, "Remove images in posts that are declared to be less wide or high than this many pixels, e.g. tracking pixels (0 disables)")
+	flag.DurationVar(&config.Delay, "delay", 0, "Hide posts newer than this by default, e.g. 15m (readers can change it)")
+	flag.BoolVar(&config.Dedupe, "dedupe", false, "Skip posts that a feed lists more than once when showing multiple feeds")
+	flag.BoolVar(&config.ProxyImages, "proxy-images", false, "Load images and videos in posts through numblr, so that readers' IPs are not sent to the sources")
+	flag.StringVar(&config.ProxyImagesHosts, "proxy-images-hosts", "media.tumblr.com,pbs.twimg.com,video.twimg.com,nitter.net,tiktokcdn.com,tiktok.com,cdninstagram.com,ytimg.com", "Comma-separated hosts that images and videos are proxied from")
+	flag.Int64Var(&config.ProxyImagesMaxSize, "proxy-images-max-size", 50*1024*1024, "Maximum size in bytes of proxied images and videos")
+	flag.StringVar(&config.ProxyImagesSecret, "proxy-images-secret", "", "Secret to sign the urls of proxied images with (random by default, so that they change on restarts)")
+	flag.Func("source-default", "Default search for feeds from a source, e.g. `twitter=noreblogs` (can be repeated)", func(val string) error {
+		source, rawSearch, ok := strings.Cut(val, "=")
+		if !ok || source == "" {
+			return fmt.Errorf("expected source=search, got %q", val)
+		}
+		if config.SourceDefaults == nil {
+			config.SourceDefaults = make(map[string]feed.Search)
+		}
+		defaults := config.SourceDefaults[source]
+		config.SourceDefaults[source] = defaults.With(feed.ParseTerms(rawSearch))
+		return nil
+	})
+	flag.Func("author-alias", "Show posts from multiple feeds as by one author, e.g. `person=person,person@twitter` (can be repeated)", func(val string) error {
+		alias, feeds, ok := strings.Cut(val, "=")
+		if !ok || alias == "" || feeds == "" {
+			return fmt.Errorf("expected name=feed,feed, got %q", val)
+		}
+		if config.AuthorAliases == nil {
+			config.AuthorAliases = make(map[string][]string)
+		}
+		config.AuthorAliases[alias] = strings.Split(feeds, ",")
+		return nil
+	})
+	flag.Func("feed-alias", "Open another feed for a name, e.g. `coffee=jameshoffmann@youtube` (can be repeated)", func(val string) error {
+		alias, feedName, ok := strings.Cut(val, "=")
+		if !ok || alias == "" || feedName == "" {
+			return fmt.Errorf("expected name=feed, got %q", val)
+		}
+		if config.FeedAliases == nil {
+			config.FeedAliases = make(map[string]string)
+		}
+		config.FeedAliases[alias] = feedName
+		return nil
+	})
+	flag.StringVar(&config.DisableSources, "disable-sources", "", "Comma-separated sources that feeds can't be opened from, e.g. tiktok,instagram")
+	flag.StringVar(&anything.DefaultSource, "default-source", anything.DefaultSource, "Source of feed names without a suffix or dots")
+	flag.IntVar(&database.MaxDescriptionSize, "max-description-size", database.MaxDescriptionSize, "Maximum size in bytes of posts stored in the cache, larger ones are truncated (0 disables)")
+	flag.Func("retention", "Delete cached posts older than this, e.g. `180d` or `720h` (kept forever by default)", func(val string) error {
+		retention, err := parseDays(val)
+		if err != nil {
+			return err
+		}
+		database.Retention = retention
+		return nil
+	})
+	flag.IntVar(&database.RetentionMinPosts, "retention-min-posts", database.RetentionMinPosts, "Number of posts of each feed that are kept regardless of -retention")
+	flag.IntVar(&feed.MergePrefetch, "merge-prefetch", feed.MergePrefetch, "Posts to prefetch from each feed before merging them")
+	flag.Func("own-blogs", "Comma-separated names of your own Tumblr blogs, whose attribution is not shown at the top of reblogs", func(val string) error {
+		for _, name := range strings.Split(val, ",") {
+			name = strings.TrimSpace(name)
+			if name != "" {
+				tumblr.OwnBlogs[name] = true
+			}
+		}
+		return nil
+	})
+	flag.BoolVar(&tumblr.LinkPreviews, "tumblr-link-previews", tumblr.LinkPreviews, "Fetch previews of the pages that Tumblr link posts link to")
+	flag.BoolVar(&ao3.FullText, "ao3-full-text", ao3.FullText, "Allow showing the text of AO3 works inline, with ?full=1")
+	flag.IntVar(&ao3.ShortWorkWords, "ao3-short-work-words", ao3.ShortWorkWords, "Number of words up to which AO3 works are shown as a whole instead of only the first chapter")
+	flag.DurationVar(&ao3.CacheTTL, "ao3-cache-ttl", ao3.CacheTTL, "Duration that AO3 feeds are cached for, instead of the default 10 minutes")
+	flag.DurationVar(&anything.DefaultTimeout, "timeout", anything.DefaultTimeout, "How long fetching feeds may take, AO3 and YouTube feeds have longer timeouts")
+	flag.DurationVar(&database.CachePreferTimeout, "cache-prefer-timeout", database.CachePreferTimeout, "How long fetching cached feeds may take before the cached posts are shown instead")
 	flag.StringVar(&nitter.NitterURL, "nitter-url", "https://nitter.net", "Nitter instance to use")
 	flag.StringVar(&bibliogram.BibliogramInstancesURL, "bibliogram-instances-url", bibliogram.BibliogramInstancesURL, "The bibliogram url to use to fetch possible instances from")
 	flag.Parse()
 
-	http.DefaultClient.Timeout = 10 * time.Second
+	for _, source := range strings.Split(config.DisableSources, ",") {
+		source = strings.TrimSpace(source)
+		if source == "" {
+			continue
+		}
+		if !isSource(source) {
+			log.Fatalf("unknown source %q to disable, must be one of %s", source, strings.Join(anything.Sources(), ", "))
+		}
+		anything.Disabled[source] = true
+	}
+	if !isSource(anything.DefaultSource) {
+		log.Fatalf("unknown default source %q, must be one of %s", anything.DefaultSource, strings.Join(anything.Sources(), ", "))
+	}
+	if len(config.FeedAliases) > 0 {
+		anything.Resolvers = append(anything.Resolvers, func(name string) (string, bool) {
+			feedName, ok := config.FeedAliases[name]
+			return feedName, ok
+		})
+	}
+
+	feedHeaders, err := loadFeedHeaders(config.FeedHeaders)
+	if err != nil {
+		log.Fatalf("load feed headers: %s", err)
+	}
+
+	if config.ScraperConfig != "" {
+		f, err := os.Open(config.ScraperConfig)
+		if err != nil {
+			log.Fatalf("open scraper config: %s", err)
+		}
+		configs, err := scraper.LoadConfigs(f)
+		f.Close()
+		if err != nil {
+			log.Fatalf("load scraper config: %s", err)
+		}
+		for host, hostConfig := range configs {
+			scraper.Configs[host] = hostConfig
+		}
+	}
+
+	if config.AvatarFallback != "" {
+		avatarFallback, err = os.ReadFile(config.AvatarFallback)
+		if err != nil {
+			log.Fatalf("read avatar fallback: %s", err)
+		}
+		avatarFallbackType = mime.TypeByExtension(path.Ext(config.AvatarFallback))
+		if avatarFallbackType == "" {
+			avatarFallbackType = http.DetectContentType(avatarFallback)
+		}
+	}
+
+	// feeds have their own timeouts, see anything.Timeout
+	http.DefaultClient.Timeout = anything.MaxTimeout()
 	http.DefaultClient.Transport = &userAgentTransport{
 		UserAgent: UserAgent,
-		Transport: http.DefaultTransport,
+		Transport: &feed.HeadersTransport{
+			Headers:   feedHeaders,
+			Transport: http.DefaultTransport,
+		},
 	}
 
 	if config.CollectStats {
@@ -131,17 +471,63 @@ func main() {
 		log.Fatalf("setup database: %s", err)
 	}
 
+	cacheDB = db
 	cacheFn = func(ctx context.Context, name string, uncachedFn feed.Open, search feed.Search) (feed.Feed, error) {
-		return database.OpenCached(ctx, db, name, uncachedFn, search)
+		f, err := database.OpenCached(ctx, db, name, uncachedFn, search)
+		CollectCacheResult(anything.Source(name), database.CacheResult(f, err))
+		return f, err
 	}
 
 	if config.CollectStats {
 		EnableDatabaseStats(db, config.DatabasePath)
 	}
 
+	warmFeeds, err := warmFeedNames(config.DefaultFeed, config.WarmFeeds)
+	if err != nil {
+		log.Fatalf("load warm feeds: %s", err)
+	}
+
 	go func() {
 		maxConcurrentFeeds := make(chan bool, config.MaxConcurrentFeeds)
 
+		// refreshFeed fetches the feed and stores it in the cache, it
+		// must be called with a slot in maxConcurrentFeeds taken.
+		refreshFeed := func(feedName string) error {
+			defer func() {
+				<-maxConcurrentFeeds
+			}()
+
+			ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+			defer cancel()
+
+			AddBackgroundFetch()
+			defer DoneBackgroundFetch()
+
+			feed, err := anything.Open(ctx, feedName, cacheFn, feed.Search{ForceFresh: true})
+			if err != nil {
+				return fmt.Errorf("opening %s: %s", feedName, err)
+			}
+			defer func() {
+				err := feed.Close()
+				if err != nil {
+					err = fmt.Errorf("background refresh: closing %s: %s", feedName, err)
+					CollectError(err)
+					log.Printf("Error: %s", err)
+				}
+			}()
+
+			_, err = feed.Next()
+			for err == nil {
+				_, err = feed.Next()
+			}
+
+			if err != nil && !errors.Is(err, io.EOF) {
+				return fmt.Errorf("iterating %s: %s", feedName, err)
+			}
+
+			return nil
+		}
+
 		refreshFn := func() {
 			feeds, err := database.ListFeedsOlderThan(context.Background(), db, time.Now().Add(-CacheTime), config.MaxConcurrentFeeds*2)
 			if err != nil {
@@ -151,46 +537,15 @@ func main() {
 
 			successfulFeeds := 0
 			for _, feedName := range feeds {
-				err := func(feedName string) error {
-					maxConcurrentFeeds <- true
-
-					ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
-					defer cancel()
-
-					AddBackgroundFetch()
-					defer DoneBackgroundFetch()
-
-					feed, err := anything.Open(ctx, feedName, cacheFn, feed.Search{ForceFresh: true})
-					if err != nil {
-						<-maxConcurrentFeeds
-						return fmt.Errorf("background refresh: opening %s: %s", feedName, err)
-					}
-					defer func() {
-						err := feed.Close()
-						if err != nil {
-							err = fmt.Errorf("background refresh: closing %s: %s", feedName, err)
-							CollectError(err)
-							log.Printf("Error: %s", err)
-						}
-						<-maxConcurrentFeeds
-					}()
-
-					_, err = feed.Next()
-					for err == nil {
-						_, err = feed.Next()
-					}
-
-					if err != nil && !errors.Is(err, io.EOF) {
-						return fmt.Errorf("background refresh: iterating %s: %s", feedName, err)
-					}
-
-					successfulFeeds++
-					return nil
-				}(feedName)
+				maxConcurrentFeeds <- true
+				err := refreshFeed(feedName)
 				if err != nil {
+					err = fmt.Errorf("background refresh: %w", err)
 					CollectError(err)
 					log.Printf("Error: %s", err)
+					continue
 				}
+				successfulFeeds++
 			}
 
 			if len(feeds) > 0 {
@@ -198,6 +553,30 @@ func main() {
 			}
 		}
 
+		// warm the cache so that the first visitors don't have to wait,
+		// fetching concurrently as far as maxConcurrentFeeds allows
+		var warmWg sync.WaitGroup
+		var warmedFeeds int64
+		for _, feedName := range warmFeeds {
+			maxConcurrentFeeds <- true
+			warmWg.Add(1)
+			go func(feedName string) {
+				defer warmWg.Done()
+				err := refreshFeed(feedName)
+				if err != nil {
+					err = fmt.Errorf("warming cache: %w", err)
+					CollectError(err)
+					log.Printf("Error: %s", err)
+					return
+				}
+				atomic.AddInt64(&warmedFeeds, 1)
+			}(feedName)
+		}
+		warmWg.Wait()
+		if len(warmFeeds) > 0 {
+			log.Printf("Warmed %d/%d feeds", warmedFeeds, len(warmFeeds))
+		}
+
 		for {
 			go refreshFn()
 
@@ -210,11 +589,51 @@ func main() {
 		log.Fatal("setup avatar cache:", err)
 	}
 
+	if config.ProxyImages {
+		imageProxyCache, err = lru.New(1000)
+		if err != nil {
+			log.Fatal("setup image proxy cache:", err)
+		}
+
+		imageProxySecret = []byte(config.ProxyImagesSecret)
+		if config.ProxyImagesSecret == "" {
+			imageProxySecret = make([]byte, 32)
+			_, err = rand.Read(imageProxySecret)
+			if err != nil {
+				log.Fatal("setup image proxy secret:", err)
+			}
+		}
+	}
+
+	if config.BaseURL != "" {
+		u, err := url.Parse(config.BaseURL)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			log.Fatalf("invalid -base-url %q, expected e.g. https://numblr.example", config.BaseURL)
+		}
+		config.BaseURL = strings.TrimSuffix(config.BaseURL, "/")
+	}
+
+	gzipHandler, err := gziphandler.NewGzipLevelHandler(config.GzipLevel)
+	if err != nil {
+		log.Fatal("setup gzip:", err)
+	}
+
 	router := chi.NewRouter()
-	router.Use(gziphandler.GzipHandler)
+	router.Use(gzipHandler)
+	if config.RateLimit > 0 {
+		rateLimiter, err := NewRateLimiter(config.RateLimit, config.TrustedProxies)
+		if err != nil {
+			log.Fatal("setup rate limit:", err)
+		}
+		router.Use(rateLimiter.Middleware)
+	}
 	router.Use(strictTransportSecurity)
 
 	router.Handle("/stats", http.HandlerFunc(StatsHandler))
+	router.Handle("/stats/feeds", http.HandlerFunc(StatsFeedsHandler))
+	if config.Metrics {
+		router.Handle("/metrics", promhttp.Handler())
+	}
 
 	router.HandleFunc("/favicon.ico", func(w http.ResponseWriter, req *http.Request) {
 		http.Redirect(w, req, "/favicon.png", http.StatusPermanentRedirect)
@@ -299,8 +718,6 @@ self.addEventListener('install', function(e) {
 		}
 	})
 
-	// TODO: implement a follow button (first only for generic feed, either add to cookie or url, depending on context)
-
 	router.Post("/settings", func(w http.ResponseWriter, req *http.Request) {
 		list := req.FormValue("list")
 		feeds := req.FormValue("feeds")
@@ -324,6 +741,20 @@ self.addEventListener('install', function(e) {
 		if list != "" {
 			redirect = "/list/" + list
 			cookieName = CookieName + "-list-" + list
+
+			// the default search of the list is saved separately
+			listSearch := &http.Cookie{
+				Name:     CookieName + "-list-" + list + "-search",
+				Value:    url.QueryEscape(strings.TrimSpace(req.FormValue("search"))),
+				Path:     "/",
+				MaxAge:   365 * 24 * 60 * 60, // one year
+				SameSite: http.SameSiteLaxMode,
+				HttpOnly: true,
+			}
+			if listSearch.Value == "" {
+				listSearch.MaxAge = -1
+			}
+			http.SetCookie(w, listSearch)
 		}
 
 		if cookieValue == "" {
@@ -334,6 +765,7 @@ self.addEventListener('install', function(e) {
 		http.SetCookie(w, &http.Cookie{
 			Name:     cookieName,
 			Value:    cookieValue,
+			Path:     "/",
 			MaxAge:   365 * 24 * 60 * 60, // one year
 			SameSite: http.SameSiteLaxMode,
 			HttpOnly: true,
@@ -341,54 +773,231 @@ self.addEventListener('install', function(e) {
 		http.Redirect(w, req, redirect, http.StatusSeeOther)
 	})
 
-	router.Post("/settings/clear", func(w http.ResponseWriter, req *http.Request) {
-		cookie, err := req.Cookie(CookieName)
+	router.Post("/follow", HandleFollow)
+	router.Post("/unfollow", HandleUnfollow)
+
+	router.Post("/snooze", func(w http.ResponseWriter, req *http.Request) {
+		feedName := strings.TrimSpace(req.FormValue("feed"))
+		if feedName == "" {
+			http.Error(w, "Error: no feed to snooze", http.StatusBadRequest)
+			return
+		}
+
+		duration, err := time.ParseDuration(req.FormValue("duration"))
 		if err != nil {
-			http.Redirect(w, req, "/", http.StatusTemporaryRedirect)
+			http.Error(w, fmt.Sprintf("Error: invalid duration: %s", err), http.StatusBadRequest)
+			return
+		}
+
+		snoozed := SnoozedFromRequest(req)
+		if duration <= 0 {
+			delete(snoozed, feedName)
+		} else {
+			snoozed[feedName] = time.Now().Add(duration)
+		}
+
+		redirect := req.FormValue("redirect")
+		if !strings.HasPrefix(redirect, "/") || strings.HasPrefix(redirect, "//") {
+			redirect = "/"
+		}
+
+		values := url.Values{}
+		maxAge := -1
+		for name, until := range snoozed {
+			values.Set(name, strconv.FormatInt(until.Unix(), 10))
+			if secs := int(time.Until(until).Seconds()) + 1; secs > maxAge {
+				maxAge = secs
+			}
+		}
+
+		http.SetCookie(w, &http.Cookie{
+			Name:     CookieName + "-snooze",
+			Value:    values.Encode(),
+			Path:     "/",
+			MaxAge:   maxAge,
+			SameSite: http.SameSiteLaxMode,
+			HttpOnly: true,
+		})
+		http.Redirect(w, req, redirect, http.StatusSeeOther)
+	})
+
+	router.Post("/read", func(w http.ResponseWriter, req *http.Request) {
+		feedName := strings.TrimSpace(req.FormValue("feed"))
+		if feedName == "" {
+			http.Error(w, "Error: no feed to mark as read", http.StatusBadRequest)
 			return
 		}
 
-		cookie.Value = ""
-		cookie.MaxAge = -1
+		readUpTo := ReadUpToFromRequest(req)
+		if id := req.FormValue("id"); id == "" {
+			delete(readUpTo, feedName)
+		} else {
+			date, err := time.Parse(time.RFC3339Nano, req.FormValue("date"))
+			if err != nil {
+				http.Error(w, fmt.Sprintf("Error: invalid date: %s", err), http.StatusBadRequest)
+				return
+			}
+			readUpTo[feedName] = &feed.Post{Source: req.FormValue("source"), ID: id, Date: date}
+		}
+
+		redirect := req.FormValue("redirect")
+		if !strings.HasPrefix(redirect, "/") || strings.HasPrefix(redirect, "//") {
+			redirect = "/"
+		}
+
+		values := url.Values{}
+		for name, post := range readUpTo {
+			values.Set(name, strconv.FormatInt(post.Date.UnixNano(), 10)+":"+post.Source+":"+post.ID)
+		}
+
+		http.SetCookie(w, &http.Cookie{
+			Name:     CookieName + "-read",
+			Value:    values.Encode(),
+			Path:     "/",
+			MaxAge:   365 * 24 * 60 * 60, // one year
+			SameSite: http.SameSiteLaxMode,
+			HttpOnly: true,
+		})
+		http.Redirect(w, req, redirect, http.StatusSeeOther)
+	})
+
+	router.Post("/settings/display", func(w http.ResponseWriter, req *http.Request) {
+		display := Display{
+			Width:    req.FormValue("width"),
+			Font:     req.FormValue("font"),
+			Collapse: req.FormValue("collapse"),
+			Delay:    strings.TrimSpace(req.FormValue("delay")),
+			Details:  req.FormValue("details"),
+		}
+		if _, ok := readingWidths[display.Width]; !ok {
+			display.Width = DefaultDisplay.Width
+		}
+		if _, ok := readingFonts[display.Font]; !ok {
+			display.Font = DefaultDisplay.Font
+		}
+		if _, ok := collapseHeights[display.Collapse]; !ok {
+			display.Collapse = DefaultDisplay.Collapse
+		}
+		if delay, err := time.ParseDuration(display.Delay); err != nil || delay < 0 {
+			display.Delay = ""
+		}
+		if display.Details != "show" && display.Details != "hide" {
+			display.Details = DefaultDisplay.Details
+		}
+
+		redirect := req.FormValue("redirect")
+		if !strings.HasPrefix(redirect, "/") || strings.HasPrefix(redirect, "//") {
+			redirect = "/"
+		}
+
+		http.SetCookie(w, &http.Cookie{
+			Name:     CookieName + "-display",
+			Value:    url.Values{"width": {display.Width}, "font": {display.Font}, "collapse": {display.Collapse}, "delay": {display.Delay}, "details": {display.Details}}.Encode(),
+			Path:     "/",
+			MaxAge:   365 * 24 * 60 * 60, // one year
+			SameSite: http.SameSiteLaxMode,
+			HttpOnly: true,
+		})
+		http.Redirect(w, req, redirect, http.StatusSeeOther)
+	})
+
+	router.Post("/settings/safe", func(w http.ResponseWriter, req *http.Request) {
+		redirect := req.FormValue("redirect")
+		if !strings.HasPrefix(redirect, "/") || strings.HasPrefix(redirect, "//") {
+			redirect = "/"
+		}
+
+		cookie := &http.Cookie{
+			Name:     CookieName + "-safe",
+			Value:    "on",
+			Path:     "/",
+			MaxAge:   365 * 24 * 60 * 60, // one year
+			SameSite: http.SameSiteLaxMode,
+			HttpOnly: true,
+		}
+		if req.FormValue("safe") != "on" {
+			cookie.Value = ""
+			cookie.MaxAge = -1
+		}
 		http.SetCookie(w, cookie)
-		http.Redirect(w, req, "/", http.StatusSeeOther)
+		http.Redirect(w, req, redirect, http.StatusSeeOther)
+	})
+
+	router.Post("/settings/clear", HandleClearSettings)
+	router.Post("/settings/import", HandleImport)
+	router.Get("/settings/export.opml", HandleExportOPML)
+
+	router.Post("/admin/reprocess", func(w http.ResponseWriter, req *http.Request) {
+		if !isAdmin(req) {
+			http.Error(w, http.StatusText(http.StatusForbidden), http.StatusForbidden)
+			return
+		}
+
+		// reblogs are flattened when rendering, so this only needs to redo the processing before caching
+		updated, err := database.Reprocess(req.Context(), db, "tumblr", 100, tumblr.Process)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Error: reprocessing posts (%d updated): %s", updated, err), http.StatusInternalServerError)
+			return
+		}
+
+		fmt.Fprintf(w, "reprocessed posts, %d updated\n", updated)
 	})
 
-	router.HandleFunc("/proxy", func(w http.ResponseWriter, req *http.Request) {
-		proxyURL := req.URL.Query().Get("url")
-		if !strings.Contains(proxyURL, ".tiktok.com/") && !strings.Contains(proxyURL, "media_type=video_") {
+	router.Post("/admin/priority", func(w http.ResponseWriter, req *http.Request) {
+		if !isAdmin(req) {
 			http.Error(w, http.StatusText(http.StatusForbidden), http.StatusForbidden)
 			return
 		}
 
-		req, err := http.NewRequestWithContext(req.Context(), "GET", proxyURL, nil)
+		feedName := req.FormValue("feed")
+		priority, err := strconv.Atoi(req.FormValue("priority"))
 		if err != nil {
-			log.Printf("Error: new request: %s", err)
+			http.Error(w, fmt.Sprintf("Error: invalid priority %q", req.FormValue("priority")), http.StatusBadRequest)
 			return
 		}
 
-		resp, err := http.DefaultClient.Do(req)
+		err = database.SetFeedPriority(req.Context(), db, feedName, priority)
 		if err != nil {
-			log.Printf("Error: proxy %q: %s", req.URL, err)
+			http.Error(w, fmt.Sprintf("Error: setting priority: %s", err), http.StatusBadRequest)
 			return
 		}
-		defer resp.Body.Close()
 
-		_, _ = io.Copy(w, resp.Body)
+		fmt.Fprintf(w, "set priority of %s to %d\n", feedName, priority)
 	})
 
+	if config.ProxyImages {
+		router.Get("/img-proxy", HandleImageProxy)
+	}
+
 	router.HandleFunc("/", HandleTumblr)
 	router.HandleFunc("/{feeds}", HandleTumblr)
 	router.HandleFunc("/{feeds}/", HandleTumblr)
 	router.HandleFunc("/{feeds}/tagged/{tag}", HandleTumblr)
+	router.Get("/{feeds}/export.ndjson", HandleExport)
+	router.Get("/{feeds}/digest", HandleDigest)
+	router.Get("/headlines", HandleHeadlines)
+	router.Get("/{feeds}/headlines", HandleHeadlines)
+	router.Get("/api/feed", HandleAPIFeed)
+	router.Get("/search", HandleSearch)
+	router.Get("/feed/{name}/status", HandleFeedStatus)
 
 	router.HandleFunc("/list/{list}", HandleTumblr)
 
+	// the page of random posts is still at `/random/`
+	router.Get("/random", HandleRandom)
 	router.HandleFunc("/{tumblr}/post/{postId}", HandlePost)
 	router.HandleFunc("/{tumblr}/post/{postId}/{slug}", HandlePost)
 
 	router.HandleFunc("/avatar/{tumblr}", HandleAvatar)
 
+	if config.Events {
+		if config.EventsInterval <= 0 {
+			log.Fatalf("invalid -events-interval %s, must be positive", config.EventsInterval)
+		}
+		eventStreams = make(chan bool, config.EventsMaxStreams)
+		router.Get("/events", HandleEvents)
+	}
+
 	if config.DebugAddr != "" {
 		go func() {
 			debug := http.NewServeMux()
@@ -413,6 +1022,18 @@ self.addEventListener('install', function(e) {
 	log.Fatal(http.ListenAndServe(config.Addr, router))
 }
 
+// parseDays parses durations like time.ParseDuration, and days like `180d`.
+func parseDays(val string) (time.Duration, error) {
+	if days, ok := strings.CutSuffix(val, "d"); ok {
+		n, err := strconv.Atoi(days)
+		if err != nil || n < 0 {
+			return 0, fmt.Errorf("invalid number of days %q", val)
+		}
+		return time.Duration(n) * 24 * time.Hour, nil
+	}
+	return time.ParseDuration(val)
+}
+
 func htmlPrelude(w http.ResponseWriter, req *http.Request, title, description, favicon string) {
 	w.Header().Set("Content-Type", `text/html; charset="utf-8"`)
 
@@ -422,6 +1043,25 @@ func htmlPrelude(w http.ResponseWriter, req *http.Request, title, description, f
 		modeCSS = nightModeCSS
 	}
 
+	display := DisplayFromRequest(req)
+	displayCSS := fmt.Sprintf(`:root { --reading-width: %s; --reading-font: %s; --collapse-height: %s; }`, readingWidths[display.Width], readingFonts[display.Font], collapseHeights[display.Collapse])
+	if display.Collapse != "off" {
+		// tall images are focusable, so clicking them expands them again
+		displayCSS += `#content img.tall { max-height: var(--collapse-height); width: 100%; object-fit: cover; object-position: top; cursor: zoom-in; }#content img.tall:focus { max-height: none; cursor: zoom-out; }`
+	}
+
+	// images of posts with content notes are always blurred, in safe mode
+	// images of all posts are
+	safeMode := SafeModeFromRequest(req)
+	bodyClass := ""
+	safeToggle := "on"
+	safeLabel := "safe mode"
+	if safeMode {
+		bodyClass = ` class="safe"`
+		safeToggle = "off"
+		safeLabel = "unsafe mode"
+	}
+
 	fmt.Fprintf(w, `<!doctype html>
 <html lang="en">
 <head>
@@ -430,15 +1070,18 @@ func htmlPrelude(w http.ResponseWriter, req *http.Request, title, description, f
 	<meta name="color-scheme" content="dark light" />
 	<meta name="description" content="%s" />
 	<title>%s</title>
+	<style>%s</style>
 	<style>body { --text-color: #000; margin: 0; } #menu { --blue: 0, 0, 255; background: linear-gradient(to right, rgba(var(--blue), 0.1), pink); font-family: monospace; font-size: large; font-weight: bold; } #menu ul { display: flex; list-style-type: none; padding-left: 0; padding: 0.3em; margin: 0 auto; max-width: 69em; } #menu ul li { padding-left: 0.75em; } #menu ul li:first-of-type { padding-left: 0; flex-grow: 4; }</style>
-	<style>header { margin-bottom: 1em; } header h1 { margin-bottom: 0; } header h2 { margin: auto 0; font-size: initial; font-weight: normal; }.jumper { font-size: 2em; float: right; text-decoration: none; }.jump-to-top { position: sticky; bottom: 0.25em; }blockquote, figure { margin: 0; }blockquote:not(:last-child) { border-bottom: 1px solid #ddd; } blockquote.question{padding-left: 2em;}blockquote.question ::before, blockquote.question ::after { content: "“"; font-family: serif; font-size: x-large; }#content { scroll-behavior: smooth; font-family: sans-serif; overflow-wrap: break-word; margin: 8px; }article,details:not([open]){ border-bottom: 1px solid black; padding-bottom: 1em; margin-bottom: 1em; }article h1 a, article h4 a { text-decoration: none; border-bottom: 1px dotted black; }section.hidden { opacity: 0.5; }.tags { list-style: none; padding: 0; color: #666; }.tags li, .tags display, tags display[open] { display: inline }.tags a, .tags a:visited{color: #333; text-decoration: none;}img:not(.avatar), video, iframe { max-width: 100%%; height: auto; object-fit: contain } video::cue { font-size: 1rem; } @media (min-width: 60em) { #content { margin: 0 auto; max-width: 60em; } img:not(.avatar), video { max-height: 50vh; width: auto; object-fit: contain; } img:hover:not(.avatar)}.avatar,img[class*="avatar"],img[src*="static.tumblr.com"],img[src*="avatar"]{width: 1em;height: 1em;vertical-align: middle;display:inline-block;}a.author,a.author:visited,a.tumblr-link,a.tumblr-link:visited{color: #000; font-weight: bold;}a.tumblr-link{padding: 0.5em; text-decoration: none; font-size: larger; vertical-align: middle;}.next-page { display: flex; justify-content: center; padding: 1em; }.ao3 dl dt, .ao3 dl dd { display: inline; margin-left: 0}.ao3 blockquote { border: none; }textarea{ width: 100%%; }.tiktok .tag { color: var(--text-color); }%s</style>
+	<style>header { margin-bottom: 1em; } header h1 { margin-bottom: 0; } header h2 { margin: auto 0; font-size: initial; font-weight: normal; }.jumper { font-size: 2em; float: right; text-decoration: none; }.jump-to-top { position: sticky; bottom: 0.25em; }blockquote, figure { margin: 0; }blockquote:not(:last-child) { border-bottom: 1px solid #ddd; } blockquote.question{padding-left: 2em;}blockquote.question ::before, blockquote.question ::after { content: "“"; font-family: serif; font-size: x-large; }#content { scroll-behavior: smooth; font-family: var(--reading-font); overflow-wrap: break-word; margin: 8px; }article,details:not([open]){ border-bottom: 1px solid black; padding-bottom: 1em; margin-bottom: 1em; }article h1 a, article h4 a { text-decoration: none; border-bottom: 1px dotted black; }section.hidden { opacity: 0.5; }.tags { list-style: none; padding: 0; color: #666; }.tags li, .tags display, tags display[open] { display: inline }.tags a, .tags a:visited{color: #333; text-decoration: none;}img:not(.avatar):not(.emoji), video, iframe { max-width: 100%%; height: auto; object-fit: contain } video::cue { font-size: 1rem; } @media (min-width: 60em) { #content { margin: 0 auto; max-width: var(--reading-width); } img:not(.avatar):not(.emoji), video { max-height: 50vh; width: auto; object-fit: contain; } img:hover:not(.avatar)}.avatar,img.emoji,img[class*="avatar"],img[src*="static.tumblr.com"],img[src*="avatar"]{width: 1em;height: 1em;vertical-align: middle;display:inline-block;}a.author,a.author:visited,a.tumblr-link,a.tumblr-link:visited{color: #000; font-weight: bold;}a.tumblr-link{padding: 0.5em; text-decoration: none; font-size: larger; vertical-align: middle;}.next-page { display: flex; justify-content: center; padding: 1em; }.ao3 dl dt, .ao3 dl dd { display: inline; margin-left: 0}.ao3 blockquote { border: none; }textarea{ width: 100%%; }.tiktok .tag { color: var(--text-color); }.gallery { display: grid; grid-template-columns: repeat(2, 1fr); gap: 2px; }.gallery img:not(.avatar):not(.emoji) { width: 100%%; height: 100%%; object-fit: cover; }form.snooze, form.read, form.follow { display: inline; }a.source { font-size: smaller; color: #666; }a.source.current { font-weight: bold; }.digest { padding-left: 0; list-style: none; }.digest li { margin-bottom: 0.5em; }.roundup-media img.thumbnail { width: 4em; height: 4em; object-fit: cover; vertical-align: middle; }.digest img.thumbnail { width: 3em; height: 3em; object-fit: cover; vertical-align: middle; }article.content-note section img:not(.avatar):not(.emoji), article.content-note section video, body.safe article section img:not(.avatar):not(.emoji), body.safe article section video { filter: blur(1.5em); transition: filter 0.2s; } article.content-note section img:hover, article.content-note section img:focus, article.content-note section video:hover, body.safe article section img:hover, body.safe article section img:focus, body.safe article section video:hover { filter: none; } #menu form { display: inline; } #menu button { font: inherit; background: none; border: none; padding: 0; cursor: pointer; } .skip-link { position: absolute; left: -100vw; } .skip-link:focus { left: 0.5em; top: 0.5em; padding: 0.5em; background: white; z-index: 1; }%s</style>
 	<link rel="preconnect" href="https://64.media.tumblr.com/" />
 	<link rel="manifest" href="/manifest.webmanifest" />
 	<meta name="theme-color" content="#222222" />
 	<link rel="icon" href="%s" />
 </head>
 
-<body>
+<body%s>
+
+<a class="skip-link" href="#content">skip to content</a>
 
 <nav id="menu">
 	<ul>
@@ -448,64 +1091,410 @@ func htmlPrelude(w http.ResponseWriter, req *http.Request, title, description, f
 		<li><a href="/changes">/changes</a></li>
 		<li lang="sv"><a href="/hjälp">/hjälp</a></li>
 		<li><a href="https://github.com/heyLu/numblr">/source</a></li>
+		<li><form method="POST" action="/settings/safe"><input type="hidden" name="safe" value="%s" /><input type="hidden" name="redirect" value="%s" /><button type="submit" title="Blur images until hovered or clicked">%s</button></form></li>
 	</ul>
 </nav>
 
 <div id="content">
-`, description, title, modeCSS, favicon)
+`, description, title, displayCSS, modeCSS, favicon, bodyClass, safeToggle, html.EscapeString(req.URL.RequestURI()), safeLabel)
 }
 
-func HandleAvatar(w http.ResponseWriter, req *http.Request) {
-	tumblr := chi.URLParam(req, "tumblr")
+// ImageProxyCacheSize is the maximum size of images that are kept in memory
+// by the image proxy.
+const ImageProxyCacheSize = 256 * 1024
 
-	avatar, isCached := avatarCache.Get(tumblr)
-	if isCached {
-		w.Header().Set("Cache-Control", fmt.Sprintf("public, max-age=%d, immutable", int(AvatarCacheTime.Seconds())))
-		_, _ = w.Write(avatar.([]byte))
+type proxiedImage struct {
+	contentType string
+	data        []byte
+}
+
+// imageProxyClient does not time out like http.DefaultClient, so that
+// longer videos can be streamed.
+var imageProxyClient = &http.Client{
+	Transport: &userAgentTransport{UserAgent: UserAgent, Transport: http.DefaultTransport},
+	CheckRedirect: func(req *http.Request, via []*http.Request) error {
+		if len(via) >= 5 {
+			return fmt.Errorf("too many redirects")
+		}
+		if !feed.MatchesHost(req.URL.Hostname(), strings.Split(config.ProxyImagesHosts, ",")) {
+			return fmt.Errorf("redirect to %q not allowed", req.URL.Host)
+		}
+		return nil
+	},
+}
+
+// absoluteURL returns the absolute url of `path` on numblr, either relative to
+// the `-base-url` or to the host of the request.
+func absoluteURL(req *http.Request, path string) string {
+	if config.BaseURL != "" {
+		return config.BaseURL + path
+	}
+
+	scheme := "http"
+	if req.TLS != nil || req.Header.Get("X-Forwarded-Proto") == "https" {
+		scheme = "https"
+	}
+	return scheme + "://" + req.Host + path
+}
+
+// proxyImageURL returns the url of mediaURL through the image proxy if
+// it is from one of the proxied hosts.
+func proxyImageURL(mediaURL string) string {
+	u, err := url.Parse(mediaURL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+		return mediaURL
+	}
+
+	if !feed.MatchesHost(u.Hostname(), strings.Split(config.ProxyImagesHosts, ",")) {
+		return mediaURL
+	}
+
+	expires, signature := signImageURL(mediaURL, time.Now())
+	return "/img-proxy?url=" + url.QueryEscape(mediaURL) + "&expires=" + strconv.FormatInt(expires, 10) + "&sig=" + signature
+}
+
+// ImageProxyURLTime is how long proxied urls are valid for at least.  They
+// are valid for up to twice as long, as they only change once in that time
+// so that browsers can cache the images.
+const ImageProxyURLTime = 7 * 24 * time.Hour
+
+// ImageProxyCacheTime is how long browsers cache proxied images.
+const ImageProxyCacheTime = 30 * 24 * time.Hour
+
+// imageProxySecret signs the urls of proxied images, see
+// `-proxy-images-secret`.
+var imageProxySecret []byte
+
+// signImageURL returns when the proxied url of imageURL expires and its
+// signature.
+func signImageURL(imageURL string, now time.Time) (int64, string) {
+	expires := now.Truncate(ImageProxyURLTime).Add(2 * ImageProxyURLTime).Unix()
+	return expires, imageURLSignature(imageURL, expires)
+}
+
+func imageURLSignature(imageURL string, expires int64) string {
+	mac := hmac.New(sha256.New, imageProxySecret)
+	fmt.Fprintf(mac, "%s\n%d", imageURL, expires)
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// checkImageURL returns an error if the proxied url of imageURL is not
+// signed or has expired.
+func checkImageURL(imageURL string, expiresParam string, signature string, now time.Time) error {
+	if signature == "" {
+		return fmt.Errorf("not signed")
+	}
+
+	expires, err := strconv.ParseInt(expiresParam, 10, 64)
+	if err != nil {
+		return fmt.Errorf("invalid expiry %q", expiresParam)
+	}
+	if !hmac.Equal([]byte(signature), []byte(imageURLSignature(imageURL, expires))) {
+		return fmt.Errorf("invalid signature")
+	}
+	if now.Unix() > expires {
+		return fmt.Errorf("expired")
+	}
+	return nil
+}
+
+// HandleImageProxy fetches images and videos from the proxied hosts, so that
+// the readers' IPs and referrers are not sent to them.  This also avoids
+// hosts that refuse to show images on other sites.
+//
+// Only urls signed by proxyImageURL are fetched, so that it can't be used
+// to fetch anything else.
+//
+// Small images are cached in memory, everything else is streamed (including
+// range requests so that videos can be seeked).
+func HandleImageProxy(w http.ResponseWriter, req *http.Request) {
+	imageURL := req.URL.Query().Get("url")
+
+	u, err := url.Parse(imageURL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || !feed.MatchesHost(u.Hostname(), strings.Split(config.ProxyImagesHosts, ",")) {
+		http.Error(w, http.StatusText(http.StatusForbidden), http.StatusForbidden)
 		return
 	}
 
-	var avatarURL string
-	switch {
-	case strings.Contains(tumblr, "@"):
-		http.Error(w, fmt.Sprintf("Error: fetching avatar for %q not supported", tumblr), http.StatusInternalServerError)
+	err = checkImageURL(imageURL, req.URL.Query().Get("expires"), req.URL.Query().Get("sig"), time.Now())
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Error: %s", err), http.StatusForbidden)
+		return
+	}
+
+	w.Header().Set("Cache-Control", fmt.Sprintf("public, max-age=%d, immutable", int(ImageProxyCacheTime.Seconds())))
+	// the images come from other sites, so don't let browsers run anything
+	// in them
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.Header().Set("Content-Security-Policy", "sandbox")
+
+	cached, isCached := imageProxyCache.Get(imageURL)
+	if isCached {
+		image := cached.(proxiedImage)
+		w.Header().Set("Content-Type", image.contentType)
+		http.ServeContent(w, req, "", time.Time{}, bytes.NewReader(image.data))
 		return
-	case strings.Contains(tumblr, "."):
-		avatarURL = "http://" + tumblr + "/favicon.ico"
-	default:
-		avatarURL = fmt.Sprintf("https://api.tumblr.com/v2/blog/%s.tumblr.com/avatar/%d", url.PathEscape(tumblr), AvatarSize)
 	}
 
-	req, err := http.NewRequestWithContext(req.Context(), "GET", avatarURL, nil)
+	proxyReq, err := http.NewRequestWithContext(req.Context(), "GET", imageURL, nil)
 	if err != nil {
-		http.Error(w, fmt.Sprintf("Error: fetching avatar: could not create request: %s", err), http.StatusInternalServerError)
+		http.Error(w, fmt.Sprintf("Error: could not create request: %s", err), http.StatusInternalServerError)
 		return
 	}
-	resp, err := http.DefaultClient.Do(req)
+	if req.Header.Get("Range") != "" {
+		proxyReq.Header.Set("Range", req.Header.Get("Range"))
+	}
+
+	resp, err := imageProxyClient.Do(proxyReq)
 	if err != nil {
-		http.Error(w, fmt.Sprintf("Error: fetching avatar: %s", err), http.StatusInternalServerError)
+		http.Error(w, fmt.Sprintf("Error: fetching image: %s", err), http.StatusBadGateway)
 		return
 	}
 	defer resp.Body.Close()
 
 	if resp.StatusCode >= 400 {
-		http.Error(w, fmt.Sprintf("Error: fetching avatar: %s", feed.StatusError{Code: resp.StatusCode}), http.StatusInternalServerError)
+		http.Error(w, fmt.Sprintf("Error: fetching image: %s", feed.StatusError{Code: resp.StatusCode}), resp.StatusCode)
 		return
 	}
 
-	buf := new(bytes.Buffer)
-	wr := io.MultiWriter(w, buf)
+	if resp.ContentLength > config.ProxyImagesMaxSize {
+		http.Error(w, fmt.Sprintf("Error: image too large (%d bytes)", resp.ContentLength), http.StatusRequestEntityTooLarge)
+		return
+	}
 
-	//avatar = resp.Header.Get("Location")
-	w.Header().Set("Cache-Control", fmt.Sprintf("max-age=%d", int(AvatarCacheTime.Seconds())))
+	// SVGs can contain scripts
+	contentType := resp.Header.Get("Content-Type")
+	mediaType, _, _ := mime.ParseMediaType(contentType)
+	if (!strings.HasPrefix(mediaType, "image/") && !strings.HasPrefix(mediaType, "video/") && !strings.HasPrefix(mediaType, "audio/") && mediaType != "text/vtt") || mediaType == "image/svg+xml" {
+		http.Error(w, fmt.Sprintf("Error: unexpected content type %q", contentType), http.StatusBadGateway)
+		return
+	}
+
+	for _, header := range []string{"Content-Type", "Content-Length", "Content-Range", "Accept-Ranges", "Last-Modified", "ETag"} {
+		if resp.Header.Get(header) != "" {
+			w.Header().Set(header, resp.Header.Get(header))
+		}
+	}
+	w.WriteHeader(resp.StatusCode)
+
+	var buf *bytes.Buffer
+	wr := io.Writer(w)
+	if resp.StatusCode == http.StatusOK && resp.ContentLength >= 0 && resp.ContentLength <= ImageProxyCacheSize {
+		buf = bytes.NewBuffer(make([]byte, 0, resp.ContentLength))
+		wr = io.MultiWriter(w, buf)
+	}
+
+	n, err := io.Copy(wr, io.LimitReader(resp.Body, config.ProxyImagesMaxSize))
+	if err != nil {
+		log.Printf("Error: proxying %q: %s", imageURL, err)
+		return
+	}
+
+	if buf != nil && n == resp.ContentLength {
+		imageProxyCache.Add(imageURL, proxiedImage{contentType: contentType, data: buf.Bytes()})
+	}
+}
+
+// HandleAvatar serves the avatar of a feed, which is the first of these that
+// works:
+//
+//   - the avatar that the posts of the feed have, see rememberAvatarURL
+//   - `/apple-touch-icon.png` and `/favicon.ico` of websites
+//   - the avatar of Tumblr blogs
+//   - a generated avatar with the first letter of the name
+//
+// Feeds without an avatar are remembered for AvatarFallbackCacheTime.
+func HandleAvatar(w http.ResponseWriter, req *http.Request) {
+	tumblr := chi.URLParam(req, "tumblr")
 
-	_, err = io.Copy(wr, resp.Body)
+	// avatars come from other sites, so don't let browsers run anything
+	// in them
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.Header().Set("Content-Security-Policy", "sandbox")
+
+	if cached, isCached := avatarCache.Get(tumblr); isCached {
+		switch avatar := cached.(type) {
+		case proxiedImage:
+			w.Header().Set("Content-Type", avatar.contentType)
+			w.Header().Set("Cache-Control", fmt.Sprintf("public, max-age=%d, immutable", int(AvatarCacheTime.Seconds())))
+			_, _ = w.Write(avatar.data)
+			return
+		case missingAvatar:
+			if time.Since(avatar.since) < AvatarFallbackCacheTime {
+				serveAvatarFallback(w, tumblr)
+				return
+			}
+		}
+	}
+
+	var err error
+	for _, avatarURL := range avatarURLsFor(tumblr) {
+		var avatar proxiedImage
+		avatar, err = fetchAvatar(req.Context(), avatarURL)
+		if err != nil {
+			err = fmt.Errorf("%s: %w", avatarURL, err)
+			continue
+		}
+
+		avatarCache.Add(tumblr, avatar)
+		w.Header().Set("Content-Type", avatar.contentType)
+		w.Header().Set("Cache-Control", fmt.Sprintf("max-age=%d", int(AvatarCacheTime.Seconds())))
+		_, _ = w.Write(avatar.data)
+		return
+	}
 	if err != nil {
-		log.Printf("could not write avatar: %s", err)
+		log.Printf("Error: fetching avatar for %q: %s", tumblr, err)
+	}
+
+	avatarCache.Add(tumblr, missingAvatar{since: time.Now()})
+	serveAvatarFallback(w, tumblr)
+}
+
+// avatarURLs are the avatars that posts of feeds have, by feed.
+var avatarURLs, _ = lru.New(1000)
+
+// rememberAvatarURL remembers the avatar that the posts of the feed have, so
+// that HandleAvatar can serve it.
+func rememberAvatarURL(post *feed.Post) {
+	if post.AvatarURL == "" || post.Author == "" {
 		return
 	}
+	avatarURLs.Add(post.Author, post.AvatarURL)
+}
+
+// missingAvatar marks feeds without an avatar in the avatarCache.
+type missingAvatar struct {
+	since time.Time
+}
+
+// avatarURLsFor returns the urls the avatar of the feed `name` might be at,
+// in the order they are tried.
+func avatarURLsFor(name string) []string {
+	var candidates []string
+	if avatarURL, ok := avatarURLs.Get(name); ok {
+		candidates = append(candidates, avatarURL.(string))
+	}
+
+	switch {
+	case strings.Contains(name, "@"):
+		// only the avatars of posts, the others would be the same for
+		// all feeds of a source
+	case strings.Contains(name, "."):
+		host := strings.SplitN(name, "/", 2)[0]
+		if u, err := url.Parse(name); err == nil && u.Host != "" {
+			host = u.Host
+		}
+		candidates = append(candidates, "https://"+host+"/apple-touch-icon.png", "http://"+host+"/favicon.ico")
+	default:
+		candidates = append(candidates, fmt.Sprintf("https://api.tumblr.com/v2/blog/%s.tumblr.com/avatar/%d", url.PathEscape(name), AvatarSize))
+	}
+	return candidates
+}
+
+// MaxAvatarSize is the maximum size of avatars in bytes.
+const MaxAvatarSize = 1024 * 1024
+
+// avatarTypes are the image types that are served as avatars.  Other types
+// such as SVG can contain scripts, so they are not served from our origin.
+var avatarTypes = map[string]bool{
+	"image/avif":               true,
+	"image/bmp":                true,
+	"image/gif":                true,
+	"image/jpeg":               true,
+	"image/png":                true,
+	"image/vnd.microsoft.icon": true,
+	"image/webp":               true,
+	"image/x-icon":             true,
+}
+
+// fetchAvatar fetches the image at avatarURL.
+//
+// Pages that are not raster images are errors, as some sites answer with
+// one for files that do not exist.
+func fetchAvatar(ctx context.Context, avatarURL string) (proxiedImage, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", avatarURL, nil)
+	if err != nil {
+		return proxiedImage{}, fmt.Errorf("new request: %w", err)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return proxiedImage{}, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 400 {
+		return proxiedImage{}, feed.StatusError{Code: resp.StatusCode}
+	}
+
+	data, err := io.ReadAll(io.LimitReader(resp.Body, MaxAvatarSize))
+	if err != nil {
+		return proxiedImage{}, fmt.Errorf("read: %w", err)
+	}
+
+	contentType := resp.Header.Get("Content-Type")
+	if contentType == "" {
+		contentType = http.DetectContentType(data)
+	}
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil || !avatarTypes[mediaType] {
+		return proxiedImage{}, fmt.Errorf("not an image: %s", contentType)
+	}
+	return proxiedImage{contentType: mediaType, data: data}, nil
+}
+
+// serveAvatarFallback writes the avatar that is shown for feeds without
+// one.
+//
+// That is the one configured with `-avatar-fallback`, or an avatar with the
+// first letter of the name.  Both are cached as long as other avatars, as
+// they are the same every time.
+func serveAvatarFallback(w http.ResponseWriter, name string) {
+	contentType, avatar := avatarFallbackType, avatarFallback
+	if config.AvatarFallback == "" {
+		if letter := letterAvatar(name); letter != nil {
+			contentType, avatar = "image/svg+xml", letter
+		}
+	}
+
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Cache-Control", fmt.Sprintf("max-age=%d", int(AvatarCacheTime.Seconds())))
+	_, _ = w.Write(avatar)
+}
+
+// letterAvatar returns an SVG with the first letter or digit of `name` on a
+// color that depends on the name, or nil if it has neither.
+func letterAvatar(name string) []byte {
+	var letter rune
+	for _, ch := range name {
+		if unicode.IsLetter(ch) || unicode.IsDigit(ch) {
+			letter = unicode.ToUpper(ch)
+			break
+		}
+	}
+	if letter == 0 {
+		return nil
+	}
+
+	hash := fnv.New32a()
+	_, _ = hash.Write([]byte(name))
+	hue := hash.Sum32() % 360
+
+	return []byte(fmt.Sprintf(`<svg xmlns="http://www.w3.org/2000/svg" width="32" height="32" viewBox="0 0 32 32"><rect width="32" height="32" rx="4" fill="hsl(%d, 40%%, 50%%)"/><text x="16" y="22" font-family="sans-serif" font-size="18" text-anchor="middle" fill="#fff">%s</text></svg>`, hue, html.EscapeString(string(letter))))
+}
+
+// isAdmin returns true if the request has the configured admin token, either
+// as `Authorization: Bearer <token>` or as the `token` form value.
+func isAdmin(req *http.Request) bool {
+	if config.AdminToken == "" {
+		return false
+	}
+
+	token := strings.TrimPrefix(req.Header.Get("Authorization"), "Bearer ")
+	if token == "" {
+		token = req.FormValue("token")
+	}
 
-	avatarCache.Add(tumblr, buf.Bytes())
+	return subtle.ConstantTimeCompare([]byte(token), []byte(config.AdminToken)) == 1
 }
 
 func strictTransportSecurity(next http.Handler) http.Handler {
@@ -521,6 +1510,67 @@ type FeedInfo struct {
 	Feed     feed.Feed
 }
 
+// sourceSearches returns the search for posts of each source, which is
+// `search` with the `-source-defaults` of the source added.
+//
+// Only AO3 has the full text of posts, which is never cached, so `?full=1`
+// does not skip the cache for other sources.
+func sourceSearches(search feed.Search) func(source string) feed.Search {
+	searches := make(map[string]feed.Search, len(config.SourceDefaults))
+	for source, defaults := range config.SourceDefaults {
+		searches[source] = search.With(defaults)
+	}
+	return func(source string) feed.Search {
+		sourceSearch, ok := searches[source]
+		if !ok {
+			sourceSearch = search
+		}
+		if source != "ao3" || !ao3.FullText {
+			sourceSearch.Full = false
+		}
+		return sourceSearch
+	}
+}
+
+// mergeFeeds merges the feeds for showing them, skipping duplicate posts if
+// config.Dedupe is set.
+func mergeFeeds(feeds ...feed.Feed) feed.Feed {
+	if config.Dedupe {
+		return feed.MergeUnique(feeds...)
+	}
+	return feed.Merge(feeds...)
+}
+
+// collectPosts returns up to `limit` posts of the merged feeds that are
+// after the search cursor and match the searches, for the pages that are
+// not html.
+func collectPosts(mergedFeeds feed.Feed, search feed.Search, searchFor func(source string) feed.Search, settings Settings, limit int) []*feed.Post {
+	posts := make([]*feed.Post, 0, limit)
+	for len(posts) < limit {
+		post, err := mergedFeeds.Next()
+		if err != nil {
+			if !errors.Is(err, io.EOF) {
+				log.Printf("Error: next post: %s", err)
+			}
+			break
+		}
+
+		postSearch := searchFor(post.Source)
+		if !search.IsAfterCursor(post) || !postSearch.Matches(post) {
+			continue
+		}
+		if settings.GlobalSearch.Skip && !settings.GlobalSearch.Matches(post) {
+			continue
+		}
+		if filter, hasFilter := settings.Searches[post.Author]; hasFilter && filter.Skip && !filter.Matches(post) {
+			continue
+		}
+
+		posts = append(posts, post)
+	}
+	return posts
+}
+
 func HandleTumblr(w http.ResponseWriter, req *http.Request) {
 	start := time.Now()
 
@@ -537,23 +1587,77 @@ func HandleTumblr(w http.ResponseWriter, req *http.Request) {
 	}
 
 	if len(req.URL.Path) > 1 && strings.HasSuffix(req.URL.Path, "/") {
-		http.Redirect(w, req, req.URL.Path[:len(req.URL.Path)-1], http.StatusFound)
+		http.Redirect(w, req, strings.TrimSuffix(req.URL.EscapedPath(), "/"), http.StatusFound)
 		return
 	}
 
 	tag := chi.URLParam(req, "tag")
 	if tag != "" {
-		req.URL.Path = strings.Replace(req.URL.Path, "/tagged/"+tag, "", 1)
+		// chi matches against the escaped path if there is one, e.g. for
+		// feeds that are urls
+		if req.URL.RawPath != "" {
+			unescapedTag, err := url.PathUnescape(tag)
+			if err == nil {
+				tag = unescapedTag
+			}
+		}
+
+		// links on the page are to the feeds without the tag
+		escapedPath := req.URL.EscapedPath()
+		escapedPath = escapedPath[:strings.LastIndex(escapedPath, "/tagged/")]
+		req.URL.Path, _ = url.PathUnescape(escapedPath)
+		req.URL.RawPath = escapedPath
 	}
 
 	settings := SettingsFromRequest(req)
 	search := feed.FromRequest(req)
 
+	// feeds that are selected twice would be opened twice and show every
+	// post twice
+	settings.SelectedFeeds = uniqueFeeds(settings.SelectedFeeds)
+
+	// snoozed feeds are not opened, unless they are viewed on their own
+	allFeeds := settings.SelectedFeeds
+	snoozed := SnoozedFromRequest(req)
+	readUpTo := ReadUpToFromRequest(req)
+	snoozedFeeds := make([]string, 0, len(snoozed))
+	if len(allFeeds) > 1 && len(snoozed) > 0 {
+		settings.SelectedFeeds = make([]string, 0, len(allFeeds))
+		for _, feedName := range allFeeds {
+			if _, isSnoozed := snoozed[feedName]; isSnoozed {
+				snoozedFeeds = append(snoozedFeeds, feedName)
+				continue
+			}
+			settings.SelectedFeeds = append(settings.SelectedFeeds, feedName)
+		}
+	}
+
 	if tag != "" {
 		search.IsActive = true
 		search.Tags = append(search.Tags, strings.ToLower(tag))
 	}
 
+	limit := feed.DefaultLimit
+	limitParam := req.URL.Query().Get("limit")
+	if limitParam != "" {
+		l, err := strconv.Atoi(limitParam)
+		if err != nil {
+			log.Printf("Error: parsing limit: %s", err)
+		} else if l > 0 {
+			limit = l
+		}
+		if limit > feed.MaxLimit {
+			limit = feed.MaxLimit
+		}
+	}
+	search.Limit = limit
+	search.MinAge = DelayFromRequest(req)
+
+	searchFor := sourceSearches(search)
+
+	// single feeds can be read from the oldest cached post onwards
+	chronological := len(settings.SelectedFeeds) == 1 && req.URL.Query().Get("from") == "oldest"
+
 	var mergedFeeds feed.Feed
 	var err error
 	var feedInfoMu sync.Mutex
@@ -573,52 +1677,114 @@ func HandleTumblr(w http.ResponseWriter, req *http.Request) {
 			var openErr error
 			defer func() {
 				wg.Done()
+				duration := time.Since(start)
 				feedInfoMu.Lock()
 				feedName := settings.SelectedFeeds[i]
 				if feeds[i] != nil {
 					feedName = feeds[i].Name()
 				}
 				feedInfo[feedName] = FeedInfo{
-					Duration: time.Since(start),
+					Duration: duration,
 					Error:    openErr,
 					Feed:     feeds[i],
 				}
 				feedInfoMu.Unlock()
+
+				if !strings.HasPrefix(settings.SelectedFeeds[i], ":") {
+					CollectFeedOpen(anything.Source(settings.SelectedFeeds[i]), duration, openErr)
+				}
 			}()
 
 			if strings.HasPrefix(settings.SelectedFeeds[i], ":") {
 				return
 			}
 
+			if chronological {
+				feeds[i], openErr = openChronological(ctx, settings.SelectedFeeds[i], req.URL.Query(), limit)
+				if openErr != nil {
+					err = fmt.Errorf("%s: %w", settings.SelectedFeeds[i], openErr)
+				}
+				return
+			}
+
 			AddBackgroundFetch()
 			defer DoneBackgroundFetch()
-			feeds[i], openErr = anything.Open(ctx, settings.SelectedFeeds[i], cacheFn, search)
+			feeds[i], openErr = anything.Open(ctx, settings.SelectedFeeds[i], cacheFn, searchFor(anything.Source(settings.SelectedFeeds[i])))
 			if openErr != nil {
 				err = fmt.Errorf("%s: %w", settings.SelectedFeeds[i], openErr)
 			}
 		}(ctx, i)
 	}
 
-	limit := 20
-	limitParam := req.URL.Query().Get("limit")
-	if limitParam != "" {
-		l, err := strconv.Atoi(limitParam)
+	title := strings.Join(allFeeds, ",")
+	if req.URL.Path == "" || req.URL.Path == "/" {
+		title = "everything"
+	} else if chi.URLParam(req, "list") != "" {
+		title = chi.URLParam(req, "list")
+	}
+
+	// feed readers get the posts as RSS or Atom instead of html
+	if format := req.URL.Query().Get("format"); format == "rss" || format == "atom" {
+		wg.Wait()
+
+		switch missingFeed(settings, feeds, err) {
+		case feed.ErrPrivate:
+			HandlePrivateFeed(w, req, settings.SelectedFeeds[0])
+			return
+		case errUnknownFeed:
+			HandleUnknownFeed(w, req, settings.SelectedFeeds[0])
+			return
+		}
+
+		successfulFeeds := make([]feed.Feed, 0, len(feeds))
+		for _, f := range feeds {
+			if f != nil {
+				successfulFeeds = append(successfulFeeds, f)
+			}
+		}
 		if err != nil {
-			log.Printf("Error: parsing limit: %s", err)
+			log.Printf("Error: open: %s", err)
+			if len(successfulFeeds) == 0 {
+				http.Error(w, fmt.Sprintf("Error: could not load feed: %s", err), http.StatusBadGateway)
+				return
+			}
+		}
+
+		mergedFeeds := mergeFeeds(successfulFeeds...)
+		defer func() {
+			err := mergedFeeds.Close()
+			if err != nil {
+				log.Printf("Error: closing %s: %s", settings.SelectedFeeds, err)
+			}
+		}()
+
+		posts := collectPosts(mergedFeeds, search, searchFor, settings, limit)
+		if format == "atom" {
+			writeAtom(w, req, title, posts)
 		} else {
-			limit = l
+			writeRSS(w, req, title, posts)
 		}
+		return
 	}
 
-	w.Header().Set("Content-Type", `text/html; charset="utf-8"`)
-
-	title := strings.Join(settings.SelectedFeeds, ",")
-	if req.URL.Path == "" || req.URL.Path == "/" {
-		title = "everything"
-	} else if chi.URLParam(req, "list") != "" {
-		title = chi.URLParam(req, "list")
+	// the first page of multiple feeds shows which of them have new posts
+	// since the last time it was visited
+	isIndex := len(allFeeds) > 1 && !search.IsActive && search.BeforeID == ""
+	var lastVisit time.Time
+	if isIndex {
+		lastVisit = LastVisitFromRequest(req)
+		http.SetCookie(w, &http.Cookie{
+			Name:     CookieName + "-lastvisit",
+			Value:    strconv.FormatInt(time.Now().Unix(), 10),
+			Path:     "/",
+			MaxAge:   365 * 24 * 60 * 60, // one year
+			SameSite: http.SameSiteLaxMode,
+			HttpOnly: true,
+		})
 	}
 
+	w.Header().Set("Content-Type", `text/html; charset="utf-8"`)
+
 	favicon := "/favicon.png"
 	if len(settings.SelectedFeeds) == 1 {
 		favicon = "/avatar/" + url.PathEscape(settings.SelectedFeeds[0])
@@ -637,6 +1803,24 @@ func HandleTumblr(w http.ResponseWriter, req *http.Request) {
 	}
 
 	wg.Wait()
+
+	// missing feeds are explained on the page instead of getting their own,
+	// it is started before the feeds are open so that others are not held up
+	switch missingFeed(settings, feeds, err) {
+	case feed.ErrPrivate:
+		fmt.Fprintln(w, `</header>`)
+		fmt.Fprintf(w, `<p>feed %s is private</p>
+`, html.EscapeString(settings.SelectedFeeds[0]))
+		writePrivateFeed(w)
+		return
+	case errUnknownFeed:
+		fmt.Fprintln(w, `</header>`)
+		fmt.Fprintf(w, `<p>couldn't find feed %s</p>
+`, html.EscapeString(settings.SelectedFeeds[0]))
+		writeUnknownFeed(w, req, settings.SelectedFeeds[0])
+		return
+	}
+
 	successfulFeeds := make([]feed.Feed, 0, len(feeds))
 	for _, feed := range feeds {
 		if feed == nil {
@@ -644,7 +1828,7 @@ func HandleTumblr(w http.ResponseWriter, req *http.Request) {
 		}
 		successfulFeeds = append(successfulFeeds, feed)
 	}
-	mergedFeeds = feed.Merge(successfulFeeds...)
+	mergedFeeds = mergeFeeds(successfulFeeds...)
 	if err != nil {
 		go CollectError(err)
 		log.Println("open:", err)
@@ -673,15 +1857,95 @@ func HandleTumblr(w http.ResponseWriter, req *http.Request) {
 	if len(settings.SelectedFeeds) == 1 && feeds[0] != nil && feeds[0].Description() != "" {
 		fmt.Fprintf(w, "<h2 id=\"description\">%s</h2>\n", feeds[0].Description())
 	}
+	if len(allFeeds) == 1 {
+		list := chi.URLParam(req, "list")
+		isFollowing := isFollowed(followedFeeds(req, list), allFeeds[0])
+		fmt.Fprintf(w, `<p class="follow">%s</p>`, followForm(allFeeds[0], list, !isFollowing, req.URL.EscapedPath()))
+		if until, isSnoozed := snoozed[allFeeds[0]]; isSnoozed {
+			fmt.Fprintf(w, `<p class="snoozed">snoozed until %s %s</p>`, until.Format("2006-01-02 15:04"), snoozeForm(allFeeds[0], "0", "unsnooze", req.URL.EscapedPath()))
+		} else {
+			fmt.Fprintf(w, `<p class="snoozed">%s</p>`, snoozeForm(allFeeds[0], "24h", "snooze for a day", req.URL.EscapedPath()))
+		}
+		if marker, isRead := readUpTo[allFeeds[0]]; isRead {
+			fmt.Fprintf(w, `<p class="read">read up to %s %s</p>`, marker.Date.Format("2006-01-02 15:04"), readForm(allFeeds[0], nil, "mark as unread", req.URL.EscapedPath()))
+		}
+		if chronological {
+			fmt.Fprintf(w, `<p>oldest posts first, <a href=%q>newest first</a></p>`, req.URL.EscapedPath())
+		} else {
+			fmt.Fprintf(w, `<p><a href="%s?from=oldest">oldest posts first</a></p>`, req.URL.EscapedPath())
+		}
+	}
+	if len(snoozedFeeds) > 0 {
+		fmt.Fprintf(w, `<details class="snoozed"><summary>%d feeds snoozed</summary><ul>`, len(snoozedFeeds))
+		for _, feedName := range snoozedFeeds {
+			fmt.Fprintf(w, `<li><a href="%s">%s</a> until %s %s</li>`, html.EscapeString("/"+url.PathEscape(feedName)), html.EscapeString(feedName), snoozed[feedName].Format("2006-01-02 15:04"), snoozeForm(feedName, "0", "unsnooze", req.URL.EscapedPath()))
+		}
+		fmt.Fprintln(w, `</ul></details>`)
+	}
+	if isIndex && !lastVisit.IsZero() {
+		writeRecentlyUpdated(req.Context(), w, settings.SelectedFeeds, lastVisit)
+	}
 	fmt.Fprintln(w, "</header>")
 
-	fmt.Fprintf(w, `<form method="GET" action=%q><input aria-label="visit feed" name="feed" type="search" value="" placeholder="feed" list="feeds" /></form>`, req.URL.Path)
+	fmt.Fprintf(w, `<form method="GET" action=%q><input aria-label="visit feed" name="feed" type="search" value="" placeholder="feed" list="feeds" /></form>`, req.URL.EscapedPath())
 	fmt.Fprintln(w, `<datalist id="feeds">`)
 	for _, tumbl := range settings.SelectedFeeds {
 		fmt.Fprintf(w, `<option value=%q>%s</option>`, tumbl, tumbl)
 	}
 	fmt.Fprintln(w, `</datalist>`)
-	fmt.Fprintf(w, `<form method="GET" action=%q><input aria-label="search posts" name="search" type="search" value=%q placeholder="noreblog #art ..." /></form>`, req.URL.Path, html.EscapeString(req.URL.Query().Get("search")))
+	// see feed.FromRequest
+	searchOptions := ""
+	if req.URL.Query().Get("cs") != "" {
+		searchOptions += ` <label><input type="checkbox" name="cs" value="1" checked /> match case</label>`
+	} else {
+		searchOptions += ` <label><input type="checkbox" name="cs" value="1" /> match case</label>`
+	}
+	if req.URL.Query().Get("sub") != "" {
+		searchOptions += ` <label><input type="checkbox" name="sub" value="1" checked /> within words</label>`
+	} else {
+		searchOptions += ` <label><input type="checkbox" name="sub" value="1" /> within words</label>`
+	}
+	fmt.Fprintf(w, `<form method="GET" action=%q><input aria-label="search posts" name="search" type="search" value=%q placeholder="noreblog #art ..." />%s</form>`, req.URL.EscapedPath(), html.EscapeString(req.URL.Query().Get("search")), searchOptions)
+
+	viewQuery := req.URL.Query()
+	if viewQuery.Get("view") == "links" {
+		viewQuery.Del("view")
+		fmt.Fprintf(w, `<p class="view"><a href="%s?%s">show full posts</a></p>`, req.URL.EscapedPath(), html.EscapeString(viewQuery.Encode()))
+	} else {
+		viewQuery.Set("view", "links")
+		fmt.Fprintf(w, `<p class="view"><a href="%s?%s">show only links and media</a></p>`, req.URL.EscapedPath(), html.EscapeString(viewQuery.Encode()))
+	}
+
+	headlinesURL := "/headlines"
+	if chi.URLParam(req, "feeds") != "" || chi.URLParam(req, "list") != "" {
+		headlinesURL = feedsPath(allFeeds) + "/headlines"
+	}
+	fmt.Fprintf(w, `<p class="view"><a href=%q>show only headlines</a></p>`, headlinesURL)
+	fmt.Fprintln(w, `<p class="view"><a href="/search">search all posts</a></p>`)
+
+	rssQuery := req.URL.Query()
+	rssQuery.Del("before")
+	rssQuery.Del("before-date")
+	rssQuery.Set("format", "rss")
+	fmt.Fprintf(w, `<p class="view"><a href="%s?%s">subscribe via rss</a></p>`, req.URL.EscapedPath(), html.EscapeString(rssQuery.Encode()))
+
+	if ao3.FullText && len(settings.SelectedFeeds) == 1 && anything.Source(settings.SelectedFeeds[0]) == "ao3" {
+		fullQuery := req.URL.Query()
+		if search.Full {
+			fullQuery.Del("full")
+			fmt.Fprintf(w, `<p class="view"><a href="%s?%s">show only summaries</a></p>`, req.URL.EscapedPath(), html.EscapeString(fullQuery.Encode()))
+		} else {
+			fullQuery.Set("full", "1")
+			fmt.Fprintf(w, `<p class="view"><a href="%s?%s">show the text of works</a></p>`, req.URL.EscapedPath(), html.EscapeString(fullQuery.Encode()))
+		}
+	}
+
+	// new posts are shown here as they come in, see HandleEvents
+	if config.Events && search.BeforeID == "" && !chronological {
+		eventsURL := "/events?" + url.Values{"feeds": {strings.Join(allFeeds, ",")}}.Encode()
+		fmt.Fprintf(w, `<section id="new-posts" data-events="%s" aria-live="polite" hidden><p><span class="count">0</span> new posts, <a href="%s">reload</a></p><ul></ul></section>`, html.EscapeString(eventsURL), html.EscapeString(req.URL.RequestURI()))
+		fmt.Fprintln(w)
+	}
 
 	postCount := 0
 	var post *feed.Post
@@ -712,17 +1976,13 @@ func HandleTumblr(w http.ResponseWriter, req *http.Request) {
 			return
 		}
 
-		if filter, hasFilter := settings.Searches[post.Author]; hasFilter && filter.Skip && !filter.Matches(post) {
+		// posts marked as read are only shown when viewing their feed alone
+		if marker, isRead := readUpTo[post.Author]; isRead && len(allFeeds) > 1 && !feed.IsNewer(post, marker) {
 			nextPost()
+			return
 		}
-	}
 
-	if search.BeforeID != "" {
-		nextPost()
-		for err == nil {
-			if post.ID <= search.BeforeID {
-				break
-			}
+		if filter, hasFilter := settings.Searches[post.Author]; hasFilter && filter.Skip && !filter.Matches(post) {
 			nextPost()
 		}
 	}
@@ -730,8 +1990,13 @@ func HandleTumblr(w http.ResponseWriter, req *http.Request) {
 	posts := make([]*feed.Post, 0, limit)
 
 	nextPost()
+	for err == nil && !search.IsAfterCursor(post) {
+		nextPost()
+	}
+
 	for err == nil {
-		if !search.Matches(post) {
+		postSearch := searchFor(post.Source)
+		if !postSearch.Matches(post) {
 			nextPost()
 			continue
 		}
@@ -760,10 +2025,19 @@ func HandleTumblr(w http.ResponseWriter, req *http.Request) {
 		postGroups = append(postGroups, group)
 	}
 
+	collapseImages := DisplayFromRequest(req).Collapse != "off"
+	safeMode := SafeModeFromRequest(req)
+
+	// the link roundup shows only the links and media of posts
+	roundup := req.URL.Query().Get("view") == "links"
+
+	// compiled once, as it is used for every post
+	termsRE := highlightRE(search.AllTerms())
+
 	imageCount := 0
 	for _, group := range postGroups {
 		if len(settings.SelectedFeeds) > 1 && len(group) >= GroupPostsNumber {
-			fmt.Fprintf(w, `<details open><summary>%d posts by %s</summary>`, len(group), group[0].Author)
+			fmt.Fprintf(w, `<details open><summary>%d posts by %s %s</summary>`, len(group), displayAuthor(group[0]), readForm(group[0].Author, group[0], "mark as read", req.URL.RequestURI()))
 		}
 
 		for _, post := range group {
@@ -774,6 +2048,16 @@ func HandleTumblr(w http.ResponseWriter, req *http.Request) {
 
 			classes = append(classes, post.Source)
 
+			// blurred images are focusable, so clicking them unblurs them
+			isBlurred := safeMode
+			for _, tag := range post.Tags {
+				if contentNoteRE.MatchString(tag) {
+					classes = append(classes, "content-note")
+					isBlurred = true
+					break
+				}
+			}
+
 			isHidden := false
 			postFilter, hasFilter := settings.Searches[post.Author]
 			if !settings.GlobalSearch.Matches(post) {
@@ -786,15 +2070,30 @@ func HandleTumblr(w http.ResponseWriter, req *http.Request) {
 			}
 
 			fmt.Fprintf(w, `<article class=%q>`, strings.Join(classes, " "))
+			rememberAvatarURL(post)
 			avatarURL := post.AvatarURL
 			if avatarURL == "" {
 				avatarURL = "/avatar/" + post.Author
+			} else if config.ProxyImages {
+				avatarURL = proxyImageURL(avatarURL)
 			}
 			feedDescription := ""
 			if feedInfo[post.Author].Feed != nil {
 				feedDescription = feedInfo[post.Author].Feed.Description()
 			}
-			fmt.Fprintf(w, `<p><img class="avatar" src="%s" loading="lazy" /> <a class="author" title=%q href="/%s">%s</a>:</p>`, avatarURL, html.EscapeString(feedDescription), post.Author, post.Author)
+			if alias, aliasFeeds, ok := authorAlias(post.Author); ok {
+				fmt.Fprintf(w, `<p><img class="avatar" src="%s" loading="lazy" /> <a class="author" title=%q href="/%s">%s</a>`, avatarURL, html.EscapeString(feedDescription), strings.Join(aliasFeeds, ","), alias)
+				for _, aliasFeed := range aliasFeeds {
+					classes := "source"
+					if aliasFeed == post.Author {
+						classes += " current"
+					}
+					fmt.Fprintf(w, ` <a class=%q href="/%s" title=%q>%s</a>`, classes, aliasFeed, aliasFeed, anything.Source(aliasFeed))
+				}
+				fmt.Fprintln(w, `:</p>`)
+			} else {
+				fmt.Fprintf(w, `<p><img class="avatar" src="%s" loading="lazy" /> <a class="author" title=%q href="/%s">%s</a>:</p>`, avatarURL, html.EscapeString(feedDescription), post.Author, post.Author)
+			}
 
 			if len(post.Tags) > 0 {
 				fmt.Fprint(w, `<ul class="tags content-notes">`)
@@ -818,42 +2117,41 @@ func HandleTumblr(w http.ResponseWriter, req *http.Request) {
 				if err != nil {
 					log.Printf("Error: flatten reblog: %s", err)
 				}
+				reblogHTML, err = tumblr.CollapseReblogs(reblogHTML, ReblogsCollapseCount)
+				if err != nil {
+					log.Printf("Error: collapse reblog: %s", err)
+				}
 				postHTML = reblogHTML
+
+				reblogSource := tumblr.ReblogSource(post.DescriptionHTML)
+				if reblogSource != "" && reblogSource != post.Author {
+					postHTML = fmt.Sprintf(`<p class="reblog-source">originally by <a href="%s">%s</a></p>`, html.EscapeString("/"+url.PathEscape(reblogSource)), html.EscapeString(reblogSource)) + postHTML
+				}
 			} else {
 				postHTML += post.DescriptionHTML
 			}
 			postHTML = strings.ReplaceAll(postHTML, "<body>", "")
 			postHTML = strings.ReplaceAll(postHTML, "</body>", "")
+			postHTML = feed.SanitizeIframes(postHTML, strings.Split(config.IframeAllowlist, ","))
+			postHTML = feed.DropSmallImages(postHTML, config.MinImageSize)
 			// load first 5 images eagerly, and the rest lazily
 			postHTML = imgRE.ReplaceAllStringFunc(postHTML, func(repl string) string {
 				imageCount++
+				if isBlurred {
+					return `<img loading="lazy" tabindex="0" `
+				}
 				if imageCount > 0 {
 					return `<img loading="lazy" `
 				}
 				return `<img `
 			})
-			postHTML = origWidthHeightRE.ReplaceAllStringFunc(postHTML, func(repl string) string {
-				parts := origWidthHeightRE.FindStringSubmatch(repl)
-				if len(parts) != 3 {
-					log.Printf("Error: invalid orig-width-height: %s", repl)
-					return repl
-				}
-
-				return fmt.Sprintf(`width=%q height=%q`, parts[1], parts[2])
-			})
-			postHTML = origHeightWidthRE.ReplaceAllStringFunc(postHTML, func(repl string) string {
-				parts := origHeightWidthRE.FindStringSubmatch(repl)
-				if len(parts) != 3 {
-					log.Printf("Error: invalid orig-width-height: %s", repl)
-					return repl
-				}
-
-				return fmt.Sprintf(`width=%q height=%q`, parts[2], parts[1])
-			})
+			postHTML = origWidthHeightRE.ReplaceAllString(postHTML, `width="$1" height="$2"`)
+			postHTML = origHeightWidthRE.ReplaceAllString(postHTML, `width="$2" height="$1"`)
+			if collapseImages {
+				postHTML = feed.MarkTallImages(postHTML, TallImageRatio)
+			}
 			postHTML = blankLinksRE.ReplaceAllString(postHTML, ` `)
-			postHTML = linkRE.ReplaceAllStringFunc(postHTML, func(repl string) string {
-				return `<a rel="noreferrer" `
-			})
+			postHTML = strings.ReplaceAll(postHTML, `<a `, `<a rel="noreferrer" `)
 			postHTML = tumblrReblogLinkRE.ReplaceAllStringFunc(postHTML, func(repl string) string {
 				parts := tumblrReblogLinkRE.FindStringSubmatch(repl)
 				if len(parts) != 6 {
@@ -919,25 +2217,23 @@ func HandleTumblr(w http.ResponseWriter, req *http.Request) {
 				return res
 			})
 			postHTML = strings.Replace(postHTML, `<span class="tmblr-alt-text-helper">ALT</span>`, "", -1)
+			if config.StripEmojiShortcodes {
+				postHTML = feed.StripEmoji(postHTML)
+			}
 
 			if post.Source != "tiktok" {
-				postHTML = videoRE.ReplaceAllStringFunc(postHTML, func(repl string) string {
-					return `<video preload="metadata" controls="" `
-				})
+				postHTML = strings.ReplaceAll(postHTML, `<video `, `<video preload="metadata" controls="" `)
 			}
-			postHTML = autoplayRE.ReplaceAllStringFunc(postHTML, func(repl string) string {
-				return ``
-			})
+			postHTML = strings.ReplaceAll(postHTML, ` autoplay="autoplay"`, ``)
 
-			for _, term := range search.Terms {
-				termRE, err := regexp.Compile("(?i)(" + regexp.QuoteMeta(term) + ")")
-				if err != nil {
-					postHTML = strings.Replace(postHTML, term, "<mark>"+term+"</mark>", -1)
-					continue
-				}
-				postHTML = termRE.ReplaceAllStringFunc(postHTML, func(repl string) string {
-					return "<mark>" + repl + "</mark>"
-				})
+			if config.ProxyImages {
+				postHTML = feed.RewriteMediaURLs(postHTML, proxyImageURL)
+			}
+
+			postHTML = feed.HighlightHTML(postHTML, termsRE)
+
+			if roundup {
+				postHTML = roundupHTML(postHTML)
 			}
 
 			if isHidden {
@@ -977,11 +2273,18 @@ func HandleTumblr(w http.ResponseWriter, req *http.Request) {
 			}
 			fmt.Fprintf(w, `<time title="%s" datetime="%s">%s ago</time> `, post.Date, post.DateString, prettyDuration(time.Since(post.Date)))
 			fmt.Fprintf(w, `by <a href=%q>%s</a>, `, "/"+post.Author, post.Author)
+			if post.NoteCount > 0 {
+				fmt.Fprintf(w, `<span class="notes">%s</span>, `, notesText(post.NoteCount))
+			}
 			if post.Source == "tumblr" {
 				fmt.Fprintf(w, `<a href=%q title="link to just this post">post</a> <a class="tumblr-link" href=%q>t</a>`, tumblrToInternal(post.URL), post.URL)
 			} else {
-				fmt.Fprintf(w, `<a href=%q title="link to just this post">post</a>`, post.URL)
+				fmt.Fprintf(w, `<a href=%q title="link to just this post">post</a>`, postPath(post))
+				if post.URL != "" {
+					fmt.Fprintf(w, ` <a class="original" href=%q title="link to the original post">original</a>`, post.URL)
+				}
 			}
+			writeShareLinks(w, post)
 			fmt.Fprint(w, "</footer>")
 			fmt.Fprintln(w, "</article>")
 			if f, ok := w.(http.Flusher); ok {
@@ -995,45 +2298,63 @@ func HandleTumblr(w http.ResponseWriter, req *http.Request) {
 	}
 
 	fmt.Fprintln(w, `<span id="bottom"></span>
-<a id="link-top" class="jumper" href="#">▴</a>`)
+<a id="link-top" class="jumper" href="#" title="back to top" aria-label="back to top">▴</a>`)
 
 	if lastPost != nil {
-		nextPage := req.URL
-		query := url.Values{}
-		query.Set("before", lastPost.ID)
-		if req.URL.Query().Get("search") != "" {
-			query.Set("search", req.URL.Query().Get("search"))
-		}
-		nextPage.RawQuery = query.Encode()
-		fmt.Fprintf(w, `<div class="next-page"><a href="%s">next page</a></div>`, nextPage)
+		fmt.Fprintf(w, `<div class="next-page"><a href="%s" rel="next">next page</a></div>`, html.EscapeString(nextPageURL(req.URL, lastPost, chronological)))
+	}
+
+	writeFeedsSummary(req.Context(), w, allFeeds)
+
+	listSearchField := ""
+	exportQuery := ""
+	if list := chi.URLParam(req, "list"); list != "" {
+		exportQuery = "?" + url.Values{"list": {list}}.Encode()
+		listSearchField = fmt.Sprintf(`	<label for="list-search">Search applied to the whole list</label>:
+	<div class="field">
+		<input type="search" id="list-search" name="search" value=%q placeholder="noreblogs -#wip ..." />
+	</div>
+`, html.EscapeString(ListSearchFromRequest(req, list)))
 	}
 
 	fmt.Fprintf(w, `<form method="POST" action="/settings">
 
 	<input type="text" name="list" hidden value=%q />
 
-	<label for="feeds">Feeds to view by default</label>:
+	<label for="default-feeds">Feeds to view by default</label>:
 	<div class="field">
-		<textarea rows="%d" cols="30" name="feeds">%s</textarea>
+		<textarea id="default-feeds" rows="%d" cols="30" name="feeds">%s</textarea>
 	</div>
-	<input type="submit" value="Save" />
+%s	<input type="submit" value="Save" />
 </form>
 
 <form method="POST" action="/settings/clear">
-	<input type="submit" value="Clear" title="FIXME: clear currently broken :/" disabled />
+	<input type="text" name="list" hidden value=%q />
+	<input type="submit" value="Clear" title="View the default feeds again" />
 </form>
-`, chi.URLParam(req, "list"), len(settings.SelectedFeeds)+1, strings.Join(settings.SelectedFeeds, "\n"))
 
-	u := url.URL{
-		Path: strings.Join(settings.SelectedFeeds, ","),
-	}
-	if strings.ContainsAny(u.Path, "/&?") {
-		u.Path = "/"
-		query := make(url.Values)
-		query["feeds"] = settings.SelectedFeeds
-		u.RawQuery = query.Encode()
-	}
-	fmt.Fprintf(w, `<p>Share feed via <a href=%q>a link</a>.</p>`, u.String())
+<form method="POST" action="/settings/import" enctype="multipart/form-data">
+	<input type="text" name="list" hidden value=%q />
+	<label for="opml">Import feeds from OPML</label>: <input type="file" id="opml" name="opml" accept=".opml,.xml,text/x-opml" />
+	<input type="submit" value="Import" />
+</form>
+
+<p><a href="/settings/export.opml%s">Export feeds as OPML</a></p>
+`, chi.URLParam(req, "list"), len(allFeeds)+1, strings.Join(allFeeds, "\n"), listSearchField, chi.URLParam(req, "list"), chi.URLParam(req, "list"), html.EscapeString(exportQuery))
+
+	display := DisplayFromRequest(req)
+	fmt.Fprintf(w, `<form method="POST" action="/settings/display">
+	<input type="text" name="redirect" hidden value=%q />
+	<label for="width">Reading width</label>: %s
+	<label for="font">Font</label>: %s
+	<label for="collapse">Collapse tall images</label>: %s
+	<label for="delay">Hide posts newer than</label>: <input type="text" id="delay" name="delay" size="5" value=%q placeholder=%q />
+	<label for="details">Performance details</label>: %s
+	<input type="submit" value="Save" />
+</form>
+`, req.URL.EscapedPath(), selectHTML("width", display.Width, "narrow", "medium", "wide"), selectHTML("font", display.Font, "sans", "serif", "mono"), selectHTML("collapse", display.Collapse, "off", "short", "medium", "long"), display.Delay, config.Delay.String(), selectHTML("details", display.Details, "show", "hide"))
+
+	fmt.Fprintf(w, `<p>Share feed via <a href=%q>a link</a>.</p>`, absoluteURL(req, feedsPath(allFeeds)))
 
 	fmt.Fprintln(w, `<section id="lists">
 <h1>Lists</h1>
@@ -1043,7 +2364,7 @@ func HandleTumblr(w http.ResponseWriter, req *http.Request) {
 <li><a href="/">everything</a></li>`)
 
 	for _, cookie := range req.Cookies() {
-		if strings.HasPrefix(cookie.Name, CookieName+"-list-") {
+		if strings.HasPrefix(cookie.Name, CookieName+"-list-") && !strings.HasSuffix(cookie.Name, "-search") {
 			listName := cookie.Name[len(CookieName+"-list-"):]
 			fmt.Fprintf(w, `<li><a href="/list/%s">%s</a></li>`, listName, listName)
 		}
@@ -1051,41 +2372,51 @@ func HandleTumblr(w http.ResponseWriter, req *http.Request) {
 	fmt.Fprintln(w, `</ul>
 </section>`)
 
-	fmt.Fprintf(w, `<hr /><footer>%d posts from %q (<a href=%q>source</a>) in %s (open: %s)</footer>`, postCount, mergedFeeds.Name(), mergedFeeds.URL(), time.Since(start).Round(time.Millisecond), openTime.Round(time.Millisecond))
+	// the performance details can be hidden, but are always shown when
+	// debugging
+	if display.Details != "hide" || req.URL.Query().Get("debug") != "" {
+		fmt.Fprintf(w, `<hr /><footer>%d posts from %q (<a href=%q>source</a>) in %s (open: %s)</footer>`, postCount, mergedFeeds.Name(), mergedFeeds.URL(), time.Since(start).Round(time.Millisecond), openTime.Round(time.Millisecond))
 
-	feedsByTime := make([]string, 0, len(feedInfo))
-	for feed := range feedInfo {
-		feedsByTime = append(feedsByTime, feed)
-	}
-	sort.Sort(sort.Reverse(sortByFunc{strings: feedsByTime, lessFn: func(a, b string) bool { return feedInfo[a].Duration < feedInfo[b].Duration }}))
-	fmt.Fprintln(w, `<details><summary>Performance details</summary><ol>`)
-	for _, feedName := range feedsByTime {
-		errorInfo := ""
-		if feedInfo[feedName].Error != nil {
-			errorInfo = fmt.Sprintf(" (<code style=\"font-size: smaller\">%s</code>)", feedInfo[feedName].Error)
+		feedsByTime := make([]string, 0, len(feedInfo))
+		for feed := range feedInfo {
+			feedsByTime = append(feedsByTime, feed)
 		}
-		notes := ""
-		if feedWithNotes, ok := feedInfo[feedName].Feed.(feed.Notes); ok {
-			notes = feedWithNotes.Notes()
-			if notes != "" {
-				notes = ", " + notes
+		sort.Sort(sort.Reverse(sortByFunc{strings: feedsByTime, lessFn: func(a, b string) bool { return feedInfo[a].Duration < feedInfo[b].Duration }}))
+		fmt.Fprintln(w, `<details><summary>Performance details</summary><ol>`)
+		for _, feedName := range feedsByTime {
+			errorInfo := ""
+			if feedInfo[feedName].Error != nil {
+				errorInfo = fmt.Sprintf(" (<code style=\"font-size: smaller\">%s</code>)", feedInfo[feedName].Error)
+			}
+			notes := ""
+			if feedWithNotes, ok := feedInfo[feedName].Feed.(feed.Notes); ok {
+				notes = feedWithNotes.Notes()
+				if notes != "" {
+					notes = ", " + notes
+				}
 			}
+			fmt.Fprintf(w, `<li>%s (%s%s)%s</li>`, feedName, feedInfo[feedName].Duration, notes, errorInfo)
 		}
-		fmt.Fprintf(w, `<li>%s (%s%s)%s</li>`, feedName, feedInfo[feedName].Duration, notes, errorInfo)
+		fmt.Fprintln(w, `</ol></details>`)
 	}
-	fmt.Fprintln(w, `</ol></details>`)
 
 	if err != nil && !errors.Is(err, io.EOF) {
 		log.Println("decode:", err)
 	}
 
+	// everything works without JavaScript, it only adds enhancements for
+	// browsers that support it
 	fmt.Fprintln(w, `<script>
+if ('querySelector' in document && 'addEventListener' in window && 'classList' in document.documentElement) {
   // pretty reloads (sparkly indicator)
 
-  let lastScrollTop = window.pageYOffset || document.documentElement.scrollTop;;
+  let lastScrollTop = window.pageYOffset || document.documentElement.scrollTop;
 
   var toTopEl = document.querySelector("#link-top");
   window.addEventListener("scroll", function() {
+    if (!toTopEl) {
+      return;
+    }
     let st = window.pageYOffset || document.documentElement.scrollTop;
     if (st > lastScrollTop){
       toTopEl.classList.remove("jump-to-top");
@@ -1097,25 +2428,27 @@ func HandleTumblr(w http.ResponseWriter, req *http.Request) {
 
   function reloadSpinner() {
     let reloadStyleEl = document.createElement("style");
-    reloadStyleEl.textContent = "#reload { position: fixed; top: 1ex; left: 50vw; animation: reload 3s infinite; } @keyframes reload { 0% { color: black; } 12.5% { color: violet; } 25% { color: blue; } 37.5% { color: green; } 50% { color: yellow; } 62.5% { color: orange; } 75% { color: red; } 87.5% { color: brown; } 100% { color: black; } }";
+    reloadStyleEl.textContent = "#reload { position: fixed; top: 1ex; left: 50vw; animation: reload 3s infinite; } @keyframes reload { 0% { color: black; } 12.5% { color: violet; } 25% { color: blue; } 37.5% { color: green; } 50% { color: yellow; } 62.5% { color: orange; } 75% { color: red; } 87.5% { color: brown; } 100% { color: black; } } @media (prefers-reduced-motion: reduce) { #reload { animation: none; } }";
     document.body.appendChild(reloadStyleEl);
     let reloadEl = document.createElement("div");
     reloadEl.id = "reload";
     reloadEl.textContent = "✦";
+    reloadEl.setAttribute("aria-hidden", "true");
     document.body.appendChild(reloadEl);
   };
 
   window.addEventListener("click", (ev) => {
-    if (ev.target.tagName != "A" || new URL(ev.target.href).pathname == window.location.pathname) {
+    let linkEl = ev.target.closest("a");
+    if (!linkEl || !linkEl.href || ev.ctrlKey || ev.metaKey || ev.shiftKey || new URL(linkEl.href).pathname == window.location.pathname) {
       return;
-	 }
-	 reloadSpinner();
+    }
+    reloadSpinner();
   });
   window.addEventListener("focus", (ev) => {
     let reloadEl = document.querySelector("#reload");
     if (reloadEl) {
       document.body.removeChild(reloadEl);
-	 }
+    }
   });
 
   // pull to reload
@@ -1132,6 +2465,7 @@ func HandleTumblr(w http.ResponseWriter, req *http.Request) {
       let url = new URL(window.location);
       if (url.searchParams.has("before")) {
         url.searchParams.delete("before");
+        url.searchParams.delete("before-date");
       }
       url.hash = "";
       window.location = url.href;
@@ -1140,33 +2474,63 @@ func HandleTumblr(w http.ResponseWriter, req *http.Request) {
     }
   }, {passive: true});
 
-  // skip posts with a double-tap
+  // skip posts with a double-tap, only on touch screens so that double
+  // clicking still selects text
 
   let lastTouch = 0;
-  window.addEventListener('mousedown', (ev) => {
+  window.addEventListener('pointerdown', (ev) => {
+    if (ev.pointerType != "touch") {
+      return;
+    }
     let el = ev.target.closest("article");
     if (ev.timeStamp - lastTouch < 500 && el != null) {
       ev.preventDefault();
-      //window.scrollBy({top: el.clientHeight, behaviour: 'smooth'});
       window.scrollTo({top: el.offsetTop + el.clientHeight - (window.innerHeight * 0.1), behavior: 'auto'});
     };
     lastTouch = ev.timeStamp;
   });
 
+  // ctrl-click on a post opens it, ctrl-click on links still opens them in
+  // a new tab
+
   window.addEventListener('click', (ev) => {
-    if (ev.ctrlKey) {
-      let postLink = ev.target.closest('article').querySelector('a[title="link to just this post"]').href;
-      window.location = postLink;
+    if (!ev.ctrlKey || ev.target.closest('a, button, input, select, textarea')) {
+      return;
+    }
+    let articleEl = ev.target.closest('article');
+    let postLinkEl = articleEl && articleEl.querySelector('a[title="link to just this post"]');
+    if (postLinkEl) {
+      window.location = postLinkEl.href;
     }
   });
 
+  // show new posts as they come in, if enabled with -events
+
+  let newPostsEl = document.querySelector("#new-posts");
+  if (newPostsEl && 'EventSource' in window) {
+    let events = new EventSource(newPostsEl.dataset.events);
+    events.addEventListener("post", (ev) => {
+      let post = JSON.parse(ev.data);
+      let listEl = newPostsEl.querySelector("ul");
+      let itemEl = document.createElement("li");
+      let linkEl = document.createElement("a");
+      linkEl.href = post.url;
+      linkEl.textContent = post.text;
+      itemEl.append(post.feed + ": ", linkEl);
+      listEl.insertBefore(itemEl, listEl.firstChild);
+      newPostsEl.querySelector(".count").textContent = listEl.children.length;
+      newPostsEl.hidden = false;
+    });
+  }
+
   // service worker to be detected as a progressive web app in webkit-based browsers
 
   if ('serviceWorker' in navigator) {
     navigator.serviceWorker.register('/service-worker.js')
       .then(() => console.log("numblr registered!"))
-		.catch((err) => console.log("numblr registration failed: ", err));
+      .catch((err) => console.log("numblr registration failed: ", err));
   }
+}
 </script>`)
 
 	fmt.Fprintln(w, `</div>`)
@@ -1175,92 +2539,472 @@ func HandleTumblr(w http.ResponseWriter, req *http.Request) {
 </html>`)
 }
 
+// writeFeedsSummary writes a short summary of the feeds, i.e. how many there
+// are from which source and whether they are cached or erroring.
+func writeFeedsSummary(ctx context.Context, w io.Writer, feeds []string) {
+	bySource := make(map[string]int)
+	sources := make([]string, 0, 5)
+	for _, feedName := range feeds {
+		source := anything.Source(feedName)
+		if bySource[source] == 0 {
+			sources = append(sources, source)
+		}
+		bySource[source]++
+	}
+	sort.Slice(sources, func(i, j int) bool {
+		return bySource[sources[i]] > bySource[sources[j]]
+	})
+
+	sourceCounts := make([]string, 0, len(sources))
+	for _, source := range sources {
+		sourceCounts = append(sourceCounts, fmt.Sprintf("%d %s", bySource[source], source))
+	}
+
+	fmt.Fprintln(w, `<section id="feeds-summary">`)
+	fmt.Fprintf(w, `<p>%d feeds: %s.</p>`, len(feeds), strings.Join(sourceCounts, ", "))
+	fmt.Fprintln(w)
+
+	infos, err := database.ListFeedInfos(ctx, cacheDB, feeds)
+	if err != nil {
+		log.Printf("Error: listing feed infos: %s", err)
+		fmt.Fprintln(w, `</section>`)
+		return
+	}
+
+	numCached := 0
+	erroring := make([]string, 0, 1)
+	for _, feedName := range feeds {
+		info, ok := infos[feedName]
+		if !ok {
+			continue
+		}
+		if info.Error != "" {
+			erroring = append(erroring, fmt.Sprintf(`<a href="/feed/%s/status"><abbr title=%q>%s</abbr></a>`, html.EscapeString(feedName), html.EscapeString(info.Error), html.EscapeString(feedName)))
+			continue
+		}
+		numCached++
+	}
+
+	fmt.Fprintf(w, `<p>%d cached, %d erroring, %d not cached yet.</p>`, numCached, len(erroring), len(feeds)-numCached-len(erroring))
+	if len(erroring) > 0 {
+		fmt.Fprintf(w, `<p>Erroring: %s</p>`, strings.Join(erroring, ", "))
+	}
+	fmt.Fprintln(w, `</section>`)
+}
+
+// RecentlyUpdatedLimit is the maximum number of feeds that are listed as
+// having new posts.
+const RecentlyUpdatedLimit = 20
+
+// writeRecentlyUpdated writes links to the feeds that have new posts since
+// `since`, most recently updated first.
+func writeRecentlyUpdated(ctx context.Context, w io.Writer, feeds []string, since time.Time) {
+	dates, err := database.NewestPostDates(ctx, cacheDB, feeds)
+	if err != nil {
+		log.Printf("Error: listing newest posts: %s", err)
+		return
+	}
+
+	updated := make([]string, 0, len(dates))
+	for feedName, date := range dates {
+		if date.After(since) {
+			updated = append(updated, feedName)
+		}
+	}
+	if len(updated) == 0 {
+		return
+	}
+
+	sort.Slice(updated, func(i, j int) bool {
+		return dates[updated[i]].After(dates[updated[j]])
+	})
+
+	links := make([]string, 0, len(updated))
+	for i, feedName := range updated {
+		if i >= RecentlyUpdatedLimit {
+			links = append(links, fmt.Sprintf("and %d more", len(updated)-RecentlyUpdatedLimit))
+			break
+		}
+		links = append(links, fmt.Sprintf(`<a href="/%s" title="newest post %s">%s</a>`, url.PathEscape(feedName), dates[feedName].Format("2006-01-02 15:04"), html.EscapeString(feedName)))
+	}
+
+	fmt.Fprintf(w, `<aside class="recently-updated"><p>New since your last visit: %s</p></aside>`, strings.Join(links, ", "))
+	fmt.Fprintln(w)
+}
+
+// highlightRE returns a regexp that matches any of the search terms, or nil
+// if there are none.
+//
+// Longer terms are matched first, so that e.g. "artist" is highlighted
+// completely when searching for "art artist".  Phrases match with any
+// whitespace between their words, e.g. line breaks.
+func highlightRE(terms []string) *regexp.Regexp {
+	if len(terms) == 0 {
+		return nil
+	}
+
+	quoted := make([]string, 0, len(terms))
+	for _, term := range terms {
+		quoted = append(quoted, strings.Join(strings.Fields(regexp.QuoteMeta(term)), `\s+`))
+	}
+	sort.SliceStable(quoted, func(i, j int) bool { return len(quoted[i]) > len(quoted[j]) })
+
+	return regexp.MustCompile(`(?i)(` + strings.Join(quoted, "|") + `)`)
+}
+
+var htmlTagRE = regexp.MustCompile(`<[^>]+>`)
+
+// writeShareLinks writes links to share the post externally, as configured
+// using `-share-targets`.
+func writeShareLinks(w io.Writer, post *feed.Post) {
+	if config.ShareTargets == "" || post.URL == "" {
+		return
+	}
+
+	title := strings.TrimSpace(html.UnescapeString(htmlTagRE.ReplaceAllString(post.Title, "")))
+	text := post.URL
+	if title != "" {
+		text = title + "\n\n" + post.URL
+	}
+
+	for _, target := range strings.Split(config.ShareTargets, ",") {
+		target = strings.TrimSpace(target)
+
+		var shareURL string
+		switch target {
+		case "email":
+			shareURL = "mailto:?subject=" + mailtoEscape(title) + "&body=" + mailtoEscape(text)
+		case "mastodon":
+			shareURL = "https://" + config.ShareMastodonInstance + "/share?text=" + url.QueryEscape(text)
+		default:
+			continue
+		}
+
+		fmt.Fprintf(w, ` <a class="share" href=%q title="share via %s">%s</a>`, shareURL, target, target)
+	}
+}
+
+// mailtoEscape escapes `s` for mailto links, with spaces as `%20` as mail
+// clients don't decode `+`.
+func mailtoEscape(s string) string {
+	return strings.ReplaceAll(url.QueryEscape(s), "+", "%20")
+}
+
 func nextPostsGroup(posts []*feed.Post, groupPostsNumber int) (group []*feed.Post, rest []*feed.Post) {
 	if len(posts) == 0 || len(posts) == 1 {
 		return posts, nil
 	}
 
-	i := 0
-	for ; i+1 < len(posts); i++ {
-		if posts[i].Author != posts[i+1].Author {
-			break
+	i := 0
+	for ; i+1 < len(posts); i++ {
+		if displayAuthor(posts[i]) != displayAuthor(posts[i+1]) {
+			break
+		}
+	}
+
+	if i+1 >= groupPostsNumber {
+		return posts[:i+1], posts[i+1:]
+	}
+
+	return []*feed.Post{posts[0]}, posts[1:]
+}
+
+// authorAlias returns the alias of the feed and all feeds with that alias, if
+// it is configured via `-author-alias`.
+func authorAlias(feedName string) (string, []string, bool) {
+	for alias, feeds := range config.AuthorAliases {
+		for _, aliasFeed := range feeds {
+			if aliasFeed == feedName {
+				return alias, feeds, true
+			}
+		}
+	}
+	return "", nil, false
+}
+
+// displayAuthor returns the name the author of the post is shown as, which is
+// their alias if they have one.
+func displayAuthor(post *feed.Post) string {
+	if alias, _, ok := authorAlias(post.Author); ok {
+		return alias
+	}
+	return post.Author
+}
+
+func tumblrToInternal(link string) string {
+	u, err := url.Parse(link)
+	if err != nil {
+		log.Printf("could not parse url: %s", err)
+		return link
+	}
+
+	if u.Path == "/redirect" {
+		redirect := u.Query().Get("z")
+		if redirect == "" {
+			log.Printf("invalid redirect: %q", link)
+			return link
+		}
+
+		return redirect
+	}
+
+	tumblrName := u.Host[:strings.Index(u.Host, ".")]
+	if tumblrName == "www" { // new non-subdmain based urls :(
+		return u.Path
+	}
+	u.Host = ""
+	u.Scheme = ""
+	u.Path = path.Join("/", tumblrName, u.Path)
+	return u.String()
+}
+
+type Settings struct {
+	// SelectedFeeds are the feeds that are explicitely selected, e.g. on
+	// the index page, by specifying feeds in the url, or by being on a
+	// list page.
+	SelectedFeeds []string
+
+	// Searches are feed-specific searches that apply additional filters to
+	// specific feeds, e.g. when you want to filter out or filter on things
+	// from those feeds.
+	Searches map[string]feed.Search
+
+	// GlobalSearch is a persistent search that applies to all feeds.
+	GlobalSearch feed.Search
+}
+
+// LastVisitFromRequest returns when the index was last visited, or the zero
+// time if it has not been visited before.
+func LastVisitFromRequest(req *http.Request) time.Time {
+	cookie, err := req.Cookie(CookieName + "-lastvisit")
+	if err != nil {
+		return time.Time{}
+	}
+
+	secs, err := strconv.ParseInt(cookie.Value, 10, 64)
+	if err != nil {
+		log.Printf("invalid lastvisit cookie %q: %s", cookie.Value, err)
+		return time.Time{}
+	}
+
+	return time.Unix(secs, 0)
+}
+
+// SnoozedFromRequest returns the feeds that are currently snoozed, and until
+// when they are snoozed.
+func SnoozedFromRequest(req *http.Request) map[string]time.Time {
+	snoozed := make(map[string]time.Time)
+
+	cookie, err := req.Cookie(CookieName + "-snooze")
+	if err != nil {
+		return snoozed
+	}
+
+	values, err := url.ParseQuery(cookie.Value)
+	if err != nil {
+		log.Printf("invalid snooze cookie %q: %s", cookie.Value, err)
+		return snoozed
+	}
+
+	now := time.Now()
+	for feedName := range values {
+		secs, err := strconv.ParseInt(values.Get(feedName), 10, 64)
+		if err != nil {
+			continue
+		}
+		until := time.Unix(secs, 0)
+		if until.After(now) {
+			snoozed[feedName] = until
+		}
+	}
+
+	return snoozed
+}
+
+// ReadUpToFromRequest returns the newest post that was marked as read for
+// each feed, older posts are not shown when viewing multiple feeds.
+func ReadUpToFromRequest(req *http.Request) map[string]*feed.Post {
+	readUpTo := make(map[string]*feed.Post)
+
+	cookie, err := req.Cookie(CookieName + "-read")
+	if err != nil {
+		return readUpTo
+	}
+
+	values, err := url.ParseQuery(cookie.Value)
+	if err != nil {
+		log.Printf("invalid read cookie %q: %s", cookie.Value, err)
+		return readUpTo
+	}
+
+	for feedName := range values {
+		parts := strings.SplitN(values.Get(feedName), ":", 3)
+		if len(parts) != 3 {
+			continue
+		}
+		nanos, err := strconv.ParseInt(parts[0], 10, 64)
+		if err != nil {
+			continue
+		}
+		readUpTo[feedName] = &feed.Post{Source: parts[1], ID: parts[2], Date: time.Unix(0, nanos)}
+	}
+
+	return readUpTo
+}
+
+func readForm(feedName string, post *feed.Post, label string, redirect string) string {
+	id, date, source := "", "", ""
+	if post != nil {
+		id, date, source = post.ID, post.Date.Format(time.RFC3339Nano), post.Source
+	}
+	return fmt.Sprintf(`<form class="read" method="POST" action="/read"><input type="hidden" name="feed" value="%s" /><input type="hidden" name="id" value="%s" /><input type="hidden" name="date" value="%s" /><input type="hidden" name="source" value="%s" /><input type="hidden" name="redirect" value="%s" /><input type="submit" value="%s" /></form>`, html.EscapeString(feedName), html.EscapeString(id), html.EscapeString(date), html.EscapeString(source), html.EscapeString(redirect), html.EscapeString(label))
+}
+
+func snoozeForm(feedName string, duration string, label string, redirect string) string {
+	return fmt.Sprintf(`<form class="snooze" method="POST" action="/snooze"><input type="hidden" name="feed" value="%s" /><input type="hidden" name="duration" value="%s" /><input type="hidden" name="redirect" value="%s" /><input type="submit" value="%s" /></form>`, html.EscapeString(feedName), html.EscapeString(duration), html.EscapeString(redirect), html.EscapeString(label))
+}
+
+// Display are the reading preferences, which are stored in a separate cookie
+// so that they apply to all feeds and lists.
+type Display struct {
+	// Width is the maximum width of the content, one of readingWidths.
+	Width string
+	// Font is the font family used for posts, one of readingFonts.
+	Font string
+	// Collapse is the height tall images are collapsed to until they are
+	// clicked, one of collapseHeights.
+	Collapse string
+	// Delay hides posts that are newer than it, e.g. `15m`.  If it is
+	// empty, the `-delay` is used.
+	Delay string
+	// Details is whether the performance details are shown below the
+	// posts, "show" or "hide".
+	Details string
+}
+
+var DefaultDisplay = Display{Width: "medium", Font: "sans", Collapse: "medium", Details: "show"}
+
+// TallImageRatio is the ratio of height to width above which an image is
+// considered tall and will be collapsed.
+const TallImageRatio = 2.5
+
+var readingWidths = map[string]string{
+	"narrow": "40em",
+	"medium": "60em",
+	"wide":   "80em",
+}
+
+var readingFonts = map[string]string{
+	"sans":  "sans-serif",
+	"serif": "serif",
+	"mono":  "monospace",
+}
+
+var collapseHeights = map[string]string{
+	"off":    "none",
+	"short":  "40vh",
+	"medium": "80vh",
+	"long":   "150vh",
+}
+
+func DisplayFromRequest(req *http.Request) Display {
+	display := DefaultDisplay
+
+	cookie, err := req.Cookie(CookieName + "-display")
+	if err != nil {
+		return display
+	}
+
+	values, err := url.ParseQuery(cookie.Value)
+	if err != nil {
+		log.Printf("invalid display cookie %q: %s", cookie.Value, err)
+		return display
+	}
+
+	if _, ok := readingWidths[values.Get("width")]; ok {
+		display.Width = values.Get("width")
+	}
+	if _, ok := readingFonts[values.Get("font")]; ok {
+		display.Font = values.Get("font")
+	}
+	if _, ok := collapseHeights[values.Get("collapse")]; ok {
+		display.Collapse = values.Get("collapse")
+	}
+	if delay, err := time.ParseDuration(values.Get("delay")); err == nil && delay >= 0 {
+		display.Delay = values.Get("delay")
+	}
+	if details := values.Get("details"); details == "show" || details == "hide" {
+		display.Details = details
+	}
+
+	return display
+}
+
+// DelayFromRequest returns how old posts have to be to be shown, from the
+// `delay` parameter, the display settings or the `-delay` flag.
+func DelayFromRequest(req *http.Request) time.Duration {
+	for _, raw := range []string{req.URL.Query().Get("delay"), DisplayFromRequest(req).Delay} {
+		if raw == "" {
+			continue
+		}
+
+		delay, err := time.ParseDuration(raw)
+		if err != nil || delay < 0 {
+			log.Printf("invalid delay %q: %v", raw, err)
+			continue
 		}
+		return delay
 	}
 
-	if i+1 >= groupPostsNumber {
-		return posts[:i+1], posts[i+1:]
-	}
+	return config.Delay
+}
 
-	return []*feed.Post{posts[0]}, posts[1:]
+// SafeModeFromRequest returns true if safe mode is enabled, in which images
+// in posts are blurred until they are hovered or focused.
+func SafeModeFromRequest(req *http.Request) bool {
+	cookie, err := req.Cookie(CookieName + "-safe")
+	return err == nil && cookie.Value == "on"
 }
 
-func tumblrToInternal(link string) string {
-	u, err := url.Parse(link)
-	if err != nil {
-		log.Printf("could not parse url: %s", err)
-		return link
-	}
+func SettingsFromRequest(req *http.Request) Settings {
+	settings := settingsFromFeeds(getFeeds(req))
 
-	if u.Path == "/redirect" {
-		redirect := u.Query().Get("z")
-		if redirect == "" {
-			log.Printf("invalid redirect: %q", link)
-			return link
+	if list := chi.URLParam(req, "list"); list != "" {
+		rawSearch := ListSearchFromRequest(req, list)
+		if rawSearch != "" {
+			settings.GlobalSearch = settings.GlobalSearch.With(feed.ParseTerms(rawSearch))
 		}
-
-		return redirect
 	}
 
-	tumblrName := u.Host[:strings.Index(u.Host, ".")]
-	if tumblrName == "www" { // new non-subdmain based urls :(
-		return u.Path
-	}
-	u.Host = ""
-	u.Scheme = ""
-	u.Path = path.Join("/", tumblrName, u.Path)
-	return u.String()
+	return settings
 }
 
-type Settings struct {
-	// SelectedFeeds are the feeds that are explicitely selected, e.g. on
-	// the index page, by specifying feeds in the url, or by being on a
-	// list page.
-	SelectedFeeds []string
-
-	// Searches are feed-specific searches that apply additional filters to
-	// specific feeds, e.g. when you want to filter out or filter on things
-	// from those feeds.
-	Searches map[string]feed.Search
+// splitFeedSearch splits the feed into its name and search, e.g.
+// `staff noreblogs`.
+func splitFeedSearch(feedName string) (name string, search string) {
+	splitAt := 0
+	// if @xyz in feedName, split after occurence of first @
+	atIdx := strings.Index(feedName, "@")
+	if atIdx != -1 {
+		splitAt = atIdx
+	}
 
-	// GlobalSearch is a persistent search that applies to all feeds.
-	GlobalSearch feed.Search
+	spaceIdx := strings.Index(feedName[splitAt:], " ")
+	if spaceIdx == -1 {
+		return feedName, ""
+	}
+	return feedName[:splitAt+spaceIdx], feedName[splitAt+spaceIdx+1:]
 }
 
-func SettingsFromRequest(req *http.Request) Settings {
+// settingsFromFeeds returns the settings for the feeds, which may have a
+// search after their name, e.g. `staff noreblogs`.
+func settingsFromFeeds(feeds []string) Settings {
 	settings := Settings{}
-
-	feeds := getFeeds(req)
 	settings.SelectedFeeds = make([]string, 0, len(feeds))
 	settings.Searches = make(map[string]feed.Search)
 
 	for _, feedName := range feeds {
-		splitAt := 0
-		// if @xyz in feedName, split after occurence of first @
-		atIdx := strings.Index(feedName, "@")
-		if atIdx != -1 {
-			splitAt = atIdx
-		}
-
-		spaceIdx := strings.Index(feedName[splitAt:], " ")
-		var name string
-		var search string
-		if spaceIdx == -1 {
-			name = feedName
-			search = ""
-		} else {
-			name = feedName[:splitAt+spaceIdx]
-			search = feedName[splitAt+spaceIdx+1:]
-		}
+		name, search := splitFeedSearch(feedName)
 		if search != "" {
 			s := feed.ParseTerms(search)
 
@@ -1278,6 +3022,22 @@ func SettingsFromRequest(req *http.Request) Settings {
 	return settings
 }
 
+// ListSearchFromRequest returns the default search of the list, which
+// applies to all posts in it like the `*` search.
+func ListSearchFromRequest(req *http.Request, list string) string {
+	cookie, err := req.Cookie(CookieName + "-list-" + list + "-search")
+	if err != nil {
+		return ""
+	}
+
+	rawSearch, err := url.QueryUnescape(cookie.Value)
+	if err != nil {
+		log.Printf("invalid list search cookie %q: %s", cookie.Value, err)
+		return ""
+	}
+	return rawSearch
+}
+
 func getFeeds(req *http.Request) []string {
 	isList := strings.HasPrefix(req.URL.Path, "/list/")
 
@@ -1286,9 +3046,8 @@ func getFeeds(req *http.Request) []string {
 	}
 
 	// explicitely specified in url
-	feeds := req.URL.Path[1:]
-	if feeds != "" && !isList {
-		return strings.Split(feeds, ",")
+	if chi.URLParam(req, "feeds") != "" {
+		return feedsParam(req)
 	}
 
 	cookieName := CookieName
@@ -1312,6 +3071,98 @@ func getFeeds(req *http.Request) []string {
 	return strings.Split(config.DefaultFeed, ",")
 }
 
+// feedsPath returns the path that shows the feeds, e.g. `/staff,engineering`.
+//
+// The names are escaped so that feeds that are urls or contain commas can be
+// shared this way as well, see parseFeedsPath.
+func feedsPath(feeds []string) string {
+	escaped := make([]string, len(feeds))
+	for i, feedName := range feeds {
+		escaped[i] = url.PathEscape(feedName)
+	}
+	return "/" + strings.Join(escaped, ",")
+}
+
+// parseFeedsPath returns the feeds in the escaped path `a,b,c` (without the
+// leading slash), see feedsPath.
+func parseFeedsPath(escapedPath string) []string {
+	feeds := strings.Split(escapedPath, ",")
+	for i, feedName := range feeds {
+		unescaped, err := url.PathUnescape(feedName)
+		if err != nil {
+			continue
+		}
+		feeds[i] = unescaped
+	}
+	return feeds
+}
+
+// feedsParam returns the feeds in the `{feeds}` part of the route.
+func feedsParam(req *http.Request) []string {
+	param := chi.URLParam(req, "feeds")
+	if req.URL.RawPath == "" {
+		// chi matches against the unescaped path if there is nothing to
+		// escape in it, so the names can't contain commas or slashes
+		return strings.Split(param, ",")
+	}
+	return parseFeedsPath(param)
+}
+
+// queryFeeds returns the feeds in the `feeds` query parameter, which are
+// comma-separated or repeated.
+func queryFeeds(req *http.Request) []string {
+	var feeds []string
+	for _, param := range req.URL.Query()["feeds"] {
+		for _, feedName := range strings.Split(param, ",") {
+			feedName = strings.TrimSpace(feedName)
+			if feedName != "" {
+				feeds = append(feeds, feedName)
+			}
+		}
+	}
+	return feeds
+}
+
+// nextPageURL returns the link to the posts after `lastPost`, keeping the
+// feeds, search and view of the current page.
+//
+// It is a plain link so that paging works without JavaScript.
+func nextPageURL(current *url.URL, lastPost *feed.Post, chronological bool) string {
+	nextPage := *current
+	currentQuery := current.Query()
+	query := url.Values{}
+	if chronological {
+		query.Set("from", "oldest")
+		query.Set("after", lastPost.ID)
+		query.Set("after-date", lastPost.Date.Format(time.RFC3339Nano))
+	} else {
+		query.Set("before", lastPost.ID)
+		query.Set("before-date", lastPost.Date.Format(time.RFC3339Nano))
+	}
+	for _, key := range []string{"feeds", "search", "cs", "sub", "view", "full", "limit"} {
+		if len(currentQuery[key]) > 0 && currentQuery.Get(key) != "" {
+			query[key] = currentQuery[key]
+		}
+	}
+	nextPage.RawQuery = query.Encode()
+	nextPage.Fragment = ""
+	return nextPage.String()
+}
+
+func selectHTML(name string, selected string, options ...string) string {
+	buf := new(strings.Builder)
+	fmt.Fprintf(buf, `<select id=%q name=%q>`, name, name)
+	for _, option := range options {
+		if option == selected {
+			fmt.Fprintf(buf, `<option selected>%s</option>`, option)
+		} else {
+			fmt.Fprintf(buf, `<option>%s</option>`, option)
+		}
+	}
+	fmt.Fprint(buf, `</select>`)
+	return buf.String()
+}
+
 func prettyDuration(dur time.Duration) string {
 	switch {
 	case dur < 24*time.Hour:
@@ -1337,9 +3188,310 @@ func prettyDuration(dur time.Duration) string {
 	}
 }
 
+// roundupHTML renders only the links and media of the post, as a compact list.
+func roundupHTML(postHTML string) string {
+	links, media := feed.ExtractLinks(postHTML)
+	if len(links) == 0 && len(media) == 0 {
+		return `<p class="roundup">no links or media</p>`
+	}
+
+	buf := new(bytes.Buffer)
+	if len(media) > 0 {
+		fmt.Fprint(buf, `<p class="roundup-media">`)
+		for _, m := range media {
+			if m.Type == "img" {
+				fmt.Fprintf(buf, `<a href="%s"><img class="thumbnail" src="%s" loading="lazy" alt="" /></a> `, html.EscapeString(m.URL), html.EscapeString(m.URL))
+			} else {
+				fmt.Fprintf(buf, `<a href="%s">%s</a> `, html.EscapeString(m.URL), m.Type)
+			}
+		}
+		fmt.Fprintln(buf, `</p>`)
+	}
+	if len(links) > 0 {
+		fmt.Fprint(buf, `<ul class="roundup">`)
+		for _, link := range links {
+			host := ""
+			if u, err := url.Parse(link.URL); err == nil {
+				host = u.Hostname()
+			}
+			fmt.Fprintf(buf, `<li><a href="%s">%s</a>`, html.EscapeString(link.URL), html.EscapeString(link.Text))
+			if host != "" {
+				fmt.Fprintf(buf, ` <small>(%s)</small>`, html.EscapeString(host))
+			}
+			fmt.Fprint(buf, `</li>`)
+		}
+		fmt.Fprintln(buf, `</ul>`)
+	}
+	return buf.String()
+}
+
+// openChronological opens the cached posts of the feed, oldest first and
+// starting after the `after` (and `after-date`) cursor in the query.
+func openChronological(ctx context.Context, feedName string, query url.Values, limit int) (feed.Feed, error) {
+	var afterDate time.Time
+	if query.Get("after-date") != "" {
+		var err error
+		afterDate, err = time.Parse(time.RFC3339Nano, query.Get("after-date"))
+		if err != nil {
+			return nil, fmt.Errorf("invalid after-date %q: %w", query.Get("after-date"), err)
+		}
+	}
+
+	posts, err := database.ListPostsChronologically(ctx, cacheDB, feedName, query.Get("after"), afterDate, limit)
+	if err != nil {
+		return nil, fmt.Errorf("list oldest posts: %w", err)
+	}
+
+	static := &feed.Static{FeedName: feedName, Posts: make([]feed.Post, 0, len(posts))}
+	for _, post := range posts {
+		static.Posts = append(static.Posts, *post)
+	}
+	return static, nil
+}
+
+// errUnknownFeed is returned by missingFeed for feeds that don't exist.
+var errUnknownFeed = errors.New("unknown feed")
+
+// missingFeed returns errUnknownFeed if the single selected feed does not
+// exist, feed.ErrPrivate if it is private and nil otherwise.
+//
+// Private feeds with cached posts show those instead, marked as
+// `numblr:private`.
+func missingFeed(settings Settings, feeds []feed.Feed, err error) error {
+	if len(settings.SelectedFeeds) != 1 || feeds[0] != nil {
+		return nil
+	}
+
+	if errors.Is(err, feed.ErrPrivate) {
+		return feed.ErrPrivate
+	}
+
+	var statusErr feed.StatusError
+	if errors.As(err, &statusErr) && statusErr.Code == http.StatusNotFound {
+		return errUnknownFeed
+	}
+	return nil
+}
+
+// HandleUnknownFeed renders a not found page for a feed that does not exist,
+// with suggestions for similarly named feeds in case of a typo.
+func HandleUnknownFeed(w http.ResponseWriter, req *http.Request, feedName string) {
+	w.Header().Set("Content-Type", `text/html; charset="utf-8"`)
+	w.WriteHeader(http.StatusNotFound)
+	htmlPrelude(w, req, "feed not found", fmt.Sprintf("Could not find feed %s", html.EscapeString(feedName)), "/favicon.png")
+
+	fmt.Fprintf(w, `<header><h1>couldn't find feed %s</h1></header>`, html.EscapeString(feedName))
+	fmt.Fprintln(w)
+
+	writeUnknownFeed(w, req, feedName)
+}
+
+// writeUnknownFeed suggests feeds with similar names to `feedName` and ends
+// the page.
+func writeUnknownFeed(w io.Writer, req *http.Request, feedName string) {
+	suggestions, err := database.SuggestFeeds(req.Context(), cacheDB, feedName)
+	if err != nil {
+		log.Printf("Error: suggesting feeds for %q: %s", feedName, err)
+	}
+
+	if len(suggestions) > 0 {
+		fmt.Fprintln(w, `<p>Did you mean...</p><ul>`)
+		for _, suggestion := range suggestions {
+			fmt.Fprintf(w, `<li><a href="/%s">%s</a></li>`, url.PathEscape(suggestion), html.EscapeString(suggestion))
+			fmt.Fprintln(w)
+		}
+		fmt.Fprintln(w, `</ul>`)
+	}
+
+	fmt.Fprintln(w, `<p>Or go back to <a href="/">everything</a>.</p>`)
+
+	fmt.Fprintln(w, `</div>
+
+</body>
+</html>`)
+}
+
+// HandlePrivateFeed renders a page for a feed that exists, but can only be
+// seen when logged in.
+func HandlePrivateFeed(w http.ResponseWriter, req *http.Request, feedName string) {
+	w.Header().Set("Content-Type", `text/html; charset="utf-8"`)
+	w.WriteHeader(http.StatusForbidden)
+	htmlPrelude(w, req, "feed is private", fmt.Sprintf("Feed %s is private", html.EscapeString(feedName)), "/favicon.png")
+
+	fmt.Fprintf(w, `<header><h1>feed %s is private</h1></header>`, html.EscapeString(feedName))
+	fmt.Fprintln(w)
+
+	writePrivateFeed(w)
+}
+
+// writePrivateFeed explains that private feeds can't be shown and ends the
+// page.
+func writePrivateFeed(w io.Writer) {
+	fmt.Fprintln(w, `<p>It can only be seen when logged in, which would need an account or an API key.  That is not supported yet.</p>`)
+	fmt.Fprintln(w, `<p>Go back to <a href="/">everything</a>.</p>`)
+
+	fmt.Fprintln(w, `</div>
+
+</body>
+</html>`)
+}
+
+// HandleClearSettings removes the saved feeds, or those of the `list` and
+// its search, so that the default feeds are shown again.
+func HandleClearSettings(w http.ResponseWriter, req *http.Request) {
+	list := req.FormValue("list")
+
+	redirect := "/"
+	cookieNames := []string{CookieName}
+	if list != "" {
+		redirect = "/list/" + list
+		cookieNames = []string{CookieName + "-list-" + list, CookieName + "-list-" + list + "-search"}
+	}
+
+	// the attributes have to be the same as when the cookies were saved,
+	// otherwise browsers keep them
+	for _, cookieName := range cookieNames {
+		http.SetCookie(w, &http.Cookie{
+			Name:     cookieName,
+			Value:    "",
+			Path:     "/",
+			MaxAge:   -1,
+			SameSite: http.SameSiteLaxMode,
+			HttpOnly: true,
+		})
+	}
+	http.Redirect(w, req, redirect, http.StatusSeeOther)
+}
+
+// HandleExport writes all cached posts of a feed as newline-delimited JSON.
+func HandleExport(w http.ResponseWriter, req *http.Request) {
+	feedName := strings.Join(feedsParam(req), ",")
+
+	w.Header().Set("Content-Type", "application/x-ndjson")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", feedName+".ndjson"))
+
+	err := database.StreamPosts(req.Context(), cacheDB, feedName, w)
+	if err != nil {
+		log.Printf("Error: exporting %q: %s", feedName, err)
+	}
+}
+
+var firstImageRE = regexp.MustCompile(`<img [^>]*src="([^"]+)"`)
+
+// HandleDigest renders a compact list of the cached posts of the feeds since
+// the `since` date, or of the last week if it is not given.
+func HandleDigest(w http.ResponseWriter, req *http.Request) {
+	feeds := feedsParam(req)
+
+	since := time.Now().Add(-7 * 24 * time.Hour)
+	sinceParam := req.URL.Query().Get("since")
+	if sinceParam != "" {
+		var err error
+		since, err = time.Parse("2006-01-02", sinceParam)
+		if err != nil {
+			since, err = time.Parse(time.RFC3339, sinceParam)
+		}
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Error: invalid since date %q, expected e.g. 2006-01-02", sinceParam), http.StatusBadRequest)
+			return
+		}
+	}
+
+	posts, err := database.ListPostsSince(req.Context(), cacheDB, feeds, since, 200)
+	if err != nil {
+		log.Printf("Error: digest for %q: %s", feeds, err)
+		http.Error(w, fmt.Sprintf("Error: could not list posts: %s", err), http.StatusInternalServerError)
+		return
+	}
+
+	title := strings.Join(feeds, ",")
+	htmlPrelude(w, req, html.EscapeString("digest of "+title), html.EscapeString(fmt.Sprintf("Posts of %s since %s", title, since.Format("2006-01-02"))), "/favicon.png")
+
+	fmt.Fprintf(w, `<header><h1>digest of <a href="%s">%s</a></h1><h2>%d posts since %s</h2></header>`, html.EscapeString(absoluteURL(req, feedsPath(feeds))), html.EscapeString(title), len(posts), since.Format("2006-01-02"))
+	fmt.Fprintln(w, `<ul class="digest">`)
+	for _, post := range posts {
+		text := postSummary(post)
+
+		fmt.Fprint(w, `<li>`)
+		parts := firstImageRE.FindStringSubmatch(post.DescriptionHTML)
+		if len(parts) == 2 {
+			thumbnailURL := html.UnescapeString(parts[1])
+			if config.ProxyImages {
+				thumbnailURL = proxyImageURL(thumbnailURL)
+			}
+			fmt.Fprintf(w, `<img class="thumbnail" src="%s" loading="lazy" alt="" /> `, html.EscapeString(thumbnailURL))
+		}
+		fmt.Fprintf(w, `<a class="author" href="%s">%s</a>: <a href="%s">%s</a> <time datetime=%q>%s</time></li>
+`, html.EscapeString(absoluteURL(req, "/"+url.PathEscape(post.Author))), html.EscapeString(displayAuthor(post)), html.EscapeString(post.URL), html.EscapeString(text), post.Date.Format(time.RFC3339), post.Date.Format("2006-01-02 15:04"))
+	}
+	fmt.Fprintln(w, `</ul>`)
+}
+
+// postSummary returns the beginning of the text of the post, from its title
+// or its content if it has no title.
+func postSummary(post *feed.Post) string {
+	text := strings.TrimSpace(html.UnescapeString(htmlTagRE.ReplaceAllString(post.Title, "")))
+	if text == "" || text == "Photo" {
+		text = strings.TrimSpace(html.UnescapeString(htmlTagRE.ReplaceAllString(post.DescriptionHTML, "")))
+	}
+	if len([]rune(text)) > 140 {
+		text = string([]rune(text)[:140]) + "…"
+	}
+	if text == "" {
+		text = "(no text)"
+	}
+	return text
+}
+
+// HandleRandom redirects to a random cached post on numblr, see postPath.
+func HandleRandom(w http.ResponseWriter, req *http.Request) {
+	post, err := database.RandomPost(req.Context(), cacheDB)
+	if err != nil {
+		log.Printf("Error: picking random post: %s", err)
+		http.Error(w, fmt.Sprintf("Error: could not pick a post: %s", err), http.StatusInternalServerError)
+		return
+	}
+	if post == nil {
+		http.Error(w, "Error: no posts cached yet", http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Cache-Control", "no-store")
+	http.Redirect(w, req, postPath(post), http.StatusFound)
+}
+
+// postPath returns the path of the post on numblr, see HandlePost.
+func postPath(post *feed.Post) string {
+	if post.Source == "tumblr" {
+		return tumblrToInternal(post.URL)
+	}
+	return "/" + url.PathEscape(post.Author) + "/post/" + url.PathEscape(post.ID)
+}
+
+// HandlePost shows a single post, Tumblr posts are fetched from Tumblr and
+// posts from other sources are shown from the cache.
 func HandlePost(w http.ResponseWriter, req *http.Request) {
 	tumblr := chi.URLParam(req, "tumblr")
 	postID := chi.URLParam(req, "postId")
+	if anything.Source(tumblr) != "tumblr" {
+		// like feedsParam, chi only matches against the escaped path if
+		// it has to
+		author := tumblr
+		if req.URL.RawPath != "" {
+			var err error
+			author, err = url.PathUnescape(tumblr)
+			if err == nil {
+				postID, err = url.PathUnescape(postID)
+			}
+			if err != nil {
+				http.Error(w, fmt.Sprintf("Error: invalid post: %s", err), http.StatusBadRequest)
+				return
+			}
+		}
+		HandleCachedPost(w, req, author, postID)
+		return
+	}
+
 	slug := chi.URLParam(req, "slug")
 	if slug != "" {
 		slug = "/" + slug
@@ -1366,6 +3518,8 @@ func HandlePost(w http.ResponseWriter, req *http.Request) {
 		return
 	}
 
+	post := &feed.Post{Source: "tumblr", ID: postID, Author: tumblr, URL: tumblrURL, NoteCount: noteCount(node)}
+
 	var cleanup func(*html.Node)
 	cleanup = func(node *html.Node) {
 		for child := node.FirstChild; child != nil; child = child.NextSibling {
@@ -1520,12 +3674,66 @@ func HandlePost(w http.ResponseWriter, req *http.Request) {
 	}
 	f(node)
 
+	if post.NoteCount > 0 {
+		fmt.Fprintf(w, `<p class="notes">%s</p>
+`, notesText(post.NoteCount))
+	}
+
 	fmt.Fprintf(w, `<hr />
 <p><a href=%q>View on Tumblr</a></p>
 <p><a href=%q>View on archive.org</a></p>
 `, tumblrURL, fmt.Sprintf("https://web.archive.org/web/%s/%s", time.Now().Format("20060102"), tumblrURL))
 }
 
+// HandleCachedPost shows the cached post `postID` of the feed `author`.
+func HandleCachedPost(w http.ResponseWriter, req *http.Request, author string, postID string) {
+	post, err := database.CachedPost(req.Context(), cacheDB, author, postID)
+	if err != nil {
+		log.Printf("Error: looking up post %q of %q: %s", postID, author, err)
+		http.Error(w, fmt.Sprintf("Error: could not look up post: %s", err), http.StatusInternalServerError)
+		return
+	}
+	if post == nil {
+		http.Error(w, fmt.Sprintf("Error: post %q of %q is not cached", postID, author), http.StatusNotFound)
+		return
+	}
+
+	htmlPrelude(w, req, html.EscapeString(displayAuthor(post)+" - "+postSummary(post)), html.EscapeString(postSummary(post)), "/avatar/"+url.PathEscape(post.Author))
+
+	fmt.Fprintf(w, `<header><h1><img class="avatar" src=%q alt="" /> <a href=%q>%s</a></h1></header>
+`, "/avatar/"+url.PathEscape(post.Author), "/"+url.PathEscape(post.Author), html.EscapeString(displayAuthor(post)))
+
+	postHTML := post.DescriptionHTML
+	if config.StripEmojiShortcodes {
+		postHTML = feed.StripEmoji(postHTML)
+	}
+	postHTML = strings.ReplaceAll(postHTML, `<video `, `<video preload="metadata" controls="" `)
+	postHTML = strings.ReplaceAll(postHTML, ` autoplay="autoplay"`, ``)
+	if config.ProxyImages {
+		postHTML = feed.RewriteMediaURLs(postHTML, proxyImageURL)
+	}
+
+	fmt.Fprintf(w, `<article class=%q><section>%s%s</section>
+`, post.Source, post.Title, postHTML)
+
+	fmt.Fprint(w, "<footer>")
+	if len(post.Tags) > 0 {
+		fmt.Fprint(w, `<ul class="tags">`)
+		for _, tag := range post.Tags {
+			fmt.Fprintf(w, `<li><a href=%q>#%s</a></li> `, "/"+post.Author+"/tagged/"+tag, html.EscapeString(tag))
+		}
+		fmt.Fprintln(w, `</ul>`)
+	}
+	fmt.Fprintf(w, `<time title="%s" datetime="%s">%s ago</time> `, post.Date, post.DateString, prettyDuration(time.Since(post.Date)))
+	fmt.Fprintf(w, `by <a href=%q>%s</a>`, "/"+post.Author, html.EscapeString(displayAuthor(post)))
+	if post.URL != "" {
+		fmt.Fprintf(w, `, <a class="original" href=%q title="link to the original post">original</a>`, post.URL)
+	}
+	writeShareLinks(w, post)
+	fmt.Fprint(w, "</footer>")
+	fmt.Fprintln(w, "</article>")
+}
+
 func fetchPhotoset(ctx context.Context, tumblr string, photosetPath string) ([]*html.Node, error) {
 	u, err := url.Parse(photosetPath)
 	if err != nil {
@@ -1631,6 +3839,87 @@ func fetchVideo(ctx context.Context, tumblr string, postPath string, videoPath s
 	return nodes, nil
 }
 
+// noteCountRE matches the notes of Tumblr posts as themes show them, e.g.
+// `1,234 notes` or `1.2k notes`.
+var noteCountRE = regexp.MustCompile(`^\s*([0-9][0-9.,]*)\s*([kKmM]?)\s+notes?\s*$`)
+
+// noteCount returns the number of notes on the Tumblr post page `node`, or 0
+// if the theme does not show them.
+func noteCount(node *html.Node) int {
+	if node.Type == html.TextNode {
+		return parseNoteCount(node.Data)
+	}
+
+	// e.g. `<a class="notes"><span>12</span> notes</a>`
+	if node.Type == html.ElementNode {
+		for _, attr := range node.Attr {
+			if attr.Key == "class" && strings.Contains(attr.Val, "note") {
+				if count := parseNoteCount(nodeText(node)); count > 0 {
+					return count
+				}
+			}
+		}
+	}
+
+	for child := node.FirstChild; child != nil; child = child.NextSibling {
+		if count := noteCount(child); count > 0 {
+			return count
+		}
+	}
+	return 0
+}
+
+func parseNoteCount(text string) int {
+	match := noteCountRE.FindStringSubmatch(text)
+	if match == nil {
+		return 0
+	}
+
+	number := strings.ReplaceAll(match[1], ",", "")
+	switch strings.ToLower(match[2]) {
+	case "k":
+		count, err := strconv.ParseFloat(number, 64)
+		if err != nil {
+			return 0
+		}
+		return int(count * 1000)
+	case "m":
+		count, err := strconv.ParseFloat(number, 64)
+		if err != nil {
+			return 0
+		}
+		return int(count * 1000 * 1000)
+	}
+
+	// without a suffix dots separate thousands as well
+	count, err := strconv.Atoi(strings.ReplaceAll(number, ".", ""))
+	if err != nil {
+		return 0
+	}
+	return count
+}
+
+// nodeText returns the text of `node` and all its children.
+func nodeText(node *html.Node) string {
+	if node.Type == html.TextNode {
+		return node.Data
+	}
+
+	var sb strings.Builder
+	for child := node.FirstChild; child != nil; child = child.NextSibling {
+		sb.WriteString(nodeText(child))
+	}
+	return sb.String()
+}
+
+// notesText returns `1 note` or `N notes`.
+func notesText(count int) string {
+	if count == 1 {
+		return "1 note"
+	}
+	return fmt.Sprintf("%d notes", count)
+}
+
 func hasAttribute(node *html.Node, attrName, attrValue string) bool {
 	for _, attr := range node.Attr {
 		if attr.Key == attrName && attr.Val == attrValue {
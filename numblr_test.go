@@ -1,10 +1,28 @@
 package main
 
 import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/cookiejar"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path"
+	"strconv"
+	"strings"
 	"testing"
+	"time"
 
+	"github.com/go-chi/chi/v5"
+	lru "github.com/hashicorp/golang-lru"
 	"github.com/heyLu/numblr/feed"
+	"github.com/heyLu/numblr/feed/database"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/net/html"
 )
 
 func TestNextPostsGroup(t *testing.T) {
@@ -35,3 +53,723 @@ func TestNextPostsGroup(t *testing.T) {
 		})
 	}
 }
+
+func TestAbsoluteURL(t *testing.T) {
+	req := httptest.NewRequest("GET", "http://numblr.local:5555/staff", nil)
+	assert.Equal(t, "http://numblr.local:5555/staff/digest", absoluteURL(req, "/staff/digest"), "from request")
+
+	req.Header.Set("X-Forwarded-Proto", "https")
+	assert.Equal(t, "https://numblr.local:5555/staff/digest", absoluteURL(req, "/staff/digest"), "behind proxy")
+
+	config.BaseURL = "https://numblr.example"
+	defer func() {
+		config.BaseURL = ""
+	}()
+	assert.Equal(t, "https://numblr.example/staff/digest", absoluteURL(req, "/staff/digest"), "base url")
+}
+
+func TestNextPageURL(t *testing.T) {
+	lastPost := &feed.Post{ID: "123", Date: time.Date(2022, time.June, 1, 12, 0, 0, 0, time.UTC)}
+
+	current, _ := url.Parse("/staff?search=%23art&view=links&before=456#bottom")
+	next, err := url.Parse(nextPageURL(current, lastPost, false))
+	assert.NoError(t, err)
+	assert.Equal(t, "/staff", next.Path, "path")
+	assert.Equal(t, "", next.Fragment, "fragment")
+	assert.Equal(t, url.Values{"before": {"123"}, "before-date": {"2022-06-01T12:00:00Z"}, "search": {"#art"}, "view": {"links"}}, next.Query(), "query")
+
+	current, _ = url.Parse("/?feeds=staff&feeds=a/b")
+	next, err = url.Parse(nextPageURL(current, lastPost, false))
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"staff", "a/b"}, next.Query()["feeds"], "feeds in query")
+
+	current, _ = url.Parse("/astolat@ao3?full=1")
+	next, err = url.Parse(nextPageURL(current, lastPost, false))
+	assert.NoError(t, err)
+	assert.Equal(t, "1", next.Query().Get("full"), "full text")
+
+	current, _ = url.Parse("/staff?from=oldest")
+	next, err = url.Parse(nextPageURL(current, lastPost, true))
+	assert.NoError(t, err)
+	assert.Equal(t, url.Values{"from": {"oldest"}, "after": {"123"}, "after-date": {"2022-06-01T12:00:00Z"}}, next.Query(), "chronological")
+}
+
+func TestFeedsPath(t *testing.T) {
+	feeds := []string{"staff", "https://example.com/feed?a=1&b=2", "a,b", "nasa@youtube"}
+	path := feedsPath(feeds)
+	assert.Equal(t, "/staff,https:%2F%2Fexample.com%2Ffeed%3Fa=1&b=2,a%2Cb,nasa@youtube", path)
+
+	var selected []string
+	router := chi.NewRouter()
+	router.Get("/{feeds}", func(w http.ResponseWriter, req *http.Request) {
+		selected = SettingsFromRequest(req).SelectedFeeds
+	})
+	router.Get("/{feeds}/digest", func(w http.ResponseWriter, req *http.Request) {
+		selected = feedsParam(req)
+	})
+	selectedFeeds := func(path string) []string {
+		selected = nil
+		router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", path, nil))
+		return selected
+	}
+
+	assert.Equal(t, feeds, selectedFeeds(path), "round trip")
+	assert.Equal(t, []string{"a", "https://example.com/feed&more"}, selectedFeeds("/a,https%3A%2F%2Fexample.com%2Ffeed%26more"), "fully escaped")
+	assert.Equal(t, []string{"staff", "engineering"}, selectedFeeds("/staff,engineering"), "plain")
+	assert.Equal(t, feeds, selectedFeeds(path+"/digest"), "route param")
+	assert.Equal(t, []string{"staff", "engineering"}, selectedFeeds("/staff,engineering/digest"), "plain route param")
+}
+
+func TestWarmFeedNames(t *testing.T) {
+	feeds, err := warmFeedNames("staff,engineering", "")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"staff", "engineering"}, feeds, "default feeds")
+
+	feeds, err = warmFeedNames("staff,engineering", "staff, @nasa")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"staff", "engineering", "@nasa"}, feeds, "list")
+
+	warmFile := path.Join(t.TempDir(), "warm-feeds.txt")
+	err = os.WriteFile(warmFile, []byte("# popular feeds\n\nnasa@youtube\nstaff\n"), 0644)
+	assert.NoError(t, err)
+	feeds, err = warmFeedNames("staff", warmFile)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"staff", "nasa@youtube"}, feeds, "file")
+
+	_, err = warmFeedNames("staff", path.Join(t.TempDir(), "missing.txt"))
+	assert.Error(t, err, "missing file")
+}
+
+func TestUniqueFeeds(t *testing.T) {
+	assert.Equal(t, []string{"staff", "engineering", "nasa@youtube"}, uniqueFeeds([]string{"staff", "engineering", "staff", " nasa@youtube", "", "engineering"}))
+	assert.Equal(t, []string{}, uniqueFeeds(nil), "empty")
+}
+
+func TestNextPostsGroupAliases(t *testing.T) {
+	config.AuthorAliases = map[string][]string{"person": {"person", "person@twitter"}}
+	defer func() {
+		config.AuthorAliases = nil
+	}()
+
+	posts := []*feed.Post{{Author: "person"}, {Author: "person@twitter"}, {Author: "person"}, {Author: "other"}}
+	group, rest := nextPostsGroup(posts, 3)
+	assert.Len(t, group, 3, "group")
+	assert.Len(t, rest, 1, "rest")
+	assert.Equal(t, "person", displayAuthor(group[1]), "alias")
+	assert.Equal(t, "other", displayAuthor(rest[0]), "no alias")
+}
+
+func TestHandleAvatarFallback(t *testing.T) {
+	var err error
+	avatarCache, err = lru.New(10)
+	assert.NoError(t, err)
+
+	// fails without sending any requests
+	requests := 0
+	origTransport := http.DefaultClient.Transport
+	http.DefaultClient.Transport = roundTripFunc(func(req *http.Request) (*http.Response, error) {
+		requests++
+		return nil, fmt.Errorf("no network in tests")
+	})
+	defer func() {
+		http.DefaultClient.Transport = origTransport
+	}()
+
+	w := requestAvatar("someone@twitter")
+	assert.Equal(t, http.StatusOK, w.Code, "unsupported")
+	assert.Equal(t, "image/svg+xml", w.Header().Get("Content-Type"), "unsupported")
+	assert.Equal(t, letterAvatar("someone@twitter"), w.Body.Bytes(), "unsupported")
+	assert.Contains(t, w.Body.String(), ">S</text>", "unsupported")
+	assert.Contains(t, w.Header().Get("Cache-Control"), "max-age="+strconv.Itoa(int(AvatarCacheTime.Seconds())), "unsupported")
+	assert.Equal(t, 0, requests, "unsupported")
+
+	w = requestAvatar("staff")
+	assert.Equal(t, http.StatusOK, w.Code, "failed")
+	assert.Equal(t, letterAvatar("staff"), w.Body.Bytes(), "failed")
+	assert.Contains(t, w.Header().Get("Cache-Control"), "max-age="+strconv.Itoa(int(AvatarCacheTime.Seconds())), "failed")
+	assert.Equal(t, 1, requests, "failed")
+
+	w = requestAvatar("staff")
+	assert.Equal(t, letterAvatar("staff"), w.Body.Bytes(), "failed again")
+	assert.Equal(t, 1, requests, "missing avatars are cached")
+
+	avatarCache.Add("staff", missingAvatar{since: time.Now().Add(-AvatarFallbackCacheTime)})
+	requestAvatar("staff")
+	assert.Equal(t, 2, requests, "looked for again later")
+
+	w = requestAvatar("---")
+	assert.Equal(t, AvatarFallbackSVGBytes, w.Body.Bytes(), "no letters")
+
+	assert.Equal(t, letterAvatar("staff"), letterAvatar("staff"), "same color every time")
+	assert.NotEqual(t, letterAvatar("staff"), letterAvatar("stuff"), "different colors")
+}
+
+func TestHandleAvatarChain(t *testing.T) {
+	var err error
+	avatarCache, err = lru.New(10)
+	assert.NoError(t, err)
+
+	var requested []string
+	origTransport := http.DefaultClient.Transport
+	http.DefaultClient.Transport = roundTripFunc(func(req *http.Request) (*http.Response, error) {
+		requested = append(requested, req.URL.String())
+
+		resp := &http.Response{StatusCode: http.StatusOK, Header: http.Header{}, Body: io.NopCloser(strings.NewReader("image of " + req.URL.String())), Request: req}
+		switch req.URL.String() {
+		case "https://mastodon.example/avatar.png":
+			resp.Header.Set("Content-Type", "image/png")
+		case "https://example.org/apple-touch-icon.png":
+			// some sites answer with a page for missing files
+			resp.Header.Set("Content-Type", "text/html")
+		case "http://example.org/favicon.ico":
+			resp.Header.Set("Content-Type", "image/x-icon")
+		default:
+			resp.StatusCode = http.StatusNotFound
+		}
+		return resp, nil
+	})
+	defer func() {
+		http.DefaultClient.Transport = origTransport
+	}()
+
+	rememberAvatarURL(&feed.Post{Author: "someone@mastodon.example", AvatarURL: "https://mastodon.example/avatar.png"})
+	w := requestAvatar("someone@mastodon.example")
+	assert.Equal(t, "image/png", w.Header().Get("Content-Type"), "avatar of posts")
+	assert.Equal(t, "image of https://mastodon.example/avatar.png", w.Body.String(), "avatar of posts")
+	assert.Equal(t, "nosniff", w.Header().Get("X-Content-Type-Options"), "avatar of posts")
+	assert.Equal(t, "sandbox", w.Header().Get("Content-Security-Policy"), "avatar of posts")
+
+	w = requestAvatar("example.org")
+	assert.Equal(t, "image/x-icon", w.Header().Get("Content-Type"), "favicon")
+	assert.Equal(t, "image of http://example.org/favicon.ico", w.Body.String(), "favicon")
+	assert.Equal(t, []string{"https://mastodon.example/avatar.png", "https://example.org/apple-touch-icon.png", "http://example.org/favicon.ico"}, requested, "requested")
+
+	w = requestAvatar("example.org")
+	assert.Equal(t, "image of http://example.org/favicon.ico", w.Body.String(), "cached")
+	assert.Len(t, requested, 3, "cached")
+}
+
+func TestFetchAvatarTypes(t *testing.T) {
+	origTransport := http.DefaultClient.Transport
+	http.DefaultClient.Transport = roundTripFunc(func(req *http.Request) (*http.Response, error) {
+		resp := &http.Response{StatusCode: http.StatusOK, Header: http.Header{}, Body: io.NopCloser(strings.NewReader(`<svg xmlns="http://www.w3.org/2000/svg"><script>alert(1)</script></svg>`)), Request: req}
+		resp.Header.Set("Content-Type", req.URL.Query().Get("type"))
+		return resp, nil
+	})
+	defer func() {
+		http.DefaultClient.Transport = origTransport
+	}()
+
+	for _, contentType := range []string{"image/svg+xml", "application/xhtml+xml", "text/html", ""} {
+		_, err := fetchAvatar(context.Background(), "https://example.org/avatar?type="+url.QueryEscape(contentType))
+		assert.Error(t, err, contentType)
+	}
+
+	avatar, err := fetchAvatar(context.Background(), "https://example.org/avatar?type="+url.QueryEscape("image/png; charset=binary"))
+	require.NoError(t, err)
+	assert.Equal(t, "image/png", avatar.contentType)
+}
+
+func requestAvatar(name string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest("GET", "/avatar/"+name, nil)
+	rctx := chi.NewRouteContext()
+	rctx.URLParams.Add("tumblr", name)
+	req = req.WithContext(context.WithValue(req.Context(), chi.RouteCtxKey, rctx))
+
+	w := httptest.NewRecorder()
+	HandleAvatar(w, req)
+	return w
+}
+
+type roundTripFunc func(req *http.Request) (*http.Response, error)
+
+func (fn roundTripFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return fn(req)
+}
+
+func TestImageProxySignature(t *testing.T) {
+	origConfig, origSecret := config, imageProxySecret
+	config.ProxyImagesHosts = "media.tumblr.com"
+	imageProxySecret = []byte("secret")
+	defer func() {
+		config, imageProxySecret = origConfig, origSecret
+	}()
+
+	imageURL := "https://64.media.tumblr.com/abc/s640x960/image.jpg"
+	proxiedURL, err := url.Parse(proxyImageURL(imageURL))
+	require.NoError(t, err)
+	require.Equal(t, "/img-proxy", proxiedURL.Path)
+
+	params := proxiedURL.Query()
+	require.Equal(t, imageURL, params.Get("url"))
+	now := time.Now()
+	require.NoError(t, checkImageURL(imageURL, params.Get("expires"), params.Get("sig"), now), "signed")
+	require.NoError(t, checkImageURL(imageURL, params.Get("expires"), params.Get("sig"), now.Add(ImageProxyURLTime)), "still valid")
+	require.Error(t, checkImageURL(imageURL, params.Get("expires"), params.Get("sig"), now.Add(2*ImageProxyURLTime+time.Second)), "expired")
+	require.Error(t, checkImageURL(imageURL, "", "", now), "not signed")
+	require.Error(t, checkImageURL("https://64.media.tumblr.com/other.jpg", params.Get("expires"), params.Get("sig"), now), "other url")
+	require.Error(t, checkImageURL(imageURL, fmt.Sprint(now.Add(365*24*time.Hour).Unix()), params.Get("sig"), now), "extended expiry")
+
+	require.Equal(t, proxyImageURL(imageURL), proxyImageURL(imageURL), "stable urls for caching")
+	require.Equal(t, "https://example.org/image.jpg", proxyImageURL("https://example.org/image.jpg"), "other hosts")
+
+	// rejected without sending any requests
+	origTransport := http.DefaultClient.Transport
+	http.DefaultClient.Transport = roundTripFunc(func(req *http.Request) (*http.Response, error) {
+		return nil, fmt.Errorf("no network in tests")
+	})
+	defer func() {
+		http.DefaultClient.Transport = origTransport
+	}()
+
+	w := httptest.NewRecorder()
+	HandleImageProxy(w, httptest.NewRequest("GET", "/img-proxy?url="+url.QueryEscape(imageURL), nil))
+	require.Equal(t, http.StatusForbidden, w.Code, "unsigned")
+}
+
+func TestImageProxyTypes(t *testing.T) {
+	origConfig, origSecret, origCache := config, imageProxySecret, imageProxyCache
+	config.ProxyImagesHosts = "media.tumblr.com"
+	config.ProxyImagesMaxSize = 1024 * 1024
+	imageProxySecret = []byte("secret")
+	var err error
+	imageProxyCache, err = lru.New(10)
+	require.NoError(t, err)
+	origTransport := imageProxyClient.Transport
+	imageProxyClient.Transport = roundTripFunc(func(req *http.Request) (*http.Response, error) {
+		resp := &http.Response{StatusCode: http.StatusOK, Header: http.Header{}, Body: io.NopCloser(strings.NewReader("data")), ContentLength: 4, Request: req}
+		resp.Header.Set("Content-Type", req.URL.Query().Get("type"))
+		return resp, nil
+	})
+	defer func() {
+		config, imageProxySecret, imageProxyCache = origConfig, origSecret, origCache
+		imageProxyClient.Transport = origTransport
+	}()
+
+	proxy := func(contentType string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		HandleImageProxy(w, httptest.NewRequest("GET", proxyImageURL("https://64.media.tumblr.com/image?type="+url.QueryEscape(contentType)), nil))
+		return w
+	}
+
+	w := proxy("image/png")
+	require.Equal(t, http.StatusOK, w.Code, "png")
+	require.Equal(t, "nosniff", w.Header().Get("X-Content-Type-Options"), "png")
+	require.Equal(t, "sandbox", w.Header().Get("Content-Security-Policy"), "png")
+
+	require.Equal(t, http.StatusOK, proxy("text/vtt; charset=utf-8").Code, "subtitles")
+	require.Equal(t, http.StatusBadGateway, proxy("image/svg+xml").Code, "svg")
+	require.Equal(t, http.StatusBadGateway, proxy("text/html").Code, "html")
+}
+
+func TestListSearch(t *testing.T) {
+	req := httptest.NewRequest("GET", "/list/news", nil)
+	req.AddCookie(&http.Cookie{Name: CookieName + "-list-news", Value: "staff,engineering"})
+	req.AddCookie(&http.Cookie{Name: CookieName + "-list-news-search", Value: url.QueryEscape("noreblogs -#wip")})
+	rctx := chi.NewRouteContext()
+	rctx.URLParams.Add("list", "news")
+	req = req.WithContext(context.WithValue(req.Context(), chi.RouteCtxKey, rctx))
+
+	settings := SettingsFromRequest(req)
+	assert.Equal(t, []string{"staff", "engineering"}, settings.SelectedFeeds)
+	assert.True(t, settings.GlobalSearch.NoReblogs, "noreblogs")
+	assert.Equal(t, []string{"wip"}, settings.GlobalSearch.ExcludeTags, "excluded tags")
+
+	req = httptest.NewRequest("GET", "/staff", nil)
+	req.AddCookie(&http.Cookie{Name: CookieName + "-list-news-search", Value: "noreblogs"})
+	settings = SettingsFromRequest(req)
+	assert.False(t, settings.GlobalSearch.IsActive, "only applies to the list")
+}
+
+func TestHandleClearSettings(t *testing.T) {
+	origDefaultFeed := config.DefaultFeed
+	config.DefaultFeed = "staff"
+	defer func() {
+		config.DefaultFeed = origDefaultFeed
+	}()
+
+	jar, err := cookiejar.New(nil)
+	require.NoError(t, err)
+	numblrURL, _ := url.Parse("https://numblr.example/")
+	jar.SetCookies(numblrURL, []*http.Cookie{
+		{Name: CookieName, Value: "engineering", Path: "/", MaxAge: 3600},
+		{Name: CookieName + "-list-news", Value: "xkcd.com", Path: "/", MaxAge: 3600},
+		{Name: CookieName + "-list-news-search", Value: "noreblogs", Path: "/", MaxAge: 3600},
+	})
+
+	feedsWithJar := func(path string) []string {
+		req := httptest.NewRequest("GET", path, nil)
+		for _, cookie := range jar.Cookies(numblrURL) {
+			req.AddCookie(cookie)
+		}
+		if strings.HasPrefix(path, "/list/") {
+			rctx := chi.NewRouteContext()
+			rctx.URLParams.Add("list", strings.TrimPrefix(path, "/list/"))
+			req = req.WithContext(context.WithValue(req.Context(), chi.RouteCtxKey, rctx))
+		}
+		return getFeeds(req)
+	}
+	clearSettings := func(form url.Values) *http.Response {
+		req := httptest.NewRequest("POST", "/settings/clear", strings.NewReader(form.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		w := httptest.NewRecorder()
+		HandleClearSettings(w, req)
+		return w.Result()
+	}
+
+	assert.Equal(t, []string{"engineering"}, feedsWithJar("/"))
+
+	resp := clearSettings(url.Values{"list": {"news"}})
+	assert.Equal(t, "/list/news", resp.Header.Get("Location"))
+	jar.SetCookies(numblrURL, resp.Cookies())
+	assert.Equal(t, []string{"staff"}, feedsWithJar("/list/news"), "list cleared")
+	assert.Equal(t, []string{"engineering"}, feedsWithJar("/"), "other feeds kept")
+	assert.Len(t, jar.Cookies(numblrURL), 1, "list search cleared")
+
+	resp = clearSettings(url.Values{})
+	assert.Equal(t, "/", resp.Header.Get("Location"))
+	for _, cookie := range resp.Cookies() {
+		assert.Equal(t, "/", cookie.Path, "same path as when saving")
+		assert.True(t, cookie.HttpOnly, "http only")
+	}
+	jar.SetCookies(numblrURL, resp.Cookies())
+	assert.Equal(t, []string{"staff"}, feedsWithJar("/"), "cleared")
+}
+
+func TestReadUpToFromRequest(t *testing.T) {
+	date := time.Date(2022, time.June, 4, 12, 30, 0, 0, time.UTC)
+	values := url.Values{}
+	values.Set("staff", strconv.FormatInt(date.UnixNano(), 10)+":tumblr:123")
+	values.Set("example.org", strconv.FormatInt(date.UnixNano(), 10)+":web:https://example.org/posts/1")
+	values.Set("broken", "not-a-date")
+
+	req := httptest.NewRequest("GET", "/", nil)
+	req.AddCookie(&http.Cookie{Name: CookieName + "-read", Value: values.Encode()})
+
+	readUpTo := ReadUpToFromRequest(req)
+	assert.Len(t, readUpTo, 2)
+	assert.Equal(t, "123", readUpTo["staff"].ID)
+	assert.Equal(t, "tumblr", readUpTo["staff"].Source)
+	assert.True(t, date.Equal(readUpTo["staff"].Date), "date")
+	assert.Equal(t, "https://example.org/posts/1", readUpTo["example.org"].ID, "ids can contain colons")
+
+	assert.False(t, feed.IsNewer(&feed.Post{Source: "tumblr", ID: "122", Date: date.Add(-time.Hour)}, readUpTo["staff"]), "older posts are read")
+	assert.True(t, feed.IsNewer(&feed.Post{Source: "tumblr", ID: "124", Date: date.Add(time.Hour)}, readUpTo["staff"]), "newer posts are not")
+}
+
+func TestHighlightRE(t *testing.T) {
+	assert.Nil(t, highlightRE(nil), "no terms")
+
+	termsRE := highlightRE([]string{"art", "artist", "c++"})
+	assert.Equal(t, "an <mark>Artist</mark> making <mark>art</mark> in <mark>C++</mark>", termsRE.ReplaceAllString("an Artist making art in C++", "<mark>$1</mark>"))
+
+	termsRE = highlightRE([]string{"fun stuff"})
+	assert.Equal(t, "<mark>fun\n stuff</mark>", termsRE.ReplaceAllString("fun\n stuff", "<mark>$1</mark>"), "phrases")
+}
+
+func BenchmarkHighlight(b *testing.B) {
+	postHTML := strings.Repeat(`<p>Some text about art and artists, with <a href="https://example.org">a link</a> and <img src="https://64.media.tumblr.com/abc/s640x960/def.jpg" alt="image" /></p>`, 20)
+	terms := []string{"art", "link", "example"}
+
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		// one page of posts
+		termsRE := highlightRE(terms)
+		for j := 0; j < feed.DefaultLimit; j++ {
+			_ = feed.HighlightHTML(postHTML, termsRE)
+		}
+	}
+}
+
+func TestParseDays(t *testing.T) {
+	retention, err := parseDays("180d")
+	require.NoError(t, err)
+	require.Equal(t, 180*24*time.Hour, retention, "days")
+
+	retention, err = parseDays("36h")
+	require.NoError(t, err)
+	require.Equal(t, 36*time.Hour, retention, "duration")
+
+	_, err = parseDays("-1d")
+	require.Error(t, err, "negative")
+	_, err = parseDays("half a year")
+	require.Error(t, err, "invalid")
+}
+
+func TestHandleRandom(t *testing.T) {
+	db, err := database.InitDatabase(path.Join(t.TempDir(), "cache.db"))
+	require.NoError(t, err)
+	defer db.Close()
+
+	origCacheDB := cacheDB
+	cacheDB = db
+	defer func() {
+		cacheDB = origCacheDB
+	}()
+
+	random := func() *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		HandleRandom(w, httptest.NewRequest("GET", "/random", nil))
+		return w
+	}
+
+	require.Equal(t, http.StatusNotFound, random().Code, "no posts")
+
+	cache := func(post feed.Post) {
+		f, err := database.OpenCached(context.Background(), db, post.Author, func(ctx context.Context, name string, _ feed.Search) (feed.Feed, error) {
+			return &feed.Static{FeedName: name, Posts: []feed.Post{post}}, nil
+		}, feed.Search{})
+		require.NoError(t, err)
+		for err == nil {
+			_, err = f.Next()
+		}
+		require.NoError(t, f.Close())
+	}
+
+	cache(feed.Post{Source: "tumblr", ID: "123", Author: "staff", URL: "https://staff.tumblr.com/post/123/hello", Date: time.Now()})
+	w := random()
+	require.Equal(t, http.StatusFound, w.Code)
+	require.Equal(t, "/staff/post/123/hello", w.Header().Get("Location"), "tumblr post on numblr")
+	require.Equal(t, "no-store", w.Header().Get("Cache-Control"))
+
+	_, err = db.Exec(`DELETE FROM posts`)
+	require.NoError(t, err)
+	cache(feed.Post{Source: "web", ID: "urn:1", Author: "example.org", URL: "https://example.org/1", Date: time.Now()})
+	require.Equal(t, "/example.org/post/urn:1", random().Header().Get("Location"), "post on numblr")
+}
+
+func TestHandleCachedPost(t *testing.T) {
+	db, err := database.InitDatabase(path.Join(t.TempDir(), "cache.db"))
+	require.NoError(t, err)
+	defer db.Close()
+
+	origCacheDB := cacheDB
+	cacheDB = db
+	defer func() {
+		cacheDB = origCacheDB
+	}()
+
+	f, err := database.OpenCached(context.Background(), db, "example.org", func(ctx context.Context, name string, _ feed.Search) (feed.Feed, error) {
+		return &feed.Static{FeedName: name, Posts: []feed.Post{
+			{Source: "web", ID: "https://example.org/1", Author: name, URL: "https://example.org/1", Title: "<h1>hello</h1>", DescriptionHTML: "<p>a cached post</p>", Date: time.Now()},
+		}}, nil
+	}, feed.Search{})
+	require.NoError(t, err)
+	for err == nil {
+		_, err = f.Next()
+	}
+	require.NoError(t, f.Close())
+
+	post := func(postPath string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		router := chi.NewRouter()
+		router.HandleFunc("/{tumblr}/post/{postId}", HandlePost)
+		router.ServeHTTP(w, httptest.NewRequest("GET", postPath, nil))
+		return w
+	}
+
+	postPath := postPath(&feed.Post{Source: "web", Author: "example.org", ID: "https://example.org/1"})
+	require.Equal(t, "/example.org/post/https:%2F%2Fexample.org%2F1", postPath)
+
+	w := post(postPath)
+	require.Equal(t, 200, w.Code)
+	require.Contains(t, w.Body.String(), "<p>a cached post</p>")
+	require.Contains(t, w.Body.String(), `href="https://example.org/1" title="link to the original post"`)
+
+	require.Equal(t, 404, post("/example.org/post/nope").Code, "not cached")
+	require.Equal(t, 404, post("/example.org/post/100%25").Code, "not cached, escaped without slashes")
+}
+
+func TestNoteCount(t *testing.T) {
+	testCases := []struct {
+		html      string
+		noteCount int
+	}{
+		{`<p>just a post</p>`, 0},
+		{`<div class="post-notes">1 note</div>`, 1},
+		{`<a href="/post/123#notes">1,234 notes</a>`, 1234},
+		{`<a href="/post/123#notes">1.234 notes</a>`, 1234},
+		{`<span class="note-count">12.5k notes</span>`, 12500},
+		{`<a class="notes"><span>42</span> notes</a>`, 42},
+		{`<p>i wrote 3 notes today</p>`, 0},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.html, func(t *testing.T) {
+			node, err := html.Parse(strings.NewReader(tc.html))
+			require.NoError(t, err)
+			assert.Equal(t, tc.noteCount, noteCount(node))
+		})
+	}
+
+	assert.Equal(t, "1 note", notesText(1))
+	assert.Equal(t, "7 notes", notesText(7))
+}
+
+func TestHandleUnknownFeed(t *testing.T) {
+	db, err := database.InitDatabase(path.Join(t.TempDir(), "cache.db"))
+	require.NoError(t, err)
+	defer db.Close()
+
+	origCacheDB := cacheDB
+	cacheDB = db
+	defer func() {
+		cacheDB = origCacheDB
+	}()
+
+	w := httptest.NewRecorder()
+	HandleUnknownFeed(w, httptest.NewRequest("GET", "/x", nil), `"><script>alert(1)</script>`)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+	assert.NotContains(t, w.Body.String(), "<script>", "escaped")
+	assert.Contains(t, w.Body.String(), `content="Could not find feed &#34;&gt;&lt;script&gt;`, "description")
+}
+
+func TestHandleTumblrMissingFeed(t *testing.T) {
+	db, err := database.InitDatabase(path.Join(t.TempDir(), "cache.db"))
+	require.NoError(t, err)
+	defer db.Close()
+
+	origCacheDB := cacheDB
+	cacheDB = db
+	origCacheFn := cacheFn
+	cacheFn = func(ctx context.Context, name string, uncachedFn feed.Open, search feed.Search) (feed.Feed, error) {
+		if name == "private" {
+			return nil, feed.ErrPrivate
+		}
+		return nil, feed.StatusError{Code: http.StatusNotFound}
+	}
+	defer func() {
+		cacheDB = origCacheDB
+		cacheFn = origCacheFn
+	}()
+
+	router := chi.NewRouter()
+	router.HandleFunc("/{feeds}", HandleTumblr)
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("GET", "/missing", nil))
+	assert.Contains(t, w.Body.String(), "couldn't find feed missing", "on the page")
+	assert.NotContains(t, w.Body.String(), "could not load feed", "no error")
+
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("GET", "/private", nil))
+	assert.Contains(t, w.Body.String(), "feed private is private", "on the page")
+
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("GET", "/missing?format=rss", nil))
+	assert.Equal(t, http.StatusNotFound, w.Code, "own page for feed readers")
+}
+
+func TestSourceSearchesFull(t *testing.T) {
+	searchFor := sourceSearches(feed.Search{Full: true})
+	assert.True(t, searchFor("ao3").Full, "ao3")
+	assert.False(t, searchFor("tumblr").Full, "other sources are cached")
+}
+
+func TestWriteShareLinks(t *testing.T) {
+	origShareTargets := config.ShareTargets
+	config.ShareTargets = "email"
+	defer func() {
+		config.ShareTargets = origShareTargets
+	}()
+
+	buf := new(bytes.Buffer)
+	writeShareLinks(buf, &feed.Post{URL: "https://staff.tumblr.com/post/1?a=b&c=d", Title: "cats & dogs"})
+	require.Contains(t, buf.String(), `href="mailto:?subject=cats%20%26%20dogs&body=cats%20%26%20dogs%0A%0Ahttps%3A%2F%2Fstaff.tumblr.com%2Fpost%2F1%3Fa%3Db%26c%3Dd"`)
+}
+
+func TestHandleDigestEscapesFeeds(t *testing.T) {
+	db, err := database.InitDatabase(path.Join(t.TempDir(), "cache.db"))
+	require.NoError(t, err)
+	defer db.Close()
+
+	origCacheDB := cacheDB
+	cacheDB = db
+	defer func() {
+		cacheDB = origCacheDB
+	}()
+
+	name := `"><script>alert(1)</script>`
+	f, err := database.OpenCached(context.Background(), db, name, func(ctx context.Context, name string, search feed.Search) (feed.Feed, error) {
+		return &feed.Static{FeedName: name, Posts: []feed.Post{{Source: "web", ID: "1", Author: name, URL: "https://example.org/1", Title: "a post", Date: time.Now()}}}, nil
+	}, feed.Search{ForceFresh: true})
+	require.NoError(t, err)
+	_, err = f.Next()
+	for err == nil {
+		_, err = f.Next()
+	}
+	require.NoError(t, f.Close())
+
+	router := chi.NewRouter()
+	router.Get("/{feeds}/digest", HandleDigest)
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("GET", "/"+url.PathEscape(name)+"/digest", nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.NotContains(t, w.Body.String(), "<script>", "escaped")
+	assert.Contains(t, w.Body.String(), `<title>digest of &#34;&gt;&lt;script&gt;`, "title")
+	assert.Contains(t, w.Body.String(), `<a class="author" href="http://example.com/%22%3E%3Cscript%3Ealert%281%29%3C%2Fscript%3E">&#34;&gt;&lt;script&gt;alert(1)&lt;/script&gt;</a>`, "author")
+}
+
+func TestReblogSourceEscaped(t *testing.T) {
+	db, err := database.InitDatabase(path.Join(t.TempDir(), "cache.db"))
+	require.NoError(t, err)
+	defer db.Close()
+
+	origCacheDB := cacheDB
+	cacheDB = db
+	origCacheFn := cacheFn
+	cacheFn = func(ctx context.Context, name string, uncachedFn feed.Open, search feed.Search) (feed.Feed, error) {
+		return &feed.Static{FeedName: name, Posts: []feed.Post{
+			{Source: "tumblr", ID: "1", Author: name, URL: "https://staff.tumblr.com/post/1", DescriptionHTML: `<p><a class="tumblr_blog" href="https://x.tumblr.com/post/1">&lt;script&gt;alert(1)&lt;/script&gt;</a>:</p><blockquote><p>original</p></blockquote>`, Date: time.Now()},
+		}}, nil
+	}
+	defer func() {
+		cacheDB = origCacheDB
+		cacheFn = origCacheFn
+	}()
+
+	router := chi.NewRouter()
+	router.HandleFunc("/{feeds}", HandleTumblr)
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("GET", "/staff", nil))
+	assert.Contains(t, w.Body.String(), `href="/%3Cscript%3Ealert%281%29%3C%2Fscript%3E">&lt;script&gt;alert(1)&lt;/script&gt;</a></p>`, "reblog source")
+	assert.NotContains(t, w.Body.String(), "<script>alert", "escaped")
+}
+
+func TestSnoozedFeedsEscaped(t *testing.T) {
+	db, err := database.InitDatabase(path.Join(t.TempDir(), "cache.db"))
+	require.NoError(t, err)
+	defer db.Close()
+
+	origCacheDB := cacheDB
+	cacheDB = db
+	origCacheFn := cacheFn
+	cacheFn = func(ctx context.Context, name string, uncachedFn feed.Open, search feed.Search) (feed.Feed, error) {
+		return &feed.Static{FeedName: name}, nil
+	}
+	defer func() {
+		cacheDB = origCacheDB
+		cacheFn = origCacheFn
+	}()
+
+	router := chi.NewRouter()
+	router.HandleFunc("/{feeds}", HandleTumblr)
+
+	name := `"><script>alert(1)</script>`
+	req := httptest.NewRequest("GET", "/staff,"+url.PathEscape(name), nil)
+	req.AddCookie(&http.Cookie{Name: CookieName + "-snooze", Value: url.Values{name: {strconv.FormatInt(time.Now().Add(time.Hour).Unix(), 10)}}.Encode()})
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	assert.Contains(t, w.Body.String(), `<li><a href="/%22%3E%3Cscript%3Ealert%281%29%3C%2Fscript%3E">&#34;&gt;&lt;script&gt;alert(1)&lt;/script&gt;</a> until`, "snoozed feed")
+	assert.Contains(t, w.Body.String(), `<input type="hidden" name="feed" value="&#34;&gt;&lt;script&gt;alert(1)&lt;/script&gt;" />`, "unsnooze form")
+	snoozedList := w.Body.String()[strings.Index(w.Body.String(), `<details class="snoozed">`):]
+	assert.NotContains(t, snoozedList[:strings.Index(snoozedList, "</details>")], "<script>alert", "escaped")
+}
+
+func TestReadFormEscaped(t *testing.T) {
+	form := readForm(`"><script>alert(1)</script>`, &feed.Post{ID: `1"2`, Source: "web"}, "mark as read", "/")
+	assert.Contains(t, form, `name="feed" value="&#34;&gt;&lt;script&gt;alert(1)&lt;/script&gt;"`, "feed")
+	assert.Contains(t, form, `name="id" value="1&#34;2"`, "id")
+}
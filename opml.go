@@ -0,0 +1,248 @@
+package main
+
+import (
+	"encoding/xml"
+	"fmt"
+	"html"
+	"io"
+	"log"
+	"net/http"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/heyLu/numblr/feed"
+	"github.com/heyLu/numblr/feed/anything"
+)
+
+// MaxOPMLSize is the maximum size of OPML files that can be imported.
+const MaxOPMLSize = 1024 * 1024
+
+// maxFeedsCookieSize is the size up to which browsers reliably store cookies.
+const maxFeedsCookieSize = 4000
+
+// opmlOutline is an `outline` of an OPML document, which is either a feed
+// with an `xmlUrl` or a folder of other outlines.
+//
+// See http://opml.org/spec2.opml#subscriptionLists.
+type opmlOutline struct {
+	Text     string        `xml:"text,attr"`
+	Title    string        `xml:"title,attr,omitempty"`
+	Type     string        `xml:"type,attr,omitempty"`
+	XMLURL   string        `xml:"xmlUrl,attr,omitempty"`
+	Outlines []opmlOutline `xml:"outline"`
+}
+
+// opmlDocument is an OPML 2.0 document, see http://opml.org/spec2.opml.
+type opmlDocument struct {
+	XMLName xml.Name `xml:"opml"`
+	Version string   `xml:"version,attr"`
+	Head    struct {
+		Title       string `xml:"title"`
+		DateCreated string `xml:"dateCreated"`
+	} `xml:"head"`
+	Body struct {
+		Outlines []opmlOutline `xml:"outline"`
+	} `xml:"body"`
+}
+
+// opmlFeed is a feed from an OPML document.
+type opmlFeed struct {
+	Name  string
+	Title string
+}
+
+var tumblrRSSRE = regexp.MustCompile(`^https?://([-\w]+)\.tumblr\.com/rss/?$`)
+
+// parseOPML returns the feeds in the OPML document, with the feeds in
+// folders flattened.
+//
+// The names of the feeds are their urls, except for Tumblr blogs which are
+// followed by their name.  The `text` or `title` only names them on the
+// import page, numblr could not open the feeds by it.
+func parseOPML(r io.Reader) ([]opmlFeed, error) {
+	var doc opmlDocument
+	dec := xml.NewDecoder(r)
+	// OPML files are often not quite utf-8, like the feeds themselves
+	dec.Strict = false
+	err := dec.Decode(&doc)
+	if err != nil {
+		return nil, fmt.Errorf("parse opml: %w", err)
+	}
+
+	var feeds []opmlFeed
+	var flatten func(outlines []opmlOutline)
+	flatten = func(outlines []opmlOutline) {
+		for _, outline := range outlines {
+			flatten(outline.Outlines)
+
+			xmlURL := strings.TrimSpace(outline.XMLURL)
+			if xmlURL == "" {
+				continue
+			}
+
+			name := xmlURL
+			if parts := tumblrRSSRE.FindStringSubmatch(xmlURL); parts != nil {
+				name = parts[1]
+			}
+
+			title := strings.TrimSpace(outline.Text)
+			if title == "" {
+				title = strings.TrimSpace(outline.Title)
+			}
+			if title == "" {
+				title = xmlURL
+			}
+
+			feeds = append(feeds, opmlFeed{Name: name, Title: title})
+		}
+	}
+	flatten(doc.Body.Outlines)
+	return feeds, nil
+}
+
+// HandleImport adds the feeds of an uploaded OPML file to the followed feeds
+// of the `list` (or the main ones), e.g. to move over from a feed reader.
+func HandleImport(w http.ResponseWriter, req *http.Request) {
+	req.Body = http.MaxBytesReader(w, req.Body, MaxOPMLSize+64*1024)
+	file, _, err := req.FormFile("opml")
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Error: no opml file: %s", err), http.StatusBadRequest)
+		return
+	}
+	defer file.Close()
+
+	imported, err := parseOPML(io.LimitReader(file, MaxOPMLSize))
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Error: %s", err), http.StatusBadRequest)
+		return
+	}
+
+	list := req.FormValue("list")
+
+	feeds, seen := dedupeFeeds(followedFeeds(req, list))
+
+	var added, skipped []opmlFeed
+	for _, importedFeed := range imported {
+		// commas separate the feeds in the cookie
+		if seen[importedFeed.Name] || strings.Contains(importedFeed.Name, ",") {
+			skipped = append(skipped, importedFeed)
+			continue
+		}
+		seen[importedFeed.Name] = true
+		feeds = append(feeds, importedFeed.Name)
+		added = append(added, importedFeed)
+	}
+
+	if len(strings.Join(feeds, ",")) > maxFeedsCookieSize {
+		http.Error(w, fmt.Sprintf("Error: too many feeds, %d feeds would not fit into a cookie", len(feeds)), http.StatusRequestEntityTooLarge)
+		return
+	}
+	if len(added) > 0 {
+		saveFollowedFeeds(w, list, feeds)
+	}
+
+	redirect := "/"
+	if list != "" {
+		redirect = "/list/" + list
+	}
+
+	htmlPrelude(w, req, "imported feeds", fmt.Sprintf("Imported %d feeds", len(added)), "/favicon.png")
+	fmt.Fprintf(w, `<header><h1>imported feeds</h1><h2>%d added, %d skipped as duplicates</h2></header>`, len(added), len(skipped))
+	fmt.Fprintln(w)
+
+	writeList := func(title string, feeds []opmlFeed) {
+		if len(feeds) == 0 {
+			return
+		}
+		fmt.Fprintf(w, "<h3>%s</h3>\n<ul>\n", title)
+		for _, f := range feeds {
+			fmt.Fprintf(w, `<li><a href="%s">%s</a></li>`, html.EscapeString(feedsPath([]string{f.Name})), html.EscapeString(f.Title))
+			fmt.Fprintln(w)
+		}
+		fmt.Fprintln(w, "</ul>")
+	}
+	writeList("added", added)
+	writeList("skipped", skipped)
+
+	fmt.Fprintf(w, `<p>Go back to <a href=%q>your feeds</a>.</p>`, redirect)
+	fmt.Fprintln(w, `</div>
+
+</body>
+</html>`)
+}
+
+// HandleExportOPML writes the followed feeds of the `list` (or the main
+// ones) as an OPML document, e.g. to subscribe to them in a feed reader.
+//
+// Feeds that are feeds elsewhere as well have their url as `xmlUrl`, the
+// others only have their name.
+func HandleExportOPML(w http.ResponseWriter, req *http.Request) {
+	list := req.URL.Query().Get("list")
+
+	followed, _ := dedupeFeeds(followedFeeds(req, list))
+	names := make([]string, 0, len(followed))
+	for _, feedName := range followed {
+		name, _ := splitFeedSearch(feedName)
+		// neither the global search nor the special feeds are feeds
+		if name == "*" || strings.HasPrefix(name, ":") {
+			continue
+		}
+		names = append(names, name)
+	}
+
+	xmlURLs := make([]string, len(names))
+	var wg sync.WaitGroup
+	for i, name := range names {
+		switch anything.Source(name) {
+		case "tumblr", "web", "youtube":
+		default:
+			continue
+		}
+
+		// the name of rss feeds is the url of the feed already, but their
+		// URL is the one of the site
+		if strings.HasPrefix(name, "http://") || strings.HasPrefix(name, "https://") {
+			xmlURLs[i] = name
+			continue
+		}
+
+		wg.Add(1)
+		go func(i int, name string) {
+			defer wg.Done()
+
+			f, err := anything.Open(req.Context(), name, cacheFn, feed.Search{})
+			if err != nil {
+				log.Printf("Error: opml export of %s: %s", name, err)
+				return
+			}
+			xmlURLs[i] = f.URL()
+
+			err = f.Close()
+			if err != nil {
+				log.Printf("Error: closing %s: %s", name, err)
+			}
+		}(i, name)
+	}
+	wg.Wait()
+
+	doc := opmlDocument{Version: "2.0"}
+	doc.Head.Title = "numblr feeds"
+	if list != "" {
+		doc.Head.Title = "numblr feeds in " + list
+	}
+	doc.Head.DateCreated = time.Now().UTC().Format(time.RFC1123Z)
+	for i, name := range names {
+		outline := opmlOutline{Text: name, XMLURL: xmlURLs[i]}
+		if outline.XMLURL != "" {
+			outline.Title = name
+			outline.Type = "rss"
+		}
+		doc.Body.Outlines = append(doc.Body.Outlines, outline)
+	}
+
+	w.Header().Set("Content-Type", "text/x-opml; charset=utf-8")
+	w.Header().Set("Content-Disposition", `attachment; filename="numblr.opml"`)
+	writeXML(w, doc)
+}
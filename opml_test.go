@@ -0,0 +1,96 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/xml"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/heyLu/numblr/feed"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const opmlFixture = `<?xml version="1.0" encoding="UTF-8"?>
+<opml version="2.0">
+<head><title>subscriptions</title></head>
+<body>
+	<outline text="xkcd" title="xkcd.com" type="rss" xmlUrl="https://xkcd.com/atom.xml" htmlUrl="https://xkcd.com/" />
+	<outline text="tumblr">
+		<outline text="staff" type="rss" xmlUrl="https://staff.tumblr.com/rss" />
+		<outline title="Engineering" type="rss" xmlUrl="https://engineering.tumblr.com/rss" />
+	</outline>
+	<outline type="rss" xmlUrl="https://example.org/feed.xml" />
+	<outline text="no feed" htmlUrl="https://example.org/" />
+</body>
+</opml>`
+
+func TestParseOPML(t *testing.T) {
+	feeds, err := parseOPML(strings.NewReader(opmlFixture))
+	require.NoError(t, err)
+	assert.Equal(t, []opmlFeed{
+		{Name: "https://xkcd.com/atom.xml", Title: "xkcd"},
+		{Name: "staff", Title: "staff"},
+		{Name: "engineering", Title: "Engineering"},
+		{Name: "https://example.org/feed.xml", Title: "https://example.org/feed.xml"},
+	}, feeds)
+
+	_, err = parseOPML(strings.NewReader("not opml"))
+	assert.Error(t, err)
+}
+
+func TestHandleImport(t *testing.T) {
+	body := new(bytes.Buffer)
+	mw := multipart.NewWriter(body)
+	fw, err := mw.CreateFormFile("opml", "subscriptions.opml")
+	require.NoError(t, err)
+	_, err = fw.Write([]byte(opmlFixture))
+	require.NoError(t, err)
+	require.NoError(t, mw.Close())
+
+	req := httptest.NewRequest("POST", "/settings/import", body)
+	req.Header.Set("Content-Type", mw.FormDataContentType())
+	req.AddCookie(&http.Cookie{Name: CookieName, Value: "staff noreblogs,someone@twitter"})
+	w := httptest.NewRecorder()
+	HandleImport(w, req)
+
+	resp := w.Result()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Contains(t, w.Body.String(), "3 added, 1 skipped as duplicates")
+	require.Len(t, resp.Cookies(), 1)
+	assert.Equal(t, "staff noreblogs,someone@twitter,https://xkcd.com/atom.xml,engineering,https://example.org/feed.xml", resp.Cookies()[0].Value)
+}
+
+func TestHandleExportOPML(t *testing.T) {
+	origCacheFn := cacheFn
+	cacheFn = func(ctx context.Context, name string, uncachedFn feed.Open, search feed.Search) (feed.Feed, error) {
+		return &feed.Static{FeedName: name, FeedURL: "https://" + name + ".tumblr.com/rss"}, nil
+	}
+	defer func() {
+		cacheFn = origCacheFn
+	}()
+
+	req := httptest.NewRequest("GET", "/settings/export.opml", nil)
+	req.AddCookie(&http.Cookie{Name: CookieName, Value: "staff noreblogs,https://xkcd.com/atom.xml,someone@twitter,staff,* -#spoilers"})
+	w := httptest.NewRecorder()
+	HandleExportOPML(w, req)
+
+	assert.Equal(t, `attachment; filename="numblr.opml"`, w.Header().Get("Content-Disposition"))
+
+	var doc opmlDocument
+	require.NoError(t, xml.Unmarshal(w.Body.Bytes(), &doc), "valid opml")
+	assert.Equal(t, "2.0", doc.Version)
+	assert.Equal(t, []opmlOutline{
+		{Text: "staff", Title: "staff", Type: "rss", XMLURL: "https://staff.tumblr.com/rss"},
+		{Text: "https://xkcd.com/atom.xml", Title: "https://xkcd.com/atom.xml", Type: "rss", XMLURL: "https://xkcd.com/atom.xml"},
+		{Text: "someone@twitter"},
+	}, doc.Body.Outlines)
+
+	feeds, err := parseOPML(bytes.NewReader(w.Body.Bytes()))
+	require.NoError(t, err)
+	assert.Len(t, feeds, 2, "can be imported again")
+}
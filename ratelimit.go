@@ -0,0 +1,185 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// maxRateLimitClients is the number of clients above which clients that have
+// not made requests in a while are forgotten.
+const maxRateLimitClients = 10000
+
+// RateLimiter limits the requests per client using a token bucket for each
+// client, identified by their ip.
+type RateLimiter struct {
+	// perSecond is the rate at which requests are allowed, with bursts of
+	// up to `burst` requests.
+	perSecond float64
+	burst     float64
+
+	// trustedProxies are the proxies whose X-Forwarded-For header is used
+	// to find the ip of the client.
+	trustedProxies []*net.IPNet
+
+	// mu protects buckets.
+	mu      sync.Mutex
+	buckets map[string]*tokenBucket
+
+	now func() time.Time
+}
+
+type tokenBucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// NewRateLimiter creates a rate limiter allowing `perMinute` requests per
+// client, all of which may be made at once.
+//
+// `trustedProxies` is a comma-separated list of ips or cidrs.
+func NewRateLimiter(perMinute int, trustedProxies string) (*RateLimiter, error) {
+	rl := &RateLimiter{
+		perSecond: float64(perMinute) / 60,
+		burst:     float64(perMinute),
+		buckets:   make(map[string]*tokenBucket),
+		now:       time.Now,
+	}
+
+	for _, proxy := range strings.Split(trustedProxies, ",") {
+		proxy = strings.TrimSpace(proxy)
+		if proxy == "" {
+			continue
+		}
+		if !strings.Contains(proxy, "/") {
+			if strings.Contains(proxy, ":") {
+				proxy += "/128"
+			} else {
+				proxy += "/32"
+			}
+		}
+
+		_, ipNet, err := net.ParseCIDR(proxy)
+		if err != nil {
+			return nil, fmt.Errorf("invalid trusted proxy %q: %w", proxy, err)
+		}
+		rl.trustedProxies = append(rl.trustedProxies, ipNet)
+	}
+
+	return rl, nil
+}
+
+// Allow returns true if the client may make another request now, or how long
+// it has to wait until it may.
+func (rl *RateLimiter) Allow(client string) (bool, time.Duration) {
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+
+	now := rl.now()
+
+	if len(rl.buckets) > maxRateLimitClients {
+		for c, bucket := range rl.buckets {
+			if bucket.tokens+now.Sub(bucket.last).Seconds()*rl.perSecond >= rl.burst {
+				delete(rl.buckets, c)
+			}
+		}
+	}
+
+	bucket, ok := rl.buckets[client]
+	if !ok {
+		bucket = &tokenBucket{tokens: rl.burst, last: now}
+		rl.buckets[client] = bucket
+	}
+
+	bucket.tokens = math.Min(rl.burst, bucket.tokens+now.Sub(bucket.last).Seconds()*rl.perSecond)
+	bucket.last = now
+
+	if bucket.tokens < 1 {
+		return false, time.Duration((1 - bucket.tokens) / rl.perSecond * float64(time.Second))
+	}
+
+	bucket.tokens--
+	return true, 0
+}
+
+// ClientIP returns the ip of the client that made the request, which is
+// taken from the X-Forwarded-For header if the request is from a trusted
+// proxy.
+func (rl *RateLimiter) ClientIP(req *http.Request) string {
+	ip, _, err := net.SplitHostPort(req.RemoteAddr)
+	if err != nil {
+		ip = req.RemoteAddr
+	}
+
+	if !rl.isTrusted(ip) {
+		return ip
+	}
+
+	// the last ip that is not a trusted proxy is the client, everything
+	// before it could have been sent by the client itself
+	forwardedFor := strings.Split(strings.Join(req.Header.Values("X-Forwarded-For"), ","), ",")
+	for i := len(forwardedFor) - 1; i >= 0; i-- {
+		forwarded := strings.TrimSpace(forwardedFor[i])
+		if forwarded == "" {
+			continue
+		}
+		if !rl.isTrusted(forwarded) {
+			return forwarded
+		}
+		ip = forwarded
+	}
+	return ip
+}
+
+func (rl *RateLimiter) isTrusted(ip string) bool {
+	parsed := net.ParseIP(ip)
+	if parsed == nil {
+		return false
+	}
+
+	for _, proxy := range rl.trustedProxies {
+		if proxy.Contains(parsed) {
+			return true
+		}
+	}
+	return false
+}
+
+// rateLimitExempt are paths that are cheap to serve and therefore not rate
+// limited.
+var rateLimitExempt = map[string]bool{
+	"/favicon.ico":          true,
+	"/favicon.png":          true,
+	"/robots.txt":           true,
+	"/manifest.webmanifest": true,
+	"/service-worker.js":    true,
+	"/about":                true,
+	"/changes":              true,
+	"/help.md":              true,
+	"/hjälp":                true,
+}
+
+// Middleware rate limits requests, responding with 429 Too Many Requests if
+// a client made too many.
+func (rl *RateLimiter) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if rateLimitExempt[req.URL.Path] {
+			next.ServeHTTP(w, req)
+			return
+		}
+
+		ok, retryAfter := rl.Allow(rl.ClientIP(req))
+		if !ok {
+			w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(retryAfter.Seconds()))))
+			http.Error(w, http.StatusText(http.StatusTooManyRequests), http.StatusTooManyRequests)
+			return
+		}
+
+		next.ServeHTTP(w, req)
+	})
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRateLimiter(t *testing.T) {
+	rl, err := NewRateLimiter(2, "")
+	require.NoError(t, err)
+
+	now := time.Date(2022, time.June, 10, 0, 0, 0, 0, time.UTC)
+	rl.now = func() time.Time { return now }
+
+	ok, _ := rl.Allow("a")
+	assert.True(t, ok, "first")
+	ok, _ = rl.Allow("a")
+	assert.True(t, ok, "burst")
+	ok, retryAfter := rl.Allow("a")
+	assert.False(t, ok, "limited")
+	assert.Equal(t, 30*time.Second, retryAfter, "retry after")
+
+	ok, _ = rl.Allow("b")
+	assert.True(t, ok, "other client")
+
+	now = now.Add(30 * time.Second)
+	ok, _ = rl.Allow("a")
+	assert.True(t, ok, "refilled")
+}
+
+func TestRateLimiterMiddleware(t *testing.T) {
+	rl, err := NewRateLimiter(1, "10.0.0.0/8")
+	require.NoError(t, err)
+
+	handler := rl.Middleware(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {}))
+	request := func(path string, remoteAddr string, forwardedFor string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", path, nil)
+		req.RemoteAddr = remoteAddr
+		if forwardedFor != "" {
+			req.Header.Set("X-Forwarded-For", forwardedFor)
+		}
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec
+	}
+
+	assert.Equal(t, http.StatusOK, request("/staff", "192.0.2.1:1234", "").Code, "first")
+	rec := request("/staff", "192.0.2.1:1234", "")
+	assert.Equal(t, http.StatusTooManyRequests, rec.Code, "limited")
+	assert.Equal(t, "60", rec.Header().Get("Retry-After"), "retry after")
+	assert.Equal(t, http.StatusOK, request("/favicon.png", "192.0.2.1:1234", "").Code, "static assets")
+
+	// untrusted clients cannot choose their ip
+	assert.Equal(t, http.StatusTooManyRequests, request("/staff", "192.0.2.1:1234", "198.51.100.1").Code, "spoofed")
+
+	// clients behind trusted proxies are limited separately
+	assert.Equal(t, http.StatusOK, request("/staff", "10.0.0.1:1234", "192.0.2.1, 198.51.100.1").Code, "behind proxy")
+	assert.Equal(t, http.StatusTooManyRequests, request("/staff", "10.0.0.2:1234", "198.51.100.1").Code, "same client behind proxy")
+}
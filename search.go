@@ -0,0 +1,72 @@
+package main
+
+import (
+	"fmt"
+	"html"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/heyLu/numblr/feed/database"
+)
+
+// DefaultSearchResults is the number of posts shown on the search page,
+// `?limit=` shows up to MaxSearchResults.
+const DefaultSearchResults = 50
+
+// MaxSearchResults is the maximum number of posts on the search page.
+const MaxSearchResults = 200
+
+// HandleSearch searches all cached posts of all feeds for `?q=`, newest
+// first, see database.SearchPosts.
+func HandleSearch(w http.ResponseWriter, req *http.Request) {
+	query := strings.TrimSpace(req.URL.Query().Get("q"))
+
+	limit := DefaultSearchResults
+	if limitParam := req.URL.Query().Get("limit"); limitParam != "" {
+		l, err := strconv.Atoi(limitParam)
+		if err != nil || l <= 0 {
+			http.Error(w, fmt.Sprintf("Error: invalid limit %q", limitParam), http.StatusBadRequest)
+			return
+		}
+		limit = l
+		if limit > MaxSearchResults {
+			limit = MaxSearchResults
+		}
+	}
+
+	posts, err := database.SearchPosts(req.Context(), cacheDB, query, limit)
+	if err != nil {
+		log.Printf("Error: searching for %q: %s", query, err)
+		http.Error(w, fmt.Sprintf("Error: could not search posts: %s", err), http.StatusInternalServerError)
+		return
+	}
+
+	title := "search"
+	if query != "" {
+		title = "search for " + html.EscapeString(query)
+	}
+	htmlPrelude(w, req, title, "Search all posts that numblr has seen", "/favicon.png")
+
+	fmt.Fprintln(w, `<header><h1>search</h1>`)
+	if query != "" {
+		fmt.Fprintf(w, `<h2>%d posts with “%s”</h2>`, len(posts), html.EscapeString(query))
+	}
+	fmt.Fprintln(w, `</header>`)
+
+	fmt.Fprintf(w, `<form method="GET" action="/search"><input type="search" name="q" value="%s" placeholder="words in posts of all feeds" autofocus /> <input type="submit" value="search" /></form>
+`, html.EscapeString(query))
+
+	if query == "" {
+		return
+	}
+
+	fmt.Fprintln(w, `<ul class="digest headlines">`)
+	for _, post := range posts {
+		fmt.Fprintf(w, `<li><a class="author" href="/%s">%s</a>: <a href=%q>%s</a> <time datetime=%q>%s</time></li>
+`, html.EscapeString(post.Author), html.EscapeString(displayAuthor(post)), post.URL, html.EscapeString(postSummary(post)), post.Date.Format(time.RFC3339), post.Date.Format("2006-01-02 15:04"))
+	}
+	fmt.Fprintln(w, `</ul>`)
+}
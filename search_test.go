@@ -0,0 +1,60 @@
+package main
+
+import (
+	"context"
+	"net/http/httptest"
+	"path"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/heyLu/numblr/feed"
+	"github.com/heyLu/numblr/feed/database"
+)
+
+func TestHandleSearch(t *testing.T) {
+	db, err := database.InitDatabase(path.Join(t.TempDir(), "cache.db"))
+	require.NoError(t, err)
+	defer db.Close()
+
+	origCacheDB := cacheDB
+	cacheDB = db
+	defer func() {
+		cacheDB = origCacheDB
+	}()
+
+	date := time.Date(2022, time.June, 1, 12, 0, 0, 0, time.UTC)
+	f, err := database.OpenCached(context.Background(), db, "staff", func(ctx context.Context, name string, _ feed.Search) (feed.Feed, error) {
+		return &feed.Static{FeedName: name, Posts: []feed.Post{
+			{Source: "tumblr", ID: "2", Author: name, URL: "https://staff.tumblr.com/post/2", DescriptionHTML: "<p>a post about cats</p>", Date: date},
+			{Source: "tumblr", ID: "1", Author: name, URL: "https://staff.tumblr.com/post/1", DescriptionHTML: "<p>a post about dogs</p>", Date: date.Add(-time.Hour)},
+		}}, nil
+	}, feed.Search{ForceFresh: true})
+	require.NoError(t, err)
+	for err == nil {
+		_, err = f.Next()
+	}
+	require.NoError(t, f.Close())
+
+	w := httptest.NewRecorder()
+	HandleSearch(w, httptest.NewRequest("GET", "/search?q=cats", nil))
+	assert.Equal(t, 200, w.Code)
+	assert.Contains(t, w.Body.String(), "a post about cats")
+	assert.Contains(t, w.Body.String(), `href="https://staff.tumblr.com/post/2"`)
+	assert.NotContains(t, w.Body.String(), "a post about dogs")
+
+	w = httptest.NewRecorder()
+	HandleSearch(w, httptest.NewRequest("GET", "/search?q=%3Cscript%3E", nil))
+	assert.NotContains(t, w.Body.String(), "<script>", "escaped")
+
+	w = httptest.NewRecorder()
+	HandleSearch(w, httptest.NewRequest("GET", "/search", nil))
+	assert.Equal(t, 200, w.Code)
+	assert.Contains(t, w.Body.String(), `name="q"`, "search form")
+
+	w = httptest.NewRecorder()
+	HandleSearch(w, httptest.NewRequest("GET", "/search?q=cats&limit=nope", nil))
+	assert.Equal(t, 400, w.Code, "invalid limit")
+}
@@ -8,9 +8,15 @@ import (
 	"net/http"
 	"os"
 	"runtime/debug"
+	"sort"
 	"strings"
 	"sync"
 	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+
+	"github.com/heyLu/numblr/feed/database"
 )
 
 type Stats struct {
@@ -26,6 +32,12 @@ type Stats struct {
 
 	NumBackgroundFetch int
 
+	// CacheResults counts how feeds were served, by source and
+	// database.CacheResult.
+	CacheResults map[string]map[string]int
+	// FeedErrors counts the feeds that could not be opened, by source.
+	FeedErrors map[string]int
+
 	RecentErrors []string
 	lastError    int
 	seenError    map[string]int
@@ -49,6 +61,59 @@ func EnableStats(numErrors int, numUsers int, numLogs int) {
 	globalStats.seenUser = make(map[string]int, numUsers)
 	globalStats.RecentLogs = make([]string, numLogs)
 	globalStats.seenLog = make(map[string]int, numLogs)
+	globalStats.CacheResults = make(map[string]map[string]int)
+	globalStats.FeedErrors = make(map[string]int)
+}
+
+var cacheResultsCounter = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "numblr_feed_opens_total",
+	Help: "Feeds opened, by source and whether they were served from cache, live, stale or not at all.",
+}, []string{"source", "result"})
+
+// CollectCacheResult counts how a feed from `source` was served, see
+// database.CacheResult.
+func CollectCacheResult(source string, result string) {
+	cacheResultsCounter.WithLabelValues(source, result).Inc()
+
+	if globalStats == nil {
+		return
+	}
+
+	globalStats.mu.Lock()
+	defer globalStats.mu.Unlock()
+	if globalStats.CacheResults[source] == nil {
+		globalStats.CacheResults[source] = make(map[string]int, 4)
+	}
+	globalStats.CacheResults[source][result]++
+}
+
+var feedErrorsCounter = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "numblr_feed_errors_total",
+	Help: "Feeds that could not be opened when viewing them, by source.",
+}, []string{"source"})
+
+var feedOpenDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+	Name:    "numblr_feed_open_duration_seconds",
+	Help:    "How long opening feeds took when viewing them, by source.",
+	Buckets: []float64{0.01, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30},
+}, []string{"source"})
+
+// CollectFeedOpen records how long opening a feed from `source` took and
+// whether it failed, see FeedInfo.
+func CollectFeedOpen(source string, duration time.Duration, err error) {
+	feedOpenDuration.WithLabelValues(source).Observe(duration.Seconds())
+	if err == nil {
+		return
+	}
+	feedErrorsCounter.WithLabelValues(source).Inc()
+
+	if globalStats == nil {
+		return
+	}
+
+	globalStats.mu.Lock()
+	globalStats.FeedErrors[source]++
+	globalStats.mu.Unlock()
 }
 
 func AddBackgroundFetch() {
@@ -116,7 +181,14 @@ func EnableDatabaseStats(db *sql.DB, path string) {
 	}()
 }
 
+var viewsCounter = promauto.NewCounter(prometheus.CounterOpts{
+	Name: "numblr_views_total",
+	Help: "Pages of feeds that were viewed.",
+})
+
 func CountView() {
+	viewsCounter.Inc()
+
 	if globalStats == nil {
 		return
 	}
@@ -227,6 +299,35 @@ func StatsHandler(w http.ResponseWriter, req *http.Request) {
 	fmt.Fprintln(w)
 	fmt.Fprintf(w, "bg fetch: %d\n", globalStats.NumBackgroundFetch)
 	fmt.Fprintln(w)
+	fmt.Fprintln(w, "cache results:")
+	globalStats.mu.Lock()
+	sources := make([]string, 0, len(globalStats.CacheResults))
+	for source := range globalStats.CacheResults {
+		sources = append(sources, source)
+	}
+	sort.Strings(sources)
+	for _, source := range sources {
+		results := globalStats.CacheResults[source]
+		total := 0
+		for _, n := range results {
+			total += n
+		}
+		fmt.Fprintf(w, "  %-10s %d cached, %d live, %d stale, %d error (%.0f%% hits)\n", source+":",
+			results[database.ResultCached], results[database.ResultLive], results[database.ResultStale], results[database.ResultError],
+			100*float64(results[database.ResultCached])/float64(total))
+	}
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "feed errors:")
+	sources = sources[:0]
+	for source := range globalStats.FeedErrors {
+		sources = append(sources, source)
+	}
+	sort.Strings(sources)
+	for _, source := range sources {
+		fmt.Fprintf(w, "  %-10s %d\n", source+":", globalStats.FeedErrors[source])
+	}
+	globalStats.mu.Unlock()
+	fmt.Fprintln(w)
 	fmt.Fprintln(w, "recent errors:")
 	for _, err := range globalStats.RecentErrors {
 		if err != "" {
@@ -258,6 +359,49 @@ func StatsHandler(w http.ResponseWriter, req *http.Request) {
 	fmt.Fprintln(w, version)
 }
 
+// StatsFeedsHandler lists all cached feeds with the number of their cached
+// posts, when they were cached and their error, if any.
+//
+// They are sorted by their number of posts, or with `?sort=stale` by when
+// they were cached, least recently first.
+func StatsFeedsHandler(w http.ResponseWriter, req *http.Request) {
+	if globalStats == nil {
+		_, _ = w.Write([]byte("stats not enabled"))
+		return
+	}
+
+	stats, err := database.ListFeedStats(req.Context(), cacheDB)
+	if err != nil {
+		log.Printf("Error: listing feed stats: %s", err)
+		http.Error(w, fmt.Sprintf("Error: could not list feeds: %s", err), http.StatusInternalServerError)
+		return
+	}
+
+	switch req.URL.Query().Get("sort") {
+	case "", "count":
+		sort.SliceStable(stats, func(i, j int) bool {
+			return stats[i].NumPosts > stats[j].NumPosts
+		})
+	case "stale":
+		sort.SliceStable(stats, func(i, j int) bool {
+			return stats[i].CachedAt.Before(stats[j].CachedAt)
+		})
+	default:
+		http.Error(w, fmt.Sprintf("Error: unknown sort %q, expected count or stale", req.URL.Query().Get("sort")), http.StatusBadRequest)
+		return
+	}
+
+	fmt.Fprintf(w, "feeds: %d\n", len(stats))
+	fmt.Fprintln(w)
+	for _, feedStats := range stats {
+		fmt.Fprintf(w, "  %-30s %6d posts, cached %s ago", feedStats.Name, feedStats.NumPosts, time.Since(feedStats.CachedAt).Round(time.Second))
+		if feedStats.Error != "" {
+			fmt.Fprintf(w, ", error: %s", feedStats.Error)
+		}
+		fmt.Fprintln(w)
+	}
+}
+
 type Bytes int64
 
 func (b Bytes) String() string {
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"fmt"
+	"html"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+
+	"github.com/heyLu/numblr/feed/database"
+)
+
+// HandleFeedStatus shows whether the feed `{name}` is currently erroring,
+// when it was last fetched successfully and what the last error was.
+func HandleFeedStatus(w http.ResponseWriter, req *http.Request) {
+	name := chi.URLParam(req, "name")
+
+	infos, err := database.ListFeedInfos(req.Context(), cacheDB, []string{name})
+	if err != nil {
+		log.Printf("Error: looking up status of %q: %s", name, err)
+		http.Error(w, fmt.Sprintf("Error: could not look up feed: %s", err), http.StatusInternalServerError)
+		return
+	}
+
+	info, ok := infos[name]
+	if !ok {
+		http.Error(w, fmt.Sprintf("Error: feed %q is not cached yet", name), http.StatusNotFound)
+		return
+	}
+
+	status := "ok"
+	if info.Error != "" {
+		status = "erroring"
+	}
+
+	htmlPrelude(w, req, "status of "+html.EscapeString(name), "Whether the feed is erroring and when it was last fetched", "/favicon.png")
+
+	fmt.Fprintf(w, `<header><h1><a href="/%s">%s</a></h1><h2>%s</h2></header>
+`, html.EscapeString(name), html.EscapeString(name), status)
+
+	fmt.Fprintln(w, `<dl class="feed-status">`)
+	fmt.Fprintf(w, `<dt>last fetched</dt><dd>%s</dd>
+`, statusTime(info.CachedAt))
+	lastSuccess := "never"
+	if !info.LastSuccessAt.IsZero() {
+		lastSuccess = statusTime(info.LastSuccessAt)
+	}
+	fmt.Fprintf(w, `<dt>last successful</dt><dd>%s</dd>
+`, lastSuccess)
+	if info.Error != "" {
+		fmt.Fprintf(w, `<dt>last error</dt><dd><code>%s</code></dd>
+`, html.EscapeString(info.Error))
+	}
+	fmt.Fprintln(w, `</dl>`)
+}
+
+// statusTime formats `t` as a date and how long ago it was.
+func statusTime(t time.Time) string {
+	return fmt.Sprintf(`<time datetime=%q>%s</time> (%s ago)`, t.Format(time.RFC3339), t.Format("2006-01-02 15:04"), time.Since(t).Round(time.Minute))
+}
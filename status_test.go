@@ -0,0 +1,71 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http/httptest"
+	"path"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/heyLu/numblr/feed"
+	"github.com/heyLu/numblr/feed/database"
+)
+
+func TestHandleFeedStatus(t *testing.T) {
+	db, err := database.InitDatabase(path.Join(t.TempDir(), "cache.db"))
+	require.NoError(t, err)
+	defer db.Close()
+
+	origCacheDB := cacheDB
+	cacheDB = db
+	defer func() {
+		cacheDB = origCacheDB
+	}()
+
+	f, err := database.OpenCached(context.Background(), db, "staff", func(ctx context.Context, name string, _ feed.Search) (feed.Feed, error) {
+		return &feed.Static{FeedName: name, Posts: []feed.Post{{Source: "tumblr", ID: "1", Author: name, Date: time.Now()}}}, nil
+	}, feed.Search{ForceFresh: true})
+	require.NoError(t, err)
+	for err == nil {
+		_, err = f.Next()
+	}
+	require.NoError(t, f.Close())
+
+	status := func(name string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", "/feed/"+name+"/status", nil)
+		rctx := chi.NewRouteContext()
+		rctx.URLParams.Add("name", name)
+		req = req.WithContext(context.WithValue(req.Context(), chi.RouteCtxKey, rctx))
+
+		w := httptest.NewRecorder()
+		HandleFeedStatus(w, req)
+		return w
+	}
+
+	w := status("staff")
+	assert.Equal(t, 200, w.Code)
+	assert.Contains(t, w.Body.String(), "<h2>ok</h2>")
+	assert.NotContains(t, w.Body.String(), "never", "successful")
+	assert.NotContains(t, w.Body.String(), "last error")
+
+	_, err = database.OpenCached(context.Background(), db, "staff", func(ctx context.Context, name string, _ feed.Search) (feed.Feed, error) {
+		return nil, errors.New("<broken>")
+	}, feed.Search{ForceFresh: true})
+	require.Error(t, err)
+
+	// the error is stored in the background
+	require.Eventually(t, func() bool {
+		return strings.Contains(status("staff").Body.String(), "<h2>erroring</h2>")
+	}, time.Second, 10*time.Millisecond)
+	w = status("staff")
+	assert.Contains(t, w.Body.String(), "<code>&lt;broken&gt;</code>", "escaped error")
+	assert.Contains(t, w.Body.String(), "last successful")
+
+	assert.Equal(t, 404, status("unknown").Code, "not cached")
+}
@@ -0,0 +1,166 @@
+package main
+
+import (
+	"encoding/xml"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/heyLu/numblr/feed"
+)
+
+// rssDocument is an RSS 2.0 document, see https://www.rssboard.org/rss-specification.
+type rssDocument struct {
+	XMLName xml.Name   `xml:"rss"`
+	Version string     `xml:"version,attr"`
+	Channel rssChannel `xml:"channel"`
+}
+
+type rssChannel struct {
+	Title       string    `xml:"title"`
+	Link        string    `xml:"link"`
+	Description string    `xml:"description"`
+	Items       []rssItem `xml:"item"`
+}
+
+type rssItem struct {
+	Title       string   `xml:"title"`
+	Link        string   `xml:"link"`
+	GUID        rssGUID  `xml:"guid"`
+	PubDate     string   `xml:"pubDate"`
+	Categories  []string `xml:"category"`
+	Description string   `xml:"description"`
+}
+
+type rssGUID struct {
+	IsPermaLink bool   `xml:"isPermaLink,attr"`
+	Value       string `xml:",chardata"`
+}
+
+// atomFeed is an Atom feed, see https://www.rfc-editor.org/rfc/rfc4287.
+type atomFeed struct {
+	XMLName xml.Name    `xml:"http://www.w3.org/2005/Atom feed"`
+	ID      string      `xml:"id"`
+	Title   string      `xml:"title"`
+	Updated string      `xml:"updated"`
+	Links   []atomLink  `xml:"link"`
+	Entries []atomEntry `xml:"entry"`
+}
+
+type atomLink struct {
+	Rel  string `xml:"rel,attr,omitempty"`
+	Href string `xml:"href,attr"`
+}
+
+type atomEntry struct {
+	ID         string         `xml:"id"`
+	Title      string         `xml:"title"`
+	Updated    string         `xml:"updated"`
+	Link       atomLink       `xml:"link"`
+	Author     atomAuthor     `xml:"author"`
+	Categories []atomCategory `xml:"category"`
+	Content    atomContent    `xml:"content"`
+}
+
+type atomAuthor struct {
+	Name string `xml:"name"`
+}
+
+type atomCategory struct {
+	Term string `xml:"term,attr"`
+}
+
+type atomContent struct {
+	Type  string `xml:"type,attr"`
+	Value string `xml:",chardata"`
+}
+
+// syndicationHTML returns the content of the post for feed readers, which
+// includes the title if it is html, e.g. the question of an ask.
+func syndicationHTML(post *feed.Post) string {
+	if strings.HasPrefix(post.Title, "<") {
+		return post.Title + post.DescriptionHTML
+	}
+	return post.DescriptionHTML
+}
+
+// writeRSS writes the posts as an RSS 2.0 document, for subscribing to
+// feeds in feed readers.
+func writeRSS(w http.ResponseWriter, req *http.Request, title string, posts []*feed.Post) {
+	doc := rssDocument{
+		Version: "2.0",
+		Channel: rssChannel{
+			Title:       title,
+			Link:        absoluteURL(req, req.URL.EscapedPath()),
+			Description: "Mirror of " + title + " feeds",
+			Items:       make([]rssItem, 0, len(posts)),
+		},
+	}
+	for _, post := range posts {
+		doc.Channel.Items = append(doc.Channel.Items, rssItem{
+			Title:       postSummary(post),
+			Link:        post.URL,
+			GUID:        rssGUID{IsPermaLink: true, Value: post.URL},
+			PubDate:     post.Date.Format(time.RFC1123Z),
+			Categories:  post.Tags,
+			Description: syndicationHTML(post),
+		})
+	}
+
+	w.Header().Set("Content-Type", "application/rss+xml; charset=utf-8")
+	writeXML(w, doc)
+}
+
+// writeAtom writes the posts as an Atom feed, like writeRSS.
+func writeAtom(w http.ResponseWriter, req *http.Request, title string, posts []*feed.Post) {
+	updated := time.Now()
+	if len(posts) > 0 {
+		updated = posts[0].Date
+	}
+
+	doc := atomFeed{
+		ID:      absoluteURL(req, req.URL.EscapedPath()),
+		Title:   title,
+		Updated: updated.UTC().Format(time.RFC3339),
+		Links: []atomLink{
+			{Href: absoluteURL(req, req.URL.EscapedPath())},
+			{Rel: "self", Href: absoluteURL(req, req.URL.RequestURI())},
+		},
+		Entries: make([]atomEntry, 0, len(posts)),
+	}
+	for _, post := range posts {
+		categories := make([]atomCategory, 0, len(post.Tags))
+		for _, tag := range post.Tags {
+			categories = append(categories, atomCategory{Term: tag})
+		}
+
+		doc.Entries = append(doc.Entries, atomEntry{
+			ID:         post.URL,
+			Title:      postSummary(post),
+			Updated:    post.Date.UTC().Format(time.RFC3339),
+			Link:       atomLink{Href: post.URL},
+			Author:     atomAuthor{Name: post.Author},
+			Categories: categories,
+			Content:    atomContent{Type: "html", Value: syndicationHTML(post)},
+		})
+	}
+
+	w.Header().Set("Content-Type", "application/atom+xml; charset=utf-8")
+	writeXML(w, doc)
+}
+
+func writeXML(w http.ResponseWriter, doc interface{}) {
+	_, err := w.Write([]byte(xml.Header))
+	if err != nil {
+		log.Printf("Error: writing feed: %s", err)
+		return
+	}
+
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "  ")
+	err = enc.Encode(doc)
+	if err != nil {
+		log.Printf("Error: writing feed: %s", err)
+	}
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"context"
+	"encoding/xml"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/heyLu/numblr/feed"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHandleTumblrFormats(t *testing.T) {
+	date := time.Date(2022, time.June, 1, 12, 0, 0, 0, time.UTC)
+
+	origCacheFn := cacheFn
+	cacheFn = func(ctx context.Context, name string, uncachedFn feed.Open, search feed.Search) (feed.Feed, error) {
+		return &feed.Static{FeedName: name, Posts: []feed.Post{
+			{Source: "tumblr", ID: "3", Author: name, URL: "https://" + name + ".tumblr.com/post/3", Title: "<h1>Hello & welcome</h1>", DescriptionHTML: "<p>third post</p>", Tags: []string{"art"}, Date: date},
+			{Source: "tumblr", ID: "2", Author: name, URL: "https://" + name + ".tumblr.com/post/2", DescriptionHTML: "<p>second post</p>", Date: date.Add(-time.Hour)},
+			{Source: "tumblr", ID: "1", Author: name, URL: "https://" + name + ".tumblr.com/post/1", DescriptionHTML: "<p>first post</p>", Date: date.Add(-2 * time.Hour)},
+		}}, nil
+	}
+	defer func() {
+		cacheFn = origCacheFn
+	}()
+
+	router := chi.NewRouter()
+	router.HandleFunc("/{feeds}", HandleTumblr)
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("GET", "/staff?format=rss&limit=2", nil))
+	assert.Equal(t, "application/rss+xml; charset=utf-8", w.Header().Get("Content-Type"))
+
+	var rss rssDocument
+	require.NoError(t, xml.Unmarshal(w.Body.Bytes(), &rss), "valid rss")
+	assert.Equal(t, "2.0", rss.Version)
+	assert.Equal(t, "staff", rss.Channel.Title)
+	if assert.Len(t, rss.Channel.Items, 2, "limit") {
+		item := rss.Channel.Items[0]
+		assert.Equal(t, "Hello & welcome", item.Title)
+		assert.Equal(t, "https://staff.tumblr.com/post/3", item.Link)
+		assert.Equal(t, "https://staff.tumblr.com/post/3", item.GUID.Value)
+		assert.Equal(t, "Wed, 01 Jun 2022 12:00:00 +0000", item.PubDate)
+		assert.Equal(t, []string{"art"}, item.Categories)
+		assert.Equal(t, "<h1>Hello & welcome</h1><p>third post</p>", item.Description)
+	}
+
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("GET", "/staff?format=atom&before=3", nil))
+	assert.Equal(t, "application/atom+xml; charset=utf-8", w.Header().Get("Content-Type"))
+
+	var atom atomFeed
+	require.NoError(t, xml.Unmarshal(w.Body.Bytes(), &atom), "valid atom")
+	if assert.Len(t, atom.Entries, 2, "before") {
+		assert.Equal(t, "https://staff.tumblr.com/post/2", atom.Entries[0].ID)
+		assert.Equal(t, "second post", atom.Entries[0].Title)
+		assert.Equal(t, "<p>second post</p>", atom.Entries[0].Content.Value)
+	}
+
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("GET", "/staff?format=rss&search=first", nil))
+	var searchRSS rssDocument
+	require.NoError(t, xml.Unmarshal(w.Body.Bytes(), &searchRSS), "valid rss")
+	if assert.Len(t, searchRSS.Channel.Items, 1, "search") {
+		assert.Equal(t, "first post", searchRSS.Channel.Items[0].Title)
+	}
+}